@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/walkdiff"
 )
 
@@ -12,41 +15,133 @@ func main() {
 	left := flag.String("left", "", "Left walk/snmprec file")
 	right := flag.String("right", "", "Right walk/snmprec file")
 	showAll := flag.Bool("show-all", false, "Show all differences (default shows first 100)")
+	dataset := flag.String("dataset", "", "Dataset (.snmprec) to check against --required")
+	required := flag.String("required", "", "File of required OIDs, one per line; reports those --dataset lacks")
+	format := flag.String("format", "text", "Output format: text or json")
+	ignoreTypes := flag.String("ignore-types", "", "Comma separated types whose values may differ, e.g. counter32,counter64,timeticks")
 	flag.Parse()
 
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown --format %q (want text or json)\n", *format)
+		os.Exit(2)
+	}
+
+	if *dataset != "" || *required != "" {
+		if *dataset == "" || *required == "" {
+			fmt.Fprintln(os.Stderr, "usage: gosnmpsim-diff --dataset <file.snmprec> --required <oids.txt>")
+			os.Exit(2)
+		}
+		os.Exit(reportMissing(*dataset, *required, *format))
+	}
+
 	if *left == "" || *right == "" {
 		fmt.Fprintln(os.Stderr, "usage: gosnmpsim-diff --left <fileA> --right <fileB>")
+		fmt.Fprintln(os.Stderr, "       gosnmpsim-diff --dataset <file.snmprec> --required <oids.txt>")
 		os.Exit(2)
 	}
 
-	result, err := walkdiff.CompareFiles(*left, *right)
+	result, err := walkdiff.CompareFiles(*left, *right, walkdiff.Options{IgnoreTypes: walkdiff.ParseTypeList(*ignoreTypes)})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "diff failed: %v\n", err)
 		os.Exit(1)
 	}
 
+	if *format == "json" {
+		err = writeJSON(os.Stdout, result)
+	} else {
+		writeText(os.Stdout, result, *showAll)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write result: %v\n", err)
+		os.Exit(1)
+	}
+	if !result.Identical() {
+		os.Exit(1)
+	}
+}
+
+// writeText prints result for people: a summary line and, unless showAll,
+// the first 100 differences
+func writeText(w io.Writer, result walkdiff.Result, showAll bool) {
 	if result.Identical() {
-		fmt.Printf("IDENTICAL: %d OIDs\n", result.LeftCount)
+		fmt.Fprintf(w, "IDENTICAL: %d OIDs\n", result.LeftCount)
 		return
 	}
 
-	fmt.Printf("DIFF: left=%d right=%d differences=%d\n", result.LeftCount, result.RightCount, len(result.Diffs))
+	fmt.Fprintf(w, "DIFF: left=%d right=%d differences=%d\n", result.LeftCount, result.RightCount, len(result.Diffs))
 	limit := len(result.Diffs)
-	if !*showAll && limit > 100 {
+	if !showAll && limit > 100 {
 		limit = 100
 	}
 	for i := 0; i < limit; i++ {
 		d := result.Diffs[i]
-		fmt.Printf("- %s [%s]\n", d.OID, d.Kind)
+		fmt.Fprintf(w, "- %s [%s]\n", d.OID, d.Kind)
 		if d.LeftType != "" || d.LeftValue != "" {
-			fmt.Printf("  left : %s|%s\n", d.LeftType, d.LeftValue)
+			fmt.Fprintf(w, "  left : %s|%s\n", d.LeftType, d.LeftValue)
 		}
 		if d.RightType != "" || d.RightValue != "" {
-			fmt.Printf("  right: %s|%s\n", d.RightType, d.RightValue)
+			fmt.Fprintf(w, "  right: %s|%s\n", d.RightType, d.RightValue)
 		}
 	}
-	if !*showAll && len(result.Diffs) > limit {
-		fmt.Printf("... %d more differences omitted (use --show-all)\n", len(result.Diffs)-limit)
+	if !showAll && len(result.Diffs) > limit {
+		fmt.Fprintf(w, "... %d more differences omitted (use --show-all)\n", len(result.Diffs)-limit)
+	}
+}
+
+// writeJSON prints v as indented JSON. A Result always lists every
+// difference, as [] when there are none.
+func writeJSON(w io.Writer, v interface{}) error {
+	if result, ok := v.(walkdiff.Result); ok && result.Diffs == nil {
+		result.Diffs = []walkdiff.Difference{}
+		v = result
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// missingReport is the --format json output of a --required check
+type missingReport struct {
+	RequiredCount int      `json:"required_count"`
+	Missing       []string `json:"missing"`
+}
+
+// reportMissing prints the required OIDs the dataset has no value for and
+// returns the exit code: 0 when none are missing, 1 otherwise
+func reportMissing(datasetPath, requiredPath, format string) int {
+	oids, err := walkdiff.ReadOIDList(requiredPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read required OIDs failed: %v\n", err)
+		return 1
+	}
+	db := store.NewOIDDatabase()
+	if _, err := store.LoadSNMPrecFile(db, datasetPath); err != nil {
+		fmt.Fprintf(os.Stderr, "load dataset failed: %v\n", err)
+		return 1
+	}
+	db.SortOIDs()
+
+	missing := walkdiff.MissingOIDs(db, oids)
+	if format == "json" {
+		if missing == nil {
+			missing = []string{}
+		}
+		if err := writeJSON(os.Stdout, missingReport{RequiredCount: len(oids), Missing: missing}); err != nil {
+			fmt.Fprintf(os.Stderr, "write result: %v\n", err)
+			return 1
+		}
+		if len(missing) > 0 {
+			return 1
+		}
+		return 0
+	}
+	if len(missing) == 0 {
+		fmt.Printf("COMPLETE: all %d required OIDs present\n", len(oids))
+		return 0
+	}
+	fmt.Printf("MISSING: %d of %d required OIDs\n", len(missing), len(oids))
+	for _, oid := range missing {
+		fmt.Printf("- %s\n", oid)
 	}
-	os.Exit(1)
+	return 1
 }
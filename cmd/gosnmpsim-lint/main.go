@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+)
+
+func main() {
+	dataset := flag.String("dataset", "", "Dataset (.snmprec) to lint")
+	flag.Parse()
+
+	if *dataset == "" && flag.NArg() == 1 {
+		*dataset = flag.Arg(0)
+	}
+	if *dataset == "" {
+		fmt.Fprintln(os.Stderr, "usage: gosnmpsim-lint --dataset <file.snmprec>")
+		os.Exit(2)
+	}
+
+	db := store.NewOIDDatabase()
+	if _, err := store.LoadSNMPrecFile(db, *dataset); err != nil {
+		fmt.Fprintf(os.Stderr, "load dataset failed: %v\n", err)
+		os.Exit(1)
+	}
+	db.SortOIDs()
+
+	warnings := store.LintDataset(db)
+	if len(warnings) == 0 {
+		fmt.Println("CLEAN: no lint warnings")
+		return
+	}
+	fmt.Printf("WARNINGS: %d\n", len(warnings))
+	for _, w := range warnings {
+		fmt.Printf("- %s\n", w)
+	}
+	os.Exit(1)
+}
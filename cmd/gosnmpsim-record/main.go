@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -29,37 +30,69 @@ func (f *stringSliceFlag) Set(value string) error {
 }
 
 func main() {
-	target := flag.String("target", "127.0.0.1", "SNMP target host")
-	port := flag.Uint("port", 161, "SNMP target port")
-	out := flag.String("out", "", "Output .snmprec path")
+	port := flag.Uint("port", 161, "Default SNMP target port")
+	out := flag.String("out", "", "Output .snmprec path (single target or --merge)")
+	outDir := flag.String("out-dir", "", "Write one <host>_<port>.snmprec per target into this directory")
+	targetsFile := flag.String("targets-file", "", "File with one target (host or host:port) per line")
+	merge := flag.Bool("merge", false, "Merge all targets into --out as a device-mapped (@device) dataset")
+	devicePrefix := flag.String("device-prefix", "Device-", "Device label prefix for --merge; target N is labelled <prefix>N")
 	community := flag.String("community", "", "SNMP community (v1/v2c mode)")
 	v3User := flag.String("v3-user", "", "SNMPv3 username")
 	v3Auth := flag.String("v3-auth", "", "SNMPv3 auth protocol: MD5,SHA1,SHA224,SHA256,SHA384,SHA512")
 	v3AuthKey := flag.String("v3-auth-key", "", "SNMPv3 auth passphrase")
 	v3Priv := flag.String("v3-priv", "", "SNMPv3 privacy protocol: DES,AES128,AES192,AES256")
 	v3PrivKey := flag.String("v3-priv-key", "", "SNMPv3 privacy passphrase")
+	v3Context := flag.String("v3-context", "", "SNMPv3 context name to record, noted in the output for contextDatasets routes")
 	maxOIDs := flag.Int("max-oids", 0, "Maximum OIDs to record (0 = unlimited)")
 	rateLimit := flag.Int("rate-limit", 0, "Maximum OIDs processed per second (0 = unlimited)")
+	workers := flag.Int("workers", 1, "Roots walked concurrently per target; --max-oids and --rate-limit stay per target")
 	timeout := flag.Duration("timeout", 2*time.Second, "Request timeout")
 	retries := flag.Int("retries", 0, "SNMP retries")
+	preserveFormat := flag.Bool("preserve-format", false, "Hex-encode string values that would not round-trip verbatim (surrounding whitespace, control bytes, '|', '@', '#')")
 
+	var targetSpecs stringSliceFlag
 	var excludes stringSliceFlag
+	flag.Var(&targetSpecs, "target", "SNMP target host or host:port (repeatable or comma-separated, default 127.0.0.1)")
 	flag.Var(&excludes, "exclude", "OID prefix to exclude (repeatable or comma-separated)")
 
 	flag.Parse()
 
-	if *out == "" {
-		fmt.Fprintln(os.Stderr, "missing required flag: --out")
+	if *targetsFile != "" {
+		specs, err := recorder.ReadTargetsFile(*targetsFile)
+		if err != nil {
+			log.Fatalf("read targets file: %v", err)
+		}
+		targetSpecs = append(targetSpecs, specs...)
+	}
+	if len(targetSpecs) == 0 {
+		targetSpecs = stringSliceFlag{"127.0.0.1"}
+	}
+	targets, err := recorder.ParseTargets(targetSpecs, uint16(*port))
+	if err != nil {
+		log.Fatalf("invalid target: %v", err)
+	}
+
+	switch {
+	case *workers < 1:
+		fmt.Fprintln(os.Stderr, "--workers must be at least 1")
+		os.Exit(2)
+	case *outDir != "" && (*out != "" || *merge):
+		fmt.Fprintln(os.Stderr, "--out-dir cannot be combined with --out or --merge")
+		os.Exit(2)
+	case *outDir == "" && *out == "":
+		fmt.Fprintln(os.Stderr, "missing required flag: --out (or --out-dir)")
+		os.Exit(2)
+	case *out != "" && len(targets) > 1 && !*merge:
+		fmt.Fprintln(os.Stderr, "multiple targets need --merge (single file) or --out-dir (one file per target)")
 		os.Exit(2)
 	}
 
-	entries, err := recorder.Record(recorder.Options{
-		Target:    *target,
-		Port:      uint16(*port),
+	recordings := recorder.RecordAll(recorder.Options{
 		Timeout:   *timeout,
 		Retries:   *retries,
 		MaxOIDs:   *maxOIDs,
 		RateLimit: *rateLimit,
+		Workers:   *workers,
 		Exclude:   excludes,
 		Community: *community,
 		V3User:    *v3User,
@@ -67,14 +100,70 @@ func main() {
 		V3AuthKey: *v3AuthKey,
 		V3Priv:    *v3Priv,
 		V3PrivKey: *v3PrivKey,
-	})
-	if err != nil {
-		log.Fatalf("record failed: %v", err)
+		V3Context: *v3Context,
+	}, targets)
+
+	write := func(path string, entries []snmprecfmt.Entry) error {
+		if *preserveFormat {
+			entries = snmprecfmt.PreserveFormatting(entries)
+		}
+		return snmprecfmt.WriteContextFile(path, *v3Context, entries)
 	}
 
-	if err := snmprecfmt.WriteFile(*out, entries); err != nil {
-		log.Fatalf("write output: %v", err)
+	failed := 0
+	for _, rec := range recordings {
+		if rec.Err != nil {
+			failed++
+			log.Printf("record %s failed: %v", rec.Target, rec.Err)
+		}
+	}
+	if failed == len(recordings) {
+		log.Fatalf("record failed for all %d target(s)", failed)
+	}
+
+	switch {
+	case *merge:
+		labels := make([]string, len(recordings))
+		for i := range recordings {
+			labels[i] = fmt.Sprintf("%s%d", *devicePrefix, i)
+		}
+		entries, err := recorder.MergeDeviceMapped(recordings, labels)
+		if err != nil {
+			log.Fatalf("merge recordings: %v", err)
+		}
+		if err := write(*out, entries); err != nil {
+			log.Fatalf("write output: %v", err)
+		}
+		for i, rec := range recordings {
+			if rec.Err == nil {
+				log.Printf("Recorded %d OIDs from %s as @%s", len(rec.Entries), rec.Target, labels[i])
+			}
+		}
+		log.Printf("Wrote %d device-mapped OIDs to %s", len(entries), *out)
+	case *outDir != "":
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			log.Fatalf("create output dir: %v", err)
+		}
+		for _, rec := range recordings {
+			if rec.Err != nil {
+				continue
+			}
+			name := fmt.Sprintf("%s_%d.snmprec", strings.NewReplacer(":", "_", "/", "_").Replace(rec.Target.Host), rec.Target.Port)
+			path := filepath.Join(*outDir, name)
+			if err := write(path, rec.Entries); err != nil {
+				log.Fatalf("write output: %v", err)
+			}
+			log.Printf("Recorded %d OIDs from %s to %s", len(rec.Entries), rec.Target, path)
+		}
+	default:
+		rec := recordings[0]
+		if err := write(*out, rec.Entries); err != nil {
+			log.Fatalf("write output: %v", err)
+		}
+		log.Printf("Recorded %d OIDs to %s", len(rec.Entries), *out)
 	}
 
-	log.Printf("Recorded %d OIDs to %s", len(entries), *out)
+	if failed > 0 {
+		os.Exit(1)
+	}
 }
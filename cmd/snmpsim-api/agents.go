@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GetLabAgents serves GET /labs/{id}/agents: the statistics of each agent
+// of a running lab, ordered by port. ?port= narrows the list to the agent on
+// that port.
+func (rm *ResourceManager) GetLabAgents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	startTime := time.Now()
+	defer func() {
+		RecordLatency("GET", id, time.Since(startTime).Seconds())
+	}()
+
+	port := 0
+	if v := r.URL.Query().Get("port"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 65535 {
+			http.Error(w, fmt.Sprintf("invalid port %q: want an integer from 1 to 65535", v), http.StatusBadRequest)
+			return
+		}
+		port = n
+	}
+
+	rm.mu.RLock()
+	_, ok := rm.labs[id]
+	sim := rm.labSimulators[id]
+	rm.mu.RUnlock()
+	if !ok {
+		RecordFailure("lab_not_found", id)
+		http.Error(w, "lab not found", http.StatusNotFound)
+		return
+	}
+	if sim == nil {
+		RecordFailure("lab_not_running", id)
+		http.Error(w, "lab not running", http.StatusConflict)
+		return
+	}
+
+	stats := sim.AgentStats()
+	if port != 0 {
+		var matched []map[string]interface{}
+		for _, s := range stats {
+			if s["port"] == port {
+				matched = append(matched, s)
+			}
+		}
+		if len(matched) == 0 {
+			http.Error(w, fmt.Sprintf("no agent on port %d", port), http.StatusNotFound)
+			return
+		}
+		stats = matched
+	}
+	writeResponse(w, r, http.StatusOK, stats)
+}
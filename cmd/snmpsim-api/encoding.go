@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpbody"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeYAML = "application/yaml"
+)
+
+// yamlMediaTypes are the Content-Type and Accept values read as YAML.
+var yamlMediaTypes = []string{contentTypeYAML, "application/x-yaml", "text/yaml", "text/x-yaml"}
+
+// isYAMLMediaType reports whether a Content-Type or Accept entry names YAML.
+func isYAMLMediaType(value string) bool {
+	mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	for _, yamlType := range yamlMediaTypes {
+		if mediaType == yamlType {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsYAML reports whether the client asked for a YAML response. The first
+// JSON or YAML entry in Accept wins; anything else falls back to JSON.
+func wantsYAML(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if isYAMLMediaType(part) {
+			return true
+		}
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mediaType == contentTypeJSON {
+			return false
+		}
+	}
+	return false
+}
+
+// decodeBody decodes the request body as YAML when Content-Type says so and
+// as JSON otherwise. Any other declared Content-Type is refused with an error
+// httpbody.ErrorStatus maps to 415. Unknown fields are an error, naming the
+// field, when the server runs with --strict-decode or the request sends
+// Prefer: handling=strict (RFC 7240).
+func (rm *ResourceManager) decodeBody(r *http.Request, v interface{}) error {
+	if err := httpbody.CheckContentType(r, append([]string{contentTypeJSON}, yamlMediaTypes...)...); err != nil {
+		return err
+	}
+	strict := rm.strictDecode || prefersStrict(r)
+	if isYAMLMediaType(r.Header.Get("Content-Type")) {
+		dec := yaml.NewDecoder(r.Body)
+		dec.KnownFields(strict)
+		return dec.Decode(v)
+	}
+	dec := json.NewDecoder(r.Body)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+// prefersStrict reports whether a Prefer header asks for handling=strict
+func prefersStrict(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			if strings.EqualFold(strings.TrimSpace(name), "handling") && strings.EqualFold(strings.Trim(strings.TrimSpace(value), `"`), "strict") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeResponse encodes v with the status code, as YAML when the request's
+// Accept header prefers it and as JSON otherwise.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	if wantsYAML(r) {
+		w.Header().Set("Content-Type", contentTypeYAML)
+		w.WriteHeader(status)
+		enc := yaml.NewEncoder(w)
+		if err := enc.Encode(v); err != nil {
+			log.Printf("encode yaml response: %v", err)
+		}
+		enc.Close()
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
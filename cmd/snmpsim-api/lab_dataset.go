@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpbody"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+)
+
+// BindLabDataset serves POST /labs/{id}/dataset: bind a dataset to the lab.
+// A running lab reloads its simulator's OID database in place, so the
+// agents serve the new dataset without restarting; a stopped lab uses it on
+// its next start.
+func (rm *ResourceManager) BindLabDataset(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	startTime := time.Now()
+	defer func() {
+		RecordLatency("POST", id, time.Since(startTime).Seconds())
+	}()
+
+	var req struct {
+		DatasetID string `json:"dataset_id" yaml:"dataset_id"`
+	}
+	if err := rm.decodeBody(r, &req); err != nil {
+		RecordFailure("invalid_dataset_payload", id)
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
+		return
+	}
+	if req.DatasetID == "" {
+		http.Error(w, "dataset_id is required", http.StatusBadRequest)
+		return
+	}
+
+	rm.mu.RLock()
+	lab, ok := rm.labs[id]
+	dataset, datasetOK := rm.datasets[req.DatasetID]
+	sim := rm.labSimulators[id]
+	rm.mu.RUnlock()
+	if !ok {
+		RecordFailure("lab_not_found", id)
+		http.Error(w, "lab not found", http.StatusNotFound)
+		return
+	}
+	if !datasetOK {
+		RecordFailure("dataset_not_found", id)
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+	if reason, status, err := checkLabDataset(dataset, lab.EngineID); err != nil {
+		RecordFailure(reason, id)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	logger := rm.labLogger(id)
+	var hash string
+	if sim != nil {
+		if err := sim.Reload(dataset.FilePath); err != nil {
+			logger.Printf("dataset reload failed: %v", err)
+			RecordFailure("dataset_reload_failed", id)
+			http.Error(w, fmt.Sprintf("failed to reload dataset: %v", err), http.StatusInternalServerError)
+			return
+		}
+		hash = sim.DatasetHash()
+	} else {
+		hash = datasetFileHash(dataset.FilePath)
+	}
+
+	rm.mu.Lock()
+	if current, ok := rm.labs[id]; ok {
+		bound := *current
+		bound.DatasetID = dataset.ID
+		rm.labs[id] = &bound
+		lab = &bound
+	}
+	if hash != "" {
+		dataset.Hash = hash
+	}
+	rm.saveStateLocked()
+	rm.mu.Unlock()
+	logger.Printf("bound dataset %s (%s, hash %s)", dataset.ID, dataset.FilePath, hash)
+
+	writeResponse(w, r, http.StatusOK, lab)
+}
+
+// checkLabDataset reports why dataset cannot serve a lab on engine engineID,
+// with the failure reason to record and the status to answer: 409 when it
+// belongs to another engine, 400 when its file is missing
+func checkLabDataset(dataset *Dataset, engineID string) (string, int, error) {
+	if dataset.EngineID != "" && dataset.EngineID != engineID {
+		return "dataset_engine_mismatch", http.StatusConflict,
+			fmt.Errorf("dataset %s belongs to engine %s, lab uses engine %s", dataset.ID, dataset.EngineID, engineID)
+	}
+	if err := checkDatasetFile(dataset); err != nil {
+		return "dataset_file_missing", http.StatusBadRequest, err
+	}
+	return "", 0, nil
+}
+
+// checkDatasetFile fails unless the file of dataset can be read
+func checkDatasetFile(dataset *Dataset) error {
+	if info, err := os.Stat(dataset.FilePath); err != nil || info.IsDir() {
+		return fmt.Errorf("dataset %s file %q is not readable", dataset.ID, dataset.FilePath)
+	}
+	return nil
+}
+
+// datasetFileHash loads path the way a lab simulator does and returns the
+// hash of the result, the same value the lab reports once it serves the
+// file. It returns "" when the file does not load, as dataset resources may
+// be registered before their file exists.
+func datasetFileHash(path string) string {
+	if path == "" {
+		return ""
+	}
+	ds, err := store.NewDatasetStore(path, nil, store.LoadOptions{})
+	if err != nil {
+		return ""
+	}
+	db, _ := ds.Resolve("")
+	if db == nil {
+		return ""
+	}
+	return db.Hash()
+}
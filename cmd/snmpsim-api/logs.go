@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLabLogLines bounds how many log lines are kept per lab
+const maxLabLogLines = 500
+
+// labLog keeps the most recent log lines of one lab. It is an io.Writer so a
+// log.Logger can write to it; each Write is one line from the logger.
+type labLog struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *labLog) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.lines) == maxLabLogLines {
+		copy(l.lines, l.lines[1:])
+		l.lines = l.lines[:maxLabLogLines-1]
+	}
+	l.lines = append(l.lines, line)
+	return len(p), nil
+}
+
+func (l *labLog) snapshot() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string{}, l.lines...)
+}
+
+// labLogger returns a logger that writes to the standard log output and to
+// the log buffer of lab id, creating the buffer on first use.
+func (rm *ResourceManager) labLogger(id string) *log.Logger {
+	rm.mu.Lock()
+	buf, ok := rm.labLogs[id]
+	if !ok {
+		buf = &labLog{}
+		rm.labLogs[id] = buf
+	}
+	rm.mu.Unlock()
+	return log.New(io.MultiWriter(log.Writer(), buf), "["+id+"] ", log.LstdFlags)
+}
+
+// GetLabLogs serves GET /labs/{id}/logs: the lab's recent simulator log
+// lines, oldest first.
+func (rm *ResourceManager) GetLabLogs(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	startTime := time.Now()
+	defer func() {
+		RecordLatency("GET", id, time.Since(startTime).Seconds())
+	}()
+
+	rm.mu.RLock()
+	_, ok := rm.labs[id]
+	buf := rm.labLogs[id]
+	rm.mu.RUnlock()
+	if !ok {
+		RecordFailure("lab_not_found", id)
+		http.Error(w, "lab not found", http.StatusNotFound)
+		return
+	}
+
+	lines := []string{}
+	if buf != nil {
+		lines = buf.snapshot()
+	}
+	writeResponse(w, r, http.StatusOK, map[string]interface{}{
+		"id":    id,
+		"lines": lines,
+	})
+}
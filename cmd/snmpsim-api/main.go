@@ -2,18 +2,25 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/accesslog"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/engine"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpbody"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpgzip"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpmethod"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httptimeout"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,13 +29,41 @@ import (
 func main() {
 	apiAddr := flag.String("api-addr", "127.0.0.1:8080", "API server address")
 	metricsAddr := flag.String("metrics-addr", "127.0.0.1:9090", "Prometheus metrics address")
+	tlsCert := flag.String("tls-cert", os.Getenv("SNMPSIM_API_TLS_CERT"), "TLS certificate file for the API server (enables HTTPS)")
+	tlsKey := flag.String("tls-key", os.Getenv("SNMPSIM_API_TLS_KEY"), "TLS private key file for the API server")
+	maxBodyBytes := flag.Int64("max-body-bytes", httpbody.DefaultMaxBytes, "Maximum request body size in bytes (0 disables the limit)")
+	accessLogLevel := flag.String("access-log", os.Getenv("SNMPSIM_API_ACCESS_LOG"), "Access log level: off, errors or all (default all)")
+	accessLogSkip := flag.String("access-log-skip", "/health,/metrics", "Comma-separated paths left out of the access log")
+	var timeouts httptimeout.Timeouts
+	flag.DurationVar(&timeouts.ReadHeader, "read-header-timeout", httptimeout.DefaultReadHeaderTimeout, "Maximum time to read request headers (0 falls back to --read-timeout)")
+	flag.DurationVar(&timeouts.Read, "read-timeout", httptimeout.DefaultReadTimeout, "Maximum time to read a whole request (0 disables)")
+	flag.DurationVar(&timeouts.Write, "write-timeout", httptimeout.DefaultWriteTimeout, "Maximum time to write a response (0 disables)")
+	flag.DurationVar(&timeouts.Idle, "idle-timeout", httptimeout.DefaultIdleTimeout, "Maximum keep-alive idle time between requests (0 falls back to --read-timeout)")
+	strictDecode := flag.Bool("strict-decode", false, "Reject request bodies with unknown fields (clients can opt in per request with Prefer: handling=strict)")
+	profileDir := flag.String("profile-dir", "", "Directory for datasets generated by POST /labs/from-profile (default: a snmpsim-profiles temp directory)")
+	stateFile := flag.String("state-file", os.Getenv("SNMPSIM_API_STATE_FILE"), "JSON file the API saves its resources to and restores them from on start (default: in memory only)")
 	flag.Parse()
 
+	level, err := accesslog.ParseLevel(*accessLogLevel)
+	if err != nil {
+		log.Fatalf("Invalid --access-log: %v", err)
+	}
+	if err := timeouts.Validate(); err != nil {
+		log.Fatalf("Invalid server timeouts: %v", err)
+	}
+
 	// Initialize metrics FIRST
 	initMetrics()
 
 	// Create resource manager
-	rm := NewResourceManager()
+	rm, err := NewResourceManager(*stateFile)
+	if err != nil {
+		log.Fatalf("Failed to restore state: %v", err)
+	}
+	if *profileDir != "" {
+		rm.profileDir = *profileDir
+	}
+	rm.strictDecode = *strictDecode
 
 	// Create HTTP mux
 	mux := http.NewServeMux()
@@ -42,20 +77,22 @@ func main() {
 	mux.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{}))
 
 	// Start API server
-	apiServer := &http.Server{
-		Addr:    *apiAddr,
-		Handler: mux,
-	}
+	accessLog := accesslog.Options{Level: level, Skip: accesslog.ParseSkip(*accessLogSkip)}
+	apiServer := newAPIServer(*apiAddr, accesslog.Handler(apiHandler(mux, *maxBodyBytes), accessLog), timeouts)
 
 	// Start metrics server
-	metricsServer := &http.Server{
+	metricsServer := timeouts.Apply(&http.Server{
 		Addr:    *metricsAddr,
 		Handler: promhttp.Handler(),
-	}
+	})
 
 	go func() {
 		log.Printf("Starting API server on %s\n", *apiAddr)
-		if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		ln, err := net.Listen("tcp", *apiAddr)
+		if err != nil {
+			log.Fatalf("API server error: %v", err)
+		}
+		if err := serveAPI(apiServer, ln, *tlsCert, *tlsKey); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("API server error: %v", err)
 		}
 	}()
@@ -89,9 +126,37 @@ func main() {
 	log.Println("Shutdown complete")
 }
 
+// apiHandler wraps the API routes with the request body limit and gzip
+// response compression. /metrics is left to promhttp, which negotiates
+// compression with scrapers itself.
+func apiHandler(mux http.Handler, maxBodyBytes int64) http.Handler {
+	return httpgzip.Handler(httpbody.Handler(mux, maxBodyBytes), httpgzip.Options{Skip: []string{"/metrics"}})
+}
+
+// newAPIServer builds the API http.Server with the given connection
+// timeouts; TLS, when enabled, requires 1.2+.
+func newAPIServer(addr string, handler http.Handler, timeouts httptimeout.Timeouts) *http.Server {
+	return timeouts.Apply(&http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+	})
+}
+
+// serveAPI serves srv on ln, switching to HTTPS when a certificate is given.
+func serveAPI(srv *http.Server, ln net.Listener, certFile, keyFile string) error {
+	if certFile == "" && keyFile == "" {
+		return srv.Serve(ln)
+	}
+	if certFile == "" || keyFile == "" {
+		ln.Close()
+		return fmt.Errorf("both --tls-cert and --tls-key are required for TLS")
+	}
+	return srv.ServeTLS(ln, certFile, keyFile)
+}
+
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	writeResponse(w, r, http.StatusOK, map[string]string{"status": "ok"})
 }
 
 // ResourceManager manages all CRUD resources and lab lifecycle
@@ -105,56 +170,63 @@ type ResourceManager struct {
 
 	labSimulators map[string]*engine.Simulator // labID -> running simulator
 	labCancels    map[string]context.CancelFunc
+	labLogs       map[string]*labLog
+	profileDir    string // where POST /labs/from-profile writes generated datasets
+	strictDecode  bool   // reject request bodies with unknown fields; see decodeBody
+	stateFile     string // where resources are saved on every change; "" keeps them in memory only
 	nextID        int
 }
 
 // Resource models
 type Lab struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	EngineID  string    `json:"engine_id"`
-	Status    string    `json:"status"` // "stopped", "running"
-	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id" yaml:"id"`
+	Name      string    `json:"name" yaml:"name"`
+	EngineID  string    `json:"engine_id" yaml:"engine_id"`
+	DatasetID string    `json:"dataset_id,omitempty" yaml:"dataset_id,omitempty"` // served on start; set on create or by POST /labs/{id}/dataset
+	Status    string    `json:"status" yaml:"status"`                             // "stopped", "running"
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
 }
 
 type Engine struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	EngineID    string    `json:"engine_id"`    // SNMPv3 engine ID (hex)
-	ListenAddr  string    `json:"listen_addr"`  // IPv4 address
-	ListenAddr6 string    `json:"listen_addr6"` // IPv6 address (optional)
-	PortStart   int       `json:"port_start"`
-	PortEnd     int       `json:"port_end"`
-	NumDevices  int       `json:"num_devices"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          string    `json:"id" yaml:"id"`
+	Name        string    `json:"name" yaml:"name"`
+	EngineID    string    `json:"engine_id" yaml:"engine_id"`       // SNMPv3 engine ID (hex or text, 5-32 octets)
+	ListenAddr  string    `json:"listen_addr" yaml:"listen_addr"`   // IPv4 address
+	ListenAddr6 string    `json:"listen_addr6" yaml:"listen_addr6"` // IPv6 address (optional)
+	PortStart   int       `json:"port_start" yaml:"port_start"`
+	PortEnd     int       `json:"port_end" yaml:"port_end"`
+	NumDevices  int       `json:"num_devices" yaml:"num_devices"`
+	CreatedAt   time.Time `json:"created_at" yaml:"created_at"`
 }
 
 type Endpoint struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Address   string    `json:"address"` // IP address
-	Port      int       `json:"port"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id" yaml:"id"`
+	Name      string    `json:"name" yaml:"name"`
+	Address   string    `json:"address" yaml:"address"` // IP address
+	Port      int       `json:"port" yaml:"port"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
 }
 
 type User struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id" yaml:"id"`
+	Name      string    `json:"name" yaml:"name"`
+	Email     string    `json:"email" yaml:"email"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
 }
 
 type Dataset struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	EngineID  string    `json:"engine_id"`
-	FilePath  string    `json:"file_path"` // path to SNMP record file
-	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id" yaml:"id"`
+	Name      string    `json:"name" yaml:"name"`
+	EngineID  string    `json:"engine_id" yaml:"engine_id"`
+	FilePath  string    `json:"file_path" yaml:"file_path"`           // path to SNMP record file
+	Hash      string    `json:"hash,omitempty" yaml:"hash,omitempty"` // dataset hash as last loaded; see datasetFileHash and StartLab
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
 }
 
-// NewResourceManager creates a new resource manager
-func NewResourceManager() *ResourceManager {
-	return &ResourceManager{
+// NewResourceManager creates a new resource manager. With a stateFile it
+// restores the resources saved there and saves them again on every change.
+func NewResourceManager(stateFile string) (*ResourceManager, error) {
+	rm := &ResourceManager{
 		labs:          make(map[string]*Lab),
 		engines:       make(map[string]*Engine),
 		endpoints:     make(map[string]*Endpoint),
@@ -162,7 +234,16 @@ func NewResourceManager() *ResourceManager {
 		datasets:      make(map[string]*Dataset),
 		labSimulators: make(map[string]*engine.Simulator),
 		labCancels:    make(map[string]context.CancelFunc),
+		labLogs:       make(map[string]*labLog),
+		profileDir:    filepath.Join(os.TempDir(), "snmpsim-profiles"),
+		stateFile:     stateFile,
+	}
+	if stateFile != "" {
+		if err := rm.loadState(); err != nil {
+			return nil, err
+		}
 	}
+	return rm, nil
 }
 
 // Lab endpoints
@@ -173,18 +254,36 @@ func (rm *ResourceManager) CreateLab(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	var req struct {
-		Name     string `json:"name"`
-		EngineID string `json:"engine_id"`
+		Name      string `json:"name" yaml:"name"`
+		EngineID  string `json:"engine_id" yaml:"engine_id"`
+		DatasetID string `json:"dataset_id" yaml:"dataset_id"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := rm.decodeBody(r, &req); err != nil {
 		RecordFailure("invalid_lab_payload", "labs")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
 		return
 	}
 
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
+	if req.DatasetID != "" {
+		dataset, ok := rm.datasets[req.DatasetID]
+		if !ok {
+			RecordFailure("dataset_not_found", "labs")
+			http.Error(w, "dataset not found", http.StatusNotFound)
+			return
+		}
+		if reason, status, err := checkLabDataset(dataset, req.EngineID); err != nil {
+			RecordFailure(reason, "labs")
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if hash := datasetFileHash(dataset.FilePath); hash != "" {
+			dataset.Hash = hash
+		}
+	}
+
 	id := fmt.Sprintf("lab-%d", rm.nextID)
 	rm.nextID++
 
@@ -192,18 +291,18 @@ func (rm *ResourceManager) CreateLab(w http.ResponseWriter, r *http.Request) {
 		ID:        id,
 		Name:      req.Name,
 		EngineID:  req.EngineID,
+		DatasetID: req.DatasetID,
 		Status:    "stopped",
 		CreatedAt: time.Now(),
 	}
 	rm.labs[id] = lab
+	rm.saveStateLocked()
 
 	RecordLabCreated()
 	RecordPacket("POST", id)
 	UpdateActiveAgents(id, 0)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(lab)
+	writeResponse(w, r, http.StatusCreated, lab)
 }
 
 func (rm *ResourceManager) ListLabs(w http.ResponseWriter, r *http.Request) {
@@ -212,18 +311,30 @@ func (rm *ResourceManager) ListLabs(w http.ResponseWriter, r *http.Request) {
 		RecordLatency("GET", "labs", time.Since(startTime).Seconds())
 	}()
 
+	p, err := parsePaging(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "running" && status != "stopped" {
+		http.Error(w, fmt.Sprintf("invalid status %q: want running or stopped", status), http.StatusBadRequest)
+		return
+	}
+
 	rm.mu.RLock()
 	labs := make([]*Lab, 0, len(rm.labs))
 	for _, lab := range rm.labs {
-		labs = append(labs, lab)
+		if status == "" || lab.Status == status {
+			labs = append(labs, lab)
+		}
 	}
 	rm.mu.RUnlock()
 
 	// Record metric for API activity
 	RecordPacket("GET", "labs")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(labs)
+	writeResponse(w, r, http.StatusOK, paginate(labs, p, func(l *Lab) (time.Time, string) { return l.CreatedAt, l.ID }))
 }
 
 func (rm *ResourceManager) GetLab(w http.ResponseWriter, r *http.Request) {
@@ -245,8 +356,66 @@ func (rm *ResourceManager) GetLab(w http.ResponseWriter, r *http.Request) {
 
 	RecordPacket("GET", id)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(lab)
+	writeResponse(w, r, http.StatusOK, lab)
+}
+
+// UpdateLab applies a partial update to a lab: only the fields present in
+// the body change. A running lab keeps its engine.
+func (rm *ResourceManager) UpdateLab(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req struct {
+		Name     *string `json:"name" yaml:"name"`
+		EngineID *string `json:"engine_id" yaml:"engine_id"`
+	}
+	if err := rm.decodeBody(r, &req); err != nil {
+		RecordFailure("invalid_lab_payload", id)
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
+		return
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	current, ok := rm.labs[id]
+	if !ok {
+		RecordFailure("lab_not_found", id)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if req.EngineID != nil && *req.EngineID != current.EngineID {
+		if current.Status == "running" {
+			http.Error(w, "cannot change the engine of a running lab (stop it first)", http.StatusConflict)
+			return
+		}
+		if _, ok := rm.engines[*req.EngineID]; !ok {
+			RecordFailure("engine_not_found", id)
+			http.Error(w, "engine not found", http.StatusBadRequest)
+			return
+		}
+		// A lab bound to a dataset may only move to an engine that dataset serves
+		if dataset, bound := rm.datasets[current.DatasetID]; bound {
+			if reason, status, err := checkLabDataset(dataset, *req.EngineID); err != nil {
+				RecordFailure(reason, id)
+				http.Error(w, err.Error(), status)
+				return
+			}
+		}
+	}
+
+	updated := *current
+	if req.Name != nil {
+		updated.Name = *req.Name
+	}
+	if req.EngineID != nil {
+		updated.EngineID = *req.EngineID
+	}
+	rm.labs[id] = &updated
+	rm.saveStateLocked()
+
+	RecordPacket("PUT", id)
+
+	writeResponse(w, r, http.StatusOK, &updated)
 }
 
 func (rm *ResourceManager) DeleteLab(w http.ResponseWriter, r *http.Request) {
@@ -260,15 +429,32 @@ func (rm *ResourceManager) DeleteLab(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if lab.Status == "running" {
-		rm.mu.Unlock()
-		http.Error(w, "cannot delete running lab", http.StatusConflict)
-		return
+	wasRunning := lab.Status == "running"
+	if wasRunning {
+		if r.URL.Query().Get("force") != "true" {
+			rm.mu.Unlock()
+			http.Error(w, "cannot delete running lab (use ?force=true to stop it first)", http.StatusConflict)
+			return
+		}
+		if err := rm.stopLabLocked(id, lab); err != nil {
+			rm.mu.Unlock()
+			RecordFailure("simulator_not_found", id)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	delete(rm.labs, id)
+	delete(rm.labLogs, id)
+	rm.saveStateLocked()
 	rm.mu.Unlock()
 
+	if wasRunning {
+		RecordLabStop()
+		RecordPacket("STOP", id)
+		UpdateActiveAgents(id, 0)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -296,45 +482,89 @@ func (rm *ResourceManager) StartLab(w http.ResponseWriter, r *http.Request) {
 	}
 
 	eng, ok := rm.engines[lab.EngineID]
+	snmprecFile, wantHash := "", ""
+	dataset, bound := rm.datasets[lab.DatasetID]
+	if bound {
+		snmprecFile, wantHash = dataset.FilePath, dataset.Hash
+	}
+	rm.mu.Unlock()
+	logger := rm.labLogger(id)
 	if !ok {
-		rm.mu.Unlock()
+		logger.Printf("start failed: engine %q not found", lab.EngineID)
 		RecordFailure("engine_not_found", id)
 		http.Error(w, "engine not found", http.StatusBadRequest)
 		return
 	}
-	rm.mu.Unlock()
+	// A lab bound to a dataset must serve it, not the empty default database
+	if lab.DatasetID != "" && !bound {
+		logger.Printf("start failed: dataset %q not found", lab.DatasetID)
+		RecordFailure("dataset_not_found", id)
+		http.Error(w, fmt.Sprintf("dataset %s of lab %s not found", lab.DatasetID, id), http.StatusBadRequest)
+		return
+	}
+	if bound {
+		if err := checkDatasetFile(dataset); err != nil {
+			logger.Printf("start failed: %v", err)
+			RecordFailure("dataset_file_missing", id)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Create and start simulator
 	v3cfg := v3.Config{
 		Enabled: false, // minimal config
 	}
-	sim, err := engine.NewSimulator(eng.ListenAddr, eng.PortStart, eng.PortEnd, eng.NumDevices, "", "", "", v3cfg)
+	logger.Printf("starting simulator: engine=%s listen=%s ports=%d-%d devices=%d",
+		eng.ID, eng.ListenAddr, eng.PortStart, eng.PortEnd, eng.NumDevices)
+	sim, err := engine.NewSimulator(eng.ListenAddr, eng.PortStart, eng.PortEnd, eng.NumDevices, snmprecFile, "", "", v3cfg)
 	if err != nil {
+		logger.Printf("failed to create simulator: %v", err)
 		http.Error(w, fmt.Sprintf("failed to create simulator: %v", err), http.StatusInternalServerError)
 		return
 	}
+	sim.SetLogger(logger)
+	// The hash is taken when the dataset is created or bound; a file edited
+	// since then would run content nobody reviewed
+	if wantHash != "" && sim.DatasetHash() != wantHash {
+		logger.Printf("start refused: dataset %s changed on disk (hash %s, now %s)", dataset.ID, wantHash, sim.DatasetHash())
+		RecordFailure("dataset_changed", id)
+		http.Error(w, fmt.Sprintf("dataset %s file %q changed since it was registered (hash %s, now %s); bind it to the lab again to accept the new content",
+			dataset.ID, dataset.FilePath, wantHash, sim.DatasetHash()), http.StatusConflict)
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	if err := sim.Start(ctx); err != nil {
 		cancel()
+		logger.Printf("failed to start simulator: %v", err)
 		RecordFailure("simulator_start_failed", id)
 		http.Error(w, fmt.Sprintf("failed to start simulator: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	rm.mu.Lock()
-	lab.Status = "running"
+	if bound && dataset.Hash == "" {
+		dataset.Hash = sim.DatasetHash() // the file did not load when registered
+	}
+	// The lab may have been replaced by an update while the simulator started
+	if current, ok := rm.labs[id]; ok {
+		running := *current
+		running.Status = "running"
+		rm.labs[id] = &running
+		lab = &running
+	}
 	rm.labSimulators[id] = sim
 	rm.labCancels[id] = cancel
+	rm.saveStateLocked()
 	rm.mu.Unlock()
 
 	RecordLabStart()
 	RecordPacket("START", id)
 	UpdateActiveAgents(id, eng.NumDevices)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(lab)
+	writeResponse(w, r, http.StatusOK, lab)
 }
 
 func (rm *ResourceManager) StopLab(w http.ResponseWriter, r *http.Request) {
@@ -360,13 +590,29 @@ func (rm *ResourceManager) StopLab(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sim, ok := rm.labSimulators[id]
-	if !ok {
+	if err := rm.stopLabLocked(id, lab); err != nil {
 		rm.mu.Unlock()
 		RecordFailure("simulator_not_found", id)
-		http.Error(w, "simulator not found", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	rm.saveStateLocked()
+	rm.mu.Unlock()
+
+	RecordLabStop()
+	RecordPacket("STOP", id)
+	UpdateActiveAgents(id, 0)
+
+	writeResponse(w, r, http.StatusOK, lab)
+}
+
+// stopLabLocked cancels and stops the simulator of running lab id, waiting
+// for its listeners to drain, and marks the lab stopped. rm.mu must be held.
+func (rm *ResourceManager) stopLabLocked(id string, lab *Lab) error {
+	sim, ok := rm.labSimulators[id]
+	if !ok {
+		return fmt.Errorf("simulator not found")
+	}
 
 	cancel := rm.labCancels[id]
 	delete(rm.labCancels, id)
@@ -379,29 +625,26 @@ func (rm *ResourceManager) StopLab(w http.ResponseWriter, r *http.Request) {
 	delete(rm.labSimulators, id)
 
 	lab.Status = "stopped"
-	rm.mu.Unlock()
-
-	RecordLabStop()
-	RecordPacket("STOP", id)
-	UpdateActiveAgents(id, 0)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(lab)
+	return nil
 }
 
 // Engine endpoints
 func (rm *ResourceManager) CreateEngine(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name        string `json:"name"`
-		EngineID    string `json:"engine_id"`
-		ListenAddr  string `json:"listen_addr"`
-		ListenAddr6 string `json:"listen_addr6"`
-		PortStart   int    `json:"port_start"`
-		PortEnd     int    `json:"port_end"`
-		NumDevices  int    `json:"num_devices"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		Name        string `json:"name" yaml:"name"`
+		EngineID    string `json:"engine_id" yaml:"engine_id"`
+		ListenAddr  string `json:"listen_addr" yaml:"listen_addr"`
+		ListenAddr6 string `json:"listen_addr6" yaml:"listen_addr6"`
+		PortStart   int    `json:"port_start" yaml:"port_start"`
+		PortEnd     int    `json:"port_end" yaml:"port_end"`
+		NumDevices  int    `json:"num_devices" yaml:"num_devices"`
+	}
+	if err := rm.decodeBody(r, &req); err != nil {
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
+		return
+	}
+	if _, err := v3.ParseEngineID(req.EngineID); err != nil {
+		http.Error(w, fmt.Sprintf("invalid engine_id: %v", err), http.StatusBadRequest)
 		return
 	}
 
@@ -423,13 +666,18 @@ func (rm *ResourceManager) CreateEngine(w http.ResponseWriter, r *http.Request)
 		CreatedAt:   time.Now(),
 	}
 	rm.engines[id] = engine
+	rm.saveStateLocked()
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(engine)
+	writeResponse(w, r, http.StatusCreated, engine)
 }
 
 func (rm *ResourceManager) ListEngines(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePaging(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	rm.mu.RLock()
 	engines := make([]*Engine, 0, len(rm.engines))
 	for _, e := range rm.engines {
@@ -437,8 +685,7 @@ func (rm *ResourceManager) ListEngines(w http.ResponseWriter, r *http.Request) {
 	}
 	rm.mu.RUnlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(engines)
+	writeResponse(w, r, http.StatusOK, paginate(engines, p, func(e *Engine) (time.Time, string) { return e.CreatedAt, e.ID }))
 }
 
 func (rm *ResourceManager) GetEngine(w http.ResponseWriter, r *http.Request) {
@@ -453,8 +700,80 @@ func (rm *ResourceManager) GetEngine(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(engine)
+	writeResponse(w, r, http.StatusOK, engine)
+}
+
+// UpdateEngine applies a partial update to an engine: only the fields present
+// in the body change. The updated engine replaces the stored one, so readers
+// holding the old pointer outside the lock never see a half-applied update.
+func (rm *ResourceManager) UpdateEngine(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req struct {
+		Name        *string `json:"name" yaml:"name"`
+		EngineID    *string `json:"engine_id" yaml:"engine_id"`
+		ListenAddr  *string `json:"listen_addr" yaml:"listen_addr"`
+		ListenAddr6 *string `json:"listen_addr6" yaml:"listen_addr6"`
+		PortStart   *int    `json:"port_start" yaml:"port_start"`
+		PortEnd     *int    `json:"port_end" yaml:"port_end"`
+		NumDevices  *int    `json:"num_devices" yaml:"num_devices"`
+	}
+	if err := rm.decodeBody(r, &req); err != nil {
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
+		return
+	}
+	if req.EngineID != nil {
+		if _, err := v3.ParseEngineID(*req.EngineID); err != nil {
+			http.Error(w, fmt.Sprintf("invalid engine_id: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	current, ok := rm.engines[id]
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	for _, lab := range rm.labs {
+		if lab.EngineID == id && lab.Status == "running" {
+			http.Error(w, fmt.Sprintf("engine in use by running lab %s", lab.ID), http.StatusConflict)
+			return
+		}
+	}
+
+	updated := *current
+	if req.Name != nil {
+		updated.Name = *req.Name
+	}
+	if req.EngineID != nil {
+		updated.EngineID = *req.EngineID
+	}
+	if req.ListenAddr != nil {
+		updated.ListenAddr = *req.ListenAddr
+	}
+	if req.ListenAddr6 != nil {
+		updated.ListenAddr6 = *req.ListenAddr6
+	}
+	if req.PortStart != nil {
+		updated.PortStart = *req.PortStart
+	}
+	if req.PortEnd != nil {
+		updated.PortEnd = *req.PortEnd
+	}
+	if req.NumDevices != nil {
+		updated.NumDevices = *req.NumDevices
+	}
+	if updated.PortEnd <= updated.PortStart {
+		http.Error(w, fmt.Sprintf("port_end (%d) must be greater than port_start (%d)", updated.PortEnd, updated.PortStart), http.StatusBadRequest)
+		return
+	}
+	rm.engines[id] = &updated
+	rm.saveStateLocked()
+
+	writeResponse(w, r, http.StatusOK, &updated)
 }
 
 func (rm *ResourceManager) DeleteEngine(w http.ResponseWriter, r *http.Request) {
@@ -477,18 +796,19 @@ func (rm *ResourceManager) DeleteEngine(w http.ResponseWriter, r *http.Request)
 	}
 
 	delete(rm.engines, id)
+	rm.saveStateLocked()
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // Endpoint (network address) handlers
 func (rm *ResourceManager) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name    string `json:"name"`
-		Address string `json:"address"`
-		Port    int    `json:"port"`
+		Name    string `json:"name" yaml:"name"`
+		Address string `json:"address" yaml:"address"`
+		Port    int    `json:"port" yaml:"port"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := rm.decodeBody(r, &req); err != nil {
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
 		return
 	}
 
@@ -506,13 +826,18 @@ func (rm *ResourceManager) CreateEndpoint(w http.ResponseWriter, r *http.Request
 		CreatedAt: time.Now(),
 	}
 	rm.endpoints[id] = endpoint
+	rm.saveStateLocked()
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(endpoint)
+	writeResponse(w, r, http.StatusCreated, endpoint)
 }
 
 func (rm *ResourceManager) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePaging(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	rm.mu.RLock()
 	endpoints := make([]*Endpoint, 0, len(rm.endpoints))
 	for _, e := range rm.endpoints {
@@ -520,8 +845,7 @@ func (rm *ResourceManager) ListEndpoints(w http.ResponseWriter, r *http.Request)
 	}
 	rm.mu.RUnlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(endpoints)
+	writeResponse(w, r, http.StatusOK, paginate(endpoints, p, func(e *Endpoint) (time.Time, string) { return e.CreatedAt, e.ID }))
 }
 
 func (rm *ResourceManager) GetEndpoint(w http.ResponseWriter, r *http.Request) {
@@ -536,8 +860,7 @@ func (rm *ResourceManager) GetEndpoint(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(endpoint)
+	writeResponse(w, r, http.StatusOK, endpoint)
 }
 
 func (rm *ResourceManager) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
@@ -552,17 +875,18 @@ func (rm *ResourceManager) DeleteEndpoint(w http.ResponseWriter, r *http.Request
 	}
 
 	delete(rm.endpoints, id)
+	rm.saveStateLocked()
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // User handlers
 func (rm *ResourceManager) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
+		Name  string `json:"name" yaml:"name"`
+		Email string `json:"email" yaml:"email"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := rm.decodeBody(r, &req); err != nil {
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
 		return
 	}
 
@@ -579,13 +903,18 @@ func (rm *ResourceManager) CreateUser(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: time.Now(),
 	}
 	rm.users[id] = user
+	rm.saveStateLocked()
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	writeResponse(w, r, http.StatusCreated, user)
 }
 
 func (rm *ResourceManager) ListUsers(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePaging(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	rm.mu.RLock()
 	users := make([]*User, 0, len(rm.users))
 	for _, u := range rm.users {
@@ -593,8 +922,7 @@ func (rm *ResourceManager) ListUsers(w http.ResponseWriter, r *http.Request) {
 	}
 	rm.mu.RUnlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	writeResponse(w, r, http.StatusOK, paginate(users, p, func(u *User) (time.Time, string) { return u.CreatedAt, u.ID }))
 }
 
 func (rm *ResourceManager) GetUser(w http.ResponseWriter, r *http.Request) {
@@ -609,8 +937,7 @@ func (rm *ResourceManager) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeResponse(w, r, http.StatusOK, user)
 }
 
 func (rm *ResourceManager) DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -625,21 +952,24 @@ func (rm *ResourceManager) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	delete(rm.users, id)
+	rm.saveStateLocked()
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // Dataset handlers
 func (rm *ResourceManager) CreateDataset(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name     string `json:"name"`
-		EngineID string `json:"engine_id"`
-		FilePath string `json:"file_path"`
+		Name     string `json:"name" yaml:"name"`
+		EngineID string `json:"engine_id" yaml:"engine_id"`
+		FilePath string `json:"file_path" yaml:"file_path"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := rm.decodeBody(r, &req); err != nil {
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
 		return
 	}
 
+	hash := datasetFileHash(req.FilePath)
+
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
@@ -651,16 +981,22 @@ func (rm *ResourceManager) CreateDataset(w http.ResponseWriter, r *http.Request)
 		Name:      req.Name,
 		EngineID:  req.EngineID,
 		FilePath:  req.FilePath,
+		Hash:      hash,
 		CreatedAt: time.Now(),
 	}
 	rm.datasets[id] = dataset
+	rm.saveStateLocked()
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(dataset)
+	writeResponse(w, r, http.StatusCreated, dataset)
 }
 
 func (rm *ResourceManager) ListDatasets(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePaging(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	rm.mu.RLock()
 	datasets := make([]*Dataset, 0, len(rm.datasets))
 	for _, d := range rm.datasets {
@@ -668,8 +1004,7 @@ func (rm *ResourceManager) ListDatasets(w http.ResponseWriter, r *http.Request)
 	}
 	rm.mu.RUnlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(datasets)
+	writeResponse(w, r, http.StatusOK, paginate(datasets, p, func(d *Dataset) (time.Time, string) { return d.CreatedAt, d.ID }))
 }
 
 func (rm *ResourceManager) GetDataset(w http.ResponseWriter, r *http.Request) {
@@ -684,8 +1019,7 @@ func (rm *ResourceManager) GetDataset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(dataset)
+	writeResponse(w, r, http.StatusOK, dataset)
 }
 
 func (rm *ResourceManager) DeleteDataset(w http.ResponseWriter, r *http.Request) {
@@ -700,6 +1034,7 @@ func (rm *ResourceManager) DeleteDataset(w http.ResponseWriter, r *http.Request)
 	}
 
 	delete(rm.datasets, id)
+	rm.saveStateLocked()
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -721,6 +1056,7 @@ func (rm *ResourceManager) Shutdown() {
 	}
 	rm.labSimulators = make(map[string]*engine.Simulator)
 	rm.labCancels = make(map[string]context.CancelFunc)
+	rm.saveStateLocked()
 }
 
 // Router registers HTTP handlers with proper method routing
@@ -758,28 +1094,39 @@ func (r *Router) Register() {
 }
 
 func (r *Router) handleLabs(w http.ResponseWriter, req *http.Request) {
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodPost) {
+		return
+	}
 	if req.Method == http.MethodPost {
 		r.rm.CreateLab(w, req)
-	} else if req.Method == http.MethodGet {
-		r.rm.ListLabs(w, req)
 	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		r.rm.ListLabs(w, req)
 	}
 }
 
 func (r *Router) handleLabsDetail(w http.ResponseWriter, req *http.Request) {
 	path := req.URL.Path
+	if path == "/labs/from-profile" {
+		if httpmethod.Allow(w, req, http.MethodPost) {
+			r.rm.CreateLabFromProfile(w, req)
+		}
+		return
+	}
 	if !contains(path[6:], "/") {
 		// /labs/{id}
 		id := path[6:]
 		req.SetPathValue("id", id)
 
-		if req.Method == http.MethodGet {
+		if !httpmethod.Allow(w, req, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete) {
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
 			r.rm.GetLab(w, req)
-		} else if req.Method == http.MethodDelete {
+		case http.MethodPut, http.MethodPatch:
+			r.rm.UpdateLab(w, req)
+		default:
 			r.rm.DeleteLab(w, req)
-		} else {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	} else {
 		// /labs/{id}/{action}
@@ -789,12 +1136,13 @@ func (r *Router) handleLabsDetail(w http.ResponseWriter, req *http.Request) {
 			action := parts[1]
 			req.SetPathValue("id", id)
 
-			if req.Method == http.MethodPost && action == "start" {
-				r.rm.StartLab(w, req)
-			} else if req.Method == http.MethodPost && action == "stop" {
-				r.rm.StopLab(w, req)
-			} else {
+			method, handler := labActionRoute(r.rm, action)
+			if handler == nil {
 				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			if httpmethod.Allow(w, req, method) {
+				handler(w, req)
 			}
 		} else {
 			http.Error(w, "not found", http.StatusNotFound)
@@ -802,13 +1150,32 @@ func (r *Router) handleLabsDetail(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// labActionRoute returns the method and handler of /labs/{id}/{action}, or
+// a nil handler for an unknown action
+func labActionRoute(rm *ResourceManager, action string) (string, http.HandlerFunc) {
+	switch action {
+	case "start":
+		return http.MethodPost, rm.StartLab
+	case "stop":
+		return http.MethodPost, rm.StopLab
+	case "logs":
+		return http.MethodGet, rm.GetLabLogs
+	case "dataset":
+		return http.MethodPost, rm.BindLabDataset
+	case "agents":
+		return http.MethodGet, rm.GetLabAgents
+	}
+	return "", nil
+}
+
 func (r *Router) handleEngines(w http.ResponseWriter, req *http.Request) {
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodPost) {
+		return
+	}
 	if req.Method == http.MethodPost {
 		r.rm.CreateEngine(w, req)
-	} else if req.Method == http.MethodGet {
-		r.rm.ListEngines(w, req)
 	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		r.rm.ListEngines(w, req)
 	}
 }
 
@@ -816,22 +1183,27 @@ func (r *Router) handleEnginesDetail(w http.ResponseWriter, req *http.Request) {
 	id := req.URL.Path[9:] // len("/engines/") = 9
 	req.SetPathValue("id", id)
 
-	if req.Method == http.MethodGet {
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete) {
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
 		r.rm.GetEngine(w, req)
-	} else if req.Method == http.MethodDelete {
+	case http.MethodPut, http.MethodPatch:
+		r.rm.UpdateEngine(w, req)
+	default:
 		r.rm.DeleteEngine(w, req)
-	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 func (r *Router) handleEndpoints(w http.ResponseWriter, req *http.Request) {
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodPost) {
+		return
+	}
 	if req.Method == http.MethodPost {
 		r.rm.CreateEndpoint(w, req)
-	} else if req.Method == http.MethodGet {
-		r.rm.ListEndpoints(w, req)
 	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		r.rm.ListEndpoints(w, req)
 	}
 }
 
@@ -839,22 +1211,24 @@ func (r *Router) handleEndpointsDetail(w http.ResponseWriter, req *http.Request)
 	id := req.URL.Path[11:] // len("/endpoints/") = 11
 	req.SetPathValue("id", id)
 
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodDelete) {
+		return
+	}
 	if req.Method == http.MethodGet {
 		r.rm.GetEndpoint(w, req)
-	} else if req.Method == http.MethodDelete {
-		r.rm.DeleteEndpoint(w, req)
 	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		r.rm.DeleteEndpoint(w, req)
 	}
 }
 
 func (r *Router) handleUsers(w http.ResponseWriter, req *http.Request) {
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodPost) {
+		return
+	}
 	if req.Method == http.MethodPost {
 		r.rm.CreateUser(w, req)
-	} else if req.Method == http.MethodGet {
-		r.rm.ListUsers(w, req)
 	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		r.rm.ListUsers(w, req)
 	}
 }
 
@@ -862,22 +1236,24 @@ func (r *Router) handleUsersDetail(w http.ResponseWriter, req *http.Request) {
 	id := req.URL.Path[7:] // len("/users/") = 7
 	req.SetPathValue("id", id)
 
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodDelete) {
+		return
+	}
 	if req.Method == http.MethodGet {
 		r.rm.GetUser(w, req)
-	} else if req.Method == http.MethodDelete {
-		r.rm.DeleteUser(w, req)
 	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		r.rm.DeleteUser(w, req)
 	}
 }
 
 func (r *Router) handleDatasets(w http.ResponseWriter, req *http.Request) {
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodPost) {
+		return
+	}
 	if req.Method == http.MethodPost {
 		r.rm.CreateDataset(w, req)
-	} else if req.Method == http.MethodGet {
-		r.rm.ListDatasets(w, req)
 	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		r.rm.ListDatasets(w, req)
 	}
 }
 
@@ -885,12 +1261,13 @@ func (r *Router) handleDatasetsDetail(w http.ResponseWriter, req *http.Request)
 	id := req.URL.Path[10:] // len("/datasets/") = 10
 	req.SetPathValue("id", id)
 
+	if !httpmethod.Allow(w, req, http.MethodGet, http.MethodDelete) {
+		return
+	}
 	if req.Method == http.MethodGet {
 		r.rm.GetDataset(w, req)
-	} else if req.Method == http.MethodDelete {
-		r.rm.DeleteDataset(w, req)
 	} else {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		r.rm.DeleteDataset(w, req)
 	}
 }
 
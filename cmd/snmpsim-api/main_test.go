@@ -2,17 +2,30 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpbody"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httptimeout"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/testutil"
+	"github.com/gosnmp/gosnmp"
+	"gopkg.in/yaml.v3"
 )
 
 func setupTestServer(t *testing.T) (*httptest.Server, *ResourceManager) {
-	rm := NewResourceManager()
+	rm, _ := NewResourceManager("")
 
 	mux := http.NewServeMux()
 
@@ -22,7 +35,7 @@ func setupTestServer(t *testing.T) (*httptest.Server, *ResourceManager) {
 
 	mux.HandleFunc("/health", healthHandler)
 
-	return httptest.NewServer(mux), rm
+	return httptest.NewServer(apiHandler(mux, httpbody.DefaultMaxBytes)), rm
 }
 
 func validateMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
@@ -93,14 +106,14 @@ func TestLabsCRUD(t *testing.T) {
 		t.Fatalf("Failed to list labs: %v", err)
 	}
 
-	var labs []Lab
+	var labs Page[Lab]
 	if err := json.NewDecoder(resp.Body).Decode(&labs); err != nil {
 		t.Fatalf("Failed to decode labs: %v", err)
 	}
 	resp.Body.Close()
 
-	if len(labs) < 1 {
-		t.Errorf("Expected at least 1 lab, got %d", len(labs))
+	if len(labs.Items) < 1 || labs.Total != len(labs.Items) {
+		t.Errorf("Expected at least 1 lab, got %d of %d", len(labs.Items), labs.Total)
 	}
 
 	// Delete lab
@@ -139,7 +152,7 @@ func TestEnginesCRUD(t *testing.T) {
 	// Create engine
 	createPayload := []byte(`{
 		"name":"test-engine",
-		"engine_id":"800007e5",
+		"engine_id":"800007e5017f000001",
 		"listen_addr":"127.0.0.1",
 		"port_start":10000,
 		"port_end":10010,
@@ -183,14 +196,14 @@ func TestEnginesCRUD(t *testing.T) {
 		t.Fatalf("Failed to list engines: %v", err)
 	}
 
-	var engines []Engine
+	var engines Page[Engine]
 	if err := json.NewDecoder(resp.Body).Decode(&engines); err != nil {
 		t.Fatalf("Failed to decode engines: %v", err)
 	}
 	resp.Body.Close()
 
-	if len(engines) < 1 {
-		t.Errorf("Expected at least 1 engine, got %d", len(engines))
+	if len(engines.Items) < 1 || engines.Total != len(engines.Items) {
+		t.Errorf("Expected at least 1 engine, got %d of %d", len(engines.Items), engines.Total)
 	}
 
 	// Delete engine
@@ -209,6 +222,138 @@ func TestEnginesCRUD(t *testing.T) {
 	resp.Body.Close()
 }
 
+func TestCreateEngineValidatesEngineID(t *testing.T) {
+	server, _ := setupTestServer(t)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	cases := []struct {
+		engineID string
+		want     int
+	}{
+		{"800007e5017f000001", http.StatusCreated},
+		{"0x80001f8804", http.StatusCreated},
+		{"lab-engine", http.StatusCreated},
+		{"800007e5", http.StatusBadRequest},
+		{"0x80zz", http.StatusBadRequest},
+		{strings.Repeat("x", 33), http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		payload := fmt.Sprintf(`{"name":"e","engine_id":%q,"listen_addr":"127.0.0.1","port_start":10000,"port_end":10010,"num_devices":1}`, tc.engineID)
+		resp, err := client.Post(server.URL+"/engines", "application/json", strings.NewReader(payload))
+		if err != nil {
+			t.Fatalf("create engine %q: %v", tc.engineID, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("engine_id %q: status %d, want %d (%s)", tc.engineID, resp.StatusCode, tc.want, body)
+		}
+		if tc.want == http.StatusBadRequest && !strings.Contains(string(body), "invalid engine_id") {
+			t.Errorf("engine_id %q: unclear error %q", tc.engineID, body)
+		}
+	}
+}
+
+func TestUpdateEngineAndLab(t *testing.T) {
+	server, rm := setupTestServer(t)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	do := func(method, path, body string) (int, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, data
+	}
+
+	_, body := do(http.MethodPost, "/engines", `{"name":"e","listen_addr":"127.0.0.1","port_start":10000,"port_end":10010,"num_devices":5}`)
+	var eng Engine
+	json.Unmarshal(body, &eng)
+
+	status, body := do(http.MethodPut, "/engines/"+eng.ID, `{"port_end":10020,"num_devices":8}`)
+	var updated Engine
+	json.Unmarshal(body, &updated)
+	if status != http.StatusOK || updated.PortStart != 10000 || updated.PortEnd != 10020 || updated.NumDevices != 8 || updated.Name != "e" {
+		t.Fatalf("PUT engine: status %d, engine %+v", status, updated)
+	}
+	storedEngine := func() Engine {
+		rm.mu.RLock()
+		defer rm.mu.RUnlock()
+		return *rm.engines[eng.ID]
+	}
+	if status, _ = do(http.MethodPatch, "/engines/"+eng.ID, `{"name":"renamed"}`); status != http.StatusOK || storedEngine().Name != "renamed" {
+		t.Fatalf("PATCH engine: status %d, name %q", status, storedEngine().Name)
+	}
+	if status, body = do(http.MethodPut, "/engines/"+eng.ID, `{"port_start":10020}`); status != http.StatusBadRequest || !strings.Contains(string(body), "port_end") {
+		t.Fatalf("PUT engine with empty port range: status %d (%s), want 400", status, body)
+	}
+	if status, _ = do(http.MethodPut, "/engines/"+eng.ID, `{"engine_id":"0x80zz"}`); status != http.StatusBadRequest {
+		t.Fatalf("PUT engine with bad engine_id: status %d, want 400", status)
+	}
+	if status, _ = do(http.MethodPut, "/engines/engine-missing", `{"name":"x"}`); status != http.StatusNotFound {
+		t.Fatalf("PUT unknown engine: status %d, want 404", status)
+	}
+
+	_, body = do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"l","engine_id":%q}`, eng.ID))
+	var lab Lab
+	json.Unmarshal(body, &lab)
+	rm.mu.RLock()
+	before := rm.labs[lab.ID]
+	rm.mu.RUnlock()
+	status, body = do(http.MethodPut, "/labs/"+lab.ID, `{"name":"lab-renamed"}`)
+	var updatedLab Lab
+	json.Unmarshal(body, &updatedLab)
+	if status != http.StatusOK || updatedLab.Name != "lab-renamed" || updatedLab.EngineID != eng.ID {
+		t.Fatalf("PUT lab: status %d, lab %+v", status, updatedLab)
+	}
+	if before.Name != "l" {
+		t.Fatalf("PUT lab modified the stored lab in place: name %q", before.Name)
+	}
+	if status, _ = do(http.MethodPut, "/labs/"+lab.ID, `{"engine_id":"engine-missing"}`); status != http.StatusBadRequest {
+		t.Fatalf("PUT lab onto unknown engine: status %d, want 400", status)
+	}
+
+	_, body = do(http.MethodPost, "/engines", `{"name":"other","listen_addr":"127.0.0.1","port_start":10100,"port_end":10110,"num_devices":1}`)
+	var other Engine
+	json.Unmarshal(body, &other)
+	path := filepath.Join(t.TempDir(), "bound.snmprec")
+	if err := os.WriteFile(path, []byte("1.3.6.1.2.1.1.1.0|octetstring|bound\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	var dataset Dataset
+	_, body = do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"bound","engine_id":%q,"file_path":%q}`, eng.ID, path))
+	json.Unmarshal(body, &dataset)
+	_, body = do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"bound","engine_id":%q,"dataset_id":%q}`, eng.ID, dataset.ID))
+	var boundLab Lab
+	json.Unmarshal(body, &boundLab)
+	if status, body = do(http.MethodPut, "/labs/"+boundLab.ID, fmt.Sprintf(`{"engine_id":%q}`, other.ID)); status != http.StatusConflict {
+		t.Fatalf("PUT dataset-bound lab onto another engine: status %d (%s), want 409", status, body)
+	}
+
+	rm.mu.Lock()
+	rm.labs[lab.ID].Status = "running"
+	rm.mu.Unlock()
+	if status, _ = do(http.MethodPut, "/engines/"+eng.ID, `{"num_devices":2}`); status != http.StatusConflict {
+		t.Fatalf("PUT engine of running lab: status %d, want 409", status)
+	}
+	if n := storedEngine().NumDevices; n != 8 {
+		t.Fatalf("num_devices = %d after refused update, want 8", n)
+	}
+	if status, _ = do(http.MethodPut, "/labs/"+lab.ID, `{"engine_id":"engine-other"}`); status != http.StatusConflict {
+		t.Fatalf("PUT engine_id of running lab: status %d, want 409", status)
+	}
+	if status, _ = do(http.MethodPatch, "/labs/"+lab.ID, `{"name":"still-running"}`); status != http.StatusOK {
+		t.Fatalf("PATCH name of running lab: status %d, want 200", status)
+	}
+}
+
 // Test CRUD for Endpoints
 func TestEndpointsCRUD(t *testing.T) {
 	server, _ := setupTestServer(t)
@@ -391,7 +536,7 @@ func TestLabLifecycle(t *testing.T) {
 	// Create engine first
 	engPayload := []byte(`{
 		"name":"test-engine",
-		"engine_id":"800007e5",
+		"engine_id":"800007e5017f000001",
 		"listen_addr":"127.0.0.1",
 		"port_start":11000,
 		"port_end":11010,
@@ -443,8 +588,160 @@ func TestLabLifecycle(t *testing.T) {
 	client.Do(req)
 }
 
+func TestForceDeleteStopsRunningLab(t *testing.T) {
+	server, rm := setupTestServer(t)
+	defer server.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/engines", fmt.Sprintf(`{"name":"drain","listen_addr":"127.0.0.1","port_start":%d,"port_end":%d,"num_devices":1}`, port, port+1))
+	var eng Engine
+	json.NewDecoder(resp.Body).Decode(&eng)
+	resp.Body.Close()
+
+	resp = do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"drain-lab","engine_id":"%s"}`, eng.ID))
+	var lab Lab
+	json.NewDecoder(resp.Body).Decode(&lab)
+	resp.Body.Close()
+
+	resp = do(http.MethodPost, "/labs/"+lab.ID+"/start", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("start status = %d", resp.StatusCode)
+	}
+
+	resp = do(http.MethodDelete, "/labs/"+lab.ID, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("delete without force status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+
+	resp = do(http.MethodDelete, "/labs/"+lab.ID+"?force=true", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("force delete status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	rm.mu.RLock()
+	_, labExists := rm.labs[lab.ID]
+	_, simExists := rm.labSimulators[lab.ID]
+	_, cancelExists := rm.labCancels[lab.ID]
+	rm.mu.RUnlock()
+	if labExists || simExists || cancelExists {
+		t.Fatalf("lab state left behind: lab=%v sim=%v cancel=%v", labExists, simExists, cancelExists)
+	}
+
+	// The simulator released its listener, so the port can be bound again
+	conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: port})
+	if err != nil {
+		t.Fatalf("port %d still bound after force delete: %v", port, err)
+	}
+	conn.Close()
+}
+
+func TestStateFileSurvivesRestart(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	rm, err := NewResourceManager(stateFile)
+	if err != nil {
+		t.Fatalf("NewResourceManager: %v", err)
+	}
+	mux := http.NewServeMux()
+	NewRouter(mux, rm).Register()
+	server := httptest.NewServer(apiHandler(mux, httpbody.DefaultMaxBytes))
+	defer server.Close()
+
+	post := func(path, body string, v interface{}) {
+		t.Helper()
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s: status %d", path, resp.StatusCode)
+		}
+		json.NewDecoder(resp.Body).Decode(v)
+	}
+	var eng Engine
+	post("/engines", `{"name":"e","listen_addr":"127.0.0.1","port_start":10000,"port_end":10010,"num_devices":5}`, &eng)
+	var lab Lab
+	post("/labs", fmt.Sprintf(`{"name":"l","engine_id":%q}`, eng.ID), &lab)
+
+	// Concurrent creates must all land in a file that still parses
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.Post(server.URL+"/users", "application/json", strings.NewReader(fmt.Sprintf(`{"name":"u%d"}`, i)))
+			if err != nil {
+				t.Errorf("create user %d: %v", i, err)
+				return
+			}
+			resp.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	// A lab running when the process died comes back stopped
+	rm.mu.Lock()
+	rm.labs[lab.ID].Status = "running"
+	rm.saveStateLocked()
+	rm.mu.Unlock()
+
+	restored, err := NewResourceManager(stateFile)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got := restored.engines[eng.ID]; got == nil || got.Name != "e" || got.PortEnd != 10010 || got.NumDevices != 5 {
+		t.Fatalf("restored engine = %+v", got)
+	}
+	if got := restored.labs[lab.ID]; got == nil || got.EngineID != eng.ID || got.Status != "stopped" {
+		t.Fatalf("restored lab = %+v, want stopped lab on %s", got, eng.ID)
+	}
+	if len(restored.users) != 20 {
+		t.Fatalf("restored %d users, want 20", len(restored.users))
+	}
+	if restored.nextID != rm.nextID {
+		t.Fatalf("restored nextID = %d, want %d so IDs are not reused", restored.nextID, rm.nextID)
+	}
+
+	// Without a state file nothing is written or read
+	memory, err := NewResourceManager("")
+	if err != nil || len(memory.engines) != 0 {
+		t.Fatalf("in-memory manager: %v, %d engines", err, len(memory.engines))
+	}
+}
+
+func TestCorruptStateFileFailsStartup(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(stateFile, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewResourceManager(stateFile); err == nil {
+		t.Fatal("NewResourceManager accepted a corrupt state file")
+	}
+}
+
 func TestShutdownCancelsAndCleansLabState(t *testing.T) {
-	rm := NewResourceManager()
+	rm, _ := NewResourceManager("")
 	called := false
 
 	rm.mu.Lock()
@@ -555,3 +852,873 @@ func TestConcurrentCRUD(t *testing.T) {
 		}
 	}
 }
+
+func TestAPIServerServesHTTPS(t *testing.T) {
+	certFile, keyFile := testutil.WriteSelfSignedCert(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", healthHandler)
+	srv := newAPIServer("127.0.0.1:0", mux, httptimeout.Defaults())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = serveAPI(srv, ln, certFile, keyFile) }()
+	defer srv.Close()
+
+	resp, err := testutil.TLSClient(t, certFile).Get("https://" + ln.Addr().String() + "/health")
+	if err != nil {
+		t.Fatalf("https request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Fatalf("unexpected TLS state: %+v", resp.TLS)
+	}
+}
+
+func TestAPIServerSetsTimeouts(t *testing.T) {
+	timeouts := httptimeout.Timeouts{ReadHeader: time.Second, Read: 2 * time.Second, Write: 3 * time.Second, Idle: 4 * time.Second}
+	srv := newAPIServer("127.0.0.1:0", http.NewServeMux(), timeouts)
+	if srv.ReadHeaderTimeout != time.Second || srv.ReadTimeout != 2*time.Second ||
+		srv.WriteTimeout != 3*time.Second || srv.IdleTimeout != 4*time.Second {
+		t.Fatalf("unexpected timeouts: header=%s read=%s write=%s idle=%s",
+			srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
+
+func TestOversizedBodyReturns413(t *testing.T) {
+	rm, _ := NewResourceManager("")
+	mux := http.NewServeMux()
+	NewRouter(mux, rm).Register()
+	server := httptest.NewServer(httpbody.Handler(mux, 128))
+	defer server.Close()
+
+	payload := fmt.Sprintf(`{"name":"big","engine_id":"engine-1","file_path":"%s"}`, strings.Repeat("x", 256))
+
+	resp, err := http.Post(server.URL+"/datasets", "application/json", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("post dataset: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	// A chunked body carries no Content-Length; the limit trips during decode.
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/datasets", io.NopCloser(strings.NewReader(payload)))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post chunked dataset: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("chunked status = %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	if got := len(rm.datasets); got != 0 {
+		t.Fatalf("datasets stored = %d, want 0", got)
+	}
+}
+
+func TestFormEncodedBodyReturns415(t *testing.T) {
+	rm, _ := NewResourceManager("")
+	mux := http.NewServeMux()
+	NewRouter(mux, rm).Register()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/labs", "application/x-www-form-urlencoded", strings.NewReader("name=form-lab&engine_id=engine-1"))
+	if err != nil {
+		t.Fatalf("post lab: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType || !strings.Contains(string(body), "application/json") {
+		t.Fatalf("status = %d, body=%s, want %d naming application/json", resp.StatusCode, body, http.StatusUnsupportedMediaType)
+	}
+
+	resp, err = http.Post(server.URL+"/labs", "application/json; charset=utf-8", strings.NewReader(`{"name":"json-lab","engine_id":"engine-1"}`))
+	if err != nil {
+		t.Fatalf("post lab: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("json with charset status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+}
+
+func TestStrictDecodeRejectsUnknownField(t *testing.T) {
+	rm, _ := NewResourceManager("")
+	mux := http.NewServeMux()
+	NewRouter(mux, rm).Register()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	post := func(name string, strictHeader bool) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/labs", strings.NewReader(`{"name":"`+name+`","engin_id":"engine-1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if strictHeader {
+			req.Header.Set("Prefer", "handling=strict")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post lab: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := post("lenient-lab", false); status != http.StatusCreated {
+		t.Fatalf("lenient status = %d, body=%s, want %d", status, body, http.StatusCreated)
+	}
+	if status, body := post("header-lab", true); status != http.StatusBadRequest || !strings.Contains(body, "engin_id") {
+		t.Fatalf("Prefer: handling=strict status = %d, body=%s, want 400 naming engin_id", status, body)
+	}
+	rm.strictDecode = true
+	if status, body := post("flag-lab", false); status != http.StatusBadRequest || !strings.Contains(body, "engin_id") {
+		t.Fatalf("--strict-decode status = %d, body=%s, want 400 naming engin_id", status, body)
+	}
+}
+
+func TestLabYAMLNegotiation(t *testing.T) {
+	server, _ := setupTestServer(t)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	createReq, _ := http.NewRequest(http.MethodPost, server.URL+"/labs", bytes.NewBufferString("name: yaml-lab\nengine_id: engine-1\n"))
+	createReq.Header.Set("Content-Type", "application/yaml")
+	createReq.Header.Set("Accept", "application/yaml")
+	resp, err := client.Do(createReq)
+	if err != nil {
+		t.Fatalf("create lab: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Expected status 201, got %d. Response: %s", resp.StatusCode, string(body))
+	}
+	var created Lab
+	if err := yaml.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode yaml create response: %v", err)
+	}
+	if created.ID == "" || created.Name != "yaml-lab" {
+		t.Fatalf("unexpected created lab: %+v", created)
+	}
+
+	getReq, _ := http.NewRequest(http.MethodGet, server.URL+"/labs/"+created.ID, nil)
+	getReq.Header.Set("Accept", "application/yaml")
+	resp2, err := client.Do(getReq)
+	if err != nil {
+		t.Fatalf("get lab: %v", err)
+	}
+	defer resp2.Body.Close()
+	if ct := resp2.Header.Get("Content-Type"); ct != "application/yaml" {
+		t.Fatalf("Content-Type = %q, want application/yaml", ct)
+	}
+	body, _ := io.ReadAll(resp2.Body)
+	if !bytes.Contains(body, []byte("engine_id: engine-1")) {
+		t.Fatalf("expected YAML body with snake_case keys, got:\n%s", body)
+	}
+	var fetched Lab
+	if err := yaml.Unmarshal(body, &fetched); err != nil {
+		t.Fatalf("decode yaml lab: %v", err)
+	}
+	if fetched.ID != created.ID || fetched.EngineID != "engine-1" || fetched.Status != "stopped" {
+		t.Fatalf("unexpected lab: %+v", fetched)
+	}
+
+	resp3, err := client.Get(server.URL + "/labs/" + created.ID)
+	if err != nil {
+		t.Fatalf("get lab json: %v", err)
+	}
+	defer resp3.Body.Close()
+	if ct := resp3.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("default Content-Type = %q, want application/json", ct)
+	}
+}
+
+func TestLabLogsReportStartFailure(t *testing.T) {
+	server, _ := setupTestServer(t)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return resp
+	}
+
+	// Five devices cannot fit in a two-port range, so the simulator is rejected
+	resp := do(http.MethodPost, "/engines", `{"name":"cramped","listen_addr":"127.0.0.1","port_start":11000,"port_end":11002,"num_devices":5}`)
+	var eng Engine
+	json.NewDecoder(resp.Body).Decode(&eng)
+	resp.Body.Close()
+
+	resp = do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"broken-lab","engine_id":"%s"}`, eng.ID))
+	var lab Lab
+	json.NewDecoder(resp.Body).Decode(&lab)
+	resp.Body.Close()
+
+	resp = do(http.MethodPost, "/labs/"+lab.ID+"/start", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("start status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+
+	resp = do(http.MethodGet, "/labs/"+lab.ID+"/logs", "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("logs status = %d", resp.StatusCode)
+	}
+	var logs struct {
+		ID    string   `json:"id"`
+		Lines []string `json:"lines"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		t.Fatalf("decode logs: %v", err)
+	}
+	if logs.ID != lab.ID || len(logs.Lines) == 0 {
+		t.Fatalf("unexpected logs: %+v", logs)
+	}
+	last := logs.Lines[len(logs.Lines)-1]
+	if !strings.Contains(last, "failed to create simulator") || !strings.Contains(last, "numDevices (5) exceeds") {
+		t.Fatalf("last log line %q does not explain the start failure", last)
+	}
+
+	resp = do(http.MethodGet, "/labs/lab-missing/logs", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing lab logs status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestLabLogIsBounded(t *testing.T) {
+	var l labLog
+	for i := 0; i < maxLabLogLines+10; i++ {
+		fmt.Fprintf(&l, "line %d\n", i)
+	}
+	lines := l.snapshot()
+	if len(lines) != maxLabLogLines || lines[0] != "line 10" || lines[len(lines)-1] != fmt.Sprintf("line %d", maxLabLogLines+9) {
+		t.Fatalf("kept %d lines, first %q last %q", len(lines), lines[0], lines[len(lines)-1])
+	}
+}
+
+func TestDatasetHashMatchesForIdenticalContent(t *testing.T) {
+	server, _ := setupTestServer(t)
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	create := func(name, content string) Dataset {
+		t.Helper()
+		path := filepath.Join(dir, name+".snmprec")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write dataset: %v", err)
+		}
+		resp, err := http.Post(server.URL+"/datasets", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"name":%q,"file_path":%q}`, name, path)))
+		if err != nil {
+			t.Fatalf("create dataset: %v", err)
+		}
+		defer resp.Body.Close()
+		var d Dataset
+		if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+			t.Fatalf("decode dataset: %v", err)
+		}
+		return d
+	}
+
+	a := create("a", "1.3.6.1.2.1.1.1.0|octetstring|router\n1.3.6.1.2.1.1.5.0|octetstring|edge-1\n")
+	b := create("b", "1.3.6.1.2.1.1.5.0|octetstring|edge-1\n1.3.6.1.2.1.1.1.0|octetstring|router\n")
+	c := create("c", "1.3.6.1.2.1.1.1.0|octetstring|router\n1.3.6.1.2.1.1.5.0|octetstring|edge-2\n")
+	if a.Hash == "" || a.Hash != b.Hash {
+		t.Fatalf("identical datasets: hashes %q and %q, want equal and non-empty", a.Hash, b.Hash)
+	}
+	if a.Hash == c.Hash {
+		t.Fatalf("changed value kept hash %q", c.Hash)
+	}
+}
+
+func TestStartLabRefusesDatasetChangedOnDisk(t *testing.T) {
+	server, _ := setupTestServer(t)
+	t.Cleanup(server.Close)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	path := filepath.Join(t.TempDir(), "drift.snmprec")
+	if err := os.WriteFile(path, []byte("1.3.6.1.2.1.1.1.0|octetstring|reviewed\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+
+	do := func(method, path, body string, out interface{}) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		if out != nil {
+			json.Unmarshal(raw, out)
+		}
+		return resp.StatusCode, string(raw)
+	}
+
+	var eng Engine
+	do(http.MethodPost, "/engines", fmt.Sprintf(`{"name":"drift","listen_addr":"127.0.0.1","port_start":%d,"port_end":%d,"num_devices":1}`, port, port+1), &eng)
+	var dataset Dataset
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"drift","engine_id":%q,"file_path":%q}`, eng.ID, path), &dataset)
+	var lab Lab
+	do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"drift-lab","engine_id":%q}`, eng.ID), &lab)
+	if code, body := do(http.MethodPost, "/labs/"+lab.ID+"/dataset", fmt.Sprintf(`{"dataset_id":%q}`, dataset.ID), nil); code != http.StatusOK {
+		t.Fatalf("bind status = %d, body=%s", code, body)
+	}
+
+	if err := os.WriteFile(path, []byte("1.3.6.1.2.1.1.1.0|octetstring|edited later\n"), 0o644); err != nil {
+		t.Fatalf("edit dataset: %v", err)
+	}
+	code, body := do(http.MethodPost, "/labs/"+lab.ID+"/start", "", nil)
+	if code != http.StatusConflict || !strings.Contains(body, "changed since it was registered") || !strings.Contains(body, dataset.Hash) {
+		t.Fatalf("start after edit: status = %d, body=%s, want 409 naming the stale hash", code, body)
+	}
+
+	// Binding again accepts the new content
+	if code, body := do(http.MethodPost, "/labs/"+lab.ID+"/dataset", fmt.Sprintf(`{"dataset_id":%q}`, dataset.ID), nil); code != http.StatusOK {
+		t.Fatalf("rebind status = %d, body=%s", code, body)
+	}
+	if code, body := do(http.MethodPost, "/labs/"+lab.ID+"/start", "", nil); code != http.StatusOK {
+		t.Fatalf("start after rebind: status = %d, body=%s", code, body)
+	}
+	do(http.MethodPost, "/labs/"+lab.ID+"/stop", "", nil)
+}
+
+func TestCreateLabWithDatasetServesItOnStart(t *testing.T) {
+	server, _ := setupTestServer(t)
+	t.Cleanup(server.Close)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	path := filepath.Join(t.TempDir(), "linked.snmprec")
+	if err := os.WriteFile(path, []byte("1.3.6.1.2.1.1.1.0|octetstring|linked dataset\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+
+	do := func(method, path, body string, out interface{}) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		if out != nil {
+			json.Unmarshal(raw, out)
+		}
+		return resp.StatusCode, string(raw)
+	}
+
+	var eng Engine
+	do(http.MethodPost, "/engines", fmt.Sprintf(`{"name":"linked","listen_addr":"127.0.0.1","port_start":%d,"port_end":%d,"num_devices":1}`, port, port+1), &eng)
+	var dataset, gone Dataset
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"linked","engine_id":%q,"file_path":%q}`, eng.ID, path), &dataset)
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"gone","engine_id":%q,"file_path":%q}`, eng.ID, path+".gone"), &gone)
+
+	if code, body := do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"bad","engine_id":%q,"dataset_id":"dataset-none"}`, eng.ID), nil); code != http.StatusNotFound {
+		t.Fatalf("create with unknown dataset: status = %d, body=%s, want 404", code, body)
+	}
+	if code, body := do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"bad","engine_id":%q,"dataset_id":%q}`, eng.ID, gone.ID), nil); code != http.StatusBadRequest {
+		t.Fatalf("create with missing file: status = %d, body=%s, want 400", code, body)
+	}
+	var lab Lab
+	if code, body := do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"linked-lab","engine_id":%q,"dataset_id":%q}`, eng.ID, dataset.ID), &lab); code != http.StatusCreated || lab.DatasetID != dataset.ID {
+		t.Fatalf("create: status = %d, body=%s, want 201 with dataset_id %s", code, body, dataset.ID)
+	}
+
+	if code, body := do(http.MethodPost, "/labs/"+lab.ID+"/start", "", nil); code != http.StatusOK {
+		t.Fatalf("start status = %d, body=%s", code, body)
+	}
+	time.Sleep(600 * time.Millisecond)
+	snmp := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := snmp.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer snmp.Conn.Close()
+	pkt, err := snmp.Get([]string{"1.3.6.1.2.1.1.1.0"})
+	if err != nil {
+		t.Fatalf("get sysDescr: %v", err)
+	}
+	if value, _ := pkt.Variables[0].Value.([]byte); string(value) != "linked dataset" {
+		t.Fatalf("sysDescr = %q, want the linked dataset's", value)
+	}
+	do(http.MethodPost, "/labs/"+lab.ID+"/stop", "", nil)
+
+	// Without its file the lab refuses to start rather than serve nothing
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove dataset: %v", err)
+	}
+	code, body := do(http.MethodPost, "/labs/"+lab.ID+"/start", "", nil)
+	if code != http.StatusBadRequest || !strings.Contains(body, "not readable") {
+		t.Fatalf("start without file: status = %d, body=%s, want 400 naming the file", code, body)
+	}
+}
+
+func TestBindLabDatasetReloadsRunningLab(t *testing.T) {
+	server, _ := setupTestServer(t)
+	t.Cleanup(server.Close)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{}
+	for _, name := range []string{"first", "second"} {
+		path := filepath.Join(dir, name+".snmprec")
+		if err := os.WriteFile(path, []byte("1.3.6.1.2.1.1.1.0|octetstring|"+name+" dataset\n"), 0o644); err != nil {
+			t.Fatalf("write dataset: %v", err)
+		}
+		files[name] = path
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	do := func(method, path, body string, out interface{}) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	var eng, other Engine
+	do(http.MethodPost, "/engines", fmt.Sprintf(`{"name":"swap","listen_addr":"127.0.0.1","port_start":%d,"port_end":%d,"num_devices":1}`, port, port+1), &eng)
+	do(http.MethodPost, "/engines", `{"name":"other","listen_addr":"127.0.0.1","port_start":12000,"port_end":12001,"num_devices":1}`, &other)
+	var first, second, foreign, missing Dataset
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"first","engine_id":%q,"file_path":%q}`, eng.ID, files["first"]), &first)
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"second","engine_id":%q,"file_path":%q}`, eng.ID, files["second"]), &second)
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"foreign","engine_id":%q,"file_path":%q}`, other.ID, files["first"]), &foreign)
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"missing","engine_id":%q,"file_path":%q}`, eng.ID, filepath.Join(dir, "none.snmprec")), &missing)
+	var lab Lab
+	do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"swap-lab","engine_id":%q}`, eng.ID), &lab)
+
+	if code := do(http.MethodPost, "/labs/"+lab.ID+"/dataset", fmt.Sprintf(`{"dataset_id":%q}`, first.ID), nil); code != http.StatusOK {
+		t.Fatalf("bind before start status = %d", code)
+	}
+	if code := do(http.MethodPost, "/labs/"+lab.ID+"/start", "", nil); code != http.StatusOK {
+		t.Fatalf("start status = %d", code)
+	}
+	t.Cleanup(func() { do(http.MethodPost, "/labs/"+lab.ID+"/stop", "", nil) })
+	time.Sleep(600 * time.Millisecond)
+
+	snmp := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := snmp.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer snmp.Conn.Close()
+	sysDescr := func() string {
+		t.Helper()
+		pkt, err := snmp.Get([]string{"1.3.6.1.2.1.1.1.0"})
+		if err != nil {
+			t.Fatalf("get sysDescr: %v", err)
+		}
+		value, _ := pkt.Variables[0].Value.([]byte)
+		return string(value)
+	}
+	if got := sysDescr(); got != "first dataset" {
+		t.Fatalf("sysDescr before swap = %q", got)
+	}
+
+	if code := do(http.MethodPost, "/labs/"+lab.ID+"/dataset", fmt.Sprintf(`{"dataset_id":%q}`, second.ID), &lab); code != http.StatusOK {
+		t.Fatalf("swap status = %d", code)
+	}
+	if lab.DatasetID != second.ID {
+		t.Fatalf("lab dataset = %q, want %q", lab.DatasetID, second.ID)
+	}
+	if got := sysDescr(); got != "second dataset" {
+		t.Fatalf("sysDescr after swap = %q", got)
+	}
+
+	if code := do(http.MethodPost, "/labs/"+lab.ID+"/dataset", fmt.Sprintf(`{"dataset_id":%q}`, foreign.ID), nil); code != http.StatusConflict {
+		t.Fatalf("foreign engine dataset status = %d, want %d", code, http.StatusConflict)
+	}
+	if code := do(http.MethodPost, "/labs/"+lab.ID+"/dataset", fmt.Sprintf(`{"dataset_id":%q}`, missing.ID), nil); code != http.StatusBadRequest {
+		t.Fatalf("missing file status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if got := sysDescr(); got != "second dataset" {
+		t.Fatalf("rejected swap changed sysDescr to %q", got)
+	}
+}
+
+func TestGetLabAgentsReportsPerDeviceStats(t *testing.T) {
+	server, _ := setupTestServer(t)
+	t.Cleanup(server.Close)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	dataset := filepath.Join(t.TempDir(), "agents.snmprec")
+	if err := os.WriteFile(dataset, []byte("1.3.6.1.4.1.55555.1.0|integer|1\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	do := func(method, path, body string, out interface{}) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	var eng Engine
+	do(http.MethodPost, "/engines", fmt.Sprintf(`{"name":"agents","listen_addr":"127.0.0.1","port_start":%d,"port_end":%d,"num_devices":2}`, port, port+2), &eng)
+	var ds Dataset
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"agents","engine_id":%q,"file_path":%q}`, eng.ID, dataset), &ds)
+	var lab Lab
+	do(http.MethodPost, "/labs", fmt.Sprintf(`{"name":"agents-lab","engine_id":%q}`, eng.ID), &lab)
+	do(http.MethodPost, "/labs/"+lab.ID+"/dataset", fmt.Sprintf(`{"dataset_id":%q}`, ds.ID), nil)
+
+	if code := do(http.MethodGet, "/labs/"+lab.ID+"/agents", "", nil); code != http.StatusConflict {
+		t.Fatalf("agents of a stopped lab status = %d, want %d", code, http.StatusConflict)
+	}
+	if code := do(http.MethodGet, "/labs/lab-none/agents", "", nil); code != http.StatusNotFound {
+		t.Fatalf("agents of an unknown lab status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := do(http.MethodPost, "/labs/"+lab.ID+"/start", "", nil); code != http.StatusOK {
+		t.Fatalf("start status = %d", code)
+	}
+	t.Cleanup(func() { do(http.MethodPost, "/labs/"+lab.ID+"/stop", "", nil) })
+	time.Sleep(600 * time.Millisecond)
+
+	snmp := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port + 1), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := snmp.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer snmp.Conn.Close()
+	if _, err := snmp.Get([]string{"1.3.6.1.4.1.55555.1.0"}); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	var all []map[string]interface{}
+	if code := do(http.MethodGet, "/labs/"+lab.ID+"/agents", "", &all); code != http.StatusOK {
+		t.Fatalf("agents status = %d", code)
+	}
+	if len(all) != 2 || all[0]["port"] != float64(port) || all[1]["port"] != float64(port+1) {
+		t.Fatalf("agents = %v, want ports %d and %d in order", all, port, port+1)
+	}
+	if all[0]["poll_count"] != float64(0) || all[1]["poll_count"] != float64(1) {
+		t.Fatalf("poll counts = %v and %v, want 0 and 1", all[0]["poll_count"], all[1]["poll_count"])
+	}
+
+	var one []map[string]interface{}
+	if code := do(http.MethodGet, fmt.Sprintf("/labs/%s/agents?port=%d", lab.ID, port+1), "", &one); code != http.StatusOK {
+		t.Fatalf("agents?port status = %d", code)
+	}
+	if len(one) != 1 || one[0]["device_id"] != float64(1) {
+		t.Fatalf("agents?port=%d = %v, want device 1 only", port+1, one)
+	}
+	if code := do(http.MethodGet, fmt.Sprintf("/labs/%s/agents?port=%d", lab.ID, port+2), "", nil); code != http.StatusNotFound {
+		t.Fatalf("agents on a port without a device status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := do(http.MethodGet, "/labs/"+lab.ID+"/agents?port=abc", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid port status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestCreateLabFromProfileGivesDevicesDistinctNames(t *testing.T) {
+	server, rm := setupTestServer(t)
+	t.Cleanup(server.Close)
+	rm.profileDir = t.TempDir()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+	if port+5 > 65535 {
+		t.Skip("no room for five ports above the free port")
+	}
+
+	base := filepath.Join(t.TempDir(), "base.snmprec")
+	if err := os.WriteFile(base, []byte("1.3.6.1.2.1.1.1.0|octetstring|branch router\n1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.1.4.1.8072.3.2.10\n"), 0o644); err != nil {
+		t.Fatalf("write base dataset: %v", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	do := func(method, path, body string, out interface{}) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	var dataset Dataset
+	do(http.MethodPost, "/datasets", fmt.Sprintf(`{"name":"base","file_path":%q}`, base), &dataset)
+
+	if code := do(http.MethodPost, "/labs/from-profile", fmt.Sprintf(`{"base_dataset_id":%q,"devices":2,"port_start":%d,"overrides":[{"device":2}]}`, dataset.ID, port), nil); code != http.StatusBadRequest {
+		t.Fatalf("out-of-range override status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	var created profileResult
+	code := do(http.MethodPost, "/labs/from-profile", fmt.Sprintf(`{
+		"name":"branch","base_dataset_id":%q,"devices":5,"port_start":%d,"sys_name":"edge-{device}",
+		"overrides":[{"device":2,"sys_name":"core-{port}","ip":"10.0.0.2","sys_object_id":"1.3.6.1.4.1.9.1.1"}]
+	}`, dataset.ID, port), &created)
+	if code != http.StatusCreated {
+		t.Fatalf("create from profile status = %d", code)
+	}
+	if created.Lab == nil || created.Engine == nil || created.Dataset == nil || created.Lab.DatasetID != created.Dataset.ID ||
+		created.Engine.NumDevices != 5 || created.Engine.PortEnd != port+5 {
+		t.Fatalf("unexpected profile result: %+v", created)
+	}
+
+	if code := do(http.MethodPost, "/labs/"+created.Lab.ID+"/start", "", nil); code != http.StatusOK {
+		t.Fatalf("start status = %d", code)
+	}
+	t.Cleanup(func() { do(http.MethodPost, "/labs/"+created.Lab.ID+"/stop", "", nil) })
+	time.Sleep(600 * time.Millisecond)
+
+	for device := 0; device < 5; device++ {
+		snmp := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port + device), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+		if err := snmp.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		pkt, err := snmp.Get([]string{"1.3.6.1.2.1.1.5.0", "1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.2.0", "1.3.6.1.2.1.4.20.1.1.10.0.0.2"})
+		snmp.Conn.Close()
+		if err != nil {
+			t.Fatalf("device %d: get: %v", device, err)
+		}
+		wantName := fmt.Sprintf("edge-%d", device)
+		if device == 2 {
+			wantName = fmt.Sprintf("core-%d", port+2)
+		}
+		if got, _ := pkt.Variables[0].Value.([]byte); string(got) != wantName {
+			t.Fatalf("device %d: sysName = %q, want %q", device, got, wantName)
+		}
+		if got, _ := pkt.Variables[1].Value.([]byte); string(got) != "branch router" {
+			t.Fatalf("device %d: sysDescr = %q, want the base dataset's", device, got)
+		}
+		if device == 2 {
+			if pkt.Variables[2].Value != ".1.3.6.1.4.1.9.1.1" || pkt.Variables[3].Value != "10.0.0.2" {
+				t.Fatalf("device 2 overrides not served: %+v", pkt.Variables)
+			}
+		} else if pkt.Variables[2].Value != ".1.3.6.1.4.1.8072.3.2.10" {
+			t.Fatalf("device %d: sysObjectID = %v, want the base dataset's", device, pkt.Variables[2].Value)
+		}
+	}
+}
+
+func TestListLabsPaginatesAndFiltersByStatus(t *testing.T) {
+	server, rm := setupTestServer(t)
+	defer server.Close()
+
+	// lab-b and lab-c share a creation time, so the ID decides their order
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	rm.mu.Lock()
+	for id, lab := range map[string]*Lab{
+		"lab-d": {Status: "stopped", CreatedAt: base.Add(3 * time.Minute)},
+		"lab-c": {Status: "running", CreatedAt: base.Add(time.Minute)},
+		"lab-a": {Status: "stopped", CreatedAt: base},
+		"lab-b": {Status: "running", CreatedAt: base.Add(time.Minute)},
+		"lab-e": {Status: "stopped", CreatedAt: base.Add(4 * time.Minute)},
+	} {
+		lab.ID, lab.Name, lab.EngineID = id, id, "engine-1"
+		rm.labs[id] = lab
+	}
+	rm.mu.Unlock()
+
+	list := func(query string) (int, Page[Lab], string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/labs" + query)
+		if err != nil {
+			t.Fatalf("list labs: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var page Page[Lab]
+		if resp.StatusCode == http.StatusOK {
+			if err := json.Unmarshal(data, &page); err != nil {
+				t.Fatalf("decode %s: %v", data, err)
+			}
+		}
+		var ids []string
+		for _, lab := range page.Items {
+			ids = append(ids, lab.ID)
+		}
+		return resp.StatusCode, page, strings.Join(ids, ",")
+	}
+
+	if status, page, ids := list(""); status != http.StatusOK || ids != "lab-a,lab-b,lab-c,lab-d,lab-e" || page.Total != 5 || page.Limit != defaultListLimit || page.Offset != 0 {
+		t.Fatalf("default page: status %d, ids %s, page %+v", status, ids, page)
+	}
+	if _, page, ids := list("?limit=2&offset=1"); ids != "lab-b,lab-c" || page.Total != 5 || page.Limit != 2 || page.Offset != 1 {
+		t.Fatalf("limit=2&offset=1: ids %s, page %+v", ids, page)
+	}
+	if _, page, ids := list("?offset=9"); ids != "" || page.Items == nil || page.Total != 5 {
+		t.Fatalf("offset past the end: ids %s, page %+v", ids, page)
+	}
+	if _, page, ids := list("?status=running&limit=1&offset=1"); ids != "lab-c" || page.Total != 2 {
+		t.Fatalf("status=running: ids %s, page %+v", ids, page)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=abc", "?limit=1001", "?offset=-1", "?offset=x", "?status=paused"} {
+		if status, _, _ := list(query); status != http.StatusBadRequest {
+			t.Errorf("GET /labs%s status = %d, want 400", query, status)
+		}
+	}
+	resp, err := http.Get(server.URL + "/engines?limit=-5")
+	if err != nil {
+		t.Fatalf("list engines: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /engines?limit=-5 status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestListEnginesGzipsLargeResponses(t *testing.T) {
+	server, _ := setupTestServer(t)
+	defer server.Close()
+
+	for i := 0; i < 200; i++ {
+		resp, err := http.Post(server.URL+"/engines", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"name":"engine-%d","listen_addr":"127.0.0.1","port_start":20000,"port_end":20010,"num_devices":10}`, i)))
+		if err != nil {
+			t.Fatalf("create engine: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	get := func(acceptGzip bool) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/engines?limit=200", nil)
+		if acceptGzip {
+			// Set explicitly, so the transport leaves the body compressed
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+		resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+		if err != nil {
+			t.Fatalf("list engines: %v", err)
+		}
+		return resp
+	}
+
+	resp := get(true)
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", resp.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	var engines Page[Engine]
+	if err := json.NewDecoder(zr).Decode(&engines); err != nil {
+		t.Fatalf("decode gzipped list: %v", err)
+	}
+	if len(engines.Items) != 200 {
+		t.Fatalf("got %d engines, want 200", len(engines.Items))
+	}
+
+	plain := get(false)
+	plain.Body.Close()
+	if plain.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("response without Accept-Encoding is encoded as %q", plain.Header.Get("Content-Encoding"))
+	}
+
+	health, err := http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("health: %v", err)
+	}
+	health.Body.Close()
+	if health.Uncompressed {
+		t.Fatal("small /health response was compressed")
+	}
+}
+
+func TestRouterAnswersOptionsAndSetsAllowOn405(t *testing.T) {
+	server, _ := setupTestServer(t)
+	defer server.Close()
+
+	for _, tc := range []struct {
+		method, path string
+		wantStatus   int
+		wantAllow    string
+	}{
+		{http.MethodPut, "/labs", http.StatusMethodNotAllowed, "GET, POST, OPTIONS"},
+		{http.MethodOptions, "/labs", http.StatusNoContent, "GET, POST, OPTIONS"},
+		{http.MethodPost, "/engines/engine-1", http.StatusMethodNotAllowed, "GET, PUT, PATCH, DELETE, OPTIONS"},
+		{http.MethodGet, "/labs/lab-1/start", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{http.MethodOptions, "/labs/lab-1/logs", http.StatusNoContent, "GET, OPTIONS"},
+	} {
+		req, _ := http.NewRequest(tc.method, server.URL+tc.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantStatus || resp.Header.Get("Allow") != tc.wantAllow {
+			t.Fatalf("%s %s: status %d Allow %q, want %d %q", tc.method, tc.path, resp.StatusCode, resp.Header.Get("Allow"), tc.wantStatus, tc.wantAllow)
+		}
+	}
+}
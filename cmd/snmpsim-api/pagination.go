@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// List endpoints return defaultListLimit items unless ?limit= asks for up to
+// maxListLimit
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// Page is the body of a list endpoint: the items selected by limit and
+// offset, and the total count before paging
+type Page[T any] struct {
+	Items  []T `json:"items" yaml:"items"`
+	Total  int `json:"total" yaml:"total"`
+	Limit  int `json:"limit" yaml:"limit"`
+	Offset int `json:"offset" yaml:"offset"`
+}
+
+// paging is the ?limit= and ?offset= of a list request
+type paging struct {
+	limit  int
+	offset int
+}
+
+// parsePaging reads ?limit= (1 to maxListLimit, default defaultListLimit)
+// and ?offset= (0 or more, default 0)
+func parsePaging(r *http.Request) (paging, error) {
+	p := paging{limit: defaultListLimit}
+	query := r.URL.Query()
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			return paging{}, fmt.Errorf("invalid limit %q: want an integer from 1 to %d", v, maxListLimit)
+		}
+		p.limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return paging{}, fmt.Errorf("invalid offset %q: want a non-negative integer", v)
+		}
+		p.offset = n
+	}
+	return p, nil
+}
+
+// paginate orders items oldest first, by creation time and then ID, so pages
+// are stable across requests though the resources live in maps, and cuts the
+// page p selects
+func paginate[T any](items []T, p paging, key func(T) (time.Time, string)) Page[T] {
+	sort.Slice(items, func(i, j int) bool {
+		ti, idi := key(items[i])
+		tj, idj := key(items[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return idi < idj
+	})
+	page := Page[T]{Items: []T{}, Total: len(items), Limit: p.limit, Offset: p.offset}
+	if p.offset < len(items) {
+		end := min(p.offset+p.limit, len(items))
+		page.Items = items[p.offset:end]
+	}
+	return page
+}
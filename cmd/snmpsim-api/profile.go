@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpbody"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+)
+
+// OIDs a lab profile can set per device
+const (
+	sysNameOID     = "1.3.6.1.2.1.1.5.0"
+	sysObjectIDOID = "1.3.6.1.2.1.1.2.0"
+	ipAdEntAddrOID = "1.3.6.1.2.1.4.20.1.1" // indexed by the address itself
+)
+
+// LabProfile describes a multi-device lab generated from one base dataset.
+// SysName is a pattern applied to every device; {device} is replaced by the
+// device ID (0-based) and {port} by its port. Overrides replace the pattern,
+// and add an IP address or sysObjectID, for single devices.
+type LabProfile struct {
+	Name          string           `json:"name" yaml:"name"`
+	BaseDatasetID string           `json:"base_dataset_id" yaml:"base_dataset_id"`
+	Devices       int              `json:"devices" yaml:"devices"`
+	ListenAddr    string           `json:"listen_addr" yaml:"listen_addr"`
+	PortStart     int              `json:"port_start" yaml:"port_start"`
+	SysName       string           `json:"sys_name" yaml:"sys_name"`
+	SysObjectID   string           `json:"sys_object_id" yaml:"sys_object_id"`
+	Overrides     []DeviceOverride `json:"overrides" yaml:"overrides"`
+}
+
+// DeviceOverride sets the identity of one device in a LabProfile
+type DeviceOverride struct {
+	Device      int    `json:"device" yaml:"device"`
+	SysName     string `json:"sys_name" yaml:"sys_name"`
+	IP          string `json:"ip" yaml:"ip"`
+	SysObjectID string `json:"sys_object_id" yaml:"sys_object_id"`
+}
+
+// profileResult is the response of POST /labs/from-profile
+type profileResult struct {
+	Lab     *Lab     `json:"lab" yaml:"lab"`
+	Engine  *Engine  `json:"engine" yaml:"engine"`
+	Dataset *Dataset `json:"dataset" yaml:"dataset"`
+}
+
+func (p *LabProfile) validate() error {
+	if p.BaseDatasetID == "" {
+		return fmt.Errorf("base_dataset_id is required")
+	}
+	if p.Devices <= 0 {
+		return fmt.Errorf("devices must be positive")
+	}
+	if p.PortStart <= 0 || p.PortStart+p.Devices > 65536 {
+		return fmt.Errorf("port_start must leave room for %d devices below 65536", p.Devices)
+	}
+	if p.SysObjectID != "" {
+		if _, err := store.ParseOIDValue("objectidentifier", p.SysObjectID); err != nil {
+			return fmt.Errorf("sys_object_id: %w", err)
+		}
+	}
+	seen := make(map[int]bool, len(p.Overrides))
+	for i, o := range p.Overrides {
+		if o.Device < 0 || o.Device >= p.Devices {
+			return fmt.Errorf("override %d: device %d is outside 0-%d", i, o.Device, p.Devices-1)
+		}
+		if seen[o.Device] {
+			return fmt.Errorf("override %d: device %d is overridden twice", i, o.Device)
+		}
+		seen[o.Device] = true
+		if o.IP != "" {
+			if ip := net.ParseIP(o.IP); ip == nil || ip.To4() == nil {
+				return fmt.Errorf("override %d: ip %q is not an IPv4 address", i, o.IP)
+			}
+		}
+		if o.SysObjectID != "" {
+			if _, err := store.ParseOIDValue("objectidentifier", o.SysObjectID); err != nil {
+				return fmt.Errorf("override %d: sys_object_id: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// deviceLines returns the @Device-N snmprec lines giving each device its
+// identity. The simulator names device N "Device-N", which the mappings key on.
+func (p *LabProfile) deviceLines() []string {
+	overrides := make(map[int]DeviceOverride, len(p.Overrides))
+	for _, o := range p.Overrides {
+		overrides[o.Device] = o
+	}
+
+	var lines []string
+	for device := 0; device < p.Devices; device++ {
+		o := overrides[device]
+		route := "@Device-" + strconv.Itoa(device)
+		expand := strings.NewReplacer("{device}", strconv.Itoa(device), "{port}", strconv.Itoa(p.PortStart+device))
+
+		if name := firstNonEmpty(o.SysName, p.SysName); name != "" {
+			lines = append(lines, sysNameOID+"|octetstring|"+expand.Replace(name)+route)
+		}
+		if oid := firstNonEmpty(o.SysObjectID, p.SysObjectID); oid != "" {
+			lines = append(lines, sysObjectIDOID+"|objectidentifier|"+strings.TrimPrefix(oid, ".")+route)
+		}
+		if o.IP != "" {
+			lines = append(lines, ipAdEntAddrOID+"."+o.IP+"|ipaddress|"+o.IP+route)
+		}
+	}
+	return lines
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// writeProfileDataset writes a dataset that includes base and adds the
+// profile's per-device lines after it, so they take precedence
+func (rm *ResourceManager) writeProfileDataset(labID, base string, p *LabProfile) (string, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(rm.profileDir, 0o755); err != nil {
+		return "", fmt.Errorf("create profile directory: %w", err)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated for %s from profile %q\n#include %s\n", labID, p.Name, absBase)
+	for _, line := range p.deviceLines() {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	path := filepath.Join(rm.profileDir, labID+".snmprec")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return "", fmt.Errorf("write profile dataset: %w", err)
+	}
+	return path, nil
+}
+
+// CreateLabFromProfile serves POST /labs/from-profile: create the engine,
+// the generated dataset and the lab of a LabProfile in one call. The lab is
+// left stopped.
+func (rm *ResourceManager) CreateLabFromProfile(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	defer func() {
+		RecordLatency("POST", "labs", time.Since(startTime).Seconds())
+	}()
+
+	var profile LabProfile
+	if err := rm.decodeBody(r, &profile); err != nil {
+		RecordFailure("invalid_profile_payload", "labs")
+		http.Error(w, err.Error(), httpbody.ErrorStatus(err))
+		return
+	}
+	if err := profile.validate(); err != nil {
+		RecordFailure("invalid_profile_payload", "labs")
+		http.Error(w, fmt.Sprintf("invalid profile: %v", err), http.StatusBadRequest)
+		return
+	}
+	if profile.ListenAddr == "" {
+		profile.ListenAddr = "127.0.0.1"
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	base, ok := rm.datasets[profile.BaseDatasetID]
+	if !ok {
+		RecordFailure("dataset_not_found", "labs")
+		http.Error(w, "base dataset not found", http.StatusNotFound)
+		return
+	}
+	if info, err := os.Stat(base.FilePath); err != nil || info.IsDir() {
+		RecordFailure("dataset_file_missing", "labs")
+		http.Error(w, fmt.Sprintf("base dataset file %q is not readable", base.FilePath), http.StatusBadRequest)
+		return
+	}
+
+	engineID := fmt.Sprintf("engine-%d", rm.nextID)
+	datasetID := fmt.Sprintf("dataset-%d", rm.nextID+1)
+	labID := fmt.Sprintf("lab-%d", rm.nextID+2)
+	path, err := rm.writeProfileDataset(labID, base.FilePath, &profile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rm.nextID += 3
+
+	now := time.Now()
+	eng := &Engine{
+		ID:         engineID,
+		Name:       profile.Name,
+		ListenAddr: profile.ListenAddr,
+		PortStart:  profile.PortStart,
+		PortEnd:    profile.PortStart + profile.Devices,
+		NumDevices: profile.Devices,
+		CreatedAt:  now,
+	}
+	dataset := &Dataset{
+		ID:        datasetID,
+		Name:      profile.Name,
+		EngineID:  engineID,
+		FilePath:  path,
+		CreatedAt: now,
+	}
+	lab := &Lab{
+		ID:        labID,
+		Name:      profile.Name,
+		EngineID:  engineID,
+		DatasetID: datasetID,
+		Status:    "stopped",
+		CreatedAt: now,
+	}
+	rm.engines[engineID] = eng
+	rm.datasets[datasetID] = dataset
+	rm.labs[labID] = lab
+	rm.saveStateLocked()
+
+	RecordLabCreated()
+	RecordPacket("POST", labID)
+	UpdateActiveAgents(labID, 0)
+
+	writeResponse(w, r, http.StatusCreated, profileResult{Lab: lab, Engine: eng, Dataset: dataset})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// persistedState is the --state-file document: every CRUD resource and the
+// ID counter, so IDs handed out before a restart are never reused
+type persistedState struct {
+	NextID    int                  `json:"next_id"`
+	Labs      map[string]*Lab      `json:"labs"`
+	Engines   map[string]*Engine   `json:"engines"`
+	Endpoints map[string]*Endpoint `json:"endpoints"`
+	Users     map[string]*User     `json:"users"`
+	Datasets  map[string]*Dataset  `json:"datasets"`
+}
+
+// loadState restores the resources saved in rm.stateFile. A missing file is
+// a first start and leaves rm empty. Labs come back stopped: their
+// simulators did not survive the restart.
+func (rm *ResourceManager) loadState() error {
+	data, err := os.ReadFile(rm.stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read state file: %w", err)
+	}
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("parse state file %s: %w", rm.stateFile, err)
+	}
+
+	rm.nextID = state.NextID
+	for id, lab := range state.Labs {
+		lab.Status = "stopped"
+		rm.labs[id] = lab
+	}
+	for id, eng := range state.Engines {
+		rm.engines[id] = eng
+	}
+	for id, endpoint := range state.Endpoints {
+		rm.endpoints[id] = endpoint
+	}
+	for id, user := range state.Users {
+		rm.users[id] = user
+	}
+	for id, dataset := range state.Datasets {
+		rm.datasets[id] = dataset
+	}
+	return nil
+}
+
+// saveStateLocked writes the resources to rm.stateFile, if one is set, after
+// a mutation. rm.mu must be held for writing; that serializes the saves, and
+// each goes to a temporary file renamed over the old one, so a crash mid-write
+// leaves the previous state intact. Failures are logged: the change already
+// applied in memory stands.
+func (rm *ResourceManager) saveStateLocked() {
+	if rm.stateFile == "" {
+		return
+	}
+	if err := rm.writeStateLocked(); err != nil {
+		log.Printf("failed to save state to %s: %v", rm.stateFile, err)
+	}
+}
+
+func (rm *ResourceManager) writeStateLocked() error {
+	data, err := json.MarshalIndent(persistedState{
+		NextID:    rm.nextID,
+		Labs:      rm.labs,
+		Engines:   rm.engines,
+		Endpoints: rm.endpoints,
+		Users:     rm.users,
+		Datasets:  rm.datasets,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(rm.stateFile), filepath.Base(rm.stateFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), rm.stateFile)
+}
@@ -3,15 +3,20 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/agent"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/api"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/engine"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/traps"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/webui"
@@ -33,17 +38,47 @@ func (f *stringSliceFlag) Set(value string) error {
 	return nil
 }
 
+// v3UserFlag collects -v3-extra-user specs; unlike stringSliceFlag it does
+// not split on commas, which passphrases may contain
+type v3UserFlag []v3.User
+
+func (f *v3UserFlag) String() string {
+	names := make([]string, len(*f))
+	for i, u := range *f {
+		names[i] = u.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *v3UserFlag) Set(value string) error {
+	u, err := v3.ParseUser(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, u)
+	return nil
+}
+
 func main() {
 	// Configuration flags
 	portStart := flag.Int("port-start", 20000, "Starting port for UDP listeners")
 	portEnd := flag.Int("port-end", 30000, "Ending port for UDP listeners")
 	devices := flag.Int("devices", 100, "Number of virtual devices to simulate")
-	snmprecFile := flag.String("snmprec", "", "Path to .snmprec file for OID templates")
+	maxDevices := flag.Int("max-devices", engine.DefaultMaxDevices, "Refuse to start with more devices than this (0 = no cap beyond the port range)")
+	snmprecFile := flag.String("snmprec", "", "Path to .snmprec file for OID templates, - for stdin, or an http(s) URL")
+	noDefaultOIDs := flag.Bool("no-default-oids", false, "Serve only the OIDs of the dataset files, without the built-in default OIDs")
+	deriveIfNumber := flag.Bool("derive-ifnumber", false, "Set ifNumber to the number of ifTable rows each dataset serves, overriding its static value")
+	replayDir := flag.String("replay-dir", "", "Directory of timestamped .snmprec captures to serve in sequence instead of -snmprec")
+	replaySpeed := flag.Float64("replay-speed", 1, "Replay speed multiplier; 60 plays a minute of captures per second")
+	replayInterval := flag.Duration("replay-interval", 0, "Spacing of the replay captures in name order, for files without timestamps in their names")
+	replayLoop := flag.Bool("replay-loop", false, "Start the replay over after the last capture instead of holding on it")
 	routeFile := flag.String("route-file", "", "Path to routes.yaml for dataset routing")
 	variationFile := flag.String("variation-file", "", "Path to variations.yaml for OID variation chains")
 	listenAddr := flag.String("listen", "0.0.0.0", "Listen address")
 	listenAddr6 := flag.String("listen6", "", "Optional IPv6 listen address (e.g. :: or ::1)")
+	dualStack := flag.Bool("dual-stack", false, "Serve IPv4 and IPv6 from one socket per port on -listen6 (IPV6_V6ONLY off) instead of separate listeners")
 	v3Enabled := flag.Bool("v3-enabled", true, "Enable SNMPv3 support")
+	v3Only := flag.Bool("v3-only", false, "Answer only SNMPv3; drop SNMPv1/v2c requests without a response")
 	engineID := flag.String("engine-id", "", "SNMPv3 authoritative engine ID (hex or plain text)")
 	v3User := flag.String("v3-user", "simuser", "SNMPv3 username")
 	legacyV3User := flag.String("snmpv3-user", "", "Deprecated alias of --v3-user")
@@ -51,18 +86,55 @@ func main() {
 	v3AuthKey := flag.String("v3-auth-key", "", "SNMPv3 auth passphrase")
 	v3Priv := flag.String("v3-priv", "", "SNMPv3 priv protocol: DES,3DES,AES128,AES192,AES256")
 	v3PrivKey := flag.String("v3-priv-key", "", "SNMPv3 privacy passphrase")
-	trapVersion := flag.String("trap-version", "v2c", "Trap/Inform version: v2c|v3")
-	trapCommunity := flag.String("trap-community", "public", "Trap community for v2c notifications")
+	v3TimeWindow := flag.Int("v3-time-window", v3.DefaultTimeWindowSeconds, "Seconds a SNMPv3 request's engine time may differ from the agent's before notInTimeWindow (0 uses the default)")
+	trapVersion := flag.String("trap-version", "v2c", "Trap/Inform version: v1|v2c|v3 (v1 sends traps only)")
+	trapCommunity := flag.String("trap-community", "public", "Trap community for v1/v2c notifications")
 	trapOnVariation := flag.Bool("trap-on-variation", false, "Emit traps on variation events")
 	trapInform := flag.Bool("trap-inform", false, "Emit informs instead of traps")
+	trapOnStart := flag.Bool("trap-on-start", false, "Send coldStart for every agent on start and warmStart on dataset reload")
+	trapHeartbeat := flag.Duration("trap-heartbeat", 0, "Interval of heartbeat traps for receiver liveness checks, e.g. 30s (0 disables)")
+	trapDefsFile := flag.String("trap-defs", "", "YAML trap definitions mapping SETs on specific OIDs to specific traps")
 	webPort := flag.String("web-port", "8080", "Port for web UI API server")
+	tlsCert := flag.String("tls-cert", os.Getenv("SNMPSIM_UI_TLS_CERT"), "TLS certificate file for the web UI (enables HTTPS)")
+	tlsKey := flag.String("tls-key", os.Getenv("SNMPSIM_UI_TLS_KEY"), "TLS private key file for the web UI")
+	apiTokensFile := flag.String("api-tokens-file", os.Getenv("SNMPSIM_UI_API_TOKENS_FILE"), "JSON file of scoped web UI API tokens, updated by /api/tokens")
+	maxRepetitions := flag.Int("max-repetitions", agent.DefaultMaxRepetitions, "Cap on GETBULK max-repetitions honored per request")
+	sysDescr := flag.String("sys-descr", "", "sysDescr served by every device instead of the dataset's")
+	sysObjectID := flag.String("sys-object-id", "", "sysObjectID served by every device instead of the dataset's, e.g. 1.3.6.1.4.1.9.1.2494")
+	sysContact := flag.String("sys-contact", "", "sysContact served by every device instead of the dataset's")
+	maxResponseSize := flag.Int("max-response-size", agent.DefaultMaxResponseSize, "Largest GETBULK response in bytes; fewer varbinds are returned to stay under it")
+	bindAttempts := flag.Int("bind-attempts", engine.DefaultBindAttempts, "Attempts to bind each UDP port while the address is still in use")
+	bindBackoff := flag.Duration("bind-backoff", engine.DefaultBindBackoff, "Wait before the first bind retry; doubles after each retry")
+	transport := flag.String("transport", engine.TransportUDP, "SNMP transport of every agent port: udp, tcp (RFC 3430) or both")
+	readWorkers := flag.Int("read-workers", engine.DefaultReadWorkers, "Goroutines reading and answering each UDP port, so a slow request does not block the ones behind it")
+	captureRequests := flag.Int("capture-requests", 0, "Keep the last N SNMP requests per agent for GET /api/agents/{port}/requests (0 = off)")
+	oidMetricsDepth := flag.Int("oid-metrics-depth", 0, "Count OID lookups on /metrics by their first N arcs, e.g. 8 for per-table counts (0 = off)")
+	debugOIDs := flag.Bool("debug-oids", false, "Answer GET on the echo OID "+agent.EchoOID+" with request metadata")
+	bootOffsetRange := flag.String("boot-offset-range", "", "Spread device sysUpTime over MIN-MAX at start (e.g. 10m-72h)")
+	setUnknownOIDError := flag.String("set-unknown-oid-error", "noCreation", "SET error for OIDs a device does not hold: noCreation|notWritable")
+	testerBackend := flag.String("tester-backend", webui.BackendAuto, "Web UI SNMP tester backend: auto (net-snmp tools when installed, else native), native (gosnmp) or netsnmp")
+	pprofAddr := flag.String("pprof-addr", "", "Serve net/http/pprof on this address (e.g. 127.0.0.1:6060); disabled when empty")
 
 	var trapTargets stringSliceFlag
 	var trapCronSpecs stringSliceFlag
 	var trapSetOIDs stringSliceFlag
-	flag.Var(&trapTargets, "trap-target", "Trap target host:port (repeatable)")
+	var trapVarbinds stringSliceFlag
+	var deviceUptimes stringSliceFlag
+	var baseLatencies stringSliceFlag
+	var includeOIDs stringSliceFlag
+	var excludeOIDs stringSliceFlag
+	var writableOIDs stringSliceFlag
+	var v3ExtraUsers v3UserFlag
+	flag.Var(&trapTargets, "trap-target", "Trap target host:port[;timeout=D][;retries=N] (repeatable)")
 	flag.Var(&trapCronSpecs, "trap-cron", "Cron spec for periodic trap emission (repeatable)")
 	flag.Var(&trapSetOIDs, "trap-on-set-oid", "Emit trap on SET to OID (repeatable)")
+	flag.Var(&trapVarbinds, "trap-varbind", "Extra trap varbind OID|TYPE|VALUE; VALUE may use ${oid:OID} and $index (repeatable)")
+	flag.Var(&baseLatencies, "base-latency", "Fixed delay added to every response as DURATION, or START-END=DURATION for a port range (repeatable)")
+	flag.Var(&includeOIDs, "include-oid", "Only serve OIDs under this prefix (repeatable or comma-separated)")
+	flag.Var(&excludeOIDs, "exclude-oid", "Never serve OIDs under this prefix (repeatable or comma-separated)")
+	flag.Var(&writableOIDs, "writable-oid", "Accept SETs on OIDs under this prefix (repeatable or comma-separated)")
+	flag.Var(&v3ExtraUsers, "v3-extra-user", "Additional SNMPv3 user name[;auth=P;auth-key=K][;priv=P;priv-key=K] (repeatable)")
+	flag.Var(&deviceUptimes, "device-uptime", "Initial sysUpTime for one device as ID=DURATION, e.g. 0=72h (repeatable)")
 	flag.Parse()
 
 	// Check file descriptors
@@ -79,32 +151,54 @@ func main() {
 
 	v3Config := v3.Config{
 		Enabled:  *v3Enabled,
+		Only:     *v3Only,
 		EngineID: parsedEngineID,
 		Username: *v3User,
 		Auth:     v3.AuthProtocol(strings.ToUpper(*v3Auth)),
 		AuthKey:  *v3AuthKey,
 		Priv:     v3.PrivProtocol(strings.ToUpper(*v3Priv)),
 		PrivKey:  *v3PrivKey,
-	}
 
-	if v3Config.Enabled {
-		if err := v3Config.Validate(); err != nil {
-			log.Fatalf("Invalid SNMPv3 config: %v", err)
-		}
+		TimeWindowSeconds: *v3TimeWindow,
+		Users:             v3ExtraUsers,
+	}
+	if err := v3Config.Validate(); err != nil {
+		log.Fatalf("Invalid SNMPv3 config: %v", err)
 	}
 
 	log.Printf("Starting SNMP Simulator")
 	log.Printf("SNMP Port range: %d-%d", *portStart, *portEnd)
 	log.Printf("Number of devices: %d", *devices)
 	if v3Config.Enabled {
-		log.Printf("SNMPv3 enabled: user=%s auth=%s priv=%s", v3Config.Username, v3Config.Auth, v3Config.Priv)
+		log.Printf("SNMPv3 enabled: user=%s auth=%s priv=%s v3-only=%t", v3Config.Username, v3Config.Auth, v3Config.Priv, v3Config.Only)
+		for _, u := range v3Config.Users {
+			log.Printf("SNMPv3 user: %s auth=%s priv=%s", u.Name, u.Auth, u.Priv)
+		}
 	} else {
 		log.Printf("SNMPv3 enabled: false")
 	}
-	log.Printf("Web UI port: %s (http://localhost:%s)", *webPort, *webPort)
+	webScheme := "http"
+	if *tlsCert != "" {
+		webScheme = "https"
+	}
+	log.Printf("Web UI port: %s (%s://localhost:%s)", *webPort, webScheme, *webPort)
+
+	var replaySeries *store.ReplaySeries
+	if *replayDir != "" {
+		if *snmprecFile != "" {
+			log.Fatalf("--replay-dir and --snmprec are mutually exclusive")
+		}
+		replaySeries, err = store.LoadReplaySeries(*replayDir, *replayInterval)
+		if err != nil {
+			log.Fatalf("Invalid --replay-dir: %v", err)
+		}
+		*snmprecFile = replaySeries.Snapshots[0].Path
+		log.Printf("Replay: %d captures over %s at %gx speed", len(replaySeries.Snapshots), replaySeries.Duration(), *replaySpeed)
+	}
 
 	// Create simulator
-	simulator, err := engine.NewSimulator(
+	engine.MaxDevices = *maxDevices
+	simulator, err := engine.NewSimulatorWithOptions(
 		*listenAddr,
 		*portStart,
 		*portEnd,
@@ -113,6 +207,7 @@ func main() {
 		*routeFile,
 		*variationFile,
 		v3Config,
+		store.LoadOptions{NoDefaultOIDs: *noDefaultOIDs, DeriveIfNumber: *deriveIfNumber},
 	)
 	if err != nil {
 		log.Fatalf("Failed to create simulator: %v", err)
@@ -121,8 +216,112 @@ func main() {
 		simulator.SetListenAddr6(*listenAddr6)
 		log.Printf("SNMP IPv6 listen enabled: %s", *listenAddr6)
 	}
+	if *dualStack {
+		if strings.TrimSpace(*listenAddr6) == "" {
+			log.Fatalf("--dual-stack needs --listen6 (e.g. --listen6 ::)")
+		}
+		simulator.SetDualStack(true)
+		log.Printf("SNMP dual-stack: IPv4 served on the IPv6 sockets, --listen ignored")
+	}
+
+	if err := simulator.SetMaxRepetitions(*maxRepetitions); err != nil {
+		log.Fatalf("Invalid --max-repetitions: %v", err)
+	}
+	if err := simulator.SetMaxResponseSize(*maxResponseSize); err != nil {
+		log.Fatalf("Invalid --max-response-size: %v", err)
+	}
+	if err := simulator.SetSystemInfo(agent.SystemInfo{SysDescr: *sysDescr, SysObjectID: *sysObjectID, SysContact: *sysContact}); err != nil {
+		log.Fatalf("Invalid --sys-object-id: %v", err)
+	}
+
+	if len(writableOIDs) > 0 {
+		if err := simulator.SetWritableOIDs(writableOIDs); err != nil {
+			log.Fatalf("Invalid --writable-oid: %v", err)
+		}
+	}
+	unknownSetErr, err := agent.ParseSetError(*setUnknownOIDError)
+	if err != nil {
+		log.Fatalf("Invalid --set-unknown-oid-error: %v", err)
+	}
+	if err := simulator.SetUnknownOIDSetError(unknownSetErr); err != nil {
+		log.Fatalf("Invalid --set-unknown-oid-error: %v", err)
+	}
+
+	if err := simulator.SetBindRetry(*bindAttempts, *bindBackoff); err != nil {
+		log.Fatalf("Invalid bind retry settings: %v", err)
+	}
+	if err := simulator.SetTransport(*transport); err != nil {
+		log.Fatalf("Invalid --transport: %v", err)
+	}
+	if err := simulator.SetReadWorkers(*readWorkers); err != nil {
+		log.Fatalf("Invalid --read-workers: %v", err)
+	}
+
+	if len(baseLatencies) > 0 {
+		rules, err := parseBaseLatencies(baseLatencies)
+		if err != nil {
+			log.Fatalf("Invalid --base-latency: %v", err)
+		}
+		if err := simulator.SetBaseLatency(rules); err != nil {
+			log.Fatalf("Invalid --base-latency: %v", err)
+		}
+	}
+
+	if len(includeOIDs) > 0 || len(excludeOIDs) > 0 {
+		filter, err := store.NewOIDFilter(includeOIDs, excludeOIDs)
+		if err != nil {
+			log.Fatalf("Invalid OID filter: %v", err)
+		}
+		if err := simulator.SetOIDFilter(filter); err != nil {
+			log.Fatalf("Failed to apply OID filter: %v", err)
+		}
+	}
+	if replaySeries != nil {
+		if err := simulator.SetReplay(replaySeries, *replaySpeed, *replayLoop); err != nil {
+			log.Fatalf("Invalid replay settings: %v", err)
+		}
+	}
+
+	if *oidMetricsDepth > 0 {
+		if err := simulator.EnableOIDMetrics(*oidMetricsDepth); err != nil {
+			log.Fatalf("Invalid --oid-metrics-depth: %v", err)
+		}
+		log.Printf("Per-OID metrics: lookups counted by the first %d arcs", *oidMetricsDepth)
+	}
+	if *captureRequests > 0 {
+		simulator.SetRequestCapture(*captureRequests)
+	}
+	if *debugOIDs {
+		simulator.SetDebugOIDs(true)
+		log.Printf("Debug OIDs enabled: GET %s echoes request metadata", agent.EchoOID)
+	}
+
+	if *bootOffsetRange != "" || len(deviceUptimes) > 0 {
+		minOffset, maxOffset, perDevice, err := parseBootOffsets(*bootOffsetRange, deviceUptimes)
+		if err != nil {
+			log.Fatalf("Invalid boot offsets: %v", err)
+		}
+		if err := simulator.SetBootOffsets(minOffset, maxOffset, perDevice); err != nil {
+			log.Fatalf("Invalid boot offsets: %v", err)
+		}
+	}
 
 	if len(trapTargets) > 0 {
+		varbinds := make([]traps.VarbindTemplate, 0, len(trapVarbinds))
+		for _, spec := range trapVarbinds {
+			tmpl, err := traps.ParseVarbindTemplate(spec)
+			if err != nil {
+				log.Fatalf("Invalid trap config: %v", err)
+			}
+			varbinds = append(varbinds, tmpl)
+		}
+		var defs traps.TrapDefs
+		if *trapDefsFile != "" {
+			defs, err = traps.LoadTrapDefs(*trapDefsFile)
+			if err != nil {
+				log.Fatalf("Invalid trap config: %v", err)
+			}
+		}
 		trapConfig := traps.Config{
 			Targets:     trapTargets,
 			Version:     *trapVersion,
@@ -135,7 +334,11 @@ func main() {
 			CronSpecs:   trapCronSpecs,
 			OnVariation: *trapOnVariation,
 			OnSetOIDs:   trapSetOIDs,
+			SetTraps:    defs.OnSet,
 			Inform:      *trapInform,
+			Varbinds:    varbinds,
+			Heartbeat:   *trapHeartbeat,
+			OnStart:     *trapOnStart,
 		}
 		if err := simulator.SetTrapConfig(trapConfig); err != nil {
 			log.Fatalf("Invalid trap config: %v", err)
@@ -151,20 +354,44 @@ func main() {
 	workloadManager := webui.NewWorkloadManager("config/workloads")
 
 	// Create API server
-	apiServer := api.NewServer(":" + *webPort)
+	apiServer, err := api.NewServer(":" + *webPort)
+	if err != nil {
+		log.Fatalf("Failed to create web UI server: %v", err)
+	}
 	apiServer.SetSimulator(simulator)
 	apiServer.SetSimulatorStatus(*portStart, *portEnd, *devices, *listenAddr, time.Now().Format(time.RFC3339))
 	apiServer.SetWorkloadManager(workloadManager)
-	apiServer.SetSNMPTester(webui.NewSNMPTester())
+	tester := webui.NewSNMPTester()
+	if err := tester.SetDefaultBackend(*testerBackend); err != nil {
+		log.Fatalf("Invalid --tester-backend: %v", err)
+	}
+	apiServer.SetSNMPTester(tester)
+	apiServer.SetTLS(*tlsCert, *tlsKey)
+	if *apiTokensFile != "" {
+		if err := apiServer.SetTokenFile(*apiTokensFile); err != nil {
+			log.Fatalf("Failed to load API tokens: %v", err)
+		}
+	}
 
 	// Start API server in goroutine
 	go func() {
-		log.Printf("Starting web UI server on http://localhost:%s", *webPort)
+		log.Printf("Starting web UI server on %s://localhost:%s", webScheme, *webPort)
 		if err := apiServer.Start(); err != nil {
 			log.Printf("Warning: Web UI server error: %v", err)
 		}
 	}()
 
+	var pprofServer *http.Server
+	if *pprofAddr != "" {
+		pprofServer = newPprofServer(*pprofAddr)
+		go func() {
+			log.Printf("Starting pprof server on http://%s/debug/pprof/", *pprofAddr)
+			if err := pprofServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Warning: pprof server error: %v", err)
+			}
+		}()
+	}
+
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -174,6 +401,11 @@ func main() {
 		cancel()
 	}()
 
+	// SIGHUP reloads the dataset files in place
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go reloadOnHangup(ctx, simulator, hangups)
+
 	// Start simulator
 	if err := simulator.Start(ctx); err != nil {
 		log.Fatalf("Failed to start simulator: %v", err)
@@ -185,10 +417,80 @@ func main() {
 
 	log.Printf("Shutting down...")
 	apiServer.Stop()
+	if pprofServer != nil {
+		pprofServer.Close()
+	}
 	simulator.Stop()
 	log.Printf("Graceful shutdown complete")
 }
 
+// parseBootOffsets parses --boot-offset-range MIN-MAX and --device-uptime
+// ID=DURATION values.
+func parseBootOffsets(rangeSpec string, deviceSpecs []string) (time.Duration, time.Duration, map[int]time.Duration, error) {
+	var minOffset, maxOffset time.Duration
+	if rangeSpec != "" {
+		lo, hi, ok := strings.Cut(rangeSpec, "-")
+		if !ok {
+			return 0, 0, nil, fmt.Errorf("range %q must be MIN-MAX", rangeSpec)
+		}
+		var err error
+		if minOffset, err = time.ParseDuration(lo); err != nil {
+			return 0, 0, nil, fmt.Errorf("range %q: %w", rangeSpec, err)
+		}
+		if maxOffset, err = time.ParseDuration(hi); err != nil {
+			return 0, 0, nil, fmt.Errorf("range %q: %w", rangeSpec, err)
+		}
+	}
+
+	perDevice := make(map[int]time.Duration, len(deviceSpecs))
+	for _, spec := range deviceSpecs {
+		idStr, durStr, ok := strings.Cut(spec, "=")
+		if !ok {
+			return 0, 0, nil, fmt.Errorf("device uptime %q must be ID=DURATION", spec)
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id < 0 {
+			return 0, 0, nil, fmt.Errorf("device uptime %q: invalid device ID", spec)
+		}
+		d, err := time.ParseDuration(durStr)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("device uptime %q: %w", spec, err)
+		}
+		perDevice[id] = d
+	}
+	return minOffset, maxOffset, perDevice, nil
+}
+
+// parseBaseLatencies parses --base-latency values: DURATION for every port or
+// START-END=DURATION (inclusive) for a port range
+func parseBaseLatencies(specs []string) ([]engine.PortLatency, error) {
+	rules := make([]engine.PortLatency, 0, len(specs))
+	for _, spec := range specs {
+		rule := engine.PortLatency{Start: 0, End: 65535}
+		durStr := spec
+		if ports, d, ok := strings.Cut(spec, "="); ok {
+			durStr = d
+			lo, hi, isRange := strings.Cut(ports, "-")
+			if !isRange {
+				hi = lo
+			}
+			var errLo, errHi error
+			rule.Start, errLo = strconv.Atoi(lo)
+			rule.End, errHi = strconv.Atoi(hi)
+			if errLo != nil || errHi != nil {
+				return nil, fmt.Errorf("%q: ports must be START-END or PORT", spec)
+			}
+		}
+		d, err := time.ParseDuration(durStr)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", spec, err)
+		}
+		rule.Latency = d
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
 func checkFileDescriptors(requiredFDs int) {
 	var rlimit syscall.Rlimit
 	err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit)
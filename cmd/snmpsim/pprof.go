@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// pprofMutexFraction samples 1 in N mutex contention events once profiling is on.
+const pprofMutexFraction = 5
+
+// newPprofServer builds a standalone server exposing the net/http/pprof
+// handlers under /debug/pprof/, kept off the web UI and metrics servers.
+func newPprofServer(addr string) *http.Server {
+	runtime.SetMutexProfileFraction(pprofMutexFraction)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
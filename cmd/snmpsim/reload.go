@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+// datasetReloader is the part of the simulator a SIGHUP drives
+type datasetReloader interface {
+	ReloadDataset() error
+}
+
+// reloadOnHangup reloads sim's dataset from disk for every signal received
+// on hangups until ctx ends. A failed reload is logged and the old dataset
+// stays in service.
+func reloadOnHangup(ctx context.Context, sim datasetReloader, hangups <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			log.Printf("Received SIGHUP, reloading dataset...")
+			if err := sim.ReloadDataset(); err != nil {
+				log.Printf("Dataset reload failed, still serving the previous dataset: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type countingReloader struct {
+	calls chan struct{}
+	err   error
+}
+
+func (r *countingReloader) ReloadDataset() error {
+	r.calls <- struct{}{}
+	return r.err
+}
+
+func TestReloadOnHangupReloadsPerSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hangups := make(chan os.Signal, 1)
+	sim := &countingReloader{calls: make(chan struct{}, 4), err: errors.New("bad file")}
+	done := make(chan struct{})
+	go func() {
+		reloadOnHangup(ctx, sim, hangups)
+		close(done)
+	}()
+
+	// a failed reload keeps the handler serving later signals
+	for i := 0; i < 2; i++ {
+		hangups <- syscall.SIGHUP
+		select {
+		case <-sim.calls:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("SIGHUP %d did not reload", i+1)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not return after cancel")
+	}
+}
@@ -1,10 +1,11 @@
 module github.com/debashish-mukherjee/go-snmpsim
 
-go 1.21
+go 1.22
 
 require (
 	github.com/gosnmp/gosnmp v1.37.0
 	github.com/prometheus/client_golang v1.17.0
+	github.com/prometheus/common v0.44.0
 	github.com/robfig/cron/v3 v3.0.1
 	golang.org/x/sys v0.15.0
 	gopkg.in/yaml.v3 v3.0.1
@@ -17,7 +18,6 @@ require (
 	github.com/kr/text v0.2.0 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
 	github.com/prometheus/client_model v0.4.1-0.20230718164431-9a2bf3000d16 // indirect
-	github.com/prometheus/common v0.44.0 // indirect
 	github.com/prometheus/procfs v0.11.1 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
@@ -0,0 +1,129 @@
+// Package accesslog logs one line per request for the HTTP API servers.
+package accesslog
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Level selects which requests are logged.
+type Level int
+
+const (
+	// Off disables access logging.
+	Off Level = iota
+	// Errors logs only responses with status 400 and above.
+	Errors
+	// All logs every request.
+	All
+)
+
+// ParseLevel accepts off, errors or all (case-insensitive); empty means all.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "all":
+		return All, nil
+	case "errors":
+		return Errors, nil
+	case "off", "none":
+		return Off, nil
+	}
+	return Off, fmt.Errorf("invalid access log level %q (want off, errors or all)", s)
+}
+
+// ParseSkip splits a comma-separated path list for Options.Skip.
+func ParseSkip(s string) []string {
+	var paths []string
+	for _, part := range strings.Split(s, ",") {
+		if path := strings.TrimSpace(part); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Options configures Handler.
+type Options struct {
+	Level Level
+	// Skip lists exact paths that are never logged, such as health checks.
+	Skip []string
+	// Logger receives the lines; nil uses the standard logger.
+	Logger *log.Logger
+}
+
+// Handler logs method, path, status, response bytes, client IP and duration
+// for each request served by next.
+func Handler(next http.Handler, opts Options) http.Handler {
+	if opts.Level == Off {
+		return next
+	}
+	skip := make(map[string]bool, len(opts.Skip))
+	for _, path := range opts.Skip {
+		skip[path] = true
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if skip[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		if opts.Level == Errors && rw.status < http.StatusBadRequest {
+			return
+		}
+		logger.Printf("access: %s %s %d %dB client=%s duration=%s",
+			r.Method, r.URL.RequestURI(), rw.status, rw.bytes, clientIP(r), time.Since(start).Round(time.Microsecond))
+	})
+}
+
+// responseWriter records the status code and body size written by a handler.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush forwards to the underlying writer so streaming handlers keep working.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
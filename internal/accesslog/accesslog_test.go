@@ -0,0 +1,66 @@
+package accesslog
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerLogsRequest(t *testing.T) {
+	var buf bytes.Buffer
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing", http.StatusNotFound)
+	}), Options{Level: All, Skip: []string{"/health"}, Logger: log.New(&buf, "", 0)})
+
+	req := httptest.NewRequest(http.MethodGet, "/labs/42?format=yaml", nil)
+	req.RemoteAddr = "192.0.2.7:5555"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	for _, want := range []string{"access: GET /labs/42?format=yaml 404 8B", "client=192.0.2.7", "duration="} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("log line %q missing %q", line, want)
+		}
+	}
+
+	buf.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	if buf.Len() != 0 {
+		t.Fatalf("skipped path was logged: %q", buf.String())
+	}
+}
+
+func TestHandlerErrorsLevelSkipsSuccess(t *testing.T) {
+	var buf bytes.Buffer
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("ok"))
+	}), Options{Level: Errors, Logger: log.New(&buf, "", 0)})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if buf.Len() != 0 {
+		t.Fatalf("successful request logged at errors level: %q", buf.String())
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bad", nil))
+	if !strings.Contains(buf.String(), "GET /bad 400") {
+		t.Fatalf("error request not logged: %q", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]Level{"": All, "ALL": All, "errors": Errors, "off": Off} {
+		got, err := ParseLevel(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseLevel(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("debug"); err == nil {
+		t.Fatal("expected error for unknown level")
+	}
+}
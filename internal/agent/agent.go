@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/debashish-mukherjee/go-snmpsim/internal/routing"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/variation"
@@ -25,24 +26,66 @@ type VirtualAgent struct {
 	port          int
 	sysName       string
 	v3Config      v3.Config
-	v3EngineBoots uint32
-	oidDB         *store.OIDDatabase
+	usmStats      v3.USMStats
+	uptime        uint32
+	pollCount     atomic.Int64
+	lastPollNanos atomic.Int64
+	disabled      atomic.Bool // offline: the listener drops every request
+
+	// state is swapped wholesale by the setters; request handling loads it
+	// once per packet and never takes a lock.
+	state atomic.Pointer[agentState]
+	mu    sync.Mutex // serializes state updates
+
+	// overlay holds device-specific value overrides (oid -> value). It is
+	// written per OID, so it lives outside the copy-on-write state; restores
+	// swap in a whole new map.
+	overlay atomic.Pointer[sync.Map]
+}
+
+// agentState holds the rarely-mutated configuration read on the hot path.
+// A published agentState is never modified; setters copy it and swap.
+type agentState struct {
+	startTime     time.Time              // last (simulated) boot; sysUpTime and the v3 engine time count from it
+	engineBoots   uint32                 // v3 snmpEngineBoots
+	oidDB         *store.OIDDatabase     // default dataset, served when no route matches
 	indexManager  *store.OIDIndexManager // Index manager for Zabbix LLD (table-aware)
 	datasetStore  *store.DatasetStore
 	router        *routing.Router
 	variations    *variation.Binder
 	deviceMapping *store.DeviceOIDMapping // Device-specific OID overrides
-	deviceOverlay map[string]interface{}  // Device-specific value overrides
-	uptime        uint32
-	startTime     time.Time
-	pollCount     atomic.Int64
-	lastPollNanos atomic.Int64
 	variationHook func(VariationEvent)
 	setHook       func(SetEvent)
+	bootOffset    time.Duration // added to sysUpTime, as if booted earlier
+	debugOIDs     bool          // answer EchoOID with request metadata
+	maxRepeats    int           // GETBULK max-repetitions cap; 0 means DefaultMaxRepetitions
+	maxRespSize   int           // GETBULK response size cap in bytes; 0 means DefaultMaxResponseSize
+	capture       *requestRing  // recent request summaries; nil when capturing is off
+	oidFilter     store.OIDFilter
+	writable      []string         // OID prefixes SETs may write; empty means read-only
+	unknownSetErr gosnmp.SNMPError // SET error for OIDs the agent does not hold; 0 means noCreation
+	system        SystemInfo       // system group values served over the dataset's
+
+	authFailureHook func(AuthFailureEvent) // runs for requests answered with wrongDigest
+	oidQueryHook    func(oid string)       // runs for every OID a request looks up; nil when off
+}
 
-	mu sync.RWMutex
+// SystemInfo holds system group values an agent serves in place of its
+// dataset's. Empty fields leave the dataset value.
+type SystemInfo struct {
+	SysDescr    string // 1.3.6.1.2.1.1.1.0
+	SysObjectID string // 1.3.6.1.2.1.1.2.0, dotted decimal
+	SysContact  string // 1.3.6.1.2.1.1.4.0
 }
 
+// DefaultMaxRepetitions caps GETBULK max-repetitions so a single request
+// cannot force an oversized response.
+const DefaultMaxRepetitions = 128
+
+// EchoOID is the debug OID that, with debug OIDs enabled, answers a GET with
+// a description of the agent and request that handled it.
+const EchoOID = "1.3.6.1.4.1.55555.99.1.0"
+
 type VariationEvent struct {
 	DeviceID int
 	Port     int
@@ -58,6 +101,13 @@ type SetEvent struct {
 	Value    string
 }
 
+// AuthFailureEvent reports an SNMPv3 request whose digest did not verify
+type AuthFailureEvent struct {
+	DeviceID int
+	Port     int
+	User     string
+}
+
 // NewVirtualAgent creates a new virtual SNMP agent
 func NewVirtualAgent(deviceID int, port int, sysName string, oidDB *store.OIDDatabase, v3Config v3.Config, v3EngineBoots uint32) *VirtualAgent {
 	if v3Config.Enabled && v3Config.Username == "" {
@@ -69,60 +119,255 @@ func NewVirtualAgent(deviceID int, port int, sysName string, oidDB *store.OIDDat
 
 	now := time.Now()
 	va := &VirtualAgent{
-		deviceID:      deviceID,
-		port:          port,
-		sysName:       sysName,
-		v3Config:      v3Config,
-		v3EngineBoots: v3EngineBoots,
-		oidDB:         oidDB,
-		indexManager:  nil,
-		deviceMapping: nil,
-		deviceOverlay: make(map[string]interface{}),
-		startTime:     now,
+		deviceID: deviceID,
+		port:     port,
+		sysName:  sysName,
+		v3Config: v3Config,
 	}
+	va.state.Store(&agentState{startTime: now, engineBoots: v3EngineBoots, oidDB: oidDB})
+	va.overlay.Store(&sync.Map{})
 	va.lastPollNanos.Store(now.UnixNano())
 	return va
 }
 
-// SetIndexManager assigns the index manager for Zabbix LLD support
-func (va *VirtualAgent) SetIndexManager(im *store.OIDIndexManager) {
+// engineTime returns the v3 snmpEngineTime: seconds since the last boot
+func (st *agentState) engineTime() uint32 {
+	return uint32(time.Since(st.startTime).Seconds())
+}
+
+// updateState publishes a modified copy of the agent state.
+func (va *VirtualAgent) updateState(fn func(st *agentState)) {
 	va.mu.Lock()
 	defer va.mu.Unlock()
-	va.indexManager = im
+	next := *va.state.Load()
+	fn(&next)
+	va.state.Store(&next)
+}
+
+// SetDataset swaps the default dataset and its index in one step, so no
+// request sees the new OIDs with the old index
+func (va *VirtualAgent) SetDataset(oidDB *store.OIDDatabase, im *store.OIDIndexManager) {
+	va.updateState(func(st *agentState) {
+		st.oidDB = oidDB
+		st.indexManager = im
+	})
+}
+
+// ImportOIDs parses snmprec lines and adds them to this agent's default
+// dataset, replacing values of OIDs it already holds. The dataset is copied
+// first, so agents that shared it keep serving the original, and the copy
+// is swapped in with a rebuilt index like SetDataset. Returns the number of
+// OIDs parsed; nothing is imported when any line is invalid.
+func (va *VirtualAgent) ImportOIDs(data []byte) (int, error) {
+	parsed := store.NewOIDDatabase()
+	count, err := store.LoadSNMPrecData(parsed, data)
+	if err != nil {
+		return 0, err
+	}
+	va.updateState(func(st *agentState) {
+		db := st.oidDB.Clone()
+		parsed.Walk(func(oid string, value *store.OIDValue) bool {
+			db.Insert(oid, value)
+			return true
+		})
+		db.SortOIDs()
+		im := store.NewOIDIndexManager()
+		_ = im.BuildIndex(db) // never fails
+		st.oidDB = db
+		st.indexManager = im
+	})
+	return count, nil
+}
+
+// SetIndexManager assigns the index manager for Zabbix LLD support
+func (va *VirtualAgent) SetIndexManager(im *store.OIDIndexManager) {
+	va.updateState(func(st *agentState) {
+		st.indexManager = im
+	})
 }
 
 // SetRouting assigns request routing and dataset registry to this agent.
 func (va *VirtualAgent) SetRouting(router *routing.Router, datasetStore *store.DatasetStore) {
-	va.mu.Lock()
-	defer va.mu.Unlock()
-	va.router = router
-	va.datasetStore = datasetStore
+	va.updateState(func(st *agentState) {
+		st.router = router
+		st.datasetStore = datasetStore
+	})
 }
 
 // SetVariationBinder assigns OID-prefix variation chains to this agent.
 func (va *VirtualAgent) SetVariationBinder(binder *variation.Binder) {
-	va.mu.Lock()
-	defer va.mu.Unlock()
-	va.variations = binder
+	va.updateState(func(st *agentState) {
+		st.variations = binder
+	})
 }
 
 func (va *VirtualAgent) SetVariationEventHook(hook func(VariationEvent)) {
-	va.mu.Lock()
-	defer va.mu.Unlock()
-	va.variationHook = hook
+	va.updateState(func(st *agentState) {
+		st.variationHook = hook
+	})
 }
 
 func (va *VirtualAgent) SetSetEventHook(hook func(SetEvent)) {
-	va.mu.Lock()
-	defer va.mu.Unlock()
-	va.setHook = hook
+	va.updateState(func(st *agentState) {
+		st.setHook = hook
+	})
+}
+
+// SetOIDQueryHook installs hook to run with each OID a GET, GETNEXT, GETBULK
+// or SET looks up, for per-OID metrics. It runs on the request path, so it
+// must be cheap. nil, the default, turns it off.
+func (va *VirtualAgent) SetOIDQueryHook(hook func(oid string)) {
+	va.updateState(func(st *agentState) {
+		st.oidQueryHook = hook
+	})
+}
+
+// SetAuthFailureHook installs hook to run for every v3 request answered with
+// a usmStatsWrongDigests report
+func (va *VirtualAgent) SetAuthFailureHook(hook func(AuthFailureEvent)) {
+	va.updateState(func(st *agentState) {
+		st.authFailureHook = hook
+	})
 }
 
 // SetDeviceMapping assigns device-specific OID mappings to this agent
 func (va *VirtualAgent) SetDeviceMapping(mapping *store.DeviceOIDMapping) {
-	va.mu.Lock()
-	defer va.mu.Unlock()
-	va.deviceMapping = mapping
+	va.updateState(func(st *agentState) {
+		st.deviceMapping = mapping
+	})
+}
+
+// DeviceID returns the simulated device number of this agent
+func (va *VirtualAgent) DeviceID() int {
+	return va.deviceID
+}
+
+// SetBootOffset makes sysUpTime report the device as booted d before the
+// agent was created. The value keeps ticking forward from there.
+func (va *VirtualAgent) SetBootOffset(d time.Duration) {
+	va.updateState(func(st *agentState) {
+		st.bootOffset = d
+	})
+}
+
+// Reboot simulates a restart of the device: sysUpTime and the v3 engine
+// time start again from zero, dropping any boot offset, and the v3 engine
+// boots become boots. Values written by SETs survive, as in NVRAM.
+func (va *VirtualAgent) Reboot(boots uint32) {
+	va.updateState(func(st *agentState) {
+		st.startTime = time.Now()
+		st.bootOffset = 0
+		st.engineBoots = boots
+	})
+}
+
+// SetEnabled takes the agent offline (false), so its listener drops every
+// request without answering, or brings it back (true)
+func (va *VirtualAgent) SetEnabled(enabled bool) {
+	va.disabled.Store(!enabled)
+}
+
+// Enabled reports whether the agent answers requests
+func (va *VirtualAgent) Enabled() bool {
+	return !va.disabled.Load()
+}
+
+// EngineBoots returns the current v3 snmpEngineBoots
+func (va *VirtualAgent) EngineBoots() uint32 {
+	return va.state.Load().engineBoots
+}
+
+// EngineID returns the v3 engine ID, or "" when SNMPv3 is disabled
+func (va *VirtualAgent) EngineID() string {
+	if !va.v3Config.Enabled {
+		return ""
+	}
+	return va.v3Config.EngineID
+}
+
+// SetDebugOIDs enables or disables the synthetic debug OIDs such as EchoOID
+func (va *VirtualAgent) SetDebugOIDs(enabled bool) {
+	va.updateState(func(st *agentState) {
+		st.debugOIDs = enabled
+	})
+}
+
+// SetMaxRepetitions caps the max-repetitions honored for GETBULK requests.
+// n <= 0 restores DefaultMaxRepetitions.
+func (va *VirtualAgent) SetMaxRepetitions(n int) {
+	va.updateState(func(st *agentState) {
+		st.maxRepeats = n
+	})
+}
+
+// SetMaxResponseSize caps the encoded size of GETBULK responses at n bytes.
+// n <= 0 restores DefaultMaxResponseSize.
+func (va *VirtualAgent) SetMaxResponseSize(n int) {
+	va.updateState(func(st *agentState) {
+		st.maxRespSize = n
+	})
+}
+
+// SetOIDFilter answers OIDs f rejects with noSuchObject, whichever source
+// (dataset, device mapping, overlay or system OID) would have served them
+func (va *VirtualAgent) SetOIDFilter(f store.OIDFilter) {
+	va.updateState(func(st *agentState) {
+		st.oidFilter = f
+	})
+}
+
+// SetWritableOIDs lets SETs write the OIDs under prefixes (whole arcs, as in
+// store.OIDFilter). Written values go to the device overlay. With no
+// prefixes every OID is read-only.
+func (va *VirtualAgent) SetWritableOIDs(prefixes []string) error {
+	f, err := store.NewOIDFilter(prefixes, nil)
+	if err != nil {
+		return err
+	}
+	va.updateState(func(st *agentState) {
+		st.writable = f.Include
+	})
+	return nil
+}
+
+// SetSystemInfo serves the non-empty fields of info for sysDescr,
+// sysObjectID and sysContact instead of the dataset values
+func (va *VirtualAgent) SetSystemInfo(info SystemInfo) error {
+	if info.SysObjectID != "" {
+		oid, err := store.ParseOIDValue("objectidentifier", info.SysObjectID)
+		if err != nil {
+			return fmt.Errorf("sysObjectID: %w", err)
+		}
+		info.SysObjectID = oid.(string)
+	}
+	va.updateState(func(st *agentState) {
+		st.system = info
+	})
+	return nil
+}
+
+// SetUnknownOIDSetError selects the error a SET on an OID the agent does not
+// hold returns: gosnmp.NoCreation (the default) or gosnmp.NotWritable.
+func (va *VirtualAgent) SetUnknownOIDSetError(status gosnmp.SNMPError) error {
+	if status != gosnmp.NoCreation && status != gosnmp.NotWritable {
+		return fmt.Errorf("unknown-OID SET error must be noCreation or notWritable, got %v", status)
+	}
+	va.updateState(func(st *agentState) {
+		st.unknownSetErr = status
+	})
+	return nil
+}
+
+// ParseSetError parses the name of an unknown-OID SET error
+func ParseSetError(name string) (gosnmp.SNMPError, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "nocreation":
+		return gosnmp.NoCreation, nil
+	case "notwritable":
+		return gosnmp.NotWritable, nil
+	default:
+		return 0, fmt.Errorf("unknown SET error %q (want noCreation or notWritable)", name)
+	}
 }
 
 // HandlePacket processes an incoming SNMP packet and returns a response
@@ -142,12 +387,24 @@ func (va *VirtualAgent) HandlePacketFrom(packet []byte, remoteAddr *net.UDPAddr,
 	}
 
 	req, reportOID, err := va.decodePacket(packet)
+	if errors.Is(err, errNotV3) {
+		return nil // v3-only: downgrade attempts are dropped silently
+	}
 	if err != nil {
 		log.Printf("Device %d: Failed to parse SNMP packet: %v", va.deviceID, err)
 		return nil
 	}
+	normalizeRequest(req)
+
+	st := va.state.Load()
+	if st.capture != nil {
+		va.captureRequest(st.capture, req, remoteAddr)
+	}
 
 	if reportOID != "" {
+		if reportOID == v3.USMStatsWrongDigestOID && st.authFailureHook != nil {
+			st.authFailureHook(AuthFailureEvent{DeviceID: va.deviceID, Port: va.port, User: usmUserName(req)})
+		}
 		return va.handleV3USMReport(req, reportOID)
 	}
 
@@ -155,27 +412,25 @@ func (va *VirtualAgent) HandlePacketFrom(packet []byte, remoteAddr *net.UDPAddr,
 		return va.handleV3DiscoveryReport(req)
 	}
 
-	activeDB, activeIndex := va.selectDataset(req, remoteAddr, dstPort)
+	activeDB, activeIndex := va.selectDataset(st, req, remoteAddr, dstPort)
 
 	switch req.PDUType {
 	case gosnmp.GetNextRequest:
-		return va.handleGetNextRequest(req, activeDB, activeIndex)
+		return va.handleGetNextRequest(st, req, activeDB, activeIndex)
 	case gosnmp.SetRequest:
-		return va.handleSetRequest(req)
+		return va.handleSetRequest(st, req, activeDB)
 	case gosnmp.GetBulkRequest:
-		return va.handleGetBulkRequest(req, activeDB, activeIndex)
+		return va.handleGetBulkRequest(st, req, activeDB, activeIndex)
 	default:
-		return va.handleGetRequest(req, activeDB)
+		return va.handleGetRequest(st, req, activeDB)
 	}
 }
 
-func (va *VirtualAgent) selectDataset(req *gosnmp.SnmpPacket, remoteAddr *net.UDPAddr, dstPort int) (*store.OIDDatabase, *store.OIDIndexManager) {
-	va.mu.RLock()
-	defaultDB := va.oidDB
-	defaultIndex := va.indexManager
-	router := va.router
-	datasetStore := va.datasetStore
-	va.mu.RUnlock()
+func (va *VirtualAgent) selectDataset(st *agentState, req *gosnmp.SnmpPacket, remoteAddr *net.UDPAddr, dstPort int) (*store.OIDDatabase, *store.OIDIndexManager) {
+	defaultDB := st.oidDB
+	defaultIndex := st.indexManager
+	router := st.router
+	datasetStore := st.datasetStore
 
 	if router == nil || datasetStore == nil || req == nil {
 		return defaultDB, defaultIndex
@@ -208,6 +463,9 @@ func (va *VirtualAgent) selectDataset(req *gosnmp.SnmpPacket, remoteAddr *net.UD
 	return routedDB, routedIndex
 }
 
+// errNotV3 is returned by decodePacket for a v1/v2c packet in v3-only mode
+var errNotV3 = errors.New("not an SNMPv3 packet")
+
 func (va *VirtualAgent) decodePacket(packet []byte) (*gosnmp.SnmpPacket, string, error) {
 	if va.v3Config.Enabled {
 		// Use the full auth+priv decoder for ALL v3 traffic.
@@ -215,7 +473,22 @@ func (va *VirtualAgent) decodePacket(packet []byte) (*gosnmp.SnmpPacket, string,
 		// (e.g. discovery), no HMAC verification is attempted even when auth params are
 		// present in the decoder. This lets us handle both discovery and authenticated
 		// packets in a single pass.
-		usmParams := va.v3Config.BuildUSM(va.v3EngineBoots, uint32(time.Since(va.startTime).Seconds()))
+		//
+		// The keys are those of the user named in the unencrypted header.
+		cfg := va.v3Config
+		if hdr, hdrErr := v3.ParseMessageHeader(packet); hdrErr == nil && hdr.USM.UserName != "" {
+			userCfg, known := va.v3Config.ForUser(hdr.USM.UserName)
+			if known {
+				cfg = userCfg
+			} else if hdr.MsgFlags&gosnmp.AuthPriv == gosnmp.AuthPriv && len(hdr.USM.AuthoritativeEngineID) > 0 {
+				// Without the user's keys the scoped PDU cannot be
+				// decrypted: report from the header alone
+				req := requestFromHeader(hdr)
+				return req, va.validateUSMIdentity(req), nil
+			}
+		}
+		st := va.state.Load()
+		usmParams := cfg.BuildUSM(st.engineBoots, st.engineTime())
 		// Pre-initialize keys; without this, gosnmp calcPacketDigest gets a nil SecretKey.
 		if initErr := usmParams.InitSecurityKeys(); initErr != nil {
 			log.Printf("Device %d: Failed to initialize USM security keys: %v", va.deviceID, initErr)
@@ -223,7 +496,7 @@ func (va *VirtualAgent) decodePacket(packet []byte) (*gosnmp.SnmpPacket, string,
 		secureDecoder := gosnmp.GoSNMP{
 			Version:            gosnmp.Version3,
 			SecurityModel:      gosnmp.UserSecurityModel,
-			MsgFlags:           va.v3Config.SecurityLevel(),
+			MsgFlags:           cfg.SecurityLevel(),
 			SecurityParameters: usmParams,
 		}
 
@@ -238,6 +511,9 @@ func (va *VirtualAgent) decodePacket(packet []byte) (*gosnmp.SnmpPacket, string,
 		if err == nil && req.Version == gosnmp.Version3 {
 			// SnmpDecodePacket does NOT verify the incoming HMAC (it only decrypts).
 			// We must manually verify authentication when the packet requests auth.
+			if reportOID := va.validateUSMIdentity(req); reportOID != "" {
+				return req, reportOID, nil
+			}
 			if req.MsgFlags&gosnmp.AuthNoPriv != 0 {
 				if authErr := va.verifyIncomingHMAC(rawCopy, req, usmParams); authErr != nil {
 					// Auth verification failed: return WrongDigest report
@@ -267,18 +543,21 @@ func (va *VirtualAgent) decodePacket(packet []byte) (*gosnmp.SnmpPacket, string,
 		}
 
 		// If secure decode failed for non-auth reasons, the packet is not v3.
-		if err != nil {
-			// fall through to v2c / v1
+		if va.v3Config.Only {
+			return nil, "", errNotV3
 		}
+		// otherwise fall through to v2c / v1
 	}
 
-	decoderV2 := gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}
+	// The community is read from the packet, not from the decoder, so routing
+	// and the handlers see whatever the client sent
+	decoderV2 := gosnmp.GoSNMP{Version: gosnmp.Version2c}
 	req, err := decoderV2.SnmpDecodePacket(packet)
 	if err == nil {
 		return req, "", nil
 	}
 
-	decoderV1 := gosnmp.GoSNMP{Version: gosnmp.Version1, Community: "public"}
+	decoderV1 := gosnmp.GoSNMP{Version: gosnmp.Version1}
 	req, err = decoderV1.SnmpDecodePacket(packet)
 	if err == nil {
 		return req, "", nil
@@ -306,6 +585,26 @@ func marshalPacket(packet *gosnmp.SnmpPacket) ([]byte, error) {
 	return packet.MarshalMsg()
 }
 
+// requestFromHeader stands in for a request whose scoped PDU could not be
+// decrypted, carrying what a Report to it needs. The Report is sent without
+// auth or privacy, as RFC 3414 section 3.2 does for an unknown user.
+func requestFromHeader(hdr v3.MessageHeader) *gosnmp.SnmpPacket {
+	return &gosnmp.SnmpPacket{
+		Version:       gosnmp.Version3,
+		MsgID:         uint32(hdr.MsgID),
+		MsgMaxSize:    uint32(hdr.MsgMaxSize),
+		MsgFlags:      hdr.MsgFlags & gosnmp.Reportable,
+		SecurityModel: gosnmp.UserSecurityModel,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{
+			AuthoritativeEngineID:    string(hdr.USM.AuthoritativeEngineID),
+			AuthoritativeEngineBoots: uint32(hdr.USM.AuthoritativeEngineBoots),
+			AuthoritativeEngineTime:  uint32(hdr.USM.AuthoritativeEngineTime),
+			UserName:                 hdr.USM.UserName,
+		},
+		PDUType: gosnmp.GetRequest,
+	}
+}
+
 // isAuthError returns true when the error indicates an HMAC authentication failure.
 func isAuthError(err error) bool {
 	if err == nil {
@@ -404,12 +703,26 @@ func (va *VirtualAgent) verifyIncomingHMAC(rawCopy []byte, req *gosnmp.SnmpPacke
 	return nil
 }
 
+// normalizeRequest clears the error-status and error-index of a request.
+// RFC 3416 has managers send them as zero, but some buggy clients fill them
+// in; they carry no meaning in a request and must not leak into handling.
+func normalizeRequest(req *gosnmp.SnmpPacket) {
+	if req.PDUType != gosnmp.GetBulkRequest {
+		req.Error = gosnmp.NoError
+		req.ErrorIndex = 0
+	}
+}
+
 func buildResponseFromRequest(req *gosnmp.SnmpPacket, vars []gosnmp.SnmpPDU, errCode gosnmp.SNMPError, errIndex uint8) *gosnmp.SnmpPacket {
 	response := *req
 	response.PDUType = gosnmp.GetResponse
 	response.Variables = vars
 	response.Error = errCode
 	response.ErrorIndex = errIndex
+	// A response has no non-repeaters or max-repetitions fields; those
+	// positions of a GETBULK request are error-status and error-index here
+	response.NonRepeaters = 0
+	response.MaxRepetitions = 0
 	return &response
 }
 
@@ -428,12 +741,11 @@ func (va *VirtualAgent) buildResponseFromRequest(req *gosnmp.SnmpPacket, vars []
 			}
 		}
 
-		cfg := va.v3ConfigForFlags(response.MsgFlags)
+		cfg, _ := va.v3Config.ForUser(username)
+		cfg = v3ConfigForFlags(cfg, response.MsgFlags)
 		cfg.Username = username
-		response.SecurityParameters = cfg.BuildUSM(
-			va.v3EngineBoots,
-			uint32(time.Since(va.startTime).Seconds()),
-		)
+		st := va.state.Load()
+		response.SecurityParameters = cfg.BuildUSM(st.engineBoots, st.engineTime())
 	}
 
 	return response
@@ -455,6 +767,22 @@ func (va *VirtualAgent) shouldSendV3DiscoveryReport(req *gosnmp.SnmpPacket) bool
 	return usm.AuthoritativeEngineID == ""
 }
 
+// validateUSMIdentity checks the authoritative engine ID and user name, which
+// RFC 3414 requires before the digest is verified.
+func (va *VirtualAgent) validateUSMIdentity(req *gosnmp.SnmpPacket) string {
+	usm, ok := req.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok || usm == nil || usm.AuthoritativeEngineID == "" {
+		return ""
+	}
+	if usm.AuthoritativeEngineID != va.v3Config.EngineID {
+		return v3.USMStatsUnknownEngineIDOID
+	}
+	if _, known := va.v3Config.ForUser(usm.UserName); usm.UserName != "" && !known {
+		return v3.USMStatsUnknownUserNameOID
+	}
+	return ""
+}
+
 func (va *VirtualAgent) validateUSMWindow(req *gosnmp.SnmpPacket) string {
 	if req == nil || req.Version != gosnmp.Version3 {
 		return ""
@@ -465,13 +793,11 @@ func (va *VirtualAgent) validateUSMWindow(req *gosnmp.SnmpPacket) string {
 		return v3.USMStatsUnknownEngineIDOID
 	}
 
-	if usm.AuthoritativeEngineID != "" && usm.AuthoritativeEngineID != va.v3Config.EngineID {
-		return v3.USMStatsUnknownEngineIDOID
-	}
-
+	// validateUSMIdentity has already rejected a foreign engine ID
 	if usm.AuthoritativeEngineID != "" {
-		now := uint32(time.Since(va.startTime).Seconds())
-		if usm.AuthoritativeEngineBoots != va.v3EngineBoots {
+		st := va.state.Load()
+		now := st.engineTime()
+		if usm.AuthoritativeEngineBoots != st.engineBoots {
 			return v3.USMStatsNotInTimeWindowOID
 		}
 
@@ -481,7 +807,7 @@ func (va *VirtualAgent) validateUSMWindow(req *gosnmp.SnmpPacket) string {
 		} else {
 			diff = usm.AuthoritativeEngineTime - now
 		}
-		if diff > 150 {
+		if diff > va.v3Config.TimeWindow() {
 			return v3.USMStatsNotInTimeWindowOID
 		}
 	}
@@ -490,7 +816,7 @@ func (va *VirtualAgent) validateUSMWindow(req *gosnmp.SnmpPacket) string {
 }
 
 func (va *VirtualAgent) handleV3USMReport(req *gosnmp.SnmpPacket, oid string) []byte {
-	response := va.buildResponseFromRequest(req, []gosnmp.SnmpPDU{v3.BuildUSMReportVar(oid)}, gosnmp.NoError, 0)
+	response := va.buildResponseFromRequest(req, []gosnmp.SnmpPDU{v3.BuildUSMReportVar(oid, va.usmStats.Increment(oid))}, gosnmp.NoError, 0)
 	response.PDUType = gosnmp.Report
 
 	data, err := marshalPacket(response)
@@ -501,8 +827,9 @@ func (va *VirtualAgent) handleV3USMReport(req *gosnmp.SnmpPacket, oid string) []
 	return data
 }
 
-func (va *VirtualAgent) v3ConfigForFlags(flags gosnmp.SnmpV3MsgFlags) v3.Config {
-	cfg := va.v3Config
+// v3ConfigForFlags strips from cfg the credentials a message at the security
+// level of flags does not use
+func v3ConfigForFlags(cfg v3.Config, flags gosnmp.SnmpV3MsgFlags) v3.Config {
 	level := flags & gosnmp.AuthPriv
 	if level == gosnmp.NoAuthNoPriv {
 		cfg.Auth = v3.AuthNone
@@ -527,11 +854,7 @@ func (va *VirtualAgent) handleV3DiscoveryReport(req *gosnmp.SnmpPacket) []byte {
 	}
 
 	vars := []gosnmp.SnmpPDU{
-		{
-			Name:  ".1.3.6.1.6.3.15.1.1.4.0",
-			Type:  gosnmp.Counter32,
-			Value: uint(1),
-		},
+		v3.BuildUSMReportVar(v3.USMStatsUnknownEngineIDOID, va.usmStats.Increment(v3.USMStatsUnknownEngineIDOID)),
 	}
 
 	response := va.buildResponseFromRequest(req, vars, gosnmp.NoError, 0)
@@ -549,17 +872,26 @@ func (va *VirtualAgent) handleV3DiscoveryReport(req *gosnmp.SnmpPacket) []byte {
 	return data
 }
 
-// handleGetRequest processes GET requests
-func (va *VirtualAgent) handleGetRequest(req *gosnmp.SnmpPacket, oidDB *store.OIDDatabase) []byte {
+// handleGetRequest processes GET requests. Every requested varbind gets its
+// own response varbind, in request order, so a repeated OID is answered as
+// many times as it was asked for.
+func (va *VirtualAgent) handleGetRequest(st *agentState, req *gosnmp.SnmpPacket, oidDB *store.OIDDatabase) []byte {
 	// Pre-allocate response variables
 	vars := make([]gosnmp.SnmpPDU, 0, len(req.Variables))
 	now := time.Now()
 
 	// Process each variable with minimal lock time
 	for _, v := range req.Variables {
-		va.mu.RLock()
-		value := va.getOIDValue(oidDB, v.Name)
-		va.mu.RUnlock()
+		var value *store.OIDValue
+		if st.debugOIDs && normalizeOID(v.Name) == EchoOID {
+			value = va.echoValue(req)
+		} else {
+			value = va.getOIDValue(st, oidDB, v.Name)
+		}
+
+		if value.Type == store.NoResponse {
+			return nil
+		}
 
 		pdu := gosnmp.SnmpPDU{
 			Name:  v.Name,
@@ -567,7 +899,7 @@ func (va *VirtualAgent) handleGetRequest(req *gosnmp.SnmpPacket, oidDB *store.OI
 			Value: value.Value,
 		}
 
-		applied, err := va.applyVariations(now, pdu)
+		applied, err := va.applyVariations(st, now, pdu)
 		if err != nil {
 			if errors.Is(err, variation.ErrDropOID) {
 				continue
@@ -595,39 +927,44 @@ func (va *VirtualAgent) handleGetRequest(req *gosnmp.SnmpPacket, oidDB *store.OI
 	return data
 }
 
-// handleGetNextRequest processes GETNEXT requests (walk operation)
-func (va *VirtualAgent) handleGetNextRequest(req *gosnmp.SnmpPacket, oidDB *store.OIDDatabase, indexManager *store.OIDIndexManager) []byte {
+// handleGetNextRequest processes GETNEXT requests (walk operation). Each
+// varbind advances independently of the others, duplicates included.
+func (va *VirtualAgent) handleGetNextRequest(st *agentState, req *gosnmp.SnmpPacket, oidDB *store.OIDDatabase, indexManager *store.OIDIndexManager) []byte {
 	// Pre-allocate response variables
 	vars := make([]gosnmp.SnmpPDU, 0, len(req.Variables))
 	now := time.Now()
 
 	// Process each variable with minimal lock time
 	for _, v := range req.Variables {
-		va.mu.RLock()
-		nextOID, val := va.getNextOID(indexManager, oidDB, v.Name)
-		va.mu.RUnlock()
+		nextOID, val := va.getNextOID(st, indexManager, oidDB, v.Name)
 
-		if val != nil {
-			pdu := gosnmp.SnmpPDU{
-				Name:  nextOID,
-				Type:  val.Type,
-				Value: val.Value,
-			}
+		if val.Type == store.NoResponse {
+			return nil
+		}
+		if val.Type == gosnmp.EndOfMibView {
+			vars = append(vars, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.EndOfMibView})
+			continue
+		}
 
-			applied, err := va.applyVariations(now, pdu)
-			if err != nil {
-				if errors.Is(err, variation.ErrDropOID) {
-					continue
-				}
-				if errors.Is(err, variation.ErrTimeout) {
-					return nil
-				}
-				log.Printf("Device %d: variation error for %s: %v", va.deviceID, pdu.Name, err)
-				applied = pdu
-			}
+		pdu := gosnmp.SnmpPDU{
+			Name:  nextOID,
+			Type:  val.Type,
+			Value: val.Value,
+		}
 
-			vars = append(vars, applied)
+		applied, err := va.applyVariations(st, now, pdu)
+		if err != nil {
+			if errors.Is(err, variation.ErrDropOID) {
+				continue
+			}
+			if errors.Is(err, variation.ErrTimeout) {
+				return nil
+			}
+			log.Printf("Device %d: variation error for %s: %v", va.deviceID, pdu.Name, err)
+			applied = pdu
 		}
+
+		vars = append(vars, applied)
 	}
 
 	// Marshal response without holding lock
@@ -642,9 +979,46 @@ func (va *VirtualAgent) handleGetNextRequest(req *gosnmp.SnmpPacket, oidDB *stor
 	return data
 }
 
+// nextBulkVarbind returns the successor of oid for one repetition of a
+// GETBULK repeater, with variations applied. OIDs the variations drop are
+// skipped, and an exhausted column (ended, or no successor) yields
+// endOfMibView on oid. abort is set when the request must go unanswered.
+func (va *VirtualAgent) nextBulkVarbind(st *agentState, indexManager *store.OIDIndexManager, oidDB *store.OIDDatabase, now time.Time, oid string, ended bool) (pdu gosnmp.SnmpPDU, abort bool) {
+	for !ended {
+		nextOID, val := va.getNextOID(st, indexManager, oidDB, oid)
+		if val == nil || val.Type == gosnmp.EndOfMibView {
+			break
+		}
+		if val.Type == store.NoResponse {
+			return gosnmp.SnmpPDU{}, true
+		}
+		pdu := gosnmp.SnmpPDU{
+			Name:  nextOID,
+			Type:  val.Type,
+			Value: val.Value,
+		}
+
+		applied, err := va.applyVariations(st, now, pdu)
+		if err != nil {
+			if errors.Is(err, variation.ErrDropOID) {
+				oid = nextOID
+				continue
+			}
+			if errors.Is(err, variation.ErrTimeout) {
+				return gosnmp.SnmpPDU{}, true
+			}
+			log.Printf("Device %d: variation error for %s: %v", va.deviceID, pdu.Name, err)
+			applied = pdu
+		}
+		return applied, false
+	}
+	// End the column with an explicit endOfMibView so walks terminate
+	return gosnmp.SnmpPDU{Name: normalizeOID(oid), Type: gosnmp.EndOfMibView}, false
+}
+
 // handleGetBulkRequest processes GETBULK requests (efficient walk)
 // Zabbix default: NonRepeaters=0, MaxRepeaters=10
-func (va *VirtualAgent) handleGetBulkRequest(req *gosnmp.SnmpPacket, oidDB *store.OIDDatabase, indexManager *store.OIDIndexManager) []byte {
+func (va *VirtualAgent) handleGetBulkRequest(st *agentState, req *gosnmp.SnmpPacket, oidDB *store.OIDDatabase, indexManager *store.OIDIndexManager) []byte {
 	// Pre-allocate response variables
 	nonRepeaters := int(req.NonRepeaters)
 	if nonRepeaters < 0 {
@@ -654,61 +1028,52 @@ func (va *VirtualAgent) handleGetBulkRequest(req *gosnmp.SnmpPacket, oidDB *stor
 	if maxRepeaters <= 0 {
 		maxRepeaters = 10
 	}
+	limit := st.maxRepeats
+	if limit <= 0 {
+		limit = DefaultMaxRepetitions
+	}
+	if maxRepeaters > limit {
+		maxRepeaters = limit
+	}
 
 	vars := make([]gosnmp.SnmpPDU, 0, len(req.Variables)*maxRepeaters)
 	now := time.Now()
 
-	// Process each variable with minimal lock time
-	for i, v := range req.Variables {
-		if i < nonRepeaters {
-			va.mu.RLock()
-			nextOID, val := va.getNextOID(indexManager, oidDB, v.Name)
-			va.mu.RUnlock()
-
-			if val != nil {
-				pdu := gosnmp.SnmpPDU{
-					Name:  nextOID,
-					Type:  val.Type,
-					Value: val.Value,
-				}
-
-				applied, err := va.applyVariations(now, pdu)
-				if err != nil {
-					if errors.Is(err, variation.ErrDropOID) {
-						continue
-					}
-					if errors.Is(err, variation.ErrTimeout) {
-						return nil
-					}
-					log.Printf("Device %d: variation error for %s: %v", va.deviceID, pdu.Name, err)
-					applied = pdu
-				}
-
-				vars = append(vars, applied)
-			}
-			continue
+	// Like a real agent, stop before the response outgrows the size limit
+	// rather than let it be fragmented or dropped (RFC 3416 section 4.2.3)
+	maxSize := va.maxBulkResponseSize(st, req)
+	response := va.buildResponseFromRequest(req, nil, gosnmp.NoError, 0)
+	budget := maxSize - responseOverhead(response) - responseSizeSlack
+	used := 0
+	full := false
+	add := func(pdu gosnmp.SnmpPDU) bool {
+		size := varbindSize(pdu)
+		if used+size > budget {
+			full = true
+			return false
 		}
+		used += size
+		vars = append(vars, pdu)
+		return true
+	}
 
-		// For repeaters, get multiple consecutive OIDs
-		currentOID := v.Name
-		for r := 0; r < maxRepeaters; r++ {
-			va.mu.RLock()
-			nextOID, val := va.getNextOID(indexManager, oidDB, currentOID)
-			va.mu.RUnlock()
+	// Non-repeaters get one successor each
+	for i := 0; i < nonRepeaters && i < len(req.Variables) && !full; i++ {
+		nextOID, val := va.getNextOID(st, indexManager, oidDB, req.Variables[i].Name)
 
-			if val == nil || val.Type == gosnmp.EndOfMibView {
-				break
-			}
+		if val != nil && val.Type == store.NoResponse {
+			return nil
+		}
+		if val != nil {
 			pdu := gosnmp.SnmpPDU{
 				Name:  nextOID,
 				Type:  val.Type,
 				Value: val.Value,
 			}
 
-			applied, err := va.applyVariations(now, pdu)
+			applied, err := va.applyVariations(st, now, pdu)
 			if err != nil {
 				if errors.Is(err, variation.ErrDropOID) {
-					currentOID = nextOID
 					continue
 				}
 				if errors.Is(err, variation.ErrTimeout) {
@@ -718,29 +1083,106 @@ func (va *VirtualAgent) handleGetBulkRequest(req *gosnmp.SnmpPacket, oidDB *stor
 				applied = pdu
 			}
 
-			vars = append(vars, applied)
-			currentOID = nextOID
+			add(applied)
 		}
 	}
 
-	outPacket := va.buildResponseFromRequest(req, vars, gosnmp.NoError, 0)
+	// Repeaters advance together, one successor each per repetition, so the
+	// Nth repetition of every column precedes the (N+1)th (RFC 3416 section
+	// 4.2.3). An exhausted column keeps answering endOfMibView so every
+	// repetition holds one varbind per repeater; the repetitions stop once
+	// all columns are exhausted.
+	var cursors []string
+	if nonRepeaters < len(req.Variables) {
+		for _, v := range req.Variables[nonRepeaters:] {
+			cursors = append(cursors, v.Name)
+		}
+	}
+	ended := make([]bool, len(cursors))
+	for r := 0; r < maxRepeaters && len(cursors) > 0 && !full; r++ {
+		allEnded := true
+		for i := range cursors {
+			pdu, abort := va.nextBulkVarbind(st, indexManager, oidDB, now, cursors[i], ended[i])
+			if abort {
+				return nil
+			}
+			if !add(pdu) {
+				break
+			}
+			cursors[i] = pdu.Name
+			ended[i] = pdu.Type == gosnmp.EndOfMibView
+			allEnded = allEnded && ended[i]
+		}
+		if allEnded {
+			break
+		}
+	}
 
-	data, err := marshalPacket(outPacket)
-	if err != nil {
-		log.Printf("Device %d: Failed to marshal GETBULK response: %v", va.deviceID, err)
-		return nil
+	// The estimate is close; should it fall short, drop trailing varbinds
+	// covering the excess and marshal again
+	for {
+		if full && len(vars) == 0 {
+			// not even one varbind fits (RFC 3416 section 4.2.1)
+			response.Error = gosnmp.TooBig
+		}
+		response.Variables = vars
+		data, err := marshalPacket(response)
+		if err != nil {
+			log.Printf("Device %d: Failed to marshal GETBULK response: %v", va.deviceID, err)
+			return nil
+		}
+		if len(data) <= maxSize || len(vars) == 0 {
+			return data
+		}
+		full = true
+		for excess := len(data) - maxSize; excess > 0 && len(vars) > 0; vars = vars[:len(vars)-1] {
+			excess -= varbindSize(vars[len(vars)-1])
+		}
 	}
+}
 
-	return data
+// maxBulkResponseSize is the largest GETBULK response the agent sends to req:
+// its configured limit, or the msgMaxSize of an SNMPv3 request if smaller
+func (va *VirtualAgent) maxBulkResponseSize(st *agentState, req *gosnmp.SnmpPacket) int {
+	limit := st.maxRespSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
+	}
+	if req.Version == gosnmp.Version3 && req.MsgMaxSize > 0 && int(req.MsgMaxSize) < limit {
+		limit = int(req.MsgMaxSize)
+	}
+	return limit
 }
 
-// handleSetRequest returns read-only error response
-func (va *VirtualAgent) handleSetRequest(req *gosnmp.SnmpPacket) []byte {
-	for _, variable := range req.Variables {
-		va.emitSetEvent(variable)
+// handleSetRequest writes the varbinds into the device overlay when every
+// OID is writable. Otherwise nothing is written and, per RFC 3416, the
+// response carries the request's varbinds with the error of the first
+// failing one: notWritable for an OID the agent holds, and noCreation (or
+// the configured unknown-OID error) for one it does not. SNMPv1 requests get
+// noSuchName instead, as RFC 2576 maps both. SetEvents are raised only for
+// a SET that was applied.
+func (va *VirtualAgent) handleSetRequest(st *agentState, req *gosnmp.SnmpPacket, oidDB *store.OIDDatabase) []byte {
+	errCode, errIndex := gosnmp.NoError, uint8(0)
+	for i, variable := range req.Variables {
+		if status := va.setStatus(st, oidDB, variable); status != gosnmp.NoError {
+			errCode, errIndex = status, uint8(i+1)
+			break
+		}
+	}
+	if errCode == gosnmp.NoError {
+		for _, variable := range req.Variables {
+			va.SetOIDValue(normalizeOID(variable.Name), &store.OIDValue{Type: variable.Type, Value: variable.Value})
+		}
+		// only writes that took effect are reported, so a rejected SET
+		// raises no event or trap
+		for _, variable := range req.Variables {
+			va.emitSetEvent(st, variable)
+		}
+	} else if req.Version == gosnmp.Version1 {
+		errCode = v1SetError(errCode)
 	}
 
-	outPacket := va.buildResponseFromRequest(req, []gosnmp.SnmpPDU{}, 4, 1)
+	outPacket := va.buildResponseFromRequest(req, req.Variables, errCode, errIndex)
 
 	data, err := marshalPacket(outPacket)
 	if err != nil {
@@ -751,17 +1193,49 @@ func (va *VirtualAgent) handleSetRequest(req *gosnmp.SnmpPacket) []byte {
 	return data
 }
 
-func (va *VirtualAgent) applyVariations(now time.Time, pdu gosnmp.SnmpPDU) (gosnmp.SnmpPDU, error) {
-	va.mu.RLock()
-	binder := va.variations
-	hook := va.variationHook
-	va.mu.RUnlock()
+// setStatus returns the error a SET of variable answers, or NoError when the
+// agent accepts the write. A writable OID the agent already holds only takes
+// values of the stored type; one it does not hold takes any type.
+func (va *VirtualAgent) setStatus(st *agentState, oidDB *store.OIDDatabase, variable gosnmp.SnmpPDU) gosnmp.SNMPError {
+	oid := normalizeOID(variable.Name)
+	val := va.getOIDValue(st, oidDB, oid)
+	held := val != nil && val.Type != gosnmp.NoSuchObject
+	if len(st.writable) > 0 && (store.OIDFilter{Include: st.writable}).Allows(oid) {
+		if held && val.Type != store.NoResponse && val.Type != variable.Type {
+			return gosnmp.WrongType
+		}
+		return gosnmp.NoError
+	}
+	if held {
+		return gosnmp.NotWritable
+	}
+	if st.unknownSetErr != gosnmp.NoError {
+		return st.unknownSetErr
+	}
+	return gosnmp.NoCreation
+}
+
+// v1SetError maps a SET error to its SNMPv1 equivalent as RFC 3584 does:
+// value errors become badValue, access errors noSuchName
+func v1SetError(status gosnmp.SNMPError) gosnmp.SNMPError {
+	switch status {
+	case gosnmp.WrongType, gosnmp.WrongLength, gosnmp.WrongEncoding, gosnmp.WrongValue, gosnmp.InconsistentValue:
+		return gosnmp.BadValue
+	case gosnmp.ResourceUnavailable, gosnmp.CommitFailed, gosnmp.UndoFailed:
+		return gosnmp.GenErr
+	}
+	return gosnmp.NoSuchName
+}
+
+func (va *VirtualAgent) applyVariations(st *agentState, now time.Time, pdu gosnmp.SnmpPDU) (gosnmp.SnmpPDU, error) {
+	binder := st.variations
+	hook := st.variationHook
 
 	if binder == nil {
 		return pdu, nil
 	}
 
-	applied, err := binder.Apply(now, pdu)
+	applied, event, err := binder.ApplyEvent(now, va.deviceID, pdu)
 	if err != nil {
 		if hook != nil {
 			hook(VariationEvent{DeviceID: va.deviceID, Port: va.port, OID: pdu.Name, Detail: err.Error()})
@@ -769,53 +1243,142 @@ func (va *VirtualAgent) applyVariations(now time.Time, pdu gosnmp.SnmpPDU) (gosn
 		return applied, err
 	}
 
-	if hook != nil && (applied.Type != pdu.Type || fmt.Sprint(applied.Value) != fmt.Sprint(pdu.Value)) {
+	// Transitions such as a flap's link-down are reported as their own detail
+	if hook != nil && event != "" {
+		hook(VariationEvent{DeviceID: va.deviceID, Port: va.port, OID: pdu.Name, Detail: event})
+	} else if hook != nil && (applied.Type != pdu.Type || fmt.Sprint(applied.Value) != fmt.Sprint(pdu.Value)) {
 		hook(VariationEvent{DeviceID: va.deviceID, Port: va.port, OID: pdu.Name, Detail: "value-changed"})
 	}
 
 	return applied, nil
 }
 
-func (va *VirtualAgent) emitSetEvent(variable gosnmp.SnmpPDU) {
-	va.mu.RLock()
-	hook := va.setHook
-	va.mu.RUnlock()
+// Errors returned by TriggerVariation
+var (
+	ErrNoVariationBinding = errors.New("no variation binding covers the OID")
+	ErrNoSuchOID          = errors.New("the agent has no value for the OID")
+)
+
+// TriggerVariation applies the variation chain bound to oid once, exactly as
+// a poll would, and raises a variation event with detail "manual-trigger"
+// whether or not the value changed. It returns the varied value; a chain
+// that drops or delays the OID reports that as the event detail instead.
+func (va *VirtualAgent) TriggerVariation(oid string) (gosnmp.SnmpPDU, error) {
+	st := va.state.Load()
+	if !st.variations.Bound(oid) {
+		return gosnmp.SnmpPDU{}, ErrNoVariationBinding
+	}
+	val := va.resolveOIDValue(st, st.oidDB, oid)
+	if val == nil || val.Type == gosnmp.NoSuchObject || val.Type == store.NoResponse {
+		return gosnmp.SnmpPDU{}, ErrNoSuchOID
+	}
+
+	pdu := gosnmp.SnmpPDU{Name: "." + normalizeOID(oid), Type: val.Type, Value: val.Value}
+	detail := "manual-trigger"
+	applied, err := st.variations.ApplyDevice(time.Now(), va.deviceID, pdu)
+	if err != nil {
+		detail = err.Error()
+		applied = pdu
+	}
+	if hook := st.variationHook; hook != nil {
+		hook(VariationEvent{DeviceID: va.deviceID, Port: va.port, OID: pdu.Name, Detail: detail})
+	}
+	return applied, nil
+}
+
+func (va *VirtualAgent) emitSetEvent(st *agentState, variable gosnmp.SnmpPDU) {
+	hook := st.setHook
 	if hook == nil {
 		return
 	}
+	value, err := snmprecfmt.ValueString(variable.Type, variable.Value)
+	if err != nil {
+		value = fmt.Sprint(variable.Value)
+	}
 	hook(SetEvent{
 		DeviceID: va.deviceID,
 		Port:     va.port,
 		OID:      normalizeOID(variable.Name),
 		Type:     variable.Type.String(),
-		Value:    fmt.Sprint(variable.Value),
+		Value:    value,
 	})
 }
 
-// getOIDValue retrieves the value for a specific OID
+// getOIDValue retrieves the value for a specific OID, following value
+// references (ref:OID) to the value they point at
+func (va *VirtualAgent) getOIDValue(st *agentState, oidDB *store.OIDDatabase, oid string) *store.OIDValue {
+	if st.oidQueryHook != nil {
+		st.oidQueryHook(oid)
+	}
+	return va.resolveOIDValue(st, oidDB, oid)
+}
+
+// resolveOIDValue is getOIDValue for lookups the agent makes on its own
+// behalf, which the OID query hook does not count
+func (va *VirtualAgent) resolveOIDValue(st *agentState, oidDB *store.OIDDatabase, oid string) *store.OIDValue {
+	return va.resolveRef(st, oidDB, va.lookupOIDValue(st, oidDB, oid), nil)
+}
+
+// maxRefDepth bounds how many value references one lookup follows
+const maxRefDepth = 16
+
+// resolveRef replaces a store.ValueRef value with the referenced OID's
+// current value. seen holds the references followed so far; a cycle, a
+// chain longer than maxRefDepth or an unusable source answers noSuchObject.
+func (va *VirtualAgent) resolveRef(st *agentState, oidDB *store.OIDDatabase, val *store.OIDValue, seen []string) *store.OIDValue {
+	if val == nil {
+		return nil
+	}
+	ref, ok := val.Value.(*store.ValueRef)
+	if !ok {
+		return val
+	}
+	for _, oid := range seen {
+		if oid == ref.OID {
+			log.Printf("Device %d: reference cycle through %s", va.deviceID, ref.OID)
+			return &store.OIDValue{Type: gosnmp.NoSuchObject, Value: nil}
+		}
+	}
+	if len(seen) >= maxRefDepth {
+		log.Printf("Device %d: reference chain through %s exceeds %d hops", va.deviceID, ref.OID, maxRefDepth)
+		return &store.OIDValue{Type: gosnmp.NoSuchObject, Value: nil}
+	}
+	source := va.resolveRef(st, oidDB, va.lookupOIDValue(st, oidDB, ref.OID), append(seen, ref.OID))
+	if source == nil || source.Type == gosnmp.NoSuchObject || source.Type == store.NoResponse {
+		return &store.OIDValue{Type: gosnmp.NoSuchObject, Value: nil}
+	}
+	resolved, err := ref.Resolve(val.Type, source)
+	if err != nil {
+		log.Printf("Device %d: %v", va.deviceID, err)
+		return &store.OIDValue{Type: gosnmp.NoSuchObject, Value: nil}
+	}
+	return resolved
+}
+
+// lookupOIDValue returns the stored value of oid without resolving references
 // Priority: device mapping (port/device-specific) > device overlay > system OIDs > OID database
-func (va *VirtualAgent) getOIDValue(oidDB *store.OIDDatabase, oid string) *store.OIDValue {
+func (va *VirtualAgent) lookupOIDValue(st *agentState, oidDB *store.OIDDatabase, oid string) *store.OIDValue {
 	if oidDB == nil {
 		return &store.OIDValue{Type: gosnmp.NoSuchObject, Value: nil}
 	}
 	oid = normalizeOID(oid)
+	if !st.oidFilter.Allows(oid) {
+		return &store.OIDValue{Type: gosnmp.NoSuchObject, Value: nil}
+	}
 	// Check device mapping first (highest priority)
-	if va.deviceMapping != nil {
-		if val := va.deviceMapping.GetOID(oid, va.port, va.sysName); val != nil {
+	if st.deviceMapping != nil {
+		if val := st.deviceMapping.GetOID(oid, va.port, va.sysName); val != nil {
 			return val
 		}
 	}
 
 	// Check device overlay second
-	if val, ok := va.deviceOverlay[oid]; ok {
-		return &store.OIDValue{
-			Type:  gosnmp.OctetString,
-			Value: val,
-		}
+	if val := va.overlayValue(oid); val != nil {
+		return val
 	}
 
 	// Check for special system OIDs
-	if val := va.getSystemOID(oid); val != nil {
+	if val := va.getSystemOID(st, oid); val != nil {
 		return val
 	}
 
@@ -832,9 +1395,40 @@ func (va *VirtualAgent) getOIDValue(oidDB *store.OIDDatabase, oid string) *store
 	}
 }
 
+// echoValue describes the answering agent and the request's security context
+func (va *VirtualAgent) echoValue(req *gosnmp.SnmpPacket) *store.OIDValue {
+	user := usmUserName(req)
+	return &store.OIDValue{
+		Type: gosnmp.OctetString,
+		Value: fmt.Sprintf("device=%d port=%d sysName=%s version=%s community=%q context=%q user=%q",
+			va.deviceID, va.port, va.sysName, req.Version, req.Community, req.ContextName, user),
+	}
+}
+
+// usmUserName returns the v3 user name of req, "" for v1/v2c
+func usmUserName(req *gosnmp.SnmpPacket) string {
+	if usm, ok := req.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok && usm != nil {
+		return usm.UserName
+	}
+	return ""
+}
+
 // getNextOID retrieves the next OID after the given one
-// Uses index manager if available for table-aware traversal (Zabbix LLD)
-func (va *VirtualAgent) getNextOID(indexManager *store.OIDIndexManager, oidDB *store.OIDDatabase, oid string) (string, *store.OIDValue) {
+// Uses index manager if available for table-aware traversal (Zabbix LLD).
+// An exhausted walk yields the requested OID with an endOfMibView value.
+func (va *VirtualAgent) getNextOID(st *agentState, indexManager *store.OIDIndexManager, oidDB *store.OIDDatabase, oid string) (string, *store.OIDValue) {
+	if st.oidQueryHook != nil {
+		st.oidQueryHook(oid)
+	}
+	nextOID, val := va.lookupNextOID(st, indexManager, oidDB, oid)
+	val = va.resolveRef(st, oidDB, val, nil)
+	if nextOID == "" || val == nil || val.Type == gosnmp.EndOfMibView {
+		return normalizeOID(oid), &store.OIDValue{Type: gosnmp.EndOfMibView, Value: nil}
+	}
+	return nextOID, val
+}
+
+func (va *VirtualAgent) lookupNextOID(st *agentState, indexManager *store.OIDIndexManager, oidDB *store.OIDDatabase, oid string) (string, *store.OIDValue) {
 	if oidDB == nil {
 		return normalizeOID(oid), &store.OIDValue{Type: gosnmp.EndOfMibView, Value: nil}
 	}
@@ -845,9 +1439,23 @@ func (va *VirtualAgent) getNextOID(indexManager *store.OIDIndexManager, oidDB *s
 		// If index manager returned a value with unknown type (0/EndOfContents),
 		// resolve the proper type from the OID database or system OIDs.
 		if val != nil && val.Type == gosnmp.EndOfContents {
-			if resolved := va.getOIDValue(oidDB, nextOID); resolved != nil && resolved.Type != gosnmp.NoSuchObject {
+			if resolved := va.resolveOIDValue(st, oidDB, nextOID); resolved != nil && resolved.Type != gosnmp.NoSuchObject {
 				val = resolved
 			}
+		} else if val != nil && val.Type != gosnmp.EndOfMibView {
+			// The index holds the shared dataset value; walks must see the
+			// same per-device, overlay and system overrides a GET would
+			var mapped *store.OIDValue
+			if st.deviceMapping != nil {
+				mapped = st.deviceMapping.GetOID(nextOID, va.port, va.sysName)
+			}
+			if mapped != nil {
+				val = mapped
+			} else if overlaid := va.overlayValue(nextOID); overlaid != nil {
+				val = overlaid
+			} else if override := st.systemOverride(nextOID); override != nil {
+				val = override
+			}
 		}
 		return nextOID, val
 	}
@@ -861,10 +1469,26 @@ func (va *VirtualAgent) getNextOID(indexManager *store.OIDIndexManager, oidDB *s
 		}
 	}
 
-	value := va.getOIDValue(oidDB, nextOID)
+	value := va.resolveOIDValue(st, oidDB, nextOID)
 	return nextOID, value
 }
 
+// overlayValue returns the device overlay value of oid, or nil when the
+// overlay does not hold it
+func (va *VirtualAgent) overlayValue(oid string) *store.OIDValue {
+	val, ok := va.overlay.Load().Load(oid)
+	if !ok {
+		return nil
+	}
+	if typed, ok := val.(*store.OIDValue); ok {
+		return typed
+	}
+	return &store.OIDValue{
+		Type:  gosnmp.OctetString,
+		Value: val,
+	}
+}
+
 func normalizeOID(oid string) string {
 	if len(oid) > 0 && oid[0] == '.' {
 		return oid[1:]
@@ -873,10 +1497,13 @@ func normalizeOID(oid string) string {
 }
 
 // getSystemOID returns system-specific OID values
-func (va *VirtualAgent) getSystemOID(oid string) *store.OIDValue {
+func (va *VirtualAgent) getSystemOID(st *agentState, oid string) *store.OIDValue {
 	switch oid {
+	case "1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.2.0", "1.3.6.1.2.1.1.4.0":
+		return st.systemOverride(oid)
+
 	case "1.3.6.1.2.1.1.3.0": // sysUpTime
-		uptime := uint32(time.Since(va.startTime).Seconds() * 100)
+		uptime := uint32((time.Since(st.startTime) + st.bootOffset) / (10 * time.Millisecond))
 		return &store.OIDValue{
 			Type:  gosnmp.TimeTicks,
 			Value: uptime,
@@ -905,19 +1532,100 @@ func (va *VirtualAgent) getSystemOID(oid string) *store.OIDValue {
 	return nil
 }
 
-// SetOIDValue sets a device-specific OID value (overlay)
+// systemOverride returns the configured value of sysDescr, sysObjectID or
+// sysContact, or nil when oid has none
+func (st *agentState) systemOverride(oid string) *store.OIDValue {
+	switch {
+	case oid == "1.3.6.1.2.1.1.1.0" && st.system.SysDescr != "":
+		return &store.OIDValue{Type: gosnmp.OctetString, Value: st.system.SysDescr}
+	case oid == "1.3.6.1.2.1.1.2.0" && st.system.SysObjectID != "":
+		return &store.OIDValue{Type: gosnmp.ObjectIdentifier, Value: st.system.SysObjectID}
+	case oid == "1.3.6.1.2.1.1.4.0" && st.system.SysContact != "":
+		return &store.OIDValue{Type: gosnmp.OctetString, Value: st.system.SysContact}
+	}
+	return nil
+}
+
+// SetOIDValue sets a device-specific OID value (overlay). A *store.OIDValue
+// is served with its own type; any other value is served as an OctetString.
 func (va *VirtualAgent) SetOIDValue(oid string, value interface{}) {
-	va.mu.Lock()
-	defer va.mu.Unlock()
-	va.deviceOverlay[oid] = value
+	va.overlay.Load().Store(oid, value)
+}
+
+// OverlaySnapshot returns a copy of the device overlay values in snmprec
+// "type|value" form, so RestoreOverlay serves each one with the type it had.
+// Untyped overlay values are recorded as octetstring, the type they are
+// served with.
+func (va *VirtualAgent) OverlaySnapshot() map[string]string {
+	out := make(map[string]string)
+	va.overlay.Load().Range(func(key, value interface{}) bool {
+		oid := key.(string)
+		typ, text := gosnmp.OctetString, ""
+		switch v := value.(type) {
+		case string:
+			text = v
+		case []byte:
+			text = string(v)
+		case *store.OIDValue:
+			typ = v.Type
+			var err error
+			if text, err = snmprecfmt.ValueString(v.Type, v.Value); err != nil {
+				text = fmt.Sprint(v.Value)
+			}
+		default:
+			text = fmt.Sprint(v)
+		}
+		out[oid] = snmprecfmt.TypeName(typ) + "|" + text
+		return true
+	})
+	return out
+}
+
+// RestoreOverlay replaces the device overlay with values, dropping any
+// overlay entries that are not in it. Values are in the "type|value" form
+// OverlaySnapshot returns; a value without a known type prefix is restored
+// as a plain string.
+func (va *VirtualAgent) RestoreOverlay(values map[string]string) {
+	overlay := &sync.Map{}
+	for oid, value := range values {
+		overlay.Store(oid, restoreOverlayValue(value))
+	}
+	va.overlay.Store(overlay)
+}
+
+func restoreOverlayValue(value string) interface{} {
+	typeName, text, ok := strings.Cut(value, "|")
+	if !ok {
+		return value
+	}
+	typ := store.GetSNMPType(typeName)
+	parsed, err := store.ParseOIDValue(typeName, text)
+	if err != nil || typ == store.NoResponse {
+		return value
+	}
+	return &store.OIDValue{Type: typ, Value: parsed}
+}
+
+// ResolveOID returns the current value of oid on this agent's default dataset.
+// It implements traps.Resolver for trap varbind templates.
+func (va *VirtualAgent) ResolveOID(oid string) (gosnmp.SnmpPDU, bool) {
+	st := va.state.Load()
+	val := va.resolveOIDValue(st, st.oidDB, oid)
+	if val == nil || val.Type == gosnmp.NoSuchObject || val.Type == store.NoResponse {
+		return gosnmp.SnmpPDU{}, false
+	}
+	return gosnmp.SnmpPDU{Name: "." + normalizeOID(oid), Type: val.Type, Value: val.Value}, true
+}
+
+// ResetPollCount zeroes the poll counter and returns the count it held.
+// Polls racing the reset land on one side of it, never both.
+func (va *VirtualAgent) ResetPollCount() int64 {
+	return va.pollCount.Swap(0)
 }
 
 // GetStatistics returns agent statistics
 func (va *VirtualAgent) GetStatistics() map[string]interface{} {
-	va.mu.RLock()
-	defer va.mu.RUnlock()
-
-	uptime := uint32(time.Since(va.startTime).Seconds())
+	uptime := va.state.Load().engineTime()
 	lastPoll := time.Unix(0, va.lastPollNanos.Load()).Format(time.RFC3339)
 	return map[string]interface{}{
 		"device_id":  va.deviceID,
@@ -926,5 +1634,6 @@ func (va *VirtualAgent) GetStatistics() map[string]interface{} {
 		"uptime":     uptime,
 		"poll_count": va.pollCount.Load(),
 		"last_poll":  lastPoll,
+		"enabled":    va.Enabled(),
 	}
 }
@@ -1,11 +1,19 @@
 package agent
 
 import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/routing"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/variation"
+	"github.com/gosnmp/gosnmp"
 )
 
 func TestHandlePacketUpdatesPollStatsConcurrently(t *testing.T) {
@@ -32,3 +40,1087 @@ func TestHandlePacketUpdatesPollStatsConcurrently(t *testing.T) {
 		t.Fatalf("last_poll not populated: %v", stats["last_poll"])
 	}
 }
+
+func TestV3DiscoveryReportIncrementsUnknownEngineIDs(t *testing.T) {
+	cfg := v3.Config{Enabled: true, EngineID: v3.GenerateEngineID("usm-stats"), Username: "simuser"}
+	va := NewVirtualAgent(1, 20000, "device-1", store.NewOIDDatabase(), cfg, 1)
+
+	for i := uint32(1); i <= 3; i++ {
+		discovery := &gosnmp.SnmpPacket{
+			Version:            gosnmp.Version3,
+			MsgFlags:           gosnmp.NoAuthNoPriv | gosnmp.Reportable,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			SecurityParameters: &gosnmp.UsmSecurityParameters{Logger: gosnmp.NewLogger(nil)},
+			PDUType:            gosnmp.GetRequest,
+			MsgID:              i,
+			RequestID:          i,
+			MsgMaxSize:         65507,
+			Logger:             gosnmp.NewLogger(nil),
+		}
+		raw, err := discovery.MarshalMsg()
+		if err != nil {
+			t.Fatalf("marshal discovery: %v", err)
+		}
+
+		resp := va.HandlePacket(raw)
+		if resp == nil {
+			t.Fatalf("discovery %d: no report returned", i)
+		}
+		decoder := gosnmp.GoSNMP{
+			Version:            gosnmp.Version3,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			MsgFlags:           gosnmp.NoAuthNoPriv,
+			SecurityParameters: &gosnmp.UsmSecurityParameters{UserName: "simuser"},
+			Logger:             gosnmp.NewLogger(nil),
+		}
+		report, err := decoder.SnmpDecodePacket(resp)
+		if err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		if report.PDUType != gosnmp.Report || len(report.Variables) != 1 {
+			t.Fatalf("unexpected report: %+v", report)
+		}
+		vb := report.Variables[0]
+		if vb.Name != v3.USMStatsUnknownEngineIDOID {
+			t.Fatalf("report OID = %s, want %s", vb.Name, v3.USMStatsUnknownEngineIDOID)
+		}
+		if got := gosnmp.ToBigInt(vb.Value).Uint64(); got != uint64(i) {
+			t.Fatalf("discovery %d: usmStatsUnknownEngineIDs = %d", i, got)
+		}
+	}
+
+	if got := va.usmStats.Value(v3.USMStatsWrongDigestOID); got != 0 {
+		t.Fatalf("wrongDigests = %d, want 0", got)
+	}
+}
+
+func marshalV2cRequest(t *testing.T, pduType gosnmp.PDUType, oids ...string) []byte {
+	t.Helper()
+	vars := make([]gosnmp.SnmpPDU, 0, len(oids))
+	for _, oid := range oids {
+		vars = append(vars, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.Null})
+	}
+	pkt := &gosnmp.SnmpPacket{
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		PDUType:   pduType,
+		RequestID: 1,
+		Variables: vars,
+		Logger:    gosnmp.NewLogger(nil),
+	}
+	raw, err := pkt.MarshalMsg()
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	return raw
+}
+
+func decodeV2cResponse(t *testing.T, raw []byte) *gosnmp.SnmpPacket {
+	t.Helper()
+	if raw == nil {
+		t.Fatal("no response")
+	}
+	decoder := gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	pkt, err := decoder.SnmpDecodePacket(raw)
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return pkt
+}
+
+func TestGetNextPastLastOIDReturnsEndOfMibView(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.2.1.1.1.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "first"})
+	db.Insert("1.3.6.1.9.9.9.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "last"})
+	db.SortOIDs()
+
+	for _, withIndex := range []bool{false, true} {
+		va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+		if withIndex {
+			im := store.NewOIDIndexManager()
+			if err := im.BuildIndex(db); err != nil {
+				t.Fatalf("build index: %v", err)
+			}
+			va.SetIndexManager(im)
+		}
+
+		resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetNextRequest, ".1.3.6.1.2.1.1.1.0", ".1.3.6.1.9.9.9.0")))
+		if len(resp.Variables) != 2 {
+			t.Fatalf("index=%v: got %d varbinds, want 2", withIndex, len(resp.Variables))
+		}
+		if vb := resp.Variables[0]; vb.Name != ".1.3.6.1.9.9.9.0" || vb.Type != gosnmp.OctetString {
+			t.Fatalf("index=%v: first varbind = %+v", withIndex, vb)
+		}
+		if vb := resp.Variables[1]; vb.Name != ".1.3.6.1.9.9.9.0" || vb.Type != gosnmp.EndOfMibView {
+			t.Fatalf("index=%v: last varbind = %+v, want endOfMibView on the requested OID", withIndex, vb)
+		}
+	}
+}
+
+func TestGetNextSeesOverlayAfterSet(t *testing.T) {
+	const oid = "1.3.6.1.4.1.55555.4.1.0"
+	db := store.NewOIDDatabase()
+	db.Insert(oid, &store.OIDValue{Type: gosnmp.Integer, Value: 1})
+	db.SortOIDs()
+
+	for _, withIndex := range []bool{false, true} {
+		va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+		if withIndex {
+			im := store.NewOIDIndexManager()
+			if err := im.BuildIndex(db); err != nil {
+				t.Fatalf("build index: %v", err)
+			}
+			va.SetIndexManager(im)
+		}
+		if err := va.SetWritableOIDs([]string{oid}); err != nil {
+			t.Fatalf("set writable OIDs: %v", err)
+		}
+
+		set := decodeV2cResponse(t, va.HandlePacket(marshalV2cSet(t, gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.Integer, Value: 2})))
+		if set.Error != gosnmp.NoError {
+			t.Fatalf("index=%v: SET error = %v", withIndex, set.Error)
+		}
+
+		resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetNextRequest, ".1.3.6.1.4.1.55555.4")))
+		if vb := resp.Variables[0]; vb.Name != "."+oid || vb.Type != gosnmp.Integer || vb.Value != 2 {
+			t.Fatalf("index=%v: GETNEXT after SET = %+v, want the SET value", withIndex, vb)
+		}
+	}
+}
+
+func TestSystemInfoOverridesDataset(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.2.1.1.1.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "dataset descr"})
+	db.Insert("1.3.6.1.2.1.1.2.0", &store.OIDValue{Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.8072.3.2.10"})
+	db.Insert("1.3.6.1.2.1.1.4.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "dataset contact"})
+	db.SortOIDs()
+
+	for _, withIndex := range []bool{false, true} {
+		va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+		if withIndex {
+			im := store.NewOIDIndexManager()
+			if err := im.BuildIndex(db); err != nil {
+				t.Fatalf("build index: %v", err)
+			}
+			va.SetIndexManager(im)
+		}
+		if err := va.SetSystemInfo(SystemInfo{SysDescr: "Cisco IOS XE 17.9", SysObjectID: "1.3.6.1.4.1.9.1.2494"}); err != nil {
+			t.Fatalf("set system info: %v", err)
+		}
+
+		get := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetRequest, ".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.2.0", ".1.3.6.1.2.1.1.4.0")))
+		next := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetNextRequest, ".1.3.6.1.2.1.1", ".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.3")))
+		for _, resp := range []*gosnmp.SnmpPacket{get, next} {
+			if len(resp.Variables) != 3 {
+				t.Fatalf("index=%v: got %d varbinds, want 3", withIndex, len(resp.Variables))
+			}
+			if got, _ := resp.Variables[0].Value.([]byte); string(got) != "Cisco IOS XE 17.9" {
+				t.Fatalf("index=%v: sysDescr = %q", withIndex, got)
+			}
+			if got := resp.Variables[1]; got.Type != gosnmp.ObjectIdentifier || got.Value != ".1.3.6.1.4.1.9.1.2494" {
+				t.Fatalf("index=%v: sysObjectID = %v %v", withIndex, got.Type, got.Value)
+			}
+			// an empty field keeps the dataset value
+			if got, _ := resp.Variables[2].Value.([]byte); string(got) != "dataset contact" {
+				t.Fatalf("index=%v: sysContact = %q", withIndex, got)
+			}
+		}
+	}
+
+	va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+	if err := va.SetSystemInfo(SystemInfo{SysObjectID: "enterprises.9"}); err == nil {
+		t.Fatal("SetSystemInfo accepted a non-numeric sysObjectID")
+	}
+}
+
+func TestGetBulkPastLastOIDReturnsEndOfMibView(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.2.1.1.1.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "first"})
+	db.Insert("1.3.6.1.9.9.9.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "last"})
+	db.SortOIDs()
+	va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+
+	req := &gosnmp.SnmpPacket{
+		Version:        gosnmp.Version2c,
+		Community:      "public",
+		PDUType:        gosnmp.GetBulkRequest,
+		RequestID:      1,
+		MaxRepetitions: 5,
+		Variables:      []gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.Null}},
+		Logger:         gosnmp.NewLogger(nil),
+	}
+	raw, err := req.MarshalMsg()
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	resp := decodeV2cResponse(t, va.HandlePacket(raw))
+	if len(resp.Variables) != 2 {
+		t.Fatalf("got %d varbinds, want 2: %+v", len(resp.Variables), resp.Variables)
+	}
+	if vb := resp.Variables[0]; vb.Name != ".1.3.6.1.9.9.9.0" || vb.Type != gosnmp.OctetString {
+		t.Fatalf("first varbind = %+v", vb)
+	}
+	if vb := resp.Variables[1]; vb.Name != ".1.3.6.1.9.9.9.0" || vb.Type != gosnmp.EndOfMibView {
+		t.Fatalf("last varbind = %+v, want endOfMibView after the last OID", vb)
+	}
+}
+
+func TestEchoOIDReportsRequestMetadata(t *testing.T) {
+	va := NewVirtualAgent(3, 20003, "device-3", store.NewOIDDatabase(), v3.Config{}, 1)
+
+	get := func() gosnmp.SnmpPDU {
+		req := &gosnmp.SnmpPacket{
+			Version:   gosnmp.Version2c,
+			Community: "lab-ro",
+			PDUType:   gosnmp.GetRequest,
+			RequestID: 1,
+			Variables: []gosnmp.SnmpPDU{{Name: "." + EchoOID, Type: gosnmp.Null}},
+			Logger:    gosnmp.NewLogger(nil),
+		}
+		raw, err := req.MarshalMsg()
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		resp := decodeV2cResponse(t, va.HandlePacket(raw))
+		if len(resp.Variables) != 1 {
+			t.Fatalf("got %d varbinds, want 1", len(resp.Variables))
+		}
+		return resp.Variables[0]
+	}
+
+	if vb := get(); vb.Type != gosnmp.NoSuchObject {
+		t.Fatalf("echo OID answered with debug OIDs disabled: %+v", vb)
+	}
+
+	va.SetDebugOIDs(true)
+	vb := get()
+	if vb.Type != gosnmp.OctetString {
+		t.Fatalf("echo varbind = %+v, want an OctetString", vb)
+	}
+	echo := string(vb.Value.([]byte))
+	for _, want := range []string{"device=3", "port=20003", "version=2c", `community="lab-ro"`} {
+		if !strings.Contains(echo, want) {
+			t.Fatalf("echo %q missing %q", echo, want)
+		}
+	}
+}
+
+func TestGetBulkInterleavesRepeaters(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.4.1.55555.10.0", &store.OIDValue{Type: gosnmp.Integer, Value: 7})
+	for i := 1; i <= 4; i++ {
+		db.Insert(fmt.Sprintf("1.3.6.1.4.1.55555.20.1.1.%d", i), &store.OIDValue{Type: gosnmp.Integer, Value: i})
+		db.Insert(fmt.Sprintf("1.3.6.1.4.1.55555.20.1.2.%d", i), &store.OIDValue{Type: gosnmp.OctetString, Value: fmt.Sprintf("eth%d", i)})
+	}
+	db.SortOIDs()
+
+	bulk := func(va *VirtualAgent, nonRepeaters uint8, oids ...string) []string {
+		var vars []gosnmp.SnmpPDU
+		for _, oid := range oids {
+			vars = append(vars, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.Null})
+		}
+		req := &gosnmp.SnmpPacket{
+			Version:        gosnmp.Version2c,
+			Community:      "public",
+			PDUType:        gosnmp.GetBulkRequest,
+			RequestID:      1,
+			NonRepeaters:   nonRepeaters,
+			MaxRepetitions: 3,
+			Variables:      vars,
+			Logger:         gosnmp.NewLogger(nil),
+		}
+		raw, err := req.MarshalMsg()
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		var got []string
+		for _, vb := range decodeV2cResponse(t, va.HandlePacket(raw)).Variables {
+			if vb.Type == gosnmp.EndOfMibView {
+				got = append(got, "end@"+vb.Name)
+			} else {
+				got = append(got, vb.Name)
+			}
+		}
+		return got
+	}
+
+	const col1, col2 = ".1.3.6.1.4.1.55555.20.1.1", ".1.3.6.1.4.1.55555.20.1.2"
+	cases := []struct {
+		nonRepeaters uint8
+		oids         []string
+		want         []string
+	}{
+		{
+			// the non-repeater first, then repetition by repetition
+			nonRepeaters: 1,
+			oids:         []string{".1.3.6.1.4.1.55555.10", col1, col2},
+			want: []string{
+				".1.3.6.1.4.1.55555.10.0",
+				col1 + ".1", col2 + ".1",
+				col1 + ".2", col2 + ".2",
+				col1 + ".3", col2 + ".3",
+			},
+		},
+		{
+			// a column that runs out keeps its place with endOfMibView
+			oids: []string{col1 + ".3", col2 + ".3"},
+			want: []string{
+				col1 + ".4", col2 + ".4",
+				col2 + ".1", "end@" + col2 + ".4",
+				col2 + ".2", "end@" + col2 + ".4",
+			},
+		},
+	}
+	for _, withIndex := range []bool{false, true} {
+		va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+		if withIndex {
+			im := store.NewOIDIndexManager()
+			if err := im.BuildIndex(db); err != nil {
+				t.Fatalf("build index: %v", err)
+			}
+			va.SetIndexManager(im)
+		}
+		for _, c := range cases {
+			got := bulk(va, c.nonRepeaters, c.oids...)
+			if strings.Join(got, " ") != strings.Join(c.want, " ") {
+				t.Fatalf("index=%v bulk %v:\n got %v\nwant %v", withIndex, c.oids, got, c.want)
+			}
+		}
+	}
+}
+
+func TestGetBulkCapsMaxRepetitions(t *testing.T) {
+	db := store.NewOIDDatabase()
+	for i := 1; i <= 300; i++ {
+		db.Insert(fmt.Sprintf("1.3.6.1.4.1.55555.7.%d.0", i), &store.OIDValue{Type: gosnmp.Integer, Value: i})
+	}
+	db.SortOIDs()
+	va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+	va.SetMaxResponseSize(65507) // count repetitions, not bytes
+
+	bulk := func(maxRepetitions uint32) int {
+		req := &gosnmp.SnmpPacket{
+			Version:        gosnmp.Version2c,
+			Community:      "public",
+			PDUType:        gosnmp.GetBulkRequest,
+			RequestID:      1,
+			MaxRepetitions: maxRepetitions,
+			Variables:      []gosnmp.SnmpPDU{{Name: ".1.3.6.1.4.1.55555.7", Type: gosnmp.Null}},
+			Logger:         gosnmp.NewLogger(nil),
+		}
+		raw, err := req.MarshalMsg()
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		return len(decodeV2cResponse(t, va.HandlePacket(raw)).Variables)
+	}
+
+	if got := bulk(100000); got != DefaultMaxRepetitions {
+		t.Fatalf("max-repetitions 100000 returned %d varbinds, want %d", got, DefaultMaxRepetitions)
+	}
+	va.SetMaxRepetitions(20)
+	if got := bulk(100000); got != 20 {
+		t.Fatalf("with cap 20 returned %d varbinds, want 20", got)
+	}
+	if got := bulk(5); got != 5 {
+		t.Fatalf("max-repetitions below the cap returned %d varbinds, want 5", got)
+	}
+}
+
+func TestGetBulkStaysUnderMaxResponseSize(t *testing.T) {
+	db := store.NewOIDDatabase()
+	for i := 1; i <= 300; i++ {
+		db.Insert(fmt.Sprintf("1.3.6.1.4.1.55555.7.%d.0", i), &store.OIDValue{Type: gosnmp.OctetString, Value: strings.Repeat("x", 40)})
+	}
+	db.Insert("1.3.6.1.4.1.55555.8.1.0", &store.OIDValue{Type: gosnmp.OctetString, Value: strings.Repeat("y", 2000)})
+	db.SortOIDs()
+	va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+
+	bulk := func(root string) ([]byte, *gosnmp.SnmpPacket) {
+		req := &gosnmp.SnmpPacket{
+			Version:        gosnmp.Version2c,
+			Community:      "public",
+			PDUType:        gosnmp.GetBulkRequest,
+			RequestID:      1,
+			MaxRepetitions: 100000,
+			Variables:      []gosnmp.SnmpPDU{{Name: root, Type: gosnmp.Null}},
+			Logger:         gosnmp.NewLogger(nil),
+		}
+		raw, err := req.MarshalMsg()
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		out := va.HandlePacket(raw)
+		return out, decodeV2cResponse(t, out)
+	}
+
+	for _, limit := range []int{0, 600, 4000} {
+		va.SetMaxResponseSize(limit)
+		want := limit
+		if want == 0 {
+			want = DefaultMaxResponseSize
+		}
+		raw, resp := bulk(".1.3.6.1.4.1.55555.7")
+		if len(raw) > want {
+			t.Fatalf("limit %d: response is %d bytes", want, len(raw))
+		}
+		if resp.Error != gosnmp.NoError || len(resp.Variables) == 0 {
+			t.Fatalf("limit %d: error %v with %d varbinds", want, resp.Error, len(resp.Variables))
+		}
+		// the varbinds that fit are the first ones, in order
+		for i, vb := range resp.Variables {
+			if wantOID := fmt.Sprintf(".1.3.6.1.4.1.55555.7.%d.0", i+1); vb.Name != wantOID {
+				t.Fatalf("limit %d: varbind %d is %s, want %s", want, i, vb.Name, wantOID)
+			}
+		}
+		// and nearly fill the response: one more would not have fit
+		if len(raw)+varbindSize(resp.Variables[0]) <= want-responseSizeSlack {
+			t.Fatalf("limit %d: response of %d bytes stopped early", want, len(raw))
+		}
+	}
+
+	va.SetMaxResponseSize(0)
+	_, resp := bulk(".1.3.6.1.4.1.55555.8")
+	if resp.Error != gosnmp.TooBig || len(resp.Variables) != 0 {
+		t.Fatalf("oversized first varbind: error %v with %d varbinds, want tooBig and none", resp.Error, len(resp.Variables))
+	}
+}
+
+func TestResponseOverheadMatchesMarshalledSize(t *testing.T) {
+	usm := func(auth gosnmp.SnmpV3AuthProtocol, priv gosnmp.SnmpV3PrivProtocol) *gosnmp.UsmSecurityParameters {
+		return &gosnmp.UsmSecurityParameters{
+			AuthoritativeEngineID:    v3.GenerateEngineID("overhead"),
+			AuthoritativeEngineBoots: 3,
+			AuthoritativeEngineTime:  100000,
+			UserName:                 "simuser",
+			AuthenticationProtocol:   auth,
+			AuthenticationPassphrase: "authpass123",
+			PrivacyProtocol:          priv,
+			PrivacyPassphrase:        "privpass123",
+			Logger:                   gosnmp.NewLogger(nil),
+		}
+	}
+	cases := map[string]*gosnmp.SnmpPacket{
+		"v2c": {Version: gosnmp.Version2c, Community: "public", RequestID: 1234567},
+		"v3 noAuthNoPriv": {Version: gosnmp.Version3, MsgFlags: gosnmp.NoAuthNoPriv, MsgMaxSize: 1472,
+			SecurityParameters: usm(gosnmp.NoAuth, gosnmp.NoPriv)},
+		"v3 authNoPriv SHA256": {Version: gosnmp.Version3, MsgFlags: gosnmp.AuthNoPriv, MsgMaxSize: 65507,
+			SecurityParameters: usm(gosnmp.SHA256, gosnmp.NoPriv)},
+		"v3 authPriv AES": {Version: gosnmp.Version3, MsgFlags: gosnmp.AuthPriv, ContextName: "vlan-1",
+			SecurityParameters: usm(gosnmp.SHA, gosnmp.AES)},
+	}
+	for name, resp := range cases {
+		resp.PDUType = gosnmp.GetResponse
+		resp.Logger = gosnmp.NewLogger(nil)
+		if resp.Version == gosnmp.Version3 {
+			resp.SecurityModel = gosnmp.UserSecurityModel
+			resp.MsgID = 42
+			resp.ContextEngineID = v3.GenerateEngineID("overhead")
+		}
+		want := responseOverhead(resp)
+		raw, err := marshalPacket(resp)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", name, err)
+		}
+		if len(raw) != want {
+			t.Fatalf("%s: responseOverhead = %d, marshalled %d bytes", name, want, len(raw))
+		}
+	}
+}
+
+// sendV3Get sends an authNoPriv GET built from client to va and returns the
+// single varbind of the Report it answers with.
+func sendV3Get(t *testing.T, va *VirtualAgent, client v3.Config, boots, engineTime uint32) gosnmp.SnmpPDU {
+	t.Helper()
+	report := sendV3Request(t, va, client, boots, engineTime)
+	if report.PDUType != gosnmp.Report || len(report.Variables) != 1 {
+		t.Fatalf("unexpected response: %+v", report)
+	}
+	return report.Variables[0]
+}
+
+// sendV3Request sends an authenticated GET of sysName and decodes the reply
+func sendV3Request(t *testing.T, va *VirtualAgent, client v3.Config, boots, engineTime uint32) *gosnmp.SnmpPacket {
+	t.Helper()
+	usm := client.BuildUSM(boots, engineTime)
+	usm.Logger = gosnmp.NewLogger(nil)
+	if err := usm.InitSecurityKeys(); err != nil {
+		t.Fatalf("init client keys: %v", err)
+	}
+	req := &gosnmp.SnmpPacket{
+		Version:            gosnmp.Version3,
+		MsgFlags:           gosnmp.AuthNoPriv | gosnmp.Reportable,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: usm,
+		ContextEngineID:    client.EngineID,
+		PDUType:            gosnmp.GetRequest,
+		MsgID:              1,
+		RequestID:          1,
+		MsgMaxSize:         65507,
+		Variables:          []gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.Null}},
+		Logger:             gosnmp.NewLogger(nil),
+	}
+	raw, err := req.MarshalMsg()
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	resp := va.HandlePacket(raw)
+	if resp == nil {
+		t.Fatal("no response returned")
+	}
+	decoder := gosnmp.GoSNMP{
+		Version:            gosnmp.Version3,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		MsgFlags:           gosnmp.AuthNoPriv,
+		SecurityParameters: va.v3Config.BuildUSM(boots, engineTime),
+		Logger:             gosnmp.NewLogger(nil),
+	}
+	pkt, err := decoder.SnmpDecodePacket(resp)
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return pkt
+}
+
+func TestV3ReportsIncrementUSMErrorCounters(t *testing.T) {
+	cfg := v3.Config{
+		Enabled:  true,
+		EngineID: v3.GenerateEngineID("usm-errors"),
+		Username: "simuser",
+		Auth:     v3.AuthSHA1,
+		AuthKey:  "authpass123",
+	}
+	va := NewVirtualAgent(1, 20000, "device-1", store.NewOIDDatabase(), cfg, 1)
+
+	unknownUser := cfg
+	unknownUser.Username = "intruder"
+	wrongKey := cfg
+	wrongKey.AuthKey = "notthepass"
+
+	for _, tc := range []struct {
+		name       string
+		client     v3.Config
+		boots      uint32
+		engineTime uint32
+		want       string
+	}{
+		{"unknown user", unknownUser, 1, 0, v3.USMStatsUnknownUserNameOID},
+		{"wrong digest", wrongKey, 1, 0, v3.USMStatsWrongDigestOID},
+		{"stale engine time", cfg, 1, 100000, v3.USMStatsNotInTimeWindowOID},
+		{"stale engine boots", cfg, 7, 0, v3.USMStatsNotInTimeWindowOID},
+	} {
+		before := va.usmStats.Value(tc.want)
+		vb := sendV3Get(t, va, tc.client, tc.boots, tc.engineTime)
+		if vb.Name != tc.want {
+			t.Fatalf("%s: report OID = %s, want %s", tc.name, vb.Name, tc.want)
+		}
+		if got := gosnmp.ToBigInt(vb.Value).Uint64(); got != uint64(before)+1 {
+			t.Fatalf("%s: reported counter = %d, want %d", tc.name, got, before+1)
+		}
+	}
+
+	if got := va.usmStats.Value(v3.USMStatsNotInTimeWindowOID); got != 2 {
+		t.Fatalf("notInTimeWindows = %d, want 2", got)
+	}
+	if got := va.usmStats.Value(v3.USMStatsUnknownEngineIDOID); got != 0 {
+		t.Fatalf("unknownEngineIDs = %d, want 0", got)
+	}
+}
+
+func TestV3TimeWindowIsConfigurable(t *testing.T) {
+	cfg := v3.Config{
+		Enabled:  true,
+		EngineID: v3.GenerateEngineID("time-window"),
+		Username: "simuser",
+		Auth:     v3.AuthSHA1,
+		AuthKey:  "authpass123",
+	}
+	narrow := cfg
+	narrow.TimeWindowSeconds = 10
+
+	for _, tc := range []struct {
+		name       string
+		cfg        v3.Config
+		engineTime uint32
+		rejected   bool
+	}{
+		{"default window, 100s skew", cfg, 100, false},
+		{"default window, 200s skew", cfg, 200, true},
+		{"10s window, 5s skew", narrow, 5, false},
+		{"10s window, 100s skew", narrow, 100, true},
+	} {
+		va := NewVirtualAgent(1, 20000, "device-1", store.NewOIDDatabase(), tc.cfg, 1)
+		resp := sendV3Request(t, va, tc.cfg, 1, tc.engineTime)
+		rejected := resp.PDUType == gosnmp.Report && len(resp.Variables) == 1 && resp.Variables[0].Name == v3.USMStatsNotInTimeWindowOID
+		if rejected != tc.rejected || (!rejected && resp.PDUType != gosnmp.GetResponse) {
+			t.Errorf("%s: answered with %v %+v, want rejected=%v", tc.name, resp.PDUType, resp.Variables, tc.rejected)
+		}
+	}
+}
+
+func TestV3OnlyDropsV2cRequests(t *testing.T) {
+	cfg := v3.Config{
+		Enabled:  true,
+		Only:     true,
+		EngineID: v3.GenerateEngineID("v3-only"),
+		Username: "simuser",
+		Auth:     v3.AuthSHA1,
+		AuthKey:  "authpass123",
+	}
+	va := NewVirtualAgent(1, 20000, "device-1", store.NewOIDDatabase(), cfg, 1)
+
+	if resp := va.HandlePacket(marshalV2cRequest(t, gosnmp.GetRequest, ".1.3.6.1.2.1.1.5.0")); resp != nil {
+		t.Fatal("v3-only agent answered a v2c GET")
+	}
+	resp := sendV3Request(t, va, cfg, 1, 0)
+	if resp.PDUType != gosnmp.GetResponse || len(resp.Variables) != 1 || string(resp.Variables[0].Value.([]byte)) != "device-1" {
+		t.Fatalf("v3 GET response = %+v, want sysName device-1", resp)
+	}
+
+	cfg.Only = false
+	va = NewVirtualAgent(1, 20000, "device-1", store.NewOIDDatabase(), cfg, 1)
+	if resp := va.HandlePacket(marshalV2cRequest(t, gosnmp.GetRequest, ".1.3.6.1.2.1.1.5.0")); resp == nil {
+		t.Fatal("agent without v3-only dropped a v2c GET")
+	}
+
+	if err := (v3.Config{Only: true}).Validate(); err == nil {
+		t.Fatal("v3-only without v3 enabled should not validate")
+	}
+}
+
+func TestRequestCaptureKeepsMostRecentRequests(t *testing.T) {
+	va := NewVirtualAgent(0, 20000, "device-0", store.NewOIDDatabase(), v3.Config{}, 1)
+	source := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 7), Port: 40001}
+
+	va.HandlePacketFrom(marshalV2cRequest(t, gosnmp.GetRequest, ".1.3.6.1.4.1.55555.6.1.0"), source, 20000)
+	if got := va.RecentRequests(); got != nil {
+		t.Fatalf("captured %d requests with capturing off", len(got))
+	}
+
+	va.SetRequestCapture(2)
+	for _, oid := range []string{".1.3.6.1.4.1.55555.6.1.0", ".1.3.6.1.4.1.55555.6.2.0", ".1.3.6.1.4.1.55555.6.3.0"} {
+		va.HandlePacketFrom(marshalV2cRequest(t, gosnmp.GetRequest, oid), source, 20000)
+	}
+	va.HandlePacketFrom(marshalV2cRequest(t, gosnmp.GetNextRequest, ".1.3.6.1.4.1.55555.6"), source, 20000)
+
+	got := va.RecentRequests()
+	if len(got) != 2 {
+		t.Fatalf("captured %d requests, want 2", len(got))
+	}
+	if got[0].PDUType != "GetRequest" || got[0].OIDs[0] != "1.3.6.1.4.1.55555.6.3.0" {
+		t.Fatalf("oldest capture = %+v, want the GET of .6.3.0", got[0])
+	}
+	if got[1].PDUType != "GetNextRequest" || got[1].Source != "192.0.2.7:40001" || got[1].Version != "2c" {
+		t.Fatalf("newest capture = %+v", got[1])
+	}
+
+	va.SetRequestCapture(0)
+	if got := va.RecentRequests(); got != nil {
+		t.Fatalf("captures kept after turning capturing off: %+v", got)
+	}
+}
+
+func TestRoutingSeesRequestCommunity(t *testing.T) {
+	dir := t.TempDir()
+	oid := "1.3.6.1.4.1.55555.9.1.0"
+	publicPath := filepath.Join(dir, "public.snmprec")
+	privatePath := filepath.Join(dir, "private.snmprec")
+	if err := os.WriteFile(publicPath, []byte(oid+"|octetstring|public-dataset\n"), 0o644); err != nil {
+		t.Fatalf("write public dataset: %v", err)
+	}
+	if err := os.WriteFile(privatePath, []byte(oid+"|octetstring|private-dataset\n"), 0o644); err != nil {
+		t.Fatalf("write private dataset: %v", err)
+	}
+	datasets, err := store.NewDatasetStore(publicPath, []string{privatePath}, store.LoadOptions{})
+	if err != nil {
+		t.Fatalf("new dataset store: %v", err)
+	}
+	router, err := routing.NewRouter([]routing.Rule{
+		{Match: routing.Matchers{Community: "private"}, Action: routing.Action{DatasetPath: privatePath}},
+	})
+	if err != nil {
+		t.Fatalf("new router: %v", err)
+	}
+
+	for _, v3Enabled := range []bool{false, true} {
+		va := NewVirtualAgent(0, 20000, "device-0", store.NewOIDDatabase(), v3.Config{Enabled: v3Enabled}, 1)
+		va.SetRouting(router, datasets)
+		for _, tc := range []struct {
+			version   gosnmp.SnmpVersion
+			community string
+			want      string
+		}{
+			{gosnmp.Version2c, "private", "private-dataset"},
+			{gosnmp.Version1, "private", "private-dataset"},
+			{gosnmp.Version2c, "public", "public-dataset"},
+		} {
+			req := &gosnmp.SnmpPacket{
+				Version:   tc.version,
+				Community: tc.community,
+				PDUType:   gosnmp.GetRequest,
+				RequestID: 1,
+				Variables: []gosnmp.SnmpPDU{{Name: "." + oid, Type: gosnmp.Null}},
+				Logger:    gosnmp.NewLogger(nil),
+			}
+			raw, err := req.MarshalMsg()
+			if err != nil {
+				t.Fatalf("marshal request: %v", err)
+			}
+			resp := decodeV2cResponse(t, va.HandlePacket(raw))
+			if resp.Community != tc.community {
+				t.Fatalf("v3=%v %s: response community = %q, want %q", v3Enabled, tc.version, resp.Community, tc.community)
+			}
+			if got := string(resp.Variables[0].Value.([]byte)); got != tc.want {
+				t.Fatalf("v3=%v %s community %q routed to %q, want %q", v3Enabled, tc.version, tc.community, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestValueRefFollowsSourceOID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ref.snmprec")
+	content := `1.3.6.1.2.1.2.2.1.5.1|gauge32|100000000
+1.3.6.1.2.1.31.1.1.1.15.1|gauge32|ref:1.3.6.1.2.1.2.2.1.5.1/1000000
+1.3.6.1.4.1.55555.12.1.0|integer|ref:1.3.6.1.4.1.55555.12.2.0
+1.3.6.1.4.1.55555.12.2.0|integer|ref:1.3.6.1.4.1.55555.12.1.0
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+	db := store.NewOIDDatabase()
+	if _, err := store.LoadSNMPrecFile(db, path); err != nil {
+		t.Fatalf("load snmprec: %v", err)
+	}
+	db.SortOIDs()
+	va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+
+	get := func(oid string) gosnmp.SnmpPDU {
+		t.Helper()
+		resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetRequest, oid)))
+		if len(resp.Variables) != 1 {
+			t.Fatalf("GET %s: got %d varbinds", oid, len(resp.Variables))
+		}
+		return resp.Variables[0]
+	}
+
+	if vb := get("1.3.6.1.2.1.31.1.1.1.15.1"); vb.Type != gosnmp.Gauge32 || gosnmp.ToBigInt(vb.Value).Int64() != 100 {
+		t.Fatalf("derived ifHighSpeed = %+v, want gauge32 100", vb)
+	}
+
+	va.SetOIDValue("1.3.6.1.2.1.2.2.1.5.1", "1000000000")
+	if vb := get("1.3.6.1.2.1.31.1.1.1.15.1"); gosnmp.ToBigInt(vb.Value).Int64() != 1000 {
+		t.Fatalf("derived ifHighSpeed after overlay = %+v, want 1000", vb)
+	}
+
+	if vb := get("1.3.6.1.4.1.55555.12.1.0"); vb.Type != gosnmp.NoSuchObject {
+		t.Fatalf("reference cycle = %+v, want noSuchObject", vb)
+	}
+}
+
+func TestGetBulkOnUnknownSubtreeReturnsEndOfMibView(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.2.1.1.1.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "first"})
+	db.Insert("1.3.6.1.2.1.2.2.1.1.1", &store.OIDValue{Type: gosnmp.Integer, Value: 1})
+	db.Insert("1.3.6.1.2.1.2.2.1.1.2", &store.OIDValue{Type: gosnmp.Integer, Value: 2})
+	db.Insert("1.3.6.1.2.1.2.2.1.2.1", &store.OIDValue{Type: gosnmp.OctetString, Value: "eth0"})
+	db.Insert("1.3.6.1.2.1.2.2.1.2.2", &store.OIDValue{Type: gosnmp.OctetString, Value: "eth1"})
+	db.SortOIDs()
+
+	unknown := []string{
+		".1.3.6.1.4.1.99999",        // subtree past the last OID
+		".1.3.6.1.2.1.2.2.1.9.1",    // missing column of the last table
+		".1.3.6.1.2.1.2.2.1.2.9",    // row past the last row of the last column
+		".1.3.6.1.2.1.2.2.1.2.2.77", // under the very last OID
+	}
+	for _, withIndex := range []bool{false, true} {
+		va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+		if withIndex {
+			im := store.NewOIDIndexManager()
+			if err := im.BuildIndex(db); err != nil {
+				t.Fatalf("build index: %v", err)
+			}
+			va.SetIndexManager(im)
+		}
+
+		for _, nonRepeaters := range []uint8{0, 1} {
+			for _, oid := range unknown {
+				req := &gosnmp.SnmpPacket{
+					Version:        gosnmp.Version2c,
+					Community:      "public",
+					PDUType:        gosnmp.GetBulkRequest,
+					RequestID:      1,
+					NonRepeaters:   nonRepeaters,
+					MaxRepetitions: 5,
+					Variables:      []gosnmp.SnmpPDU{{Name: oid, Type: gosnmp.Null}},
+					Logger:         gosnmp.NewLogger(nil),
+				}
+				raw, err := req.MarshalMsg()
+				if err != nil {
+					t.Fatalf("marshal request: %v", err)
+				}
+				resp := decodeV2cResponse(t, va.HandlePacket(raw))
+				if len(resp.Variables) != 1 {
+					t.Fatalf("index=%v nonRepeaters=%d %s: got %+v, want one endOfMibView varbind", withIndex, nonRepeaters, oid, resp.Variables)
+				}
+				if vb := resp.Variables[0]; vb.Type != gosnmp.EndOfMibView || vb.Name != oid {
+					t.Fatalf("index=%v nonRepeaters=%d %s: varbind = %+v, want endOfMibView on the requested OID", withIndex, nonRepeaters, oid, vb)
+				}
+			}
+		}
+	}
+}
+
+func TestDuplicateOIDsAnswerEachVarbind(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.4.1.55555.13.1.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "one"})
+	db.Insert("1.3.6.1.4.1.55555.13.2.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "two"})
+	db.SortOIDs()
+
+	for _, withIndex := range []bool{false, true} {
+		va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+		if withIndex {
+			im := store.NewOIDIndexManager()
+			if err := im.BuildIndex(db); err != nil {
+				t.Fatalf("build index: %v", err)
+			}
+			va.SetIndexManager(im)
+		}
+
+		get := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetRequest,
+			".1.3.6.1.4.1.55555.13.1.0", ".1.3.6.1.4.1.55555.13.2.0", ".1.3.6.1.4.1.55555.13.1.0")))
+		wantGet := []string{"one", "two", "one"}
+		if len(get.Variables) != len(wantGet) {
+			t.Fatalf("index=%v: GET returned %d varbinds, want %d", withIndex, len(get.Variables), len(wantGet))
+		}
+		for i, want := range wantGet {
+			if got := string(get.Variables[i].Value.([]byte)); got != want {
+				t.Fatalf("index=%v: GET varbind %d = %q, want %q", withIndex, i, got, want)
+			}
+		}
+
+		next := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetNextRequest,
+			".1.3.6.1.4.1.55555.13.1.0", ".1.3.6.1.4.1.55555.13.1.0", ".1.3.6.1.4.1.55555.13.2.0")))
+		wantNext := []struct {
+			name string
+			typ  gosnmp.Asn1BER
+		}{
+			{".1.3.6.1.4.1.55555.13.2.0", gosnmp.OctetString},
+			{".1.3.6.1.4.1.55555.13.2.0", gosnmp.OctetString},
+			{".1.3.6.1.4.1.55555.13.2.0", gosnmp.EndOfMibView},
+		}
+		if len(next.Variables) != len(wantNext) {
+			t.Fatalf("index=%v: GETNEXT returned %d varbinds, want %d", withIndex, len(next.Variables), len(wantNext))
+		}
+		for i, want := range wantNext {
+			if vb := next.Variables[i]; vb.Name != want.name || vb.Type != want.typ {
+				t.Fatalf("index=%v: GETNEXT varbind %d = %+v, want %s %v", withIndex, i, vb, want.name, want.typ)
+			}
+		}
+	}
+}
+
+func marshalV2cSet(t *testing.T, vars ...gosnmp.SnmpPDU) []byte {
+	t.Helper()
+	pkt := &gosnmp.SnmpPacket{
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		PDUType:   gosnmp.SetRequest,
+		RequestID: 1,
+		Variables: vars,
+		Logger:    gosnmp.NewLogger(nil),
+	}
+	raw, err := pkt.MarshalMsg()
+	if err != nil {
+		t.Fatalf("marshal set: %v", err)
+	}
+	return raw
+}
+
+func TestGetWithGarbageErrorFieldsGetsCleanResponse(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.4.1.55555.15.1.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "edge-1"})
+	db.SortOIDs()
+	va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+
+	pkt := &gosnmp.SnmpPacket{
+		Version:    gosnmp.Version2c,
+		Community:  "public",
+		PDUType:    gosnmp.GetRequest,
+		RequestID:  7,
+		Error:      gosnmp.GenErr,
+		ErrorIndex: 9,
+		Variables:  []gosnmp.SnmpPDU{{Name: ".1.3.6.1.4.1.55555.15.1.0", Type: gosnmp.Null}},
+		Logger:     gosnmp.NewLogger(nil),
+	}
+	raw, err := pkt.MarshalMsg()
+	if err != nil {
+		t.Fatalf("marshal get: %v", err)
+	}
+
+	resp := decodeV2cResponse(t, va.HandlePacket(raw))
+	if resp.Error != gosnmp.NoError || resp.ErrorIndex != 0 {
+		t.Fatalf("response error=%v index=%d, want noError index 0", resp.Error, resp.ErrorIndex)
+	}
+	if resp.RequestID != 7 || len(resp.Variables) != 1 || string(resp.Variables[0].Value.([]byte)) != "edge-1" {
+		t.Fatalf("response = %+v, want the stored value for request 7", resp)
+	}
+
+	pkt.Variables = []gosnmp.SnmpPDU{{Name: ".1.3.6.1.4.1.55555.15.2.0", Type: gosnmp.Null}}
+	if raw, err = pkt.MarshalMsg(); err != nil {
+		t.Fatalf("marshal get: %v", err)
+	}
+	resp = decodeV2cResponse(t, va.HandlePacket(raw))
+	if resp.Error != gosnmp.NoError || resp.ErrorIndex != 0 || resp.Variables[0].Type != gosnmp.NoSuchObject {
+		t.Fatalf("missing OID: error=%v index=%d type=%v, want noError index 0 noSuchObject", resp.Error, resp.ErrorIndex, resp.Variables[0].Type)
+	}
+}
+
+func TestSetErrorsDistinguishUnknownAndReadOnlyOIDs(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.4.1.55555.14.1.0", &store.OIDValue{Type: gosnmp.Integer, Value: 1})
+	db.Insert("1.3.6.1.4.1.55555.14.2.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "old"})
+	db.SortOIDs()
+	va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+	if err := va.SetWritableOIDs([]string{"1.3.6.1.4.1.55555.14.2"}); err != nil {
+		t.Fatalf("set writable: %v", err)
+	}
+	var events []SetEvent
+	va.SetSetEventHook(func(ev SetEvent) { events = append(events, ev) })
+
+	readOnly := gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.55555.14.1.0", Type: gosnmp.Integer, Value: 2}
+	unknown := gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.55555.14.9.0", Type: gosnmp.Integer, Value: 2}
+	writable := gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.55555.14.2.0", Type: gosnmp.OctetString, Value: []byte("new")}
+
+	cases := []struct {
+		name      string
+		vars      []gosnmp.SnmpPDU
+		wantErr   gosnmp.SNMPError
+		wantIndex uint8
+	}{
+		{"unknown", []gosnmp.SnmpPDU{unknown}, gosnmp.NoCreation, 1},
+		{"read-only", []gosnmp.SnmpPDU{readOnly}, gosnmp.NotWritable, 1},
+		{"second varbind fails", []gosnmp.SnmpPDU{writable, readOnly}, gosnmp.NotWritable, 2},
+		{"writable", []gosnmp.SnmpPDU{writable}, gosnmp.NoError, 0},
+	}
+	for _, tc := range cases {
+		resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cSet(t, tc.vars...)))
+		if resp.Error != tc.wantErr || resp.ErrorIndex != tc.wantIndex {
+			t.Fatalf("%s: error=%v index=%d, want %v index %d", tc.name, resp.Error, resp.ErrorIndex, tc.wantErr, tc.wantIndex)
+		}
+		if len(resp.Variables) != len(tc.vars) {
+			t.Fatalf("%s: response has %d varbinds, want the %d of the request", tc.name, len(resp.Variables), len(tc.vars))
+		}
+		// a rejected SET changes nothing, so it must not be reported
+		wantEvents := 0
+		if tc.wantErr == gosnmp.NoError {
+			wantEvents = len(tc.vars)
+		}
+		if len(events) != wantEvents {
+			t.Fatalf("%s: %d SET events, want %d: %+v", tc.name, len(events), wantEvents, events)
+		}
+		events = nil
+	}
+
+	get := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetRequest, ".1.3.6.1.4.1.55555.14.2.0")))
+	if v := get.Variables[0]; v.Type != gosnmp.OctetString || string(v.Value.([]byte)) != "new" {
+		t.Fatalf("GET after SET = %+v, want written value", v)
+	}
+
+	if err := va.SetUnknownOIDSetError(gosnmp.NotWritable); err != nil {
+		t.Fatalf("set unknown-OID error: %v", err)
+	}
+	resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cSet(t, unknown)))
+	if resp.Error != gosnmp.NotWritable {
+		t.Fatalf("configured unknown-OID error = %v, want notWritable", resp.Error)
+	}
+}
+
+func TestSetValidatesTypeAgainstStoredValue(t *testing.T) {
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.4.1.55555.17.1.0", &store.OIDValue{Type: gosnmp.Integer, Value: 1})
+	db.Insert("1.3.6.1.4.1.55555.17.2.0", &store.OIDValue{Type: gosnmp.OctetString, Value: "old"})
+	db.SortOIDs()
+	va := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+	if err := va.SetWritableOIDs([]string{"1.3.6.1.4.1.55555.17"}); err != nil {
+		t.Fatalf("set writable: %v", err)
+	}
+	get := func(oid string) gosnmp.SnmpPDU {
+		t.Helper()
+		return decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetRequest, oid))).Variables[0]
+	}
+
+	name := gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.55555.17.2.0", Type: gosnmp.OctetString, Value: []byte("new")}
+	badStatus := gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.55555.17.1.0", Type: gosnmp.OctetString, Value: []byte("2")}
+	resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cSet(t, name, badStatus)))
+	if resp.Error != gosnmp.WrongType || resp.ErrorIndex != 2 {
+		t.Fatalf("octet string on an integer: error=%v index=%d, want wrongType index 2", resp.Error, resp.ErrorIndex)
+	}
+	if v := get(".1.3.6.1.4.1.55555.17.2.0"); string(v.Value.([]byte)) != "old" {
+		t.Fatalf("failed SET wrote its first varbind: %+v", v)
+	}
+
+	status := gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.55555.17.1.0", Type: gosnmp.Integer, Value: 2}
+	resp = decodeV2cResponse(t, va.HandlePacket(marshalV2cSet(t, name, status)))
+	if resp.Error != gosnmp.NoError || len(resp.Variables) != 2 || resp.Variables[1].Value != 2 {
+		t.Fatalf("matching types: error=%v varbinds=%+v, want the written varbinds echoed", resp.Error, resp.Variables)
+	}
+	if v := get(".1.3.6.1.4.1.55555.17.1.0"); v.Type != gosnmp.Integer || v.Value != 2 {
+		t.Fatalf("GET after SET = %+v, want integer 2", v)
+	}
+
+	// a new OID under a writable prefix takes any type, which later SETs keep
+	created := gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.55555.17.3.0", Type: gosnmp.Gauge32, Value: uint32(7)}
+	if resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cSet(t, created))); resp.Error != gosnmp.NoError {
+		t.Fatalf("create: error=%v, want noError", resp.Error)
+	}
+	created.Type, created.Value = gosnmp.Integer, 8
+	if resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cSet(t, created))); resp.Error != gosnmp.WrongType {
+		t.Fatalf("integer on a created gauge: error=%v, want wrongType", resp.Error)
+	}
+
+	v1 := &gosnmp.SnmpPacket{Version: gosnmp.Version1, Community: "public", PDUType: gosnmp.SetRequest, RequestID: 2,
+		Variables: []gosnmp.SnmpPDU{badStatus}, Logger: gosnmp.NewLogger(nil)}
+	raw, err := v1.MarshalMsg()
+	if err != nil {
+		t.Fatalf("marshal v1 set: %v", err)
+	}
+	if resp := decodeV2cResponse(t, va.HandlePacket(raw)); resp.Error != gosnmp.BadValue {
+		t.Fatalf("v1 wrong type: error=%v, want badValue", resp.Error)
+	}
+}
+
+func TestSequenceVariationAdvancesPerGetAndDevice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "variations.yaml")
+	if err := os.WriteFile(path, []byte("bindings:\n  - prefix: \"1.3.6.1.4.1.55555.16.1\"\n    variations:\n      - type: sequence\n        values: [10, 20, 40, 80]\n"), 0o644); err != nil {
+		t.Fatalf("write variations: %v", err)
+	}
+	binder, err := variation.LoadBinder(path)
+	if err != nil {
+		t.Fatalf("load binder: %v", err)
+	}
+	db := store.NewOIDDatabase()
+	db.Insert("1.3.6.1.4.1.55555.16.1.0", &store.OIDValue{Type: gosnmp.Gauge32, Value: uint32(0)})
+	db.SortOIDs()
+	first := NewVirtualAgent(1, 20000, "device-1", db, v3.Config{}, 1)
+	second := NewVirtualAgent(2, 20001, "device-2", db, v3.Config{}, 1)
+	first.SetVariationBinder(binder)
+	second.SetVariationBinder(binder)
+
+	get := func(va *VirtualAgent) uint32 {
+		t.Helper()
+		resp := decodeV2cResponse(t, va.HandlePacket(marshalV2cRequest(t, gosnmp.GetRequest, ".1.3.6.1.4.1.55555.16.1.0")))
+		return uint32(gosnmp.ToBigInt(resp.Variables[0].Value).Uint64())
+	}
+	var got []uint32
+	for i := 0; i < 6; i++ {
+		got = append(got, get(first))
+	}
+	if want := []uint32{10, 20, 40, 80, 10, 20}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("device 1 values = %v, want %v", got, want)
+	}
+	if v := get(second); v != 10 {
+		t.Fatalf("device 2 first value = %d, want its own sequence start 10", v)
+	}
+}
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// DefaultMaxResponseSize caps the encoded size of a GETBULK response at the
+// UDP payload of a 1500-byte Ethernet frame, so responses are not
+// fragmented.
+const DefaultMaxResponseSize = 1472
+
+// MinMaxResponseSize is the message size RFC 3417 requires every SNMP
+// entity to accept
+const MinMaxResponseSize = 484
+
+// responseSizeSlack covers what the size of an empty response does not: the
+// length fields of the message, PDU and varbind list growing as varbinds are
+// added, and the padding of a DES encrypted scoped PDU
+const responseSizeSlack = 3*4 + 8
+
+// macSize is the length of the msgAuthenticationParameters of each SNMPv3
+// authentication protocol
+var macSize = map[gosnmp.SnmpV3AuthProtocol]int{
+	gosnmp.MD5:    12,
+	gosnmp.SHA:    12,
+	gosnmp.SHA224: 16,
+	gosnmp.SHA256: 24,
+	gosnmp.SHA384: 32,
+	gosnmp.SHA512: 48,
+}
+
+// responseOverhead is the encoded size of resp without its varbinds, worked
+// out from its fields so a GETBULK response is marshalled, and for SNMPv3
+// authenticated and encrypted, only once it is filled
+func responseOverhead(resp *gosnmp.SnmpPacket) int {
+	pdu := tlvSize(intSize(int64(resp.RequestID)) + intSize(int64(resp.Error)) + intSize(int64(resp.ErrorIndex)) + tlvSize(0))
+	if resp.Version != gosnmp.Version3 {
+		return tlvSize(intSize(int64(resp.Version)) + tlvSize(len(resp.Community)) + pdu)
+	}
+
+	usm, _ := resp.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if usm == nil {
+		usm = &gosnmp.UsmSecurityParameters{}
+	}
+	maxSize := int64(resp.MsgMaxSize)
+	if maxSize == 0 {
+		maxSize = 65535 // what gosnmp sends when unset
+	}
+	// gosnmp always encodes msgID in four octets
+	header := tlvSize(4) + intSize(maxSize) + tlvSize(1) + intSize(int64(resp.SecurityModel))
+	auth, priv := tlvSize(0), tlvSize(0)
+	if resp.MsgFlags&gosnmp.AuthNoPriv != 0 {
+		auth = tlvSize(macSize[usm.AuthenticationProtocol])
+	}
+	encrypted := resp.MsgFlags&gosnmp.AuthPriv == gosnmp.AuthPriv
+	if encrypted {
+		priv = tlvSize(8) // the salt
+	}
+	security := tlvSize(tlvSize(len(usm.AuthoritativeEngineID)) + intSize(int64(usm.AuthoritativeEngineBoots)) +
+		intSize(int64(usm.AuthoritativeEngineTime)) + tlvSize(len(usm.UserName)) + auth + priv)
+	scoped := tlvSize(tlvSize(len(resp.ContextEngineID)) + tlvSize(len(resp.ContextName)) + pdu)
+	if encrypted {
+		scoped = tlvSize(scoped) // DES padding is left to responseSizeSlack
+	}
+	return tlvSize(intSize(int64(resp.Version)) + tlvSize(header) + tlvSize(security) + scoped)
+}
+
+// intSize is the encoded size of n as an INTEGER element
+func intSize(n int64) int {
+	return tlvSize(intContentSize(big.NewInt(n)))
+}
+
+// varbindSize estimates the BER encoded size of pdu as a varbind: a sequence
+// of its OID and value
+func varbindSize(pdu gosnmp.SnmpPDU) int {
+	return tlvSize(tlvSize(oidContentSize(pdu.Name)) + tlvSize(valueContentSize(pdu)))
+}
+
+// tlvSize is the size of a BER element with n content octets
+func tlvSize(n int) int {
+	size := 1 + 1 + n
+	for l := n; l > 0x7F; l >>= 8 {
+		size++
+	}
+	return size
+}
+
+// oidContentSize is the number of content octets of oid encoded as an
+// OBJECT IDENTIFIER
+func oidContentSize(oid string) int {
+	arcs := strings.Split(strings.Trim(oid, "."), ".")
+	if len(arcs) < 2 {
+		return 1
+	}
+	first, _ := strconv.ParseUint(arcs[0], 10, 64)
+	second, _ := strconv.ParseUint(arcs[1], 10, 64)
+	size := base128Size(first*40 + second)
+	for _, arc := range arcs[2:] {
+		n, _ := strconv.ParseUint(arc, 10, 64)
+		size += base128Size(n)
+	}
+	return size
+}
+
+func base128Size(n uint64) int {
+	size := 1
+	for n >>= 7; n > 0; n >>= 7 {
+		size++
+	}
+	return size
+}
+
+// valueContentSize is the number of content octets of the value of pdu
+func valueContentSize(pdu gosnmp.SnmpPDU) int {
+	switch pdu.Type {
+	case gosnmp.Null, gosnmp.EndOfMibView, gosnmp.NoSuchObject, gosnmp.NoSuchInstance:
+		return 0
+	case gosnmp.IPAddress:
+		return 4
+	case gosnmp.ObjectIdentifier:
+		if s, ok := pdu.Value.(string); ok {
+			return oidContentSize(s)
+		}
+	case gosnmp.Integer:
+		return intContentSize(gosnmp.ToBigInt(pdu.Value))
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32, gosnmp.Counter64:
+		// unsigned, so a set high bit takes a leading zero octet
+		return len(gosnmp.ToBigInt(pdu.Value).Bytes()) + 1
+	}
+	switch v := pdu.Value.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	default:
+		return len(fmt.Sprint(v))
+	}
+}
+
+// intContentSize is the number of content octets of n encoded as a two's
+// complement INTEGER
+func intContentSize(n *big.Int) int {
+	if n.Sign() < 0 {
+		n = new(big.Int).Not(n) // -1 encodes like 0, -129 like 128
+	}
+	return n.BitLen()/8 + 1
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// RequestSummary describes one SNMP request received by an agent
+type RequestSummary struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Version string    `json:"version"`
+	PDUType string    `json:"pdu_type"`
+	OIDs    []string  `json:"oids"`
+}
+
+// requestRing keeps the most recent request summaries, overwriting the
+// oldest once full
+type requestRing struct {
+	mu   sync.Mutex
+	buf  []RequestSummary
+	next int
+	full bool
+}
+
+func newRequestRing(size int) *requestRing {
+	return &requestRing{buf: make([]RequestSummary, size)}
+}
+
+func (r *requestRing) add(summary RequestSummary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = summary
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the captured requests, oldest first
+func (r *requestRing) snapshot() []RequestSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]RequestSummary(nil), r.buf[:r.next]...)
+	}
+	out := make([]RequestSummary, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// SetRequestCapture keeps summaries of the last n requests for
+// RecentRequests. n <= 0 turns capturing off and drops what was kept.
+func (va *VirtualAgent) SetRequestCapture(n int) {
+	var ring *requestRing
+	if n > 0 {
+		ring = newRequestRing(n)
+	}
+	va.updateState(func(st *agentState) {
+		st.capture = ring
+	})
+}
+
+// RecentRequests returns the captured request summaries, oldest first, or
+// nil when capturing is off
+func (va *VirtualAgent) RecentRequests() []RequestSummary {
+	ring := va.state.Load().capture
+	if ring == nil {
+		return nil
+	}
+	return ring.snapshot()
+}
+
+func (va *VirtualAgent) captureRequest(ring *requestRing, req *gosnmp.SnmpPacket, remoteAddr *net.UDPAddr) {
+	summary := RequestSummary{
+		Time:    time.Now(),
+		Version: req.Version.String(),
+		PDUType: req.PDUType.String(),
+		OIDs:    make([]string, len(req.Variables)),
+	}
+	if remoteAddr != nil {
+		summary.Source = remoteAddr.String()
+	}
+	for i, variable := range req.Variables {
+		summary.OIDs[i] = normalizeOID(variable.Name)
+	}
+	ring.add(summary)
+}
@@ -2,8 +2,11 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net"
@@ -14,12 +17,30 @@ import (
 	"sync"
 	"time"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/accesslog"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/agent"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/engine"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpbody"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpgzip"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpmethod"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httptimeout"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/recorder"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/walkdiff"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/websocket"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/webui"
 	webstatic "github.com/debashish-mukherjee/go-snmpsim/web"
+	"github.com/prometheus/common/expfmt"
 )
 
+// defaultMaxRestoreBytes is the body limit for /api/state/restore, which
+// accepts snapshots far larger than ordinary API payloads
+const defaultMaxRestoreBytes = 64 << 20
+
+// maxAgentDiffOIDs caps how many OIDs /api/agents/diff walks on each agent
+const maxAgentDiffOIDs = 10000
+
 // Server handles HTTP API requests and WebSocket connections
 type Server struct {
 	simulator       *engine.Simulator
@@ -27,10 +48,15 @@ type Server struct {
 	snmpTester      *webui.SNMPTester
 	httpServer      *http.Server
 	simCancel       context.CancelFunc
-	apiToken        string
+	tokens          *tokenStore
+	tlsCertFile     string
+	tlsKeyFile      string
 	limiter         *requestLimiter
+	maxBodyBytes    int64
+	maxRestoreBytes int64
+	accessLog       accesslog.Options
 	mu              sync.RWMutex
-	status          *SimulatorStatus
+	status          SimulatorStatus // guarded by mu; handlers read a copy
 }
 
 // SimulatorStatus contains current simulator metrics
@@ -44,23 +70,41 @@ type SimulatorStatus struct {
 	Uptime       string `json:"uptime"`
 	TotalPolls   int64  `json:"total_polls"`
 	AvgLatency   string `json:"avg_latency_ms"`
+	DatasetHash  string `json:"dataset_hash,omitempty"`
+
+	// PollsPerSecond is the recent request rate across all agents
+	PollsPerSecond float64 `json:"polls_per_second"`
 }
 
-// NewServer creates a new API server
-func NewServer(addr string) *Server {
+// NewServer creates a new API server. It fails when the admin token file
+// named by SNMPSIM_UI_API_TOKEN_FILE cannot be read, rather than serving
+// the API with a token other than the one configured.
+func NewServer(addr string) (*Server, error) {
 	s := &Server{
-		status: &SimulatorStatus{
-			IsRunning: false,
-		},
-		apiToken: os.Getenv("SNMPSIM_UI_API_TOKEN"),
-		limiter:  newRequestLimiterFromEnv(),
+		tokens:          newTokenStore(),
+		tlsCertFile:     os.Getenv("SNMPSIM_UI_TLS_CERT"),
+		tlsKeyFile:      os.Getenv("SNMPSIM_UI_TLS_KEY"),
+		limiter:         newRequestLimiterFromEnv(),
+		maxBodyBytes:    bodyLimitFromEnv("SNMPSIM_UI_MAX_BODY_BYTES", httpbody.DefaultMaxBytes),
+		maxRestoreBytes: bodyLimitFromEnv("SNMPSIM_UI_MAX_RESTORE_BYTES", defaultMaxRestoreBytes),
+		accessLog:       accessLogFromEnv(),
+	}
+
+	token, err := apiTokenFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		s.tokens.setFixed(token, []tokenScope{scopeAdmin})
 	}
 
 	mux := http.NewServeMux()
 
 	// API endpoints
 	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/stats/reset", s.handleStatsReset)
 	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/api/metrics", s.handleMetricsJSON)
 	mux.HandleFunc("/api/start", s.handleStart)
 	mux.HandleFunc("/api/stop", s.handleStop)
 	mux.HandleFunc("/api/test/snmp", s.handleSNMPTest)
@@ -70,6 +114,12 @@ func NewServer(addr string) *Server {
 	mux.HandleFunc("/api/workloads/delete", s.handleDeleteWorkload)
 	mux.HandleFunc("/api/test/results", s.handleTestResults)
 	mux.HandleFunc("/api/test/jobs/", s.handleTestJob)
+	mux.HandleFunc("/api/state/snapshot", s.handleStateSnapshot)
+	mux.HandleFunc("/api/state/restore", s.handleStateRestore)
+	mux.HandleFunc("/api/tokens", s.handleTokens)
+	mux.HandleFunc("/api/agents/diff", s.handleAgentDiff)
+	mux.HandleFunc("/api/agents/", s.handleAgentRequests)
+	mux.HandleFunc("/api/variations/trigger", s.handleTriggerVariation)
 
 	// Static files (embedded so they are independent of current working directory).
 	uiFS, err := fs.Sub(webstatic.EmbeddedFiles, "ui")
@@ -83,12 +133,13 @@ func NewServer(addr string) *Server {
 	mux.Handle("/", http.FileServer(http.FS(uiFS)))
 	mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.FS(assetsFS))))
 
-	s.httpServer = &http.Server{
-		Addr:    addr,
-		Handler: s.wrapMiddleware(mux),
-	}
+	s.httpServer = timeoutsFromEnv().Apply(&http.Server{
+		Addr:      addr,
+		Handler:   s.wrapMiddleware(mux),
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+	})
 
-	return s
+	return s, nil
 }
 
 // SetSimulator sets the running simulator instance
@@ -103,12 +154,20 @@ func (s *Server) SetSimulator(sim *engine.Simulator) {
 func (s *Server) SetSimulatorStatus(portStart, portEnd, numDevices int, listenAddr, startTime string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.status.IsRunning = true
-	s.status.TotalDevices = numDevices
-	s.status.PortStart = portStart
-	s.status.PortEnd = portEnd
-	s.status.ListenAddr = listenAddr
-	s.status.StartTime = startTime
+	s.setRunningStatusLocked(portStart, portEnd, numDevices, listenAddr, startTime)
+}
+
+// setRunningStatusLocked records a started simulator; s.mu must be held for
+// writing
+func (s *Server) setRunningStatusLocked(portStart, portEnd, numDevices int, listenAddr, startTime string) {
+	s.status = SimulatorStatus{
+		IsRunning:    true,
+		TotalDevices: numDevices,
+		PortStart:    portStart,
+		PortEnd:      portEnd,
+		ListenAddr:   listenAddr,
+		StartTime:    startTime,
+	}
 }
 
 // SetWorkloadManager sets the workload manager
@@ -125,10 +184,47 @@ func (s *Server) SetSNMPTester(tester *webui.SNMPTester) {
 	s.snmpTester = tester
 }
 
+// SetTLS enables HTTPS using the given certificate and key files.
+// Empty paths keep the server on plaintext HTTP.
+func (s *Server) SetTLS(certFile, keyFile string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tlsCertFile = certFile
+	s.tlsKeyFile = keyFile
+}
+
+// SetTokenFile loads scoped API tokens from a JSON file and writes token
+// changes made through /api/tokens back to it. A missing file is created on
+// the first change.
+func (s *Server) SetTokenFile(path string) error {
+	return s.tokens.load(path)
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
-	log.Printf("Starting Web UI on http://localhost%s", s.httpServer.Addr)
-	return s.httpServer.ListenAndServe()
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln, using TLS when a certificate is configured
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.RLock()
+	certFile, keyFile := s.tlsCertFile, s.tlsKeyFile
+	s.mu.RUnlock()
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			ln.Close()
+			return fmt.Errorf("both TLS certificate and key are required")
+		}
+		log.Printf("Starting Web UI on https://%s", ln.Addr())
+		return s.httpServer.ServeTLS(ln, certFile, keyFile)
+	}
+	log.Printf("Starting Web UI on http://%s", ln.Addr())
+	return s.httpServer.Serve(ln)
 }
 
 // Stop stops the HTTP server gracefully
@@ -140,13 +236,12 @@ func (s *Server) Stop() error {
 
 // handleStatus returns current simulator status
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodGet) {
 		return
 	}
 
 	s.mu.RLock()
-	status := *s.status
+	status := s.status
 	sim := s.simulator
 	tester := s.snmpTester
 	s.mu.RUnlock()
@@ -156,7 +251,11 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 			if totalPolls, ok := stats["total_polls"].(int64); ok {
 				status.TotalPolls = totalPolls
 			}
+			if rate, ok := stats["polls_per_second"].(float64); ok {
+				status.PollsPerSecond = rate
+			}
 		}
+		status.DatasetHash = sim.DatasetHash()
 	}
 	if tester != nil {
 		if last := tester.GetLastResults(); last != nil && last.TotalTests > 0 {
@@ -173,50 +272,121 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
-func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// handleStatsReset zeroes the poll counters and returns the totals they
+// held, so a test run can start from a clean total_polls
+func (s *Server) handleStatsReset(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodPost) {
 		return
 	}
 
 	s.mu.RLock()
 	sim := s.simulator
 	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
 
-	totalPolls := int64(0)
-	virtualAgents := 0
-	running := 0
+	totalPolls, polls := sim.ResetStatistics()
+	agents := make(map[string]int64, len(polls))
+	for port, count := range polls {
+		agents[strconv.Itoa(port)] = count
+	}
 
-	if sim != nil {
-		if stats := sim.Statistics(); stats != nil {
-			if total, ok := stats["total_polls"].(int64); ok {
-				totalPolls = total
-			}
-			if count, ok := stats["virtual_agents"].(int); ok {
-				virtualAgents = count
-			}
-			if isRunning, ok := stats["running"].(bool); ok && isRunning {
-				running = 1
-			}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "reset",
+		"total_polls": totalPolls,
+		"agents":      agents,
+	})
+}
+
+// simulatorMetrics holds the figures served by /metrics and /api/metrics
+type simulatorMetrics struct {
+	TotalPolls int64 `json:"total_polls"`
+	Agents     int   `json:"agents"`
+	Running    bool  `json:"running"`
+}
+
+// currentMetrics reads the running simulator's statistics, or zeroes when
+// none is set
+func (s *Server) currentMetrics() simulatorMetrics {
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+
+	var m simulatorMetrics
+	if sim == nil {
+		return m
+	}
+	if stats := sim.Statistics(); stats != nil {
+		if total, ok := stats["total_polls"].(int64); ok {
+			m.TotalPolls = total
+		}
+		if count, ok := stats["virtual_agents"].(int); ok {
+			m.Agents = count
+		}
+		if isRunning, ok := stats["running"].(bool); ok {
+			m.Running = isRunning
 		}
 	}
+	return m
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodGet) {
+		return
+	}
+
+	m := s.currentMetrics()
+	running := 0
+	if m.Running {
+		running = 1
+	}
 
 	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
 	fmt.Fprintln(w, "# HELP snmpsim_simulator_polls_total Total SNMP packets handled by simulator")
 	fmt.Fprintln(w, "# TYPE snmpsim_simulator_polls_total counter")
-	fmt.Fprintln(w, "snmpsim_simulator_polls_total "+strconv.FormatInt(totalPolls, 10))
+	fmt.Fprintln(w, "snmpsim_simulator_polls_total "+strconv.FormatInt(m.TotalPolls, 10))
 	fmt.Fprintln(w, "# HELP snmpsim_simulator_agents Number of active simulator virtual agents")
 	fmt.Fprintln(w, "# TYPE snmpsim_simulator_agents gauge")
-	fmt.Fprintln(w, "snmpsim_simulator_agents "+strconv.Itoa(virtualAgents))
+	fmt.Fprintln(w, "snmpsim_simulator_agents "+strconv.Itoa(m.Agents))
 	fmt.Fprintln(w, "# HELP snmpsim_simulator_running Simulator running state (1 up, 0 down)")
 	fmt.Fprintln(w, "# TYPE snmpsim_simulator_running gauge")
 	fmt.Fprintln(w, "snmpsim_simulator_running "+strconv.Itoa(running))
+
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+	if sim == nil {
+		return
+	}
+	if oidMetrics := sim.OIDMetrics(); oidMetrics != nil {
+		families, err := oidMetrics.Gather()
+		if err != nil {
+			log.Printf("gather OID metrics: %v", err)
+		}
+		for _, family := range families {
+			if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleMetricsJSON serves GET /api/metrics: the /metrics figures as JSON,
+// so the UI need not parse Prometheus text
+func (s *Server) handleMetricsJSON(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.currentMetrics())
 }
 
 // handleStart starts the simulator with given parameters
 func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodPost) {
 		return
 	}
 
@@ -228,8 +398,8 @@ func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
 		SNMPrecFile string `json:"snmprec_file"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), httpbody.ErrorStatus(err))
 		return
 	}
 
@@ -277,12 +447,7 @@ func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
 
 	s.simCancel = cancel
 	s.simulator = sim
-	s.status.IsRunning = true
-	s.status.TotalDevices = req.Devices
-	s.status.PortStart = req.PortStart
-	s.status.PortEnd = req.PortEnd
-	s.status.ListenAddr = req.ListenAddr
-	s.status.StartTime = time.Now().Format(time.RFC3339)
+	s.setRunningStatusLocked(req.PortStart, req.PortEnd, req.Devices, req.ListenAddr, time.Now().Format(time.RFC3339))
 	s.mu.Unlock()
 
 	w.Header().Set("Content-Type", "application/json")
@@ -294,8 +459,7 @@ func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
 
 // handleStop stops the simulator
 func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodPost) {
 		return
 	}
 
@@ -321,29 +485,418 @@ func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleSNMPTest runs SNMP tests on configured devices
-func (s *Server) handleSNMPTest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// handleStateSnapshot returns the agents' overlay state as a JSON blob
+func (s *Server) handleStateSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodPost) {
+		return
+	}
+
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	blob, err := sim.SnapshotState()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("snapshot failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(blob)
+}
+
+// handleStateRestore reapplies a blob returned by /api/state/snapshot
+func (s *Server) handleStateRestore(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodPost) {
+		return
+	}
+
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := httpbody.CheckContentType(r, "application/json"); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), httpbody.ErrorStatus(err))
+		return
+	}
+	blob, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), httpbody.ErrorStatus(err))
+		return
+	}
+	if err := sim.RestoreState(blob); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "restored",
+		"message": "Simulator state restored",
+	})
+}
+
+// handleTriggerVariation serves POST /api/variations/trigger: apply the
+// variation bound to an OID on one agent (selected by port or device) and
+// raise its variation event, firing the variation trap when enabled.
+func (s *Server) handleTriggerVariation(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodPost) {
 		return
 	}
 
 	var req struct {
-		TestType     string   `json:"test_type"` // get, getnext, bulkwalk
-		OIDs         []string `json:"oids"`
-		PortStart    int      `json:"port_start"`
-		PortEnd      int      `json:"port_end"`
-		Community    string   `json:"community"`
-		Timeout      int      `json:"timeout"`
-		MaxRepeaters int      `json:"max_repeaters"`
-		Concurrency  int      `json:"concurrency"`
-		Iterations   int      `json:"iterations"`
-		IntervalSec  int      `json:"interval_seconds"`
-		DurationSec  int      `json:"duration_seconds"`
+		Port   int    `json:"port"`
+		Device *int   `json:"device"`
+		OID    string `json:"oid"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), httpbody.ErrorStatus(err))
+		return
+	}
+	req.OID = strings.TrimPrefix(strings.TrimSpace(req.OID), ".")
+	if req.OID == "" {
+		http.Error(w, "oid is required", http.StatusBadRequest)
+		return
+	}
+	if (req.Port == 0) == (req.Device == nil) {
+		http.Error(w, "exactly one of port or device is required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	port := req.Port
+	if req.Device != nil {
+		var ok bool
+		if port, ok = sim.DevicePort(*req.Device); !ok {
+			http.Error(w, fmt.Sprintf("no agent for device %d", *req.Device), http.StatusNotFound)
+			return
+		}
+	}
+	pdu, ok, err := sim.TriggerVariation(port, req.OID)
+	switch {
+	case !ok:
+		http.Error(w, fmt.Sprintf("no agent on port %d", port), http.StatusNotFound)
+		return
+	case errors.Is(err, agent.ErrNoVariationBinding):
+		http.Error(w, fmt.Sprintf("oid %s has no variation binding", req.OID), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, agent.ErrNoSuchOID):
+		http.Error(w, fmt.Sprintf("agent on port %d has no value for oid %s", port, req.OID), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	value, err := snmprecfmt.ValueString(pdu.Type, pdu.Value)
+	if err != nil {
+		value = fmt.Sprint(pdu.Value)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"port":  port,
+		"oid":   req.OID,
+		"type":  snmprecfmt.TypeName(pdu.Type),
+		"value": value,
+	})
+}
+
+// handleAgentRequests serves GET /api/agents/{port}/requests: the requests
+// the agent captured, oldest first. Capturing is enabled with
+// --capture-requests; without it the list is empty.
+func (s *Server) handleAgentRequests(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/agents/"), "/"), "/")
+	if len(parts) == 2 && parts[1] == "reboot" {
+		s.handleAgentReboot(w, r, parts[0])
+		return
+	}
+	if len(parts) == 2 && parts[1] == "oids" {
+		s.handleAgentImportOIDs(w, r, parts[0])
+		return
+	}
+	if len(parts) == 2 && (parts[1] == "disable" || parts[1] == "enable") {
+		s.handleAgentEnable(w, r, parts[0], parts[1] == "enable")
+		return
+	}
+	if len(parts) != 2 || parts[1] != "requests" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if !httpmethod.Allow(w, r, http.MethodGet) {
+		return
+	}
+	port, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "agent port must be a number", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
+	requests, ok := sim.RecentRequests(port)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no agent on port %d", port), http.StatusNotFound)
+		return
+	}
+	if requests == nil {
+		requests = []agent.RequestSummary{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"port":     port,
+		"requests": requests,
+	})
+}
+
+// handleAgentReboot serves POST /api/agents/{port}/reboot: simulate a
+// reboot of the agent, restarting its sysUpTime, incrementing its v3 engine
+// boots and sending a coldStart trap.
+func (s *Server) handleAgentReboot(w http.ResponseWriter, r *http.Request, portText string) {
+	if !httpmethod.Allow(w, r, http.MethodPost) {
+		return
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		http.Error(w, "agent port must be a number", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
+	boots, ok, err := sim.RebootAgent(port)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no agent on port %d", port), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"port":         port,
+		"status":       "rebooted",
+		"engine_boots": boots,
+	})
+}
+
+// handleAgentEnable serves POST /api/agents/{port}/disable and .../enable:
+// take the agent offline, so requests time out, or bring it back. The
+// listener stays bound either way.
+func (s *Server) handleAgentEnable(w http.ResponseWriter, r *http.Request, portText string, enable bool) {
+	if !httpmethod.Allow(w, r, http.MethodPost) {
+		return
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		http.Error(w, "agent port must be a number", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
+	var ok bool
+	var status string
+	if enable {
+		ok, status = sim.EnableAgent(port), "enabled"
+	} else {
+		ok, status = sim.DisableAgent(port), "disabled"
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("no agent on port %d", port), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"port":   port,
+		"status": status,
+	})
+}
+
+// handleAgentImportOIDs serves POST /api/agents/{port}/oids: add the
+// snmprec lines (OID|TYPE|VALUE) of the body to the running agent's dataset.
+// Imported OIDs are served immediately and last until the dataset is
+// reloaded.
+func (s *Server) handleAgentImportOIDs(w http.ResponseWriter, r *http.Request, portText string) {
+	if !httpmethod.Allow(w, r, http.MethodPost) {
+		return
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		http.Error(w, "agent port must be a number", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	sim := s.simulator
+	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
+	blob, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), httpbody.ErrorStatus(err))
+		return
+	}
+	count, ok, err := sim.ImportAgentOIDs(port, blob)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no agent on port %d", port), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"port":     port,
+		"imported": count,
+	})
+}
+
+// handleAgentDiff walks the same subtree on two agents over SNMP and returns
+// the differences: GET /api/agents/diff?a=PORT&b=PORT&root=OID
+func (s *Server) handleAgentDiff(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mu.RLock()
+	sim := s.simulator
+	listenAddr := s.status.ListenAddr
+	s.mu.RUnlock()
+	if sim == nil {
+		http.Error(w, "simulator not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	ports := make([]int, 2)
+	for i, name := range []string{"a", "b"} {
+		port, err := strconv.Atoi(query.Get(name))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("query parameter %s must be an agent port", name), http.StatusBadRequest)
+			return
+		}
+		if !sim.HasAgent(port) {
+			http.Error(w, fmt.Sprintf("no agent on port %d", port), http.StatusNotFound)
+			return
+		}
+		ports[i] = port
+	}
+	root := strings.TrimPrefix(query.Get("root"), ".")
+	if root == "" {
+		root = "1.3.6.1.2.1"
+	}
+	community := query.Get("community")
+	if community == "" {
+		community = "public"
+	}
+	maxOIDs := maxAgentDiffOIDs
+	if raw := query.Get("max_oids"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "max_oids must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if parsed < maxOIDs {
+			maxOIDs = parsed
+		}
+	}
+
+	target := localTarget(listenAddr)
+	walks := make([][]snmprecfmt.Entry, 2)
+	for i, port := range ports {
+		entries, err := recorder.Record(recorder.Options{
+			Target:    target,
+			Port:      uint16(port),
+			Timeout:   2 * time.Second,
+			Retries:   1,
+			MaxOIDs:   maxOIDs,
+			Roots:     []string{root},
+			Community: community,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("walk port %d: %v", port, err), http.StatusBadGateway)
+			return
+		}
+		walks[i] = entries
+	}
+
+	result := walkdiff.CompareEntries(walks[0], walks[1], walkdiff.Options{})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		A         int    `json:"a"`
+		B         int    `json:"b"`
+		Root      string `json:"root"`
+		Identical bool   `json:"identical"`
+		Truncated bool   `json:"truncated"`
+		walkdiff.Result
+	}{
+		A:         ports[0],
+		B:         ports[1],
+		Root:      root,
+		Identical: result.Identical(),
+		Truncated: len(walks[0]) >= maxOIDs || len(walks[1]) >= maxOIDs,
+		Result:    result,
+	})
+}
+
+// localTarget is the address to reach the simulator's listeners from this
+// process: loopback when they are bound to a wildcard address.
+func localTarget(listenAddr string) string {
+	switch listenAddr {
+	case "", "0.0.0.0":
+		return "127.0.0.1"
+	case "::":
+		return "::1"
 	}
+	return listenAddr
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+// handleSNMPTest runs SNMP tests on configured devices
+func (s *Server) handleSNMPTest(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodPost) {
+		return
+	}
+
+	var req webui.TestRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), httpbody.ErrorStatus(err))
 		return
 	}
 
@@ -379,8 +932,7 @@ func (s *Server) handleSNMPTest(w http.ResponseWriter, r *http.Request) {
 
 // handleWorkloads returns list of saved workloads
 func (s *Server) handleWorkloads(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodGet) {
 		return
 	}
 
@@ -399,8 +951,7 @@ func (s *Server) handleWorkloads(w http.ResponseWriter, r *http.Request) {
 
 // handleSaveWorkload saves a workload configuration
 func (s *Server) handleSaveWorkload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodPost) {
 		return
 	}
 
@@ -413,8 +964,8 @@ func (s *Server) handleSaveWorkload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var workload webui.Workload
-	if err := json.NewDecoder(r.Body).Decode(&workload); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+	if err := decodeJSON(r, &workload); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), httpbody.ErrorStatus(err))
 		return
 	}
 
@@ -429,8 +980,7 @@ func (s *Server) handleSaveWorkload(w http.ResponseWriter, r *http.Request) {
 
 // handleLoadWorkload loads a workload configuration
 func (s *Server) handleLoadWorkload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodGet) {
 		return
 	}
 
@@ -460,8 +1010,7 @@ func (s *Server) handleLoadWorkload(w http.ResponseWriter, r *http.Request) {
 
 // handleDeleteWorkload deletes a workload configuration
 func (s *Server) handleDeleteWorkload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodDelete) {
 		return
 	}
 
@@ -490,8 +1039,7 @@ func (s *Server) handleDeleteWorkload(w http.ResponseWriter, r *http.Request) {
 
 // handleTestResults returns latest test results
 func (s *Server) handleTestResults(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodGet) {
 		return
 	}
 
@@ -509,8 +1057,7 @@ func (s *Server) handleTestResults(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleTestJob(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet && r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !httpmethod.Allow(w, r, http.MethodGet, http.MethodPost) {
 		return
 	}
 
@@ -545,7 +1092,11 @@ func (s *Server) handleTestJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(parts) != 1 {
+	if len(parts) == 2 && parts[1] == "stream" {
+		s.streamTestJob(w, r, tester, jobID)
+		return
+	}
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "metrics") {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
@@ -554,38 +1105,102 @@ func (s *Server) handleTestJob(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "job not found", http.StatusNotFound)
 		return
 	}
+	if len(parts) == 2 {
+		s.writeTestJobMetrics(w, r, job)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(job)
 }
 
-func (s *Server) wrapMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/api/") {
-			if s.apiToken != "" && !authorized(r, s.apiToken) {
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
+// streamTestJob serves GET /api/test/jobs/{id}/stream: a WebSocket that
+// carries the job's state as a JSON webui.JobUpdate each time its progress
+// changes. The final update, with the full results, is followed by a normal
+// close.
+func (s *Server) streamTestJob(w http.ResponseWriter, r *http.Request, tester *webui.SNMPTester, jobID string) {
+	updates, unsubscribe, ok := tester.SubscribeJob(jobID)
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	defer unsubscribe()
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return // Upgrade answered the request
+	}
+	for {
+		select {
+		case update, open := <-updates:
+			if !open {
+				_ = conn.Close(websocket.CloseNormal, "job finished")
 				return
 			}
-			if s.limiter != nil && !s.limiter.Allow(clientIP(r)) {
-				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			if err := conn.WriteJSON(update); err != nil {
+				log.Printf("stream job %s: %v", jobID, err)
+				_ = conn.Close(websocket.CloseGoingAway, "")
 				return
 			}
+		case <-conn.Done():
+			_ = conn.Close(websocket.CloseGoingAway, "")
+			return
 		}
-		next.ServeHTTP(w, r)
-	})
+	}
 }
 
-func authorized(r *http.Request, token string) bool {
-	if token == "" {
-		return true
+// writeTestJobMetrics serves GET /api/test/jobs/{id}/metrics: the finished
+// job's per-poll latency and success as Prometheus text or InfluxDB line
+// protocol (?format=, defaulting to the job's metrics_format)
+func (s *Server) writeTestJobMetrics(w http.ResponseWriter, r *http.Request, job *webui.TestJob) {
+	if job.Results == nil {
+		http.Error(w, "job has no results yet (status "+job.Status+")", http.StatusConflict)
+		return
 	}
-	if r.Header.Get("X-API-Token") == token {
-		return true
+	format := r.URL.Query().Get("format")
+	if format == "" && job.Request != nil {
+		format = job.Request.MetricsFormat
 	}
-	authHeader := r.Header.Get("Authorization")
-	if strings.HasPrefix(authHeader, "Bearer ") && strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer ")) == token {
-		return true
+	format, err := webui.ParseMetricsFormat(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", webui.MetricsContentType(format))
+	if err := webui.WriteMetrics(w, job.Results, format); err != nil {
+		log.Printf("write metrics for job %s: %v", job.ID, err)
 	}
-	return false
+}
+
+func (s *Server) wrapMiddleware(next http.Handler) http.Handler {
+	return accesslog.Handler(httpgzip.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			// OPTIONS only lists the allowed methods; CORS preflights
+			// carry no credentials
+			if s.tokens.enabled() && r.Method != http.MethodOptions {
+				token := requestToken(r)
+				if !s.tokens.allows(token, scopeRead) {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				if !s.tokens.allows(token, requiredScope(r)) {
+					http.Error(w, "forbidden: token lacks the "+string(requiredScope(r))+" scope", http.StatusForbidden)
+					return
+				}
+			}
+			if s.limiter != nil && !s.limiter.Allow(clientIP(r)) {
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			limit := s.maxBodyBytes
+			if r.URL.Path == "/api/state/restore" {
+				// Snapshots grow with the agent count and overlay size
+				limit = s.maxRestoreBytes
+			}
+			if !httpbody.Limit(w, r, limit) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}), httpgzip.Options{Skip: []string{"/metrics"}}), s.accessLog)
 }
 
 func clientIP(r *http.Request) string {
@@ -620,6 +1235,79 @@ func newRequestLimiterFromEnv() *requestLimiter {
 	return &requestLimiter{perSecond: limit, clientState: make(map[string]*clientRateState)}
 }
 
+// apiTokenFromEnv returns the admin token: the trimmed contents of the file
+// named by SNMPSIM_UI_API_TOKEN_FILE, as Docker and Kubernetes secret mounts
+// provide, or else SNMPSIM_UI_API_TOKEN, which is visible in /proc
+func apiTokenFromEnv() (string, error) {
+	path := strings.TrimSpace(os.Getenv("SNMPSIM_UI_API_TOKEN_FILE"))
+	if path == "" {
+		return os.Getenv("SNMPSIM_UI_API_TOKEN"), nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read API token file: %w", err)
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("API token file %s is empty", path)
+	}
+	return token, nil
+}
+
+func bodyLimitFromEnv(name string, fallback int64) int64 {
+	limit := fallback
+	if raw := strings.TrimSpace(os.Getenv(name)); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	return limit
+}
+
+// timeoutsFromEnv reads the server timeouts from SNMPSIM_UI_READ_HEADER_TIMEOUT,
+// SNMPSIM_UI_READ_TIMEOUT, SNMPSIM_UI_WRITE_TIMEOUT and SNMPSIM_UI_IDLE_TIMEOUT
+// (Go durations; 0 disables), keeping the default for unset or invalid values.
+func timeoutsFromEnv() httptimeout.Timeouts {
+	t := httptimeout.Defaults()
+	for _, v := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"SNMPSIM_UI_READ_HEADER_TIMEOUT", &t.ReadHeader},
+		{"SNMPSIM_UI_READ_TIMEOUT", &t.Read},
+		{"SNMPSIM_UI_WRITE_TIMEOUT", &t.Write},
+		{"SNMPSIM_UI_IDLE_TIMEOUT", &t.Idle},
+	} {
+		raw := strings.TrimSpace(os.Getenv(v.name))
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			log.Printf("Warning: invalid %s %q; using %s", v.name, raw, *v.dst)
+			continue
+		}
+		*v.dst = d
+	}
+	return t
+}
+
+// accessLogFromEnv reads SNMPSIM_UI_ACCESS_LOG (off, errors, all) and the
+// SNMPSIM_UI_ACCESS_LOG_SKIP path list; the UI's status poll and /metrics
+// are skipped by default.
+func accessLogFromEnv() accesslog.Options {
+	level, err := accesslog.ParseLevel(os.Getenv("SNMPSIM_UI_ACCESS_LOG"))
+	if err != nil {
+		log.Printf("Warning: %v; logging all requests", err)
+		level = accesslog.All
+	}
+	skip := "/api/status,/metrics"
+	if raw, ok := os.LookupEnv("SNMPSIM_UI_ACCESS_LOG_SKIP"); ok {
+		skip = raw
+	}
+	return accesslog.Options{Level: level, Skip: accesslog.ParseSkip(skip)}
+}
+
 func (rl *requestLimiter) Allow(ip string) bool {
 	if rl == nil {
 		return true
@@ -652,3 +1340,12 @@ func formatUptime(d time.Duration) string {
 	s := total % 60
 	return fmt.Sprintf("%02dh %02dm %02ds", h, m, s)
 }
+
+// decodeJSON decodes the request body into v, rejecting bodies whose
+// Content-Type is not JSON so form posts get 415 rather than a parse error
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := httpbody.CheckContentType(r, "application/json"); err != nil {
+		return err
+	}
+	return json.NewDecoder(r.Body).Decode(v)
+}
@@ -2,16 +2,42 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/agent"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/engine"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httptimeout"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/testutil"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/traps"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/walkdiff"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/webui"
+	"github.com/gosnmp/gosnmp"
 )
 
+func newTestServer(t *testing.T, addr string) *Server {
+	t.Helper()
+	s, err := NewServer(addr)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	return s
+}
+
 func freeUDPPort() (int, bool) {
 	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
 	if err != nil {
@@ -22,7 +48,7 @@ func freeUDPPort() (int, bool) {
 }
 
 func TestHandleSNMPTestWithoutTester(t *testing.T) {
-	s := NewServer(":0")
+	s := newTestServer(t, ":0")
 	body := bytes.NewBufferString(`{"test_type":"get","oids":["1.3.6.1.2.1.1.1.0"],"port_start":20000,"port_end":20000}`)
 	req := httptest.NewRequest(http.MethodPost, "/api/test/snmp", body)
 	rec := httptest.NewRecorder()
@@ -35,7 +61,7 @@ func TestHandleSNMPTestWithoutTester(t *testing.T) {
 }
 
 func TestHandleWorkloadsWithoutManager(t *testing.T) {
-	s := NewServer(":0")
+	s := newTestServer(t, ":0")
 	req := httptest.NewRequest(http.MethodGet, "/api/workloads", nil)
 	rec := httptest.NewRecorder()
 
@@ -47,7 +73,7 @@ func TestHandleWorkloadsWithoutManager(t *testing.T) {
 }
 
 func TestHandleStartStopLifecycle(t *testing.T) {
-	s := NewServer(":0")
+	s := newTestServer(t, ":0")
 	port, ok := freeUDPPort()
 	if !ok {
 		t.Skip("UDP sockets unavailable in this environment")
@@ -96,7 +122,7 @@ func TestHandleStartStopLifecycle(t *testing.T) {
 }
 
 func TestHandleSNMPTestStartsAsyncJob(t *testing.T) {
-	s := NewServer(":0")
+	s := newTestServer(t, ":0")
 	s.SetSNMPTester(webui.NewSNMPTester())
 
 	body := bytes.NewBufferString(`{"test_type":"get","oids":["1.3.6.1.2.1.1.1.0"],"port_start":20000,"port_end":20000,"duration_seconds":1,"interval_seconds":1}`)
@@ -118,7 +144,7 @@ func TestHandleSNMPTestStartsAsyncJob(t *testing.T) {
 }
 
 func TestHandleTestJobWithoutTester(t *testing.T) {
-	s := NewServer(":0")
+	s := newTestServer(t, ":0")
 	req := httptest.NewRequest(http.MethodGet, "/api/test/jobs/job-1", nil)
 	rec := httptest.NewRecorder()
 	s.handleTestJob(rec, req)
@@ -127,9 +153,128 @@ func TestHandleTestJobWithoutTester(t *testing.T) {
 	}
 }
 
+func TestTestJobMetricsEndpointServesFinishedJob(t *testing.T) {
+	s := newTestServer(t, ":0")
+	tester := webui.NewSNMPTester()
+	s.SetSNMPTester(tester)
+
+	// Nothing listens on the port, so the single poll fails fast and the job
+	// finishes with one failed result
+	job, err := tester.StartTests(map[string]interface{}{
+		"test_type":      "get",
+		"oids":           []string{"1.3.6.1.2.1.1.3.0"},
+		"port_start":     1,
+		"port_end":       1,
+		"timeout":        1,
+		"metrics_format": "influx",
+	})
+	if err != nil {
+		t.Fatalf("start tests: %v", err)
+	}
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		current, _ := tester.GetJob(job.ID)
+		if current.EndedAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", current)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/test/jobs/"+job.ID+"/metrics"+query, nil)
+		rec := httptest.NewRecorder()
+		s.handleTestJob(rec, req)
+		return rec
+	}
+
+	rec := get("")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	line := strings.TrimSpace(rec.Body.String())
+	if !strings.HasPrefix(line, "snmpsim_test,test_id=") || !strings.Contains(line, ",port=1,device=0,oid=1.3.6.1.2.1.1.3.0,iteration=1 latency_ms=") || !strings.Contains(line, ",success=false ") {
+		t.Fatalf("unexpected influx metrics: %q", line)
+	}
+
+	rec = get("?format=prometheus")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("prometheus status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "# TYPE snmpsim_test_latency_ms gauge\n") || !strings.Contains(body, `oid="1.3.6.1.2.1.1.3.0",iteration="1"} 0 `) {
+		t.Fatalf("unexpected prometheus metrics:\n%s", body)
+	}
+
+	if rec := get("?format=csv"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown format status = %d, want 400", rec.Code)
+	}
+}
+
+func TestTestJobStreamPushesProgressThenResults(t *testing.T) {
+	s := newTestServer(t, ":0")
+	tester := webui.NewSNMPTester()
+	s.SetSNMPTester(tester)
+	srv := httptest.NewServer(s.httpServer.Handler)
+	defer srv.Close()
+
+	// Nothing listens on port 1: each poll fails fast, and the interval
+	// between the iterations leaves time to attach
+	job, err := tester.StartTests(map[string]interface{}{
+		"test_type":        "get",
+		"oids":             []string{"1.3.6.1.2.1.1.3.0"},
+		"port_start":       1,
+		"port_end":         1,
+		"timeout":          1,
+		"iterations":       2,
+		"interval_seconds": 1,
+	})
+	if err != nil {
+		t.Fatalf("start tests: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/test/jobs/job_missing/stream")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown job stream status = %d, want 404", resp.StatusCode)
+	}
+
+	client := testutil.DialWebSocket(t, srv.URL+"/api/test/jobs/"+job.ID+"/stream", nil)
+	var updates []webui.JobUpdate
+	for {
+		frame, err := client.ReadFrame(15 * time.Second)
+		if err != nil {
+			t.Fatalf("read frame after %d updates: %v", len(updates), err)
+		}
+		if frame.Opcode == 0x8 {
+			if code := int(frame.Payload[0])<<8 | int(frame.Payload[1]); code != 1000 {
+				t.Fatalf("close code = %d, want 1000", code)
+			}
+			break
+		}
+		var update webui.JobUpdate
+		if err := json.Unmarshal(frame.Payload, &update); err != nil {
+			t.Fatalf("decode update %q: %v", frame.Payload, err)
+		}
+		updates = append(updates, update)
+	}
+
+	if len(updates) < 2 || updates[0].Status != "running" || updates[0].Results != nil {
+		t.Fatalf("updates = %+v, want running progress before the final one", updates)
+	}
+	final := updates[len(updates)-1]
+	if final.Status != "failed" || final.Progress.CompletedJobs != 2 || final.Results == nil || final.Results.FailureCount != 2 {
+		t.Fatalf("final update = %+v, want failed with both results", final)
+	}
+}
+
 func TestAPIMiddlewareAuth(t *testing.T) {
 	t.Setenv("SNMPSIM_UI_API_TOKEN", "secret")
-	s := NewServer(":0")
+	s := newTestServer(t, ":0")
 	handler := s.wrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
@@ -152,10 +297,46 @@ func TestAPIMiddlewareAuth(t *testing.T) {
 	}
 }
 
+func TestAPITokenFileTakesPrecedenceOverEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("write token file: %v", err)
+	}
+	t.Setenv("SNMPSIM_UI_API_TOKEN", "from-env")
+	t.Setenv("SNMPSIM_UI_API_TOKEN_FILE", path)
+
+	status := func(s *Server, token string) int {
+		t.Helper()
+		handler := s.wrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	s := newTestServer(t, ":0")
+	if got := status(s, "from-file"); got != http.StatusOK {
+		t.Fatalf("file token status = %d, want %d", got, http.StatusOK)
+	}
+	if got := status(s, "from-env"); got != http.StatusUnauthorized {
+		t.Fatalf("env token status = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	// An unreadable token file fails startup instead of serving the API
+	t.Setenv("SNMPSIM_UI_API_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := NewServer(":0"); err == nil {
+		t.Fatal("NewServer succeeded with a missing token file")
+	}
+}
+
 func TestAPIMiddlewareRateLimit(t *testing.T) {
 	t.Setenv("SNMPSIM_UI_RATE_LIMIT_PER_SEC", "1")
 	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
-	s := NewServer(":0")
+	s := newTestServer(t, ":0")
 	handler := s.wrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
@@ -176,3 +357,1121 @@ func TestAPIMiddlewareRateLimit(t *testing.T) {
 		t.Fatalf("second request status = %d, want %d", rec2.Code, http.StatusTooManyRequests)
 	}
 }
+
+func TestAPIMiddlewareRejectsOversizedBody(t *testing.T) {
+	t.Setenv("SNMPSIM_UI_MAX_BODY_BYTES", "64")
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	s := newTestServer(t, ":0")
+	handler := s.httpServer.Handler
+
+	body := `{"snmprec_file":"` + strings.Repeat("x", 128) + `"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/start", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("declared oversized body status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// Without a Content-Length the limit is enforced while decoding.
+	req = httptest.NewRequest(http.MethodPost, "/api/start", strings.NewReader(body))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("streamed oversized body status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestAPIRejectsNonJSONContentType(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	s := newTestServer(t, ":0")
+	handler := s.httpServer.Handler
+
+	for _, path := range []string{"/api/start", "/api/test/snmp", "/api/variations/trigger", "/api/tokens"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("port_start=20000"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnsupportedMediaType || !strings.Contains(rec.Body.String(), "want application/json") {
+			t.Fatalf("%s status = %d, body=%s, want %d", path, rec.Code, rec.Body.String(), http.StatusUnsupportedMediaType)
+		}
+	}
+}
+
+func TestServerTimeoutsFromEnv(t *testing.T) {
+	s := newTestServer(t, ":0")
+	if s.httpServer.ReadHeaderTimeout != httptimeout.DefaultReadHeaderTimeout || s.httpServer.ReadTimeout != httptimeout.DefaultReadTimeout ||
+		s.httpServer.WriteTimeout != httptimeout.DefaultWriteTimeout || s.httpServer.IdleTimeout != httptimeout.DefaultIdleTimeout {
+		t.Fatalf("default timeouts not set: %+v", s.httpServer)
+	}
+
+	t.Setenv("SNMPSIM_UI_READ_HEADER_TIMEOUT", "2s")
+	t.Setenv("SNMPSIM_UI_WRITE_TIMEOUT", "0")
+	t.Setenv("SNMPSIM_UI_IDLE_TIMEOUT", "soon")
+	s = newTestServer(t, ":0")
+	if s.httpServer.ReadHeaderTimeout != 2*time.Second {
+		t.Fatalf("read header timeout = %s, want 2s", s.httpServer.ReadHeaderTimeout)
+	}
+	if s.httpServer.WriteTimeout != 0 {
+		t.Fatalf("write timeout = %s, want disabled", s.httpServer.WriteTimeout)
+	}
+	if s.httpServer.IdleTimeout != httptimeout.DefaultIdleTimeout {
+		t.Fatalf("invalid idle timeout should keep default, got %s", s.httpServer.IdleTimeout)
+	}
+}
+
+func TestStateSnapshotRestoreEndpoints(t *testing.T) {
+	sim, err := engine.NewSimulator("127.0.0.1", 20000, 20001, 1, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	handler := s.httpServer.Handler
+	const oid = "1.3.6.1.4.1.55555.3.1.0"
+
+	if err := sim.SetOverlayValue(20000, oid, "original"); err != nil {
+		t.Fatalf("set overlay: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/state/snapshot", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("snapshot status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	blob := rec.Body.Bytes()
+
+	if err := sim.SetOverlayValue(20000, oid, "clobbered"); err != nil {
+		t.Fatalf("set overlay: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/state/restore", bytes.NewReader(blob)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	restored, err := sim.SnapshotState()
+	if err != nil {
+		t.Fatalf("snapshot after restore: %v", err)
+	}
+	if !bytes.Equal(restored, blob) {
+		t.Fatalf("state after restore = %s, want %s", restored, blob)
+	}
+
+	// Snapshots are exempt from the general body cap but have their own
+	t.Setenv("SNMPSIM_UI_MAX_BODY_BYTES", "16")
+	t.Setenv("SNMPSIM_UI_MAX_RESTORE_BYTES", strconv.Itoa(len(blob)))
+	limited := newTestServer(t, ":0")
+	limited.SetSimulator(sim)
+	rec = httptest.NewRecorder()
+	limited.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/state/restore", bytes.NewReader(blob)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore under general cap status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	oversized := append(append([]byte(nil), blob...), ' ')
+	rec = httptest.NewRecorder()
+	limited.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/state/restore", bytes.NewReader(oversized)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("restore over restore cap status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/state/restore", strings.NewReader("not json")))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad blob status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServerServesHTTPS(t *testing.T) {
+	certFile, keyFile := testutil.WriteSelfSignedCert(t)
+
+	s := newTestServer(t, "127.0.0.1:0")
+	s.SetTLS(certFile, keyFile)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = s.Stop() })
+
+	client := testutil.TLSClient(t, certFile)
+	resp, err := client.Get("https://" + ln.Addr().String() + "/api/status")
+	if err != nil {
+		t.Fatalf("https request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Fatalf("unexpected TLS state: %+v", resp.TLS)
+	}
+
+	old := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS11,
+		}},
+	}
+	if resp, err := old.Get("https://" + ln.Addr().String() + "/api/status"); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected TLS 1.1 handshake to be rejected")
+	}
+}
+
+func TestAPIMiddlewareTokenScopes(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	tokensFile := filepath.Join(t.TempDir(), "tokens.json")
+	seed := `{"tokens":[{"token":"admin-token","scopes":["admin"]},{"token":"read-token","scopes":["read"]},{"token":"ops-token","scopes":["control"]}]}`
+	if err := os.WriteFile(tokensFile, []byte(seed), 0o600); err != nil {
+		t.Fatalf("write tokens file: %v", err)
+	}
+	s := newTestServer(t, ":0")
+	if err := s.SetTokenFile(tokensFile); err != nil {
+		t.Fatalf("load tokens: %v", err)
+	}
+	handler := s.wrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cases := []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/api/status", "read-token", http.StatusOK},
+		{http.MethodPost, "/api/start", "read-token", http.StatusForbidden},
+		{http.MethodPost, "/api/stop", "read-token", http.StatusForbidden},
+		{http.MethodPost, "/api/stop", "ops-token", http.StatusOK},
+		{http.MethodGet, "/api/tokens", "ops-token", http.StatusForbidden},
+		{http.MethodGet, "/api/tokens", "admin-token", http.StatusOK},
+		{http.MethodGet, "/api/status", "unknown", http.StatusUnauthorized},
+		{http.MethodGet, "/api/status", "", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		if got := do(tc.method, tc.path, tc.token); got != tc.want {
+			t.Errorf("%s %s with %q: status = %d, want %d", tc.method, tc.path, tc.token, got, tc.want)
+		}
+	}
+}
+
+func TestTokensEndpointRotatesTokens(t *testing.T) {
+	t.Setenv("SNMPSIM_UI_API_TOKEN", "bootstrap")
+	tokensFile := filepath.Join(t.TempDir(), "tokens.json")
+	s := newTestServer(t, ":0")
+	if err := s.SetTokenFile(tokensFile); err != nil {
+		t.Fatalf("load tokens: %v", err)
+	}
+	handler := s.httpServer.Handler
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:12345"
+		req.Header.Set("X-API-Token", token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/tokens", "bootstrap", `{"scopes":["read"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add token status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var created apiTokenEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.Token == "" {
+		t.Fatalf("decode created token: %v %+v", err, created)
+	}
+	if rec := do(http.MethodGet, "/api/status", created.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("new read token on status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/tokens", "bootstrap", `{"token":"x","scopes":["superuser"]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown scope status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// The new token is persisted so a restarted server still accepts it
+	reloaded := newTokenStore()
+	if err := reloaded.load(tokensFile); err != nil {
+		t.Fatalf("reload tokens: %v", err)
+	}
+	if !reloaded.allows(created.Token, scopeRead) {
+		t.Fatal("created token missing from tokens file")
+	}
+	if reloaded.allows("bootstrap", scopeRead) {
+		t.Fatal("environment token written to tokens file")
+	}
+
+	if rec := do(http.MethodDelete, "/api/tokens?token="+created.Token, "bootstrap", ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoke status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/status", created.Token, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token on status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := do(http.MethodDelete, "/api/tokens?token=bootstrap", "bootstrap", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("revoking the last admin token status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestAPIMiddlewareWritesAccessLog(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	s := newTestServer(t, ":0")
+	var buf bytes.Buffer
+	s.accessLog.Logger = log.New(&buf, "", 0)
+	handler := s.wrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such workload", http.StatusNotFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/workloads/load?name=x", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if line := buf.String(); !strings.Contains(line, "GET /api/workloads/load?name=x 404") || !strings.Contains(line, "client=127.0.0.1") {
+		t.Fatalf("unexpected access log: %q", line)
+	}
+
+	buf.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if buf.Len() != 0 {
+		t.Fatalf("status poll should be skipped by default, got %q", buf.String())
+	}
+}
+
+func TestAgentDiffEndpointComparesRoutedDatasets(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	left := writeFile("left.snmprec", "1.3.6.1.4.1.55555.4.1.0|octetstring|same\n1.3.6.1.4.1.55555.4.2.0|octetstring|left\n")
+	right := writeFile("right.snmprec", "1.3.6.1.4.1.55555.4.1.0|octetstring|same\n1.3.6.1.4.1.55555.4.2.0|octetstring|right\n1.3.6.1.4.1.55555.4.3.0|integer|3\n")
+	routes := writeFile("routes.yaml", fmt.Sprintf(`routes:
+  - match: {dstPort: %d}
+    action: {datasetPath: %s}
+  - match: {dstPort: %d}
+    action: {datasetPath: %s}
+`, port, left, port+1, right))
+
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+2, 2, "", routes, "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	s.SetSimulatorStatus(port, port+2, 2, "127.0.0.1", time.Now().Format(time.RFC3339))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/agents/diff?a=%d&b=%d&root=1.3.6.1.4.1.55555.4", port, port+1), nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("diff status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var got struct {
+		Identical  bool                  `json:"identical"`
+		LeftCount  int                   `json:"left_count"`
+		RightCount int                   `json:"right_count"`
+		Diffs      []walkdiff.Difference `json:"diffs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode diff: %v", err)
+	}
+	if got.Identical || got.LeftCount != 2 || got.RightCount != 3 || len(got.Diffs) != 2 {
+		t.Fatalf("unexpected diff: %s", rec.Body.String())
+	}
+	if d := got.Diffs[0]; d.OID != "1.3.6.1.4.1.55555.4.2.0" || d.Kind != "value-mismatch" || d.LeftValue != "left" || d.RightValue != "right" {
+		t.Fatalf("first difference = %+v", d)
+	}
+	if d := got.Diffs[1]; d.OID != "1.3.6.1.4.1.55555.4.3.0" || d.Kind != "missing-in-left" {
+		t.Fatalf("second difference = %+v", d)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/agents/diff?a=%d&b=1", port), nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown port status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestTriggerVariationEndpointFiresVariationTrap(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	sink, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen trap sink: %v", err)
+	}
+	defer sink.Close()
+
+	dir := t.TempDir()
+	dataset := filepath.Join(dir, "device.snmprec")
+	if err := os.WriteFile(dataset, []byte("1.3.6.1.4.1.55555.8.1.0|counter32|100\n1.3.6.1.4.1.55555.8.2.0|integer|7\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	variations := filepath.Join(dir, "variations.yaml")
+	if err := os.WriteFile(variations, []byte("bindings:\n  - prefix: \"1.3.6.1.4.1.55555.8.1\"\n    variations:\n      - type: counterMonotonic\n        delta: 5\n"), 0o644); err != nil {
+		t.Fatalf("write variations: %v", err)
+	}
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+1, 1, dataset, "", variations, v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetTrapConfig(traps.Config{Targets: []string{sink.LocalAddr().String()}, OnVariation: true, Timeout: time.Second}); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	trigger := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/variations/trigger", strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:12345"
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := trigger(fmt.Sprintf(`{"port":%d,"oid":"1.3.6.1.4.1.55555.8.1.0"}`, port))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("trigger status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode trigger: %v", err)
+	}
+	if got.Type != "counter32" || got.Value != "105" {
+		t.Fatalf("unexpected varied value: %s", rec.Body.String())
+	}
+
+	_ = sink.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := sink.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("read trap: %v", err)
+	}
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	pkt, err := decoder.SnmpDecodePacket(buf[:n])
+	if err != nil {
+		t.Fatalf("decode trap: %v", err)
+	}
+	vars := make(map[string]interface{}, len(pkt.Variables))
+	for _, v := range pkt.Variables {
+		vars[v.Name] = v.Value
+	}
+	if vars[".1.3.6.1.6.3.1.1.4.1.0"] != "."+traps.TrapOIDVariation {
+		t.Fatalf("trap OID = %v, want %s", vars[".1.3.6.1.6.3.1.1.4.1.0"], traps.TrapOIDVariation)
+	}
+	if string(vars[".1.3.6.1.4.1.55555.2.1.0"].([]byte)) != "1.3.6.1.4.1.55555.8.1.0" ||
+		string(vars[".1.3.6.1.4.1.55555.2.2.0"].([]byte)) != "manual-trigger" {
+		t.Fatalf("unexpected trap varbinds: %+v", pkt.Variables)
+	}
+
+	if rec := trigger(`{"device":0,"oid":"1.3.6.1.4.1.55555.8.2.0"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("unbound oid status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := trigger(`{"port":1,"oid":"1.3.6.1.4.1.55555.8.1.0"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown port status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAgentRequestsEndpointReturnsCapturedRequests(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	dataset := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(dataset, []byte("1.3.6.1.4.1.55555.7.1.0|octetstring|one\n1.3.6.1.4.1.55555.7.2.0|integer|2\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+1, 1, dataset, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	sim.SetRequestCapture(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		Timeout:   time.Second,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	for _, oids := range [][]string{{"1.3.6.1.4.1.55555.7.1.0"}, {"1.3.6.1.4.1.55555.7.1.0", "1.3.6.1.4.1.55555.7.2.0"}} {
+		if _, err := client.Get(oids); err != nil {
+			t.Fatalf("get %v: %v", oids, err)
+		}
+	}
+
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/agents/%d/requests", port), nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("requests status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var got struct {
+		Port     int                    `json:"port"`
+		Requests []agent.RequestSummary `json:"requests"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode requests: %v", err)
+	}
+	if got.Port != port || len(got.Requests) != 2 {
+		t.Fatalf("unexpected capture: %s", rec.Body.String())
+	}
+	last := got.Requests[1]
+	if last.PDUType != "GetRequest" || last.Version != "2c" || len(last.OIDs) != 2 || last.OIDs[1] != "1.3.6.1.4.1.55555.7.2.0" {
+		t.Fatalf("last request = %+v", last)
+	}
+	if !strings.HasPrefix(last.Source, "127.0.0.1:") || last.Time.IsZero() {
+		t.Fatalf("last request source/time = %q/%v", last.Source, last.Time)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/agents/1/requests", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown port status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAgentRebootResetsUptimeAndSendsColdStart(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	sink, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen trap sink: %v", err)
+	}
+	defer sink.Close()
+
+	dataset := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(dataset, []byte("1.3.6.1.2.1.1.1.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+1, 1, dataset, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetBootOffsets(time.Hour, time.Hour, nil); err != nil {
+		t.Fatalf("set boot offsets: %v", err)
+	}
+	if err := sim.SetTrapConfig(traps.Config{Targets: []string{sink.LocalAddr().String()}, Timeout: time.Second}); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	uptime := func() uint32 {
+		t.Helper()
+		client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+		if err := client.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer client.Conn.Close()
+		pkt, err := client.Get([]string{"1.3.6.1.2.1.1.3.0"})
+		if err != nil {
+			t.Fatalf("get sysUpTime: %v", err)
+		}
+		return uint32(gosnmp.ToBigInt(pkt.Variables[0].Value).Uint64())
+	}
+	before := uptime()
+
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/agents/%d/reboot", port), nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reboot status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		EngineBoots uint32 `json:"engine_boots"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.EngineBoots != 2 {
+		t.Fatalf("reboot response = %s, want engine_boots 2", rec.Body.String())
+	}
+
+	if after := uptime(); after >= before || after > 100 {
+		t.Fatalf("sysUpTime after reboot = %d, before = %d; want it reset near zero", after, before)
+	}
+
+	_ = sink.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := sink.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("read trap: %v", err)
+	}
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	pkt, err := decoder.SnmpDecodePacket(buf[:n])
+	if err != nil {
+		t.Fatalf("decode trap: %v", err)
+	}
+	var trapOID interface{}
+	for _, v := range pkt.Variables {
+		if v.Name == ".1.3.6.1.6.3.1.1.4.1.0" {
+			trapOID = v.Value
+		}
+	}
+	if trapOID != "."+traps.TrapOIDColdStart {
+		t.Fatalf("trap OID = %v, want coldStart", trapOID)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/agents/1/reboot", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown port status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAgentDisableDropsRequestsUntilEnabled(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	dataset := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(dataset, []byte("1.3.6.1.2.1.1.1.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+1, 1, dataset, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	get := func() error {
+		t.Helper()
+		client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: 300 * time.Millisecond}
+		if err := client.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer client.Conn.Close()
+		_, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"})
+		return err
+	}
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	post := func(action string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/agents/%d/%s", port, action), nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"`+action+`d"`) {
+			t.Fatalf("%s status = %d, body=%s", action, rec.Code, rec.Body.String())
+		}
+	}
+
+	if err := get(); err != nil {
+		t.Fatalf("get before disable: %v", err)
+	}
+	post("disable")
+	if err := get(); err == nil {
+		t.Fatal("get while disabled succeeded, want a timeout")
+	}
+	post("enable")
+	if err := get(); err != nil {
+		t.Fatalf("get after enable: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/agents/1/disable", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown port status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAgentEnableLeavesRunningAgentUntouched(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	sim, err := engine.NewSimulator("127.0.0.1", 20000, 20001, 1, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	var logs bytes.Buffer
+	sim.SetLogger(log.New(&logs, "", 0))
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/agents/20000/enable", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enable status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("enabling a running agent changed its state: %q", logs.String())
+	}
+}
+
+func TestAgentImportOIDsServesNewOIDsImmediately(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	dataset := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(dataset, []byte("1.3.6.1.2.1.1.1.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+2, 2, dataset, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	post := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/agents/%d/oids", port), strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:12345"
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := post("1.3.6.1.4.1.55555.20.1.0|octetstring|imported\n1.3.6.1.4.1.55555.20.2.0|counter32|42\n")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"imported":2`) {
+		t.Fatalf("import status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := post("1.3.6.1.4.1.55555.20.3.0|integer|not-a-number\n"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid line status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	get := func(port int) []gosnmp.SnmpPDU {
+		t.Helper()
+		client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+		if err := client.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer client.Conn.Close()
+		pkt, err := client.Get([]string{"1.3.6.1.4.1.55555.20.1.0", "1.3.6.1.4.1.55555.20.2.0"})
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		return pkt.Variables
+	}
+	vars := get(port)
+	if value, _ := vars[0].Value.([]byte); string(value) != "imported" {
+		t.Fatalf("imported string = %v (%v)", vars[0].Value, vars[0].Type)
+	}
+	if vars[1].Type != gosnmp.Counter32 || gosnmp.ToBigInt(vars[1].Value).Uint64() != 42 {
+		t.Fatalf("imported counter = %v (%v)", vars[1].Value, vars[1].Type)
+	}
+	if other := get(port + 1); other[0].Type != gosnmp.NoSuchObject {
+		t.Fatalf("other agent serves imported OID: %v (%v)", other[0].Value, other[0].Type)
+	}
+}
+
+func TestAPIAnswersOptionsAndSetsAllowOn405(t *testing.T) {
+	t.Setenv("SNMPSIM_UI_API_TOKEN", "secret")
+	s := newTestServer(t, ":0")
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		req.Header.Set("X-API-Token", "secret")
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodDelete, "/api/start"); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Fatalf("DELETE /api/start: status %d Allow %q, want 405 %q", rec.Code, rec.Header().Get("Allow"), "POST, OPTIONS")
+	}
+	if rec := serve(http.MethodPut, "/api/test/jobs/job-1"); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Fatalf("PUT /api/test/jobs: status %d Allow %q, want 405 %q", rec.Code, rec.Header().Get("Allow"), "GET, POST, OPTIONS")
+	}
+
+	// Preflights carry no token
+	req := httptest.NewRequest(http.MethodOptions, "/api/tokens", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Allow") != "GET, POST, DELETE, OPTIONS" {
+		t.Fatalf("OPTIONS /api/tokens: status %d Allow %q, want 204 %q", rec.Code, rec.Header().Get("Allow"), "GET, POST, DELETE, OPTIONS")
+	}
+}
+
+func TestStatsResetZeroesPollCounts(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	dataset := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(dataset, []byte("1.3.6.1.2.1.1.1.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+1, 1, dataset, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+			t.Fatalf("get %d: %v", i, err)
+		}
+	}
+
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	reset := func() map[string]interface{} {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/stats/reset", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("reset status = %d, body=%s", rec.Code, rec.Body.String())
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode reset: %v", err)
+		}
+		return body
+	}
+
+	body := reset()
+	if body["total_polls"] != float64(3) {
+		t.Fatalf("pre-reset total_polls = %v, want 3", body["total_polls"])
+	}
+	if agents, _ := body["agents"].(map[string]interface{}); agents[strconv.Itoa(port)] != float64(3) {
+		t.Fatalf("pre-reset agents = %v, want port %d at 3", body["agents"], port)
+	}
+	if got := sim.Statistics()["total_polls"]; got != int64(0) {
+		t.Fatalf("total_polls after reset = %v, want 0", got)
+	}
+
+	if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatalf("get after reset: %v", err)
+	}
+	if body := reset(); body["total_polls"] != float64(1) {
+		t.Fatalf("second reset total_polls = %v, want 1", body["total_polls"])
+	}
+}
+
+func TestMetricsJSONMatchesPrometheus(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	dataset := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(dataset, []byte("1.3.6.1.2.1.1.1.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+2, 2, dataset, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+			t.Fatalf("get %d: %v", i, err)
+		}
+	}
+
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	get := func(path string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status = %d, body=%s", path, rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+
+	prom := make(map[string]string)
+	for _, line := range strings.Split(get("/metrics"), "\n") {
+		if name, value, ok := strings.Cut(line, " "); ok && !strings.HasPrefix(line, "#") {
+			prom[name] = value
+		}
+	}
+	var metrics struct {
+		TotalPolls int64 `json:"total_polls"`
+		Agents     int   `json:"agents"`
+		Running    bool  `json:"running"`
+	}
+	if err := json.Unmarshal([]byte(get("/api/metrics")), &metrics); err != nil {
+		t.Fatalf("decode /api/metrics: %v", err)
+	}
+
+	if metrics.TotalPolls != 2 || prom["snmpsim_simulator_polls_total"] != strconv.FormatInt(metrics.TotalPolls, 10) {
+		t.Errorf("total_polls = %d, prometheus = %s, want both 2", metrics.TotalPolls, prom["snmpsim_simulator_polls_total"])
+	}
+	if metrics.Agents != 2 || prom["snmpsim_simulator_agents"] != strconv.Itoa(metrics.Agents) {
+		t.Errorf("agents = %d, prometheus = %s, want both 2", metrics.Agents, prom["snmpsim_simulator_agents"])
+	}
+	if !metrics.Running || prom["snmpsim_simulator_running"] != "1" {
+		t.Errorf("running = %v, prometheus = %s, want true and 1", metrics.Running, prom["snmpsim_simulator_running"])
+	}
+}
+
+func TestMetricsCountsOIDQueriesByPrefix(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	dataset := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(dataset, []byte(`1.3.6.1.4.1.55555.20.1.1.1|integer|1
+1.3.6.1.4.1.55555.20.1.1.2|integer|2
+1.3.6.1.4.1.55555.20.1.2.1|octetstring|a
+1.3.6.1.4.1.55555.20.1.2.2|octetstring|b
+1.3.6.1.4.1.55555.30.1.0|integer|3
+`), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+1, 1, dataset, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	s := newTestServer(t, ":0")
+	s.SetSimulator(sim)
+	metrics := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/metrics status = %d, body=%s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+	if body := metrics(); strings.Contains(body, "snmpsim_oid_queries_total") {
+		t.Fatalf("OID metrics served before they were enabled:\n%s", body)
+	}
+
+	if err := sim.EnableOIDMetrics(8); err != nil {
+		t.Fatalf("enable OID metrics: %v", err)
+	}
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get([]string{"1.3.6.1.4.1.55555.30.1.0"}); err != nil {
+			t.Fatalf("get %d: %v", i, err)
+		}
+	}
+	if _, err := client.WalkAll("1.3.6.1.4.1.55555.20"); err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+
+	body := metrics()
+	// the walk's five GETNEXTs (the root and each of the four rows) share a
+	// prefix; the GETs have their own
+	for _, want := range []string{
+		`snmpsim_oid_queries_total{prefix="1.3.6.1.4.1.55555.20"} 5`,
+		`snmpsim_oid_queries_total{prefix="1.3.6.1.4.1.55555.30"} 3`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("/metrics lacks %s:\n%s", want, body)
+		}
+	}
+	if err := sim.EnableOIDMetrics(0); err == nil {
+		t.Error("EnableOIDMetrics(0) succeeded, want an error")
+	}
+}
+
+// TestStatusStartStopConcurrently is meant for go test -race: it reads the
+// status while other requests start and stop the simulator.
+func TestStatusStartStopConcurrently(t *testing.T) {
+	os.Unsetenv("SNMPSIM_UI_API_TOKEN")
+	t.Setenv("SNMPSIM_UI_RATE_LIMIT_PER_SEC", "1000")
+	port, ok := freeUDPPort()
+	if !ok {
+		t.Skip("UDP sockets unavailable in this environment")
+	}
+	s := newTestServer(t, ":0")
+	t.Cleanup(func() {
+		s.mu.Lock()
+		sim, cancel := s.simulator, s.simCancel
+		s.mu.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+		if sim != nil {
+			sim.Stop()
+		}
+	})
+	serve := func(method, path, body string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:12345"
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	start := fmt.Sprintf(`{"listen_addr":"127.0.0.1","port_start":%d,"port_end":%d,"devices":1}`, port, port+1)
+
+	var wg sync.WaitGroup
+	for _, worker := range []func(){
+		func() {
+			if code := serve(http.MethodPost, "/api/start", start); code != http.StatusOK && code != http.StatusConflict && code != http.StatusInternalServerError {
+				t.Errorf("start status = %d", code)
+			}
+		},
+		func() {
+			if code := serve(http.MethodPost, "/api/stop", ""); code != http.StatusOK {
+				t.Errorf("stop status = %d", code)
+			}
+		},
+		func() {
+			if code := serve(http.MethodGet, "/api/status", ""); code != http.StatusOK {
+				t.Errorf("status status = %d", code)
+			}
+		},
+	} {
+		wg.Add(1)
+		go func(work func()) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				work()
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	for _, tc := range []struct {
+		method, path, body string
+		running            bool
+	}{
+		{http.MethodPost, "/api/stop", "", false},
+		{http.MethodPost, "/api/start", start, true},
+		{http.MethodPost, "/api/stop", "", false},
+	} {
+		if code := serve(tc.method, tc.path, tc.body); code != http.StatusOK {
+			t.Fatalf("%s status = %d", tc.path, code)
+		}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		var status SimulatorStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("decode status: %v", err)
+		}
+		if status.IsRunning != tc.running {
+			t.Fatalf("after %s is_running = %v, want %v", tc.path, status.IsRunning, tc.running)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpbody"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/httpmethod"
+)
+
+// tokenScope is a permission level granted to an API token. Each scope
+// includes the ones below it: admin > control > read.
+type tokenScope string
+
+const (
+	scopeRead    tokenScope = "read"
+	scopeControl tokenScope = "control"
+	scopeAdmin   tokenScope = "admin"
+)
+
+var scopeRank = map[tokenScope]int{scopeRead: 1, scopeControl: 2, scopeAdmin: 3}
+
+// apiTokenEntry is one token as stored in the tokens file and accepted by
+// POST /api/tokens
+type apiTokenEntry struct {
+	Token  string       `json:"token"`
+	Scopes []tokenScope `json:"scopes"`
+}
+
+type tokenFile struct {
+	Tokens []apiTokenEntry `json:"tokens"`
+}
+
+// tokenStore holds the API tokens and their scopes. When path is set, every
+// change is written back to it so rotations survive a restart. Tokens in
+// fixed come from the environment and are never written to the file.
+type tokenStore struct {
+	mu     sync.RWMutex
+	path   string
+	tokens map[string][]tokenScope
+	fixed  map[string]bool
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{tokens: make(map[string][]tokenScope), fixed: make(map[string]bool)}
+}
+
+// setFixed grants token scopes for the life of the process without
+// persisting it
+func (ts *tokenStore) setFixed(token string, scopes []tokenScope) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tokens[token] = scopes
+	ts.fixed[token] = true
+}
+
+// load reads the tokens file at path and persists later changes to it. A
+// missing file starts an empty store that is created on the first change.
+func (ts *tokenStore) load(path string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.path = path
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read API tokens file: %w", err)
+	}
+	var file tokenFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("decode API tokens file %s: %w", path, err)
+	}
+	for _, entry := range file.Tokens {
+		if err := validateTokenEntry(entry); err != nil {
+			return fmt.Errorf("API tokens file %s: %w", path, err)
+		}
+		ts.tokens[entry.Token] = entry.Scopes
+	}
+	return nil
+}
+
+func validateTokenEntry(entry apiTokenEntry) error {
+	if strings.TrimSpace(entry.Token) == "" {
+		return fmt.Errorf("token must not be empty")
+	}
+	if len(entry.Scopes) == 0 {
+		return fmt.Errorf("token needs at least one scope")
+	}
+	for _, scope := range entry.Scopes {
+		if _, ok := scopeRank[scope]; !ok {
+			return fmt.Errorf("unknown scope %q (want read, control or admin)", scope)
+		}
+	}
+	return nil
+}
+
+// enabled reports whether any token is configured; without tokens the API
+// is open, as before token support existed.
+func (ts *tokenStore) enabled() bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return len(ts.tokens) > 0
+}
+
+// allows reports whether token grants scope
+func (ts *tokenStore) allows(token string, scope tokenScope) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	for _, granted := range ts.tokens[token] {
+		if scopeRank[granted] >= scopeRank[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts *tokenStore) add(entry apiTokenEntry) error {
+	if err := validateTokenEntry(entry); err != nil {
+		return err
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if _, ok := ts.tokens[entry.Token]; ok {
+		return errTokenExists
+	}
+	ts.tokens[entry.Token] = entry.Scopes
+	if err := ts.saveLocked(); err != nil {
+		delete(ts.tokens, entry.Token)
+		return err
+	}
+	return nil
+}
+
+func (ts *tokenStore) revoke(token string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	scopes, ok := ts.tokens[token]
+	if !ok {
+		return errTokenNotFound
+	}
+	if hasScope(scopes, scopeAdmin) && ts.adminCountLocked() == 1 {
+		return errLastAdminToken
+	}
+	fixed := ts.fixed[token]
+	delete(ts.tokens, token)
+	delete(ts.fixed, token)
+	if err := ts.saveLocked(); err != nil {
+		ts.tokens[token] = scopes
+		if fixed {
+			ts.fixed[token] = true
+		}
+		return err
+	}
+	return nil
+}
+
+// list returns the tokens with their values masked, sorted for stable output
+func (ts *tokenStore) list() []apiTokenEntry {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	out := make([]apiTokenEntry, 0, len(ts.tokens))
+	for token, scopes := range ts.tokens {
+		out = append(out, apiTokenEntry{Token: maskToken(token), Scopes: scopes})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Token < out[j].Token })
+	return out
+}
+
+func (ts *tokenStore) adminCountLocked() int {
+	count := 0
+	for _, scopes := range ts.tokens {
+		if hasScope(scopes, scopeAdmin) {
+			count++
+		}
+	}
+	return count
+}
+
+func (ts *tokenStore) saveLocked() error {
+	if ts.path == "" {
+		return nil
+	}
+	file := tokenFile{Tokens: make([]apiTokenEntry, 0, len(ts.tokens))}
+	for token, scopes := range ts.tokens {
+		if ts.fixed[token] {
+			continue
+		}
+		file.Tokens = append(file.Tokens, apiTokenEntry{Token: token, Scopes: scopes})
+	}
+	sort.Slice(file.Tokens, func(i, j int) bool { return file.Tokens[i].Token < file.Tokens[j].Token })
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ts.path), ".tokens-*.json")
+	if err != nil {
+		return fmt.Errorf("write API tokens file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write API tokens file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write API tokens file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), ts.path); err != nil {
+		return fmt.Errorf("write API tokens file: %w", err)
+	}
+	return nil
+}
+
+func hasScope(scopes []tokenScope, scope tokenScope) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+	return token[:4] + "****"
+}
+
+func generateToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+var (
+	errTokenExists    = fmt.Errorf("token already exists")
+	errTokenNotFound  = fmt.Errorf("token not found")
+	errLastAdminToken = fmt.Errorf("cannot revoke the last admin token")
+)
+
+// requiredScope is the scope a request needs: token management is admin
+// only, other reads need read, and everything that changes state needs control.
+func requiredScope(r *http.Request) tokenScope {
+	if r.URL.Path == "/api/tokens" {
+		return scopeAdmin
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return scopeRead
+	}
+	return scopeControl
+}
+
+// requestToken returns the token from X-API-Token or a Bearer Authorization header
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get("X-API-Token"); token != "" {
+		return token
+	}
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	}
+	return ""
+}
+
+// handleTokens lists (GET), adds (POST) and revokes (DELETE ?token=) API tokens
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	if !httpmethod.Allow(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"tokens": s.tokens.list()})
+
+	case http.MethodPost:
+		var entry apiTokenEntry
+		if err := decodeJSON(r, &entry); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), httpbody.ErrorStatus(err))
+			return
+		}
+		if entry.Token == "" {
+			token, err := generateToken()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("generate token: %v", err), http.StatusInternalServerError)
+				return
+			}
+			entry.Token = token
+		}
+		if err := s.tokens.add(entry); err != nil {
+			status := http.StatusBadRequest
+			if err == errTokenExists {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entry)
+
+	case http.MethodDelete:
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Error(w, "token required", http.StatusBadRequest)
+			return
+		}
+		if err := s.tokens.revoke(token); err != nil {
+			status := http.StatusInternalServerError
+			switch err {
+			case errTokenNotFound:
+				status = http.StatusNotFound
+			case errLastAdminToken:
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+	}
+}
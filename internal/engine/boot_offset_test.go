@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+)
+
+func TestBootOffsetsGiveDevicesDistinctTickingUptimes(t *testing.T) {
+	sim, err := NewSimulator("127.0.0.1", 20000, 20003, 3, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	perDevice := map[int]time.Duration{0: 72 * time.Hour, 1: 10 * time.Minute}
+	if err := sim.SetBootOffsets(time.Hour, 2*time.Hour, perDevice); err != nil {
+		t.Fatalf("set boot offsets: %v", err)
+	}
+
+	uptime := func(port int) uint32 {
+		pdu, ok := sim.agents[port].ResolveOID("1.3.6.1.2.1.1.3.0")
+		if !ok {
+			t.Fatalf("port %d: sysUpTime not resolved", port)
+		}
+		return pdu.Value.(uint32)
+	}
+
+	first := map[int]uint32{20000: uptime(20000), 20001: uptime(20001), 20002: uptime(20002)}
+	near := func(got uint32, want time.Duration) bool {
+		return time.Duration(got)*10*time.Millisecond-want < time.Second
+	}
+	if !near(first[20000], 72*time.Hour) {
+		t.Fatalf("device 0 sysUpTime = %d, want about 3 days", first[20000])
+	}
+	if !near(first[20001], 10*time.Minute) {
+		t.Fatalf("device 1 sysUpTime = %d, want about 10 minutes", first[20001])
+	}
+	if got := time.Duration(first[20002]) * 10 * time.Millisecond; got < time.Hour || got > 2*time.Hour+time.Second {
+		t.Fatalf("device 2 sysUpTime = %s, want within the 1h-2h range", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	for port, before := range first {
+		if after := uptime(port); after <= before {
+			t.Fatalf("port %d sysUpTime did not advance: %d -> %d", port, before, after)
+		}
+	}
+
+	if err := sim.SetBootOffsets(2*time.Hour, time.Hour, nil); err == nil {
+		t.Fatal("expected error for an inverted range")
+	}
+	if err := sim.SetBootOffsets(0, 0, map[int]time.Duration{0: 600 * 24 * time.Hour}); err == nil {
+		t.Fatal("expected error for an offset past the TimeTicks range")
+	}
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/routing"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+	"github.com/gosnmp/gosnmp"
+)
+
+// snmpCommunityEntry is the SNMP-COMMUNITY-MIB snmpCommunityTable row
+const snmpCommunityEntry = "1.3.6.1.6.3.18.1.1.1"
+
+// StorageType and RowStatus of the table rows the simulator generates
+const (
+	storageReadOnly = 5 // StorageType readOnly
+	rowStatusActive = 1 // RowStatus active
+)
+
+// communityTableEntries renders community mappings as snmpCommunityTable
+// rows. Rows are indexed by the IMPLIED snmpCommunityIndex, one arc per
+// character, as the MIB defines.
+func communityTableEntries(communities []routing.Community) map[string]*store.OIDValue {
+	entries := make(map[string]*store.OIDValue, len(communities)*7)
+	for _, c := range communities {
+		index := impliedIndex(c.Index)
+		engineID, _ := hex.DecodeString(strings.TrimPrefix(c.ContextEngineID, "0x")) // validated by the router
+		columns := map[int]*store.OIDValue{
+			2: {Type: gosnmp.OctetString, Value: c.Community},
+			3: {Type: gosnmp.OctetString, Value: c.SecurityName},
+			4: {Type: gosnmp.OctetString, Value: string(engineID)},
+			5: {Type: gosnmp.OctetString, Value: c.Context},
+			6: {Type: gosnmp.OctetString, Value: ""},
+			7: {Type: gosnmp.Integer, Value: storageReadOnly},
+			8: {Type: gosnmp.Integer, Value: rowStatusActive},
+		}
+		for col, value := range columns {
+			entries[fmt.Sprintf("%s.%d.%s", snmpCommunityEntry, col, index)] = value
+		}
+	}
+	return entries
+}
+
+// impliedIndex renders an IMPLIED string index: one arc per byte, without
+// the length prefix
+func impliedIndex(s string) string {
+	arcs := make([]string, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		arcs = append(arcs, fmt.Sprint(s[i]))
+	}
+	return strings.Join(arcs, ".")
+}
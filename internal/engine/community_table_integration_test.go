@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestCommunityTableServesMappingsAndRoutesByContext(t *testing.T) {
+	dir := t.TempDir()
+	testOID := "1.3.6.1.4.1.55555.1.0"
+	datasetA := filepath.Join(dir, "dataset-a.snmprec")
+	datasetB := filepath.Join(dir, "dataset-b.snmprec")
+	if err := os.WriteFile(datasetA, []byte(testOID+"|octetstring|Dataset-A\n"), 0o644); err != nil {
+		t.Fatalf("write dataset A: %v", err)
+	}
+	if err := os.WriteFile(datasetB, []byte(testOID+"|octetstring|Dataset-B\n"), 0o644); err != nil {
+		t.Fatalf("write dataset B: %v", err)
+	}
+	routeFile := filepath.Join(dir, "routes.yaml")
+	routes := fmt.Sprintf(`communities:
+  - community: blue
+    context: ctxBlue
+    contextEngineID: "80001f8804"
+  - index: red-row
+    community: red
+    securityName: redUser
+    context: ctxRed
+routes:
+  - match:
+      context: ctxBlue
+    action:
+      datasetPath: %s
+`, datasetB)
+	if err := os.WriteFile(routeFile, []byte(routes), 0o644); err != nil {
+		t.Fatalf("write route file: %v", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, datasetA, routeFile, "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	client := func(community string) *gosnmp.GoSNMP {
+		t.Helper()
+		c := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: community, Timeout: time.Second}
+		if err := c.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(func() { c.Conn.Close() })
+		return c
+	}
+
+	got := map[string]interface{}{}
+	err = client("public").Walk("1.3.6.1.6.3.18.1.1", func(pdu gosnmp.SnmpPDU) error {
+		value := pdu.Value
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		got[pdu.Name] = value
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk snmpCommunityTable: %v", err)
+	}
+	blue := ".98.108.117.101"            // IMPLIED index "blue"
+	red := ".114.101.100.45.114.111.119" // IMPLIED index "red-row"
+	want := map[string]interface{}{
+		".1.3.6.1.6.3.18.1.1.1.2" + blue: "blue",
+		".1.3.6.1.6.3.18.1.1.1.3" + blue: "blue",
+		".1.3.6.1.6.3.18.1.1.1.4" + blue: "\x80\x00\x1f\x88\x04",
+		".1.3.6.1.6.3.18.1.1.1.5" + blue: "ctxBlue",
+		".1.3.6.1.6.3.18.1.1.1.2" + red:  "red",
+		".1.3.6.1.6.3.18.1.1.1.3" + red:  "redUser",
+		".1.3.6.1.6.3.18.1.1.1.5" + red:  "ctxRed",
+		".1.3.6.1.6.3.18.1.1.1.8" + red:  1,
+	}
+	for oid, value := range want {
+		if fmt.Sprint(got[oid]) != fmt.Sprint(value) {
+			t.Errorf("%s = %q, want %q", oid, got[oid], value)
+		}
+	}
+	if len(got) != 14 {
+		t.Errorf("walk returned %d varbinds, want 14 (7 columns x 2 rows): %v", len(got), got)
+	}
+
+	for community, wantValue := range map[string]string{"public": "Dataset-A", "blue": "Dataset-B", "red": "Dataset-A"} {
+		pkt, err := client(community).Get([]string{testOID})
+		if err != nil {
+			t.Fatalf("get with community %s: %v", community, err)
+		}
+		if value, _ := pkt.Variables[0].Value.([]byte); string(value) != wantValue {
+			t.Errorf("community %s served %q, want %q", community, value, wantValue)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestWalkedCounterWrapsAt2To32(t *testing.T) {
+	dir := t.TempDir()
+	snmprec := filepath.Join(dir, "switch.snmprec")
+	content := `1.3.6.1.2.1.2.2.1.10.1|counter32|4294967000
+1.3.6.1.2.1.31.1.1.1.6.1|counter64|18446744073709551000
+`
+	if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+	variations := filepath.Join(dir, "variations.yaml")
+	yaml := `bindings:
+  - prefix: "1.3.6.1.2.1.2.2.1.10"
+    variations:
+      - type: counterWrap
+        delta: 100
+  - prefix: "1.3.6.1.2.1.31.1.1.1.6"
+    variations:
+      - type: counter64Wrap
+        delta: 100
+`
+	if err := os.WriteFile(variations, []byte(yaml), 0o644); err != nil {
+		t.Fatalf("write variations: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", variations, v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Retries:   1,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+
+	// Each walk reads each counter once: ifInOctets.1 crosses 2^32 on the
+	// third walk, ifHCInOctets.1 crosses 2^64 on the seventh
+	want32 := []uint64{4294967100, 4294967200, 4, 104, 204, 304, 404, 504}
+	want64 := []uint64{18446744073709551100, 18446744073709551200, 18446744073709551300, 18446744073709551400, 18446744073709551500, 18446744073709551600, 84, 184}
+	for i := range want32 {
+		in, err := client.WalkAll("1.3.6.1.2.1.2.2.1.10")
+		if err != nil || len(in) != 1 {
+			t.Fatalf("walk %d of ifInOctets: %v (%d values)", i, err, len(in))
+		}
+		if in[0].Type != gosnmp.Counter32 || gosnmp.ToBigInt(in[0].Value).Uint64() != want32[i] {
+			t.Fatalf("walk %d ifInOctets.1 = %v %v, want Counter32 %d", i, in[0].Type, in[0].Value, want32[i])
+		}
+		hc, err := client.WalkAll("1.3.6.1.2.1.31.1.1.1.6")
+		if err != nil || len(hc) != 1 {
+			t.Fatalf("walk %d of ifHCInOctets: %v (%d values)", i, err, len(hc))
+		}
+		if hc[0].Type != gosnmp.Counter64 || gosnmp.ToBigInt(hc[0].Value).Uint64() != want64[i] {
+			t.Fatalf("walk %d ifHCInOctets.1 = %v %v, want Counter64 %d", i, hc[0].Type, hc[0].Value, want64[i])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestDeviceMappedDatasetServesPerAgentValues(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "rack.snmprec")
+	content := `1.3.6.1.4.1.55555.2.1.0|octetstring|alpha@Device-0
+1.3.6.1.4.1.55555.2.1.0|octetstring|beta@Device-1
+1.3.6.1.4.1.55555.2.2.0|octetstring|shared
+`
+	if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+2, 2, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+
+	time.Sleep(600 * time.Millisecond)
+
+	for i, want := range []string{"alpha", "beta"} {
+		client := &gosnmp.GoSNMP{
+			Target:    "127.0.0.1",
+			Port:      uint16(port + i),
+			Version:   gosnmp.Version2c,
+			Community: "public",
+			Timeout:   time.Second,
+			Retries:   1,
+		}
+		if err := client.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+
+		pkt, err := client.Get([]string{"1.3.6.1.4.1.55555.2.1.0", "1.3.6.1.4.1.55555.2.2.0"})
+		if err != nil {
+			client.Conn.Close()
+			t.Fatalf("Device-%d get: %v", i, err)
+		}
+		if got := string(pkt.Variables[0].Value.([]byte)); got != want {
+			t.Fatalf("Device-%d mapped value = %q, want %q", i, got, want)
+		}
+		if got := string(pkt.Variables[1].Value.([]byte)); got != "shared" {
+			t.Fatalf("Device-%d default value = %q, want %q", i, got, "shared")
+		}
+
+		pkt, err = client.GetNext([]string{"1.3.6.1.4.1.55555.2"})
+		client.Conn.Close()
+		if err != nil {
+			t.Fatalf("Device-%d getnext: %v", i, err)
+		}
+		if got := string(pkt.Variables[0].Value.([]byte)); got != want {
+			t.Fatalf("Device-%d walked value = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"net"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -69,6 +70,74 @@ func TestWalkViaIPv6Loopback(t *testing.T) {
 	}
 }
 
+func TestDualStackAnswersV4MappedRequests(t *testing.T) {
+	if _, err := net.ListenPacket("udp6", "[::1]:0"); err != nil {
+		t.Skipf("ipv6 unavailable: %v", err)
+	}
+	port, err := freeUDPPort6()
+	if err != nil {
+		t.Fatalf("free ipv6 port: %v", err)
+	}
+	snmprec := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(snmprec, []byte("1.3.6.1.2.1.1.1.0|octetstring|dual-stack router\n"), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	sim.SetListenAddr6("::")
+	sim.SetDualStack(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startErr := make(chan error, 1)
+	go func() { startErr <- sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+	select {
+	case err := <-startErr:
+		if err != nil {
+			t.Skipf("dual-stack bind unavailable: %v", err)
+		}
+	default:
+	}
+
+	for _, target := range []string{"127.0.0.1", "::1"} {
+		client := &gosnmp.GoSNMP{
+			Target:    target,
+			Port:      uint16(port),
+			Version:   gosnmp.Version2c,
+			Community: "public",
+			Timeout:   2 * time.Second,
+		}
+		if err := client.Connect(); err != nil {
+			t.Fatalf("connect %s: %v", target, err)
+		}
+		pkt, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"})
+		client.Conn.Close()
+		if err != nil {
+			if target == "127.0.0.1" {
+				t.Skipf("v4-mapped delivery unavailable (IPv6 sockets may be v6-only by policy): %v", err)
+			}
+			t.Fatalf("get via %s: %v", target, err)
+		}
+		if got := string(pkt.Variables[0].Value.([]byte)); got != "dual-stack router" {
+			t.Fatalf("sysDescr via %s = %q", target, got)
+		}
+	}
+
+	sim.mu.RLock()
+	listeners := len(sim.listeners)
+	sim.mu.RUnlock()
+	if listeners != 1 {
+		t.Fatalf("listeners = %d, want one shared socket", listeners)
+	}
+}
+
 func freeUDPPort6() (int, error) {
 	addr, err := net.ResolveUDPAddr("udp6", "[::1]:0")
 	if err != nil {
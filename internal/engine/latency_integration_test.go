@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestBaseLatencyDelaysResponsesWithoutSerializing(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "latency.snmprec")
+	if err := os.WriteFile(snmprec, []byte("1.3.6.1.4.1.55555.14.1.0|integer|1\n"), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	const floor = 250 * time.Millisecond
+	if err := sim.SetBaseLatency([]PortLatency{{Start: port, End: port, Latency: floor}}); err != nil {
+		t.Fatalf("set base latency: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+
+	time.Sleep(600 * time.Millisecond)
+
+	const clients = 6
+	start := time.Now()
+	elapsed := make([]time.Duration, clients)
+	errs := make([]error, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client := &gosnmp.GoSNMP{
+				Target:    "127.0.0.1",
+				Port:      uint16(port),
+				Version:   gosnmp.Version2c,
+				Community: "public",
+				Timeout:   2 * time.Second,
+				Retries:   0,
+			}
+			if err := client.Connect(); err != nil {
+				errs[i] = err
+				return
+			}
+			defer client.Conn.Close()
+			sent := time.Now()
+			_, errs[i] = client.Get([]string{"1.3.6.1.4.1.55555.14.1.0"})
+			elapsed[i] = time.Since(sent)
+		}(i)
+	}
+	wg.Wait()
+	total := time.Since(start)
+
+	for i := 0; i < clients; i++ {
+		if errs[i] != nil {
+			t.Fatalf("client %d: %v", i, errs[i])
+		}
+		if elapsed[i] < floor {
+			t.Fatalf("client %d got a response after %s, want at least %s", i, elapsed[i], floor)
+		}
+	}
+	// Serialized writes would take clients*floor
+	if total >= 3*floor {
+		t.Fatalf("%d concurrent requests took %s, want well under %s", clients, total, clients*floor)
+	}
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestNoResponseOIDDropsGetRequest(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "blackhole.snmprec")
+	content := `1.3.6.1.4.1.55555.1.1.0|octetstring|answers
+1.3.6.1.4.1.55555.1.2.0|noresponse|
+`
+	if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		Timeout:   500 * time.Millisecond,
+		Retries:   0,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+
+	pkt, err := client.Get([]string{"1.3.6.1.4.1.55555.1.1.0"})
+	if err != nil {
+		t.Fatalf("get regular OID: %v", err)
+	}
+	if len(pkt.Variables) != 1 || string(pkt.Variables[0].Value.([]byte)) != "answers" {
+		t.Fatalf("unexpected regular OID response: %+v", pkt.Variables)
+	}
+
+	if _, err := client.Get([]string{"1.3.6.1.4.1.55555.1.1.0", "1.3.6.1.4.1.55555.1.2.0"}); err == nil {
+		t.Fatal("expected GET including a noresponse OID to time out")
+	}
+	if _, err := client.GetNext([]string{"1.3.6.1.4.1.55555.1.1.0"}); err == nil {
+		t.Fatal("expected GETNEXT landing on a noresponse OID to time out")
+	}
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestExcludeOIDFilterDropsSubtree(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "filtered.snmprec")
+	content := `1.3.6.1.4.1.55555.10.1.0|octetstring|kept
+1.3.6.1.4.1.55555.11.1.0|octetstring|dropped
+1.3.6.1.4.1.55555.11.2.0|integer|7
+1.3.6.1.4.1.55555.110.1.0|octetstring|sibling
+`
+	if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	filter, err := store.NewOIDFilter(nil, []string{"1.3.6.1.4.1.55555.11"})
+	if err != nil {
+		t.Fatalf("new filter: %v", err)
+	}
+	if err := sim.SetOIDFilter(filter); err != nil {
+		t.Fatalf("set filter: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Retries:   0,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+
+	pkt, err := client.Get([]string{"1.3.6.1.4.1.55555.10.1.0", "1.3.6.1.4.1.55555.11.1.0"})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(pkt.Variables) != 2 {
+		t.Fatalf("expected 2 varbinds, got %+v", pkt.Variables)
+	}
+	if pkt.Variables[0].Type != gosnmp.OctetString || string(pkt.Variables[0].Value.([]byte)) != "kept" {
+		t.Fatalf("unexpected kept OID response: %+v", pkt.Variables[0])
+	}
+	if pkt.Variables[1].Type != gosnmp.NoSuchObject {
+		t.Fatalf("expected noSuchObject for excluded OID, got %+v", pkt.Variables[1])
+	}
+
+	next, err := client.GetNext([]string{"1.3.6.1.4.1.55555.10.1.0"})
+	if err != nil {
+		t.Fatalf("getnext: %v", err)
+	}
+	if len(next.Variables) != 1 || next.Variables[0].Name != ".1.3.6.1.4.1.55555.110.1.0" {
+		t.Fatalf("expected GETNEXT to skip the excluded subtree, got %+v", next.Variables)
+	}
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// oidMetrics counts the OIDs the agents look up, labelled by OID prefix so
+// a walk of a large table adds one series rather than one per row
+type oidMetrics struct {
+	depth    int
+	queries  *prometheus.CounterVec
+	registry *prometheus.Registry
+}
+
+func newOIDMetrics(depth int) *oidMetrics {
+	m := &oidMetrics{
+		depth: depth,
+		queries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "snmpsim_oid_queries_total",
+				Help: "OID lookups by GET, GETNEXT, GETBULK and SET requests, by OID prefix",
+			},
+			[]string{"prefix"},
+		),
+		registry: prometheus.NewRegistry(),
+	}
+	m.registry.MustRegister(m.queries)
+	return m
+}
+
+func (m *oidMetrics) observe(oid string) {
+	m.queries.WithLabelValues(OIDPrefix(oid, m.depth)).Inc()
+}
+
+// OIDPrefix returns the first depth arcs of oid, without a leading dot. An
+// OID with depth arcs or fewer is returned whole.
+func OIDPrefix(oid string, depth int) string {
+	oid = strings.TrimPrefix(oid, ".")
+	end := 0
+	for arcs := 0; arcs < depth; arcs++ {
+		next := strings.IndexByte(oid[end:], '.')
+		if next < 0 {
+			return oid
+		}
+		end += next + 1
+	}
+	return oid[:end-1]
+}
+
+// EnableOIDMetrics counts the OIDs every agent looks up in
+// snmpsim_oid_queries_total, labelled by their first depth arcs. Counting is
+// off until this is called; it adds a counter update to every lookup.
+func (s *Simulator) EnableOIDMetrics(depth int) error {
+	if depth < 1 {
+		return fmt.Errorf("OID metrics prefix depth must be positive")
+	}
+	m := newOIDMetrics(depth)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.oidMetrics = m
+	for _, vAgent := range s.agents {
+		vAgent.SetOIDQueryHook(m.observe)
+	}
+	return nil
+}
+
+// OIDMetrics returns the gatherer of the per-OID counters, or nil when
+// EnableOIDMetrics was not called
+func (s *Simulator) OIDMetrics() prometheus.Gatherer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.oidMetrics == nil {
+		return nil
+	}
+	return s.oidMetrics.registry
+}
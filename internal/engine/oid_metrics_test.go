@@ -0,0 +1,22 @@
+package engine
+
+import "testing"
+
+func TestOIDPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		oid   string
+		depth int
+		want  string
+	}{
+		{"1.3.6.1.2.1.2.2.1.10.3", 8, "1.3.6.1.2.1.2.2"},
+		{".1.3.6.1.2.1.2.2.1.10.3", 8, "1.3.6.1.2.1.2.2"},
+		{"1.3.6.1.2.1.2.2", 8, "1.3.6.1.2.1.2.2"},
+		{"1.3.6.1.2.1.1.1.0", 7, "1.3.6.1.2.1.1"},
+		{"1.3.6", 8, "1.3.6"},
+		{"1.3.6.1", 1, "1"},
+	} {
+		if got := OIDPrefix(tt.oid, tt.depth); got != tt.want {
+			t.Errorf("OIDPrefix(%q, %d) = %q, want %q", tt.oid, tt.depth, got, tt.want)
+		}
+	}
+}
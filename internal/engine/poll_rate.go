@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultPollRateInterval is how often the poll rate is sampled
+const DefaultPollRateInterval = time.Second
+
+// pollRateWindow is the EWMA time constant in sample intervals: a burst
+// decays to 1/e of its rate after this many idle samples
+const pollRateWindow = 5
+
+// pollRate is an exponentially weighted moving average of polls per second,
+// fed with the simulator's cumulative poll count
+type pollRate struct {
+	mu        sync.Mutex
+	lastTotal int64
+	lastAt    time.Time
+	rate      float64
+}
+
+// sample folds the polls since the previous sample into the average. A
+// total that went backwards, after ResetStatistics, restarts the baseline.
+func (p *pollRate) sample(total int64, now time.Time, interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lastAt.IsZero() || total < p.lastTotal {
+		p.lastTotal, p.lastAt = total, now
+		return
+	}
+	elapsed := now.Sub(p.lastAt)
+	if elapsed <= 0 {
+		return
+	}
+	instant := float64(total-p.lastTotal) / elapsed.Seconds()
+	alpha := 1 - math.Exp(-float64(elapsed)/float64(pollRateWindow*interval))
+	p.rate += alpha * (instant - p.rate)
+	p.lastTotal, p.lastAt = total, now
+}
+
+// reset forgets the history, so a restarted simulator starts from zero
+func (p *pollRate) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastTotal, p.lastAt, p.rate = 0, time.Time{}, 0
+}
+
+func (p *pollRate) perSecond() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rate
+}
+
+// samplePollRate feeds the poll rate every rateInterval until ctx is done
+// or stopped is closed
+func (s *Simulator) samplePollRate(ctx context.Context, stopped <-chan struct{}) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.rateInterval)
+	defer ticker.Stop()
+	s.pollRate.sample(s.totalPolls(), time.Now(), s.rateInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopped:
+			return
+		case now := <-ticker.C:
+			s.pollRate.sample(s.totalPolls(), now, s.rateInterval)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestPollRateRisesWithBurstAndDecaysWhenIdle(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "rate.snmprec")
+	if err := os.WriteFile(snmprec, []byte("1.3.6.1.2.1.1.1.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	const interval = 50 * time.Millisecond
+	sim.rateInterval = interval
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	rate := func() float64 {
+		return sim.Statistics()["polls_per_second"].(float64)
+	}
+	if got := rate(); got != 0 {
+		t.Fatalf("rate before any poll = %v, want 0", got)
+	}
+
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	for burst := time.Now(); time.Since(burst) < 10*interval; {
+		if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+			t.Fatalf("get: %v", err)
+		}
+	}
+	time.Sleep(2 * interval)
+	peak := rate()
+	if peak <= 0 {
+		t.Fatalf("rate after burst = %v, want > 0", peak)
+	}
+
+	time.Sleep(30 * interval)
+	if idle := rate(); idle >= peak/10 {
+		t.Fatalf("rate after idling = %v, want well below the burst's %v", idle, peak)
+	}
+}
+
+func TestStopDoesNotWaitForPollRateSample(t *testing.T) {
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	sim.rateInterval = time.Minute
+	if err := sim.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	started := time.Now()
+	sim.Stop()
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Fatalf("Stop took %v, want it to end the sampler without waiting for a tick", elapsed)
+	}
+}
@@ -0,0 +1,21 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollRateRestartsBaselineAfterReset(t *testing.T) {
+	var p pollRate
+	start := time.Unix(0, 0)
+	p.sample(0, start, time.Second)
+	p.sample(100, start.Add(time.Second), time.Second)
+	if p.perSecond() <= 0 {
+		t.Fatalf("rate = %v, want > 0", p.perSecond())
+	}
+	before := p.perSecond()
+	p.sample(0, start.Add(2*time.Second), time.Second)
+	if p.perSecond() != before {
+		t.Fatalf("rate after counter reset = %v, want unchanged %v", p.perSecond(), before)
+	}
+}
@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	slowOID = "1.3.6.1.4.1.55555.71.1.0" // held by a timeout variation, never answered
+	fastOID = "1.3.6.1.4.1.55555.72.1.0"
+)
+
+// startSlowPortSimulator serves one port whose slowOID blocks its reader
+// for delay before being dropped
+func startSlowPortSimulator(tb testing.TB, workers int, delay time.Duration) int {
+	tb.Helper()
+	dir := tb.TempDir()
+	snmprec := filepath.Join(dir, "slow.snmprec")
+	if err := os.WriteFile(snmprec, []byte(slowOID+"|integer|1\n"+fastOID+"|integer|2\n"), 0o644); err != nil {
+		tb.Fatalf("write snmprec: %v", err)
+	}
+	variations := filepath.Join(dir, "variations.yaml")
+	spec := fmt.Sprintf("bindings:\n  - prefix: %s\n    variations:\n      - type: timeout\n        delay: %s\n", slowOID, delay)
+	if err := os.WriteFile(variations, []byte(spec), 0o644); err != nil {
+		tb.Fatalf("write variations: %v", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		tb.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", variations, v3.Config{Enabled: false})
+	if err != nil {
+		tb.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetReadWorkers(workers); err != nil {
+		tb.Fatalf("set read workers: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = sim.Start(ctx) }()
+	tb.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+	return port
+}
+
+func snmpClient(tb testing.TB, port int, timeout time.Duration) *gosnmp.GoSNMP {
+	tb.Helper()
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: timeout}
+	if err := client.Connect(); err != nil {
+		tb.Fatalf("connect: %v", err)
+	}
+	tb.Cleanup(func() { client.Conn.Close() })
+	return client
+}
+
+// keepPortBusy sends slow requests back to back until stop is closed
+func keepPortBusy(tb testing.TB, port int, delay time.Duration, stop <-chan struct{}) {
+	client := snmpClient(tb, port, 2*delay)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, _ = client.Get([]string{slowOID})
+		}
+	}()
+}
+
+func TestReadWorkersAnswerWhileAnotherRequestBlocks(t *testing.T) {
+	const delay = 500 * time.Millisecond
+	port := startSlowPortSimulator(t, 2, delay)
+
+	slow := snmpClient(t, port, 2*delay)
+	go func() { _, _ = slow.Get([]string{slowOID}) }()
+	time.Sleep(50 * time.Millisecond) // let the slow request occupy a worker
+
+	start := time.Now()
+	result, err := snmpClient(t, port, 2*delay).Get([]string{fastOID})
+	if err != nil {
+		t.Fatalf("get %s: %v", fastOID, err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay/2 {
+		t.Fatalf("fast GET took %s behind a %s slow request, want it answered by the idle worker", elapsed, delay)
+	}
+	if len(result.Variables) != 1 || result.Variables[0].Value != 2 {
+		t.Fatalf("fast GET = %v, want 2", result.Variables)
+	}
+}
+
+// BenchmarkPortThroughputWithSlowRequests measures GETs on one port while
+// two other clients keep it busy with requests a timeout variation holds for
+// 5ms each. With one reader nearly every GET queues behind them.
+func BenchmarkPortThroughputWithSlowRequests(b *testing.B) {
+	const delay = 5 * time.Millisecond
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			port := startSlowPortSimulator(b, workers, delay)
+			stop := make(chan struct{})
+			defer close(stop)
+			keepPortBusy(b, port, delay, stop)
+			keepPortBusy(b, port, delay, stop)
+			client := snmpClient(b, port, time.Second)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.Get([]string{fastOID}); err != nil {
+					b.Fatalf("get: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+// syncBuffer is a bytes.Buffer safe to log into from the simulator's
+// goroutines while the test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReloadDatasetServesEditedFile(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "device.snmprec")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+			t.Fatalf("write snmprec: %v", err)
+		}
+	}
+	write("1.3.6.1.4.1.55555.30.1.0|integer|1\n1.3.6.1.4.1.55555.30.2.0|octetstring|same\n")
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	var logs syncBuffer
+	sim.SetLogger(log.New(&logs, "", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second, Retries: 1}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	get := func(oid string) gosnmp.SnmpPDU {
+		t.Helper()
+		pkt, err := client.Get([]string{oid})
+		if err != nil {
+			t.Fatalf("get %s: %v", oid, err)
+		}
+		return pkt.Variables[0]
+	}
+	if got := get("1.3.6.1.4.1.55555.30.1.0"); gosnmp.ToBigInt(got.Value).Int64() != 1 {
+		t.Fatalf("before reload = %v", got.Value)
+	}
+
+	// one value changes and one OID is added
+	write("1.3.6.1.4.1.55555.30.1.0|integer|2\n1.3.6.1.4.1.55555.30.2.0|octetstring|same\n1.3.6.1.4.1.55555.30.3.0|integer|3\n")
+	if err := sim.ReloadDataset(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := get("1.3.6.1.4.1.55555.30.1.0"); gosnmp.ToBigInt(got.Value).Int64() != 2 {
+		t.Fatalf("after reload = %v, want 2", got.Value)
+	}
+	if got := get("1.3.6.1.4.1.55555.30.3.0"); got.Type != gosnmp.Integer {
+		t.Fatalf("added OID after reload = %v %v", got.Type, got.Value)
+	}
+	if !strings.Contains(logs.String(), "2 OIDs changed") {
+		t.Fatalf("reload log does not count 2 changed OIDs:\n%s", logs.String())
+	}
+
+	// a reload that fails keeps the previous dataset in service
+	if err := os.Remove(snmprec); err != nil {
+		t.Fatalf("remove snmprec: %v", err)
+	}
+	if err := sim.ReloadDataset(); err == nil {
+		t.Fatal("reload of a missing file succeeded")
+	}
+	if got := get("1.3.6.1.4.1.55555.30.1.0"); gosnmp.ToBigInt(got.Value).Int64() != 2 {
+		t.Fatalf("after failed reload = %v, want 2", got.Value)
+	}
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+)
+
+// replayCheckInterval bounds how long the replay goroutine sleeps, so Stop
+// does not wait for a long gap between captures
+const replayCheckInterval = time.Second
+
+// SetReplay serves the captures of series in turn instead of a fixed
+// dataset: the first one right away, and each later one once its offset,
+// divided by speed, has passed since Start. With loop the series starts over
+// after the last capture; otherwise the last one stays. Like SetOIDFilter it
+// must be called before Start.
+func (s *Simulator) SetReplay(series *store.ReplaySeries, speed float64, loop bool) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot set up replay on a running simulator")
+	}
+	if series == nil || len(series.Snapshots) == 0 {
+		return fmt.Errorf("replay series has no captures")
+	}
+	if speed <= 0 {
+		return fmt.Errorf("invalid replay speed %v (want > 0)", speed)
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loaded, err := s.loadDataset(series.Snapshots[0].Path, s.datasetSettingsLocked())
+	if err != nil {
+		return fmt.Errorf("replay capture %s: %w", series.Snapshots[0].Path, err)
+	}
+	s.swapDatasetLocked(loaded)
+	s.replay = series
+	s.replaySpeed = speed
+	s.replayLoop = loop
+	return nil
+}
+
+// runReplay advances the agents through the replay series until ctx ends or
+// the simulator stops
+func (s *Simulator) runReplay(ctx context.Context, stopped <-chan struct{}) {
+	defer s.wg.Done()
+	series, speed, loop := s.replay, s.replaySpeed, s.replayLoop
+	started := time.Now()
+	current := -1 // a restart begins again at the first capture
+	for {
+		elapsed := time.Duration(float64(time.Since(started)) * speed)
+		if i := series.At(elapsed, loop); i != current {
+			current = i
+			path := series.Snapshots[i].Path
+			err := s.replayCapture(path)
+			if err != nil {
+				s.logf("Replay: capture %s not served: %v", path, err)
+			} else {
+				s.logf("Replay: serving capture %d/%d %q", i+1, len(series.Snapshots), path)
+			}
+		}
+
+		wait, ok := series.Next(elapsed, loop)
+		if !ok {
+			return
+		}
+		delay := time.Duration(float64(wait)/speed) + time.Millisecond
+		if delay > replayCheckInterval {
+			delay = replayCheckInterval
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-stopped:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// replayCapture serves the capture at path, loading it before s.mu is taken
+// for the swap
+func (s *Simulator) replayCapture(path string) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.mu.RLock()
+	settings := s.datasetSettingsLocked()
+	s.mu.RUnlock()
+	loaded, err := s.loadDataset(path, settings)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.swapDatasetLocked(loaded)
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestReplayServesCapturesInSequence(t *testing.T) {
+	dir := t.TempDir()
+	captures := map[string]string{
+		"router-20240101T120000.snmprec": "1.3.6.1.2.1.2.2.1.10.1|counter32|100\n",
+		"router-20240101T120100.snmprec": "1.3.6.1.2.1.2.2.1.10.1|counter32|200\n",
+	}
+	for name, content := range captures {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write capture: %v", err)
+		}
+	}
+	series, err := store.LoadReplaySeries(dir, 0)
+	if err != nil {
+		t.Fatalf("load series: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, series.Snapshots[0].Path, "", "", v3.Config{})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	// the captures are a minute apart; at 120x the second is due after 500ms
+	if err := sim.SetReplay(series, 120, false); err != nil {
+		t.Fatalf("set replay: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := sim.Start(ctx); err != nil {
+		cancel()
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	ifInOctets := func() uint64 {
+		t.Helper()
+		pkt, err := client.Get([]string{"1.3.6.1.2.1.2.2.1.10.1"})
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		return gosnmp.ToBigInt(pkt.Variables[0].Value).Uint64()
+	}
+
+	started := time.Now()
+	if got := ifInOctets(); got != 100 {
+		t.Fatalf("ifInOctets at start = %d, want the first capture's 100", got)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for ifInOctets() != 200 {
+		if time.Now().After(deadline) {
+			t.Fatal("ifInOctets never reached the second capture's 200")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if elapsed := time.Since(started); elapsed < 400*time.Millisecond {
+		t.Fatalf("second capture served after %s, want about 500ms", elapsed)
+	}
+}
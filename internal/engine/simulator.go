@@ -2,9 +2,15 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"net"
+	"os"
+	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -16,6 +22,7 @@ import (
 	"github.com/debashish-mukherjee/go-snmpsim/internal/traps"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
 	"github.com/debashish-mukherjee/go-snmpsim/internal/variation"
+	"github.com/gosnmp/gosnmp"
 	"golang.org/x/sys/unix"
 )
 
@@ -23,6 +30,7 @@ import (
 type Simulator struct {
 	listenAddr    string
 	listenAddr6   string
+	dualStack     bool // one IPv6 socket with IPV6_V6ONLY off serves IPv4 too
 	portStart     int
 	portEnd       int
 	numDevices    int
@@ -33,26 +41,70 @@ type Simulator struct {
 	v3State       *v3.EngineStateStore
 	router        *routing.Router
 	datasetStore  *store.DatasetStore
+	loadOpts      store.LoadOptions
+	oidFilter     store.OIDFilter
+	deviceMapping *store.DeviceOIDMapping
+	datasetHash   string // store.OIDDatabase.Hash of the default dataset
 	variations    *variation.Binder
 	trapManager   *traps.Manager
+	logger        *log.Logger // nil logs to the standard logger
+	bindAttempts  int
+	bindBackoff   time.Duration
+	readWorkers   int                   // goroutines reading and answering each socket
+	transport     string                // TransportUDP, TransportTCP or TransportBoth
+	baseLatency   map[int]time.Duration // port -> delay added to every response
+	oidMetrics    *oidMetrics           // per-OID query counters; nil when off
 
 	// Listeners and dispatcher
 	listeners    map[string]*net.UDPConn     // key -> listener
+	tcpListeners map[string]net.Listener     // key -> listener, with TCP transport
+	tcpConns     map[net.Conn]struct{}       // open TCP connections, closed by cleanup
+	tcpMu        sync.Mutex                  // guards tcpConns
 	agents       map[int]*agent.VirtualAgent // port -> agent
 	dispatcher   *PacketDispatcher
 	indexManager *store.OIDIndexManager // Index manager for Zabbix LLD
 
 	// Synchronization
-	mu      sync.RWMutex
-	wg      sync.WaitGroup
-	running atomic.Bool
+	mu       sync.RWMutex
+	reloadMu sync.Mutex // serializes dataset loads, which run outside mu
+	wg       sync.WaitGroup
+	running  atomic.Bool
+	stopped  chan struct{} // closed by cleanup to end the background loops of a run
 
 	// Performance
 	packetPool *sync.Pool
+
+	// Live load, sampled while running
+	pollRate     pollRate
+	rateInterval time.Duration
+
+	// Replay mode; nil replay serves the dataset as loaded
+	replay      *store.ReplaySeries
+	replaySpeed float64
+	replayLoop  bool
 }
 
+// DefaultMaxDevices is the default cap on devices per simulator: one agent
+// per UDP port, so a single address cannot serve more.
+const DefaultMaxDevices = 65535
+
+// MaxDevices caps numDevices in NewSimulator so an absurd count fails up
+// front instead of exhausting memory or file descriptors while starting.
+// Set it before creating simulators.
+var MaxDevices = DefaultMaxDevices
+
+// estimatedAgentBytes is a rough per-agent memory cost (agent, state,
+// overlay and dispatch entries), not counting the shared datasets
+const estimatedAgentBytes = 4 << 10
+
 // NewSimulator creates a new SNMP simulator instance
 func NewSimulator(listenAddr string, portStart, portEnd, numDevices int, snmprecFile string, routeFile string, variationFile string, v3Config v3.Config) (*Simulator, error) {
+	return NewSimulatorWithOptions(listenAddr, portStart, portEnd, numDevices, snmprecFile, routeFile, variationFile, v3Config, store.LoadOptions{})
+}
+
+// NewSimulatorWithOptions is NewSimulator with control over how datasets are
+// loaded, e.g. without the built-in default OIDs
+func NewSimulatorWithOptions(listenAddr string, portStart, portEnd, numDevices int, snmprecFile string, routeFile string, variationFile string, v3Config v3.Config, loadOpts store.LoadOptions) (*Simulator, error) {
 	if portStart >= portEnd {
 		return nil, fmt.Errorf("portStart must be less than portEnd")
 	}
@@ -60,6 +112,15 @@ func NewSimulator(listenAddr string, portStart, portEnd, numDevices int, snmprec
 	if numDevices <= 0 {
 		return nil, fmt.Errorf("numDevices must be positive")
 	}
+	if MaxDevices > 0 && numDevices > MaxDevices {
+		return nil, fmt.Errorf("numDevices (%d) exceeds the limit of %d devices per simulator", numDevices, MaxDevices)
+	}
+
+	// Each device gets its own port in [portStart, portEnd)
+	if numPorts := portEnd - portStart; numDevices > numPorts {
+		return nil, fmt.Errorf("numDevices (%d) exceeds the %d ports in %d-%d (port end is exclusive); raise portEnd to %d or lower numDevices",
+			numDevices, numPorts, portStart, portEnd, portStart+numDevices)
+	}
 
 	if v3Config.Enabled {
 		if err := v3Config.Validate(); err != nil {
@@ -67,6 +128,10 @@ func NewSimulator(listenAddr string, portStart, portEnd, numDevices int, snmprec
 		}
 	}
 
+	// One UDP socket per device; SetListenAddr6 doubles that
+	log.Printf("Simulator sizing: %d devices need about %d file descriptors and %d MiB for agents (plus datasets)",
+		numDevices, numDevices, (numDevices*estimatedAgentBytes+(1<<20)-1)>>20)
+
 	v3State, err := v3.NewEngineStateStore("")
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize v3 state: %w", err)
@@ -82,7 +147,15 @@ func NewSimulator(listenAddr string, portStart, portEnd, numDevices int, snmprec
 		variationFile: variationFile,
 		v3Config:      v3Config,
 		v3State:       v3State,
+		loadOpts:      loadOpts,
+		bindAttempts:  DefaultBindAttempts,
+		bindBackoff:   DefaultBindBackoff,
+		readWorkers:   DefaultReadWorkers,
+		transport:     TransportUDP,
+		rateInterval:  DefaultPollRateInterval,
 		listeners:     make(map[string]*net.UDPConn),
+		tcpListeners:  make(map[string]net.Listener),
+		tcpConns:      make(map[net.Conn]struct{}),
 		agents:        make(map[int]*agent.VirtualAgent),
 		packetPool: &sync.Pool{
 			New: func() interface{} {
@@ -114,10 +187,13 @@ func NewSimulator(listenAddr string, portStart, portEnd, numDevices int, snmprec
 		extraDatasetPaths = routeEngine.DatasetPaths()
 	}
 
-	datasetStore, err := store.NewDatasetStore(snmprecFile, extraDatasetPaths)
+	datasetStore, err := store.NewDatasetStore(snmprecFile, extraDatasetPaths, loadOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize dataset store: %w", err)
 	}
+	if err := datasetStore.InsertAll(communityTableEntries(routeEngine.Communities())); err != nil {
+		return nil, err
+	}
 	sim.router = routeEngine
 	sim.datasetStore = datasetStore
 
@@ -126,12 +202,23 @@ func NewSimulator(listenAddr string, portStart, portEnd, numDevices int, snmprec
 		return nil, fmt.Errorf("default dataset could not be resolved")
 	}
 
+	// Values routed to a port or device (VALUE@20000, VALUE@Device-1)
+	if snmprecFile != "" {
+		mapping, err := store.LoadDeviceMappings(snmprecFile)
+		if err != nil {
+			log.Printf("Warning: Could not load device mappings: %v", err)
+		} else if total, _, _, _ := mapping.GetStats(); total > 0 {
+			sim.deviceMapping = mapping
+		}
+	}
+
 	// Create index manager for Zabbix LLD support
 	indexManager := store.NewOIDIndexManager()
 	if err := indexManager.BuildIndex(oidDB); err != nil {
 		return nil, fmt.Errorf("failed to build OID index: %w", err)
 	}
 	sim.indexManager = indexManager
+	sim.datasetHash = oidDB.Hash()
 
 	// Create virtual agents
 	if err := sim.createVirtualAgents(oidDB); err != nil {
@@ -141,6 +228,160 @@ func NewSimulator(listenAddr string, portStart, portEnd, numDevices int, snmprec
 	return sim, nil
 }
 
+// Reload replaces the default dataset with snmprecFile (and reloads the
+// route datasets) on every agent without stopping the listeners. The files
+// are loaded before s.mu is taken, which is held only to swap the result in,
+// so requests keep being answered against the old dataset meanwhile; device
+// overlays are kept. The OID filter and load options given earlier still
+// apply.
+func (s *Simulator) Reload(snmprecFile string) error {
+	// A file that went away would otherwise swap in the built-in defaults
+	if snmprecFile != "" {
+		if _, err := os.Stat(snmprecFile); err != nil {
+			return fmt.Errorf("dataset %q: %w", snmprecFile, err)
+		}
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.RLock()
+	settings := s.datasetSettingsLocked()
+	s.mu.RUnlock()
+	loaded, err := s.loadDataset(snmprecFile, settings)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	oldDB, _ := s.datasetStore.Resolve("")
+	s.swapDatasetLocked(loaded)
+	s.mu.Unlock()
+
+	if s.running.Load() && settings.trapManager != nil && settings.trapManager.Config().OnStart {
+		s.mu.RLock()
+		for port, vAgent := range s.agents {
+			settings.trapManager.EnqueueWarmStartEvent(vAgent.DeviceID(), port)
+		}
+		s.mu.RUnlock()
+	}
+	s.logf("Reloaded dataset %q: %d OIDs changed", snmprecFile, changedOIDs(oldDB, loaded.oidDB))
+	return nil
+}
+
+// ReloadDataset re-reads the current dataset file and the route datasets
+// from disk, as Reload does, so edits are served without a restart
+func (s *Simulator) ReloadDataset() error {
+	s.mu.RLock()
+	snmprecFile := s.snmprecFile
+	s.mu.RUnlock()
+	return s.Reload(snmprecFile)
+}
+
+// datasetSettings are the simulator settings a dataset load depends on
+type datasetSettings struct {
+	router      *routing.Router
+	loadOpts    store.LoadOptions
+	oidFilter   store.OIDFilter
+	trapManager *traps.Manager
+}
+
+// datasetSettingsLocked copies the settings loadDataset needs. The caller
+// holds s.mu.
+func (s *Simulator) datasetSettingsLocked() datasetSettings {
+	return datasetSettings{router: s.router, loadOpts: s.loadOpts, oidFilter: s.oidFilter, trapManager: s.trapManager}
+}
+
+// loadedDataset is a dataset read from disk, ready to hand to the agents
+type loadedDataset struct {
+	snmprecFile   string
+	datasetStore  *store.DatasetStore
+	oidDB         *store.OIDDatabase
+	indexManager  *store.OIDIndexManager
+	deviceMapping *store.DeviceOIDMapping
+}
+
+// loadDataset loads snmprecFile and the route datasets of settings. It does
+// not touch s.mu, so a slow load does not hold up request handling.
+func (s *Simulator) loadDataset(snmprecFile string, settings datasetSettings) (*loadedDataset, error) {
+	extraDatasetPaths := []string{}
+	if settings.router != nil {
+		extraDatasetPaths = settings.router.DatasetPaths()
+	}
+	datasetStore, err := store.NewDatasetStore(snmprecFile, extraDatasetPaths, settings.loadOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize dataset store: %w", err)
+	}
+	if err := datasetStore.InsertAll(communityTableEntries(settings.router.Communities())); err != nil {
+		return nil, err
+	}
+	if err := s.insertTargetAddrTable(datasetStore, settings.trapManager); err != nil {
+		return nil, err
+	}
+	if _, err := datasetStore.ApplyFilter(settings.oidFilter); err != nil {
+		return nil, err
+	}
+	oidDB, _ := datasetStore.Resolve("")
+	if oidDB == nil {
+		return nil, fmt.Errorf("default dataset could not be resolved")
+	}
+	indexManager := store.NewOIDIndexManager()
+	if err := indexManager.BuildIndex(oidDB); err != nil {
+		return nil, fmt.Errorf("failed to build OID index: %w", err)
+	}
+
+	var deviceMapping *store.DeviceOIDMapping
+	if snmprecFile != "" {
+		mapping, err := store.LoadDeviceMappings(snmprecFile)
+		if err != nil {
+			s.logf("Warning: Could not load device mappings: %v", err)
+		} else if total, _, _, _ := mapping.GetStats(); total > 0 {
+			deviceMapping = mapping
+		}
+	}
+	return &loadedDataset{
+		snmprecFile:   snmprecFile,
+		datasetStore:  datasetStore,
+		oidDB:         oidDB,
+		indexManager:  indexManager,
+		deviceMapping: deviceMapping,
+	}, nil
+}
+
+// swapDatasetLocked hands a loaded dataset to every agent. The caller holds
+// s.mu.
+func (s *Simulator) swapDatasetLocked(l *loadedDataset) {
+	s.snmprecFile = l.snmprecFile
+	s.datasetStore = l.datasetStore
+	s.indexManager = l.indexManager
+	s.deviceMapping = l.deviceMapping
+	s.datasetHash = l.oidDB.Hash()
+	for _, vAgent := range s.agents {
+		vAgent.SetDataset(l.oidDB, l.indexManager)
+		vAgent.SetRouting(s.router, l.datasetStore)
+		vAgent.SetDeviceMapping(l.deviceMapping)
+	}
+}
+
+// changedOIDs counts the OIDs added, removed or given another value between
+// two datasets
+func changedOIDs(before, after *store.OIDDatabase) int {
+	if before == nil || after == nil {
+		return 0
+	}
+	old := before.GetAll()
+	changed := 0
+	after.Walk(func(oid string, value *store.OIDValue) bool {
+		prev, ok := old[oid]
+		if !ok || prev.Type != value.Type || !reflect.DeepEqual(prev.Value, value.Value) {
+			changed++
+		}
+		delete(old, oid)
+		return true
+	})
+	return changed + len(old)
+}
+
 // SetListenAddr6 configures optional IPv6 UDP listener address (e.g. :: or ::1).
 func (s *Simulator) SetListenAddr6(addr string) {
 	s.mu.Lock()
@@ -148,16 +389,380 @@ func (s *Simulator) SetListenAddr6(addr string) {
 	s.listenAddr6 = addr
 }
 
-// createVirtualAgents creates virtual agents mapped to ports
-func (s *Simulator) createVirtualAgents(oidDB *store.OIDDatabase) error {
-	numPorts := s.portEnd - s.portStart
+// SetDualStack chooses how the IPv6 listener set with SetListenAddr6 treats
+// IPv4. Off (the default), the IPv6 sockets set IPV6_V6ONLY and a separate
+// IPv4 socket serves the listen address. On, IPV6_V6ONLY is cleared so one
+// socket per port on the IPv6 address (normally ::) also answers IPv4, seen
+// as v4-mapped addresses, and no IPv4 socket is opened; this avoids bind
+// conflicts between :: and 0.0.0.0 on hosts where the two stacks overlap.
+func (s *Simulator) SetDualStack(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dualStack = enabled
+}
+
+// maxBootOffset is the largest uptime sysUpTime (TimeTicks, 1/100 s in a
+// uint32) can report, about 497 days.
+const maxBootOffset = time.Duration(math.MaxUint32) * 10 * time.Millisecond
+
+// SetBootOffsets spreads device boot times so sysUpTime differs per device.
+// Devices listed in perDevice (device ID -> uptime at start) use that value;
+// the rest get an offset in [min, max], fixed per device ID so restarts
+// reproduce the same uptimes. max == 0 leaves the rest booting at start.
+func (s *Simulator) SetBootOffsets(min, max time.Duration, perDevice map[int]time.Duration) error {
+	if min < 0 || max < 0 || min > max {
+		return fmt.Errorf("invalid boot offset range %s-%s", min, max)
+	}
+	if max > maxBootOffset {
+		return fmt.Errorf("boot offset %s exceeds the sysUpTime limit of %s", max, maxBootOffset)
+	}
+	for id, d := range perDevice {
+		if d < 0 || d > maxBootOffset {
+			return fmt.Errorf("boot offset %s for device %d must be between 0 and %s", d, id, maxBootOffset)
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, vAgent := range s.agents {
+		id := vAgent.DeviceID()
+		offset, ok := perDevice[id]
+		if !ok && max > 0 {
+			offset = min + time.Duration(rand.New(rand.NewSource(int64(id))).Int63n(int64(max-min)+1))
+		}
+		vAgent.SetBootOffset(offset)
+	}
+	return nil
+}
+
+// Defaults for retrying a listener bind that fails with EADDRINUSE
+const (
+	DefaultBindAttempts = 3
+	DefaultBindBackoff  = 200 * time.Millisecond
+)
+
+// SetBindRetry makes Start try binding each port up to attempts times when
+// the address is still in use, waiting backoff before the first retry and
+// doubling it after each one. Other bind errors fail immediately. Call it
+// before Start.
+func (s *Simulator) SetBindRetry(attempts int, backoff time.Duration) error {
+	if attempts <= 0 {
+		return fmt.Errorf("bind attempts must be positive")
+	}
+	if backoff < 0 {
+		return fmt.Errorf("bind backoff must not be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bindAttempts = attempts
+	s.bindBackoff = backoff
+	return nil
+}
+
+// PortLatency is a base response latency for the ports Start to End,
+// inclusive
+type PortLatency struct {
+	Start, End int
+	Latency    time.Duration
+}
+
+// DefaultReadWorkers is how many goroutines serve each socket by default
+const DefaultReadWorkers = 1
+
+// SetReadWorkers sets how many goroutines read and answer each socket. With
+// one, a request that blocks, such as one held by a timeout variation's
+// delay, holds up every packet queued behind it on that port; more workers
+// let other requests be answered meanwhile, at the cost of responses leaving
+// out of order. Call it before Start.
+func (s *Simulator) SetReadWorkers(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("read workers must be positive")
+	}
+	if s.running.Load() {
+		return fmt.Errorf("cannot change the read workers of a running simulator")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readWorkers = n
+	return nil
+}
+
+// SetBaseLatency delays every response by a fixed latency, on top of any
+// variation delay, to model the round trip to a remote device. Rules apply
+// in order, so a later rule overrides an earlier one for the ports both
+// cover. Responses are written from timers, so a delay never holds up the
+// listener. Call it before Start.
+func (s *Simulator) SetBaseLatency(rules []PortLatency) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot change the base latency of a running simulator")
+	}
+	for _, rule := range rules {
+		if rule.Latency < 0 {
+			return fmt.Errorf("base latency %s must not be negative", rule.Latency)
+		}
+		if rule.Start > rule.End {
+			return fmt.Errorf("base latency port range %d-%d is reversed", rule.Start, rule.End)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latency := make(map[int]time.Duration)
+	for port := range s.agents {
+		for _, rule := range rules {
+			if port >= rule.Start && port <= rule.End {
+				latency[port] = rule.Latency
+			}
+		}
+	}
+	s.baseLatency = latency
+	return nil
+}
+
+// HasAgent reports whether a virtual agent listens on port.
+func (s *Simulator) HasAgent(port int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.agents[port]
+	return ok
+}
+
+// SetLogger sends the simulator's own log lines (listener start, read and
+// write errors, shutdown) to logger. Call it before Start.
+func (s *Simulator) SetLogger(logger *log.Logger) {
+	s.logger = logger
+}
+
+func (s *Simulator) logf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// SetDebugOIDs enables the synthetic debug OIDs (agent.EchoOID) on every agent.
+func (s *Simulator) SetDebugOIDs(enabled bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, vAgent := range s.agents {
+		vAgent.SetDebugOIDs(enabled)
+	}
+}
+
+// SetMaxRepetitions caps GETBULK max-repetitions on every agent.
+func (s *Simulator) SetMaxRepetitions(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("max repetitions must be positive")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, vAgent := range s.agents {
+		vAgent.SetMaxRepetitions(n)
+	}
+	return nil
+}
+
+// SetMaxResponseSize caps the encoded size of GETBULK responses on every
+// agent.
+func (s *Simulator) SetMaxResponseSize(n int) error {
+	if n < agent.MinMaxResponseSize {
+		return fmt.Errorf("max response size must be at least %d bytes", agent.MinMaxResponseSize)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, vAgent := range s.agents {
+		vAgent.SetMaxResponseSize(n)
+	}
+	return nil
+}
+
+// SetSystemInfo makes every agent serve the non-empty fields of info for
+// sysDescr, sysObjectID and sysContact instead of the dataset values
+func (s *Simulator) SetSystemInfo(info agent.SystemInfo) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, vAgent := range s.agents {
+		if err := vAgent.SetSystemInfo(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetWritableOIDs lets SETs write the OIDs under prefixes on every agent
+func (s *Simulator) SetWritableOIDs(prefixes []string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, vAgent := range s.agents {
+		if err := vAgent.SetWritableOIDs(prefixes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetUnknownOIDSetError selects the error SETs on OIDs an agent does not
+// hold return on every agent: gosnmp.NoCreation or gosnmp.NotWritable
+func (s *Simulator) SetUnknownOIDSetError(status gosnmp.SNMPError) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, vAgent := range s.agents {
+		if err := vAgent.SetUnknownOIDSetError(status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetOIDFilter removes the OIDs f rejects from every loaded dataset, so walks
+// skip them, and makes every agent answer them with noSuchObject. Call it
+// before Start.
+func (s *Simulator) SetOIDFilter(f store.OIDFilter) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot change the OID filter of a running simulator")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed, err := s.datasetStore.ApplyFilter(f)
+	if err != nil {
+		return err
+	}
+	oidDB, _ := s.datasetStore.Resolve("")
+	indexManager := store.NewOIDIndexManager()
+	if err := indexManager.BuildIndex(oidDB); err != nil {
+		return fmt.Errorf("failed to build OID index: %w", err)
+	}
+	s.indexManager = indexManager
+	for _, vAgent := range s.agents {
+		vAgent.SetIndexManager(indexManager)
+		vAgent.SetOIDFilter(f)
+	}
+	s.oidFilter = f
+	s.datasetHash = oidDB.Hash()
+	s.logf("OID filter removed %d OIDs from the loaded datasets", removed)
+	return nil
+}
 
-	// Distribute devices across available ports
-	devicesPerPort := s.numDevices / numPorts
-	if devicesPerPort == 0 {
-		devicesPerPort = 1
+// SetRequestCapture keeps the last n request summaries on every agent;
+// n <= 0 turns capturing off.
+func (s *Simulator) SetRequestCapture(n int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, vAgent := range s.agents {
+		vAgent.SetRequestCapture(n)
 	}
+}
 
+// RecentRequests returns the requests captured by the agent on port, oldest
+// first. ok is false when no agent listens on port.
+func (s *Simulator) RecentRequests(port int) (requests []agent.RequestSummary, ok bool) {
+	s.mu.RLock()
+	vAgent, ok := s.agents[port]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return vAgent.RecentRequests(), true
+}
+
+// TriggerVariation forces a variation event on oid for the agent on port;
+// see agent.VirtualAgent.TriggerVariation. ok is false when no agent listens
+// on port.
+func (s *Simulator) TriggerVariation(port int, oid string) (pdu gosnmp.SnmpPDU, ok bool, err error) {
+	s.mu.RLock()
+	vAgent, ok := s.agents[port]
+	s.mu.RUnlock()
+	if !ok {
+		return gosnmp.SnmpPDU{}, false, nil
+	}
+	pdu, err = vAgent.TriggerVariation(oid)
+	return pdu, true, err
+}
+
+// RebootAgent simulates a reboot of the agent on port: its uptime restarts,
+// its v3 engine boots go up by one (persisted when SNMPv3 is enabled) and a
+// coldStart trap is sent. ok is false when no agent listens on port.
+func (s *Simulator) RebootAgent(port int) (boots uint32, ok bool, err error) {
+	s.mu.RLock()
+	vAgent, ok := s.agents[port]
+	s.mu.RUnlock()
+	if !ok {
+		return 0, false, nil
+	}
+	boots = vAgent.EngineBoots() + 1
+	if engineID := vAgent.EngineID(); engineID != "" {
+		if boots, err = s.v3State.EnsureBoots(engineID); err != nil {
+			return 0, true, fmt.Errorf("failed to persist v3 engine boots: %w", err)
+		}
+	}
+	vAgent.Reboot(boots)
+	s.logf("Device %d (port %d) rebooted, engine boots %d", vAgent.DeviceID(), port, boots)
+	s.trapManager.EnqueueColdStartEvent(vAgent.DeviceID(), port)
+	return boots, true, nil
+}
+
+// DisableAgent takes the agent on port offline: its listener keeps the port
+// bound but drops every request, as if the device stopped responding. ok is
+// false when no agent listens on port.
+func (s *Simulator) DisableAgent(port int) bool {
+	return s.setAgentEnabled(port, false)
+}
+
+// EnableAgent lets a disabled agent answer requests again
+func (s *Simulator) EnableAgent(port int) bool {
+	return s.setAgentEnabled(port, true)
+}
+
+func (s *Simulator) setAgentEnabled(port int, enabled bool) bool {
+	s.mu.RLock()
+	vAgent, ok := s.agents[port]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	if vAgent.Enabled() != enabled {
+		state := "disabled"
+		if enabled {
+			state = "enabled"
+		}
+		s.logf("Device %d (port %d) %s", vAgent.DeviceID(), port, state)
+	}
+	vAgent.SetEnabled(enabled)
+	return true
+}
+
+// ImportAgentOIDs adds snmprec lines to the default dataset of the agent on
+// port while it runs; see agent.VirtualAgent.ImportOIDs. The OIDs are lost
+// when the dataset is reloaded. ok is false when no agent listens on port.
+func (s *Simulator) ImportAgentOIDs(port int, data []byte) (count int, ok bool, err error) {
+	s.mu.RLock()
+	vAgent, ok := s.agents[port]
+	s.mu.RUnlock()
+	if !ok {
+		return 0, false, nil
+	}
+	count, err = vAgent.ImportOIDs(data)
+	if err == nil {
+		s.logf("Imported %d OIDs into device %d (port %d)", count, vAgent.DeviceID(), port)
+	}
+	return count, true, err
+}
+
+// DevicePort returns the port of the agent simulating deviceID
+func (s *Simulator) DevicePort(deviceID int) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for port, vAgent := range s.agents {
+		if vAgent.DeviceID() == deviceID {
+			return port, true
+		}
+	}
+	return 0, false
+}
+
+// createVirtualAgents creates virtual agents mapped to ports
+func (s *Simulator) createVirtualAgents(oidDB *store.OIDDatabase) error {
 	deviceID := 0
 	for port := s.portStart; port < s.portEnd && deviceID < s.numDevices; port++ {
 		cfg := s.v3Config
@@ -187,14 +792,12 @@ func (s *Simulator) createVirtualAgents(oidDB *store.OIDDatabase) error {
 			virtualAgent.SetIndexManager(s.indexManager)
 		}
 		virtualAgent.SetRouting(s.router, s.datasetStore)
+		if s.deviceMapping != nil {
+			virtualAgent.SetDeviceMapping(s.deviceMapping)
+		}
 		virtualAgent.SetVariationBinder(s.variations)
 		if s.trapManager != nil {
-			virtualAgent.SetVariationEventHook(func(ev agent.VariationEvent) {
-				s.trapManager.EnqueueVariationEvent(ev.DeviceID, ev.Port, ev.OID, ev.Detail)
-			})
-			virtualAgent.SetSetEventHook(func(ev agent.SetEvent) {
-				s.trapManager.EnqueueSetEvent(ev.DeviceID, ev.Port, ev.OID, ev.Type, ev.Value)
-			})
+			attachTrapManager(virtualAgent, port, s.trapManager)
 		}
 
 		s.agents[port] = virtualAgent
@@ -205,97 +808,305 @@ func (s *Simulator) createVirtualAgents(oidDB *store.OIDDatabase) error {
 		}
 	}
 
-	log.Printf("Created %d virtual agents across ports %d-%d",
+	s.logf("Created %d virtual agents across ports %d-%d",
 		len(s.agents), s.portStart, s.portStart+len(s.agents)-1)
 
 	return nil
 }
 
+// SetTrapConfig installs the trap manager for cfg and serves its targets in
+// snmpTargetAddrTable. Like SetOIDFilter it must be called before Start.
 func (s *Simulator) SetTrapConfig(cfg traps.Config) error {
+	if s.running.Load() {
+		return fmt.Errorf("cannot change the trap configuration of a running simulator")
+	}
 	manager, err := traps.NewManager(cfg)
 	if err != nil {
 		return err
 	}
 
+	// Reload the dataset rather than insert into it, so the rows of targets
+	// the previous configuration had are dropped from snmpTargetAddrTable
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	settings := s.datasetSettingsLocked()
+	settings.trapManager = manager
+	loaded, err := s.loadDataset(s.snmprecFile, settings)
+	if err != nil {
+		return err
+	}
 	s.trapManager = manager
-	for _, vAgent := range s.agents {
+	s.swapDatasetLocked(loaded)
+	for port, vAgent := range s.agents {
 		if manager == nil {
 			vAgent.SetVariationEventHook(nil)
 			vAgent.SetSetEventHook(nil)
+			vAgent.SetAuthFailureHook(nil)
 			continue
 		}
-		vAgent.SetVariationEventHook(func(ev agent.VariationEvent) {
-			manager.EnqueueVariationEvent(ev.DeviceID, ev.Port, ev.OID, ev.Detail)
-		})
-		vAgent.SetSetEventHook(func(ev agent.SetEvent) {
-			manager.EnqueueSetEvent(ev.DeviceID, ev.Port, ev.OID, ev.Type, ev.Value)
-		})
+		attachTrapManager(vAgent, port, manager)
 	}
 	return nil
 }
 
+// attachTrapManager routes the variation, SET and authentication failure
+// events of the agent on port to manager
+func attachTrapManager(vAgent *agent.VirtualAgent, port int, manager *traps.Manager) {
+	vAgent.SetVariationEventHook(variationTrapHook(manager))
+	vAgent.SetSetEventHook(func(ev agent.SetEvent) {
+		manager.EnqueueSetEvent(ev.DeviceID, ev.Port, ev.OID, ev.Type, ev.Value)
+	})
+	vAgent.SetAuthFailureHook(func(ev agent.AuthFailureEvent) {
+		manager.EnqueueAuthFailureEvent(ev.DeviceID, ev.Port, ev.User)
+	})
+	manager.SetResolver(port, vAgent)
+}
+
+// variationTrapHook turns variation events into traps: flap transitions
+// become linkDown/linkUp, anything else the generic variation trap
+func variationTrapHook(manager *traps.Manager) func(agent.VariationEvent) {
+	return func(ev agent.VariationEvent) {
+		switch ev.Detail {
+		case variation.EventLinkDown, variation.EventLinkUp:
+			manager.EnqueueLinkEvent(ev.DeviceID, ev.Port, ev.OID, ev.Detail == variation.EventLinkUp)
+		default:
+			manager.EnqueueVariationEvent(ev.DeviceID, ev.Port, ev.OID, ev.Detail)
+		}
+	}
+}
+
 // Start initializes all UDP listeners and starts packet handling
 func (s *Simulator) Start(ctx context.Context) error {
 	if !s.running.CompareAndSwap(false, true) {
 		return fmt.Errorf("simulator already running")
 	}
 
-	s.mu.Lock()
-	if s.trapManager != nil {
-		s.trapManager.Start()
+	s.mu.RLock()
+	plan := s.listenPlanLocked()
+	s.mu.RUnlock()
+	if plan.dualStack && plan.listenAddr6 == "" {
+		return fmt.Errorf("dual-stack mode needs an IPv6 listen address")
 	}
 
-	// Create UDP listeners with SO_REUSEADDR/SO_REUSEPORT
-	for port := range s.agents {
-		if err := s.startListener(ctx, "udp", s.listenAddr, port, "ipv4"); err != nil {
-			s.mu.Unlock()
+	// Bind before taking s.mu, so the retries of a port still in use do not
+	// block everyone else waiting on the simulator
+	var bound []portListener
+	for _, port := range plan.ports {
+		listeners, err := s.bindPortListeners(ctx, plan, port)
+		bound = append(bound, listeners...)
+		if err != nil {
+			for _, l := range bound {
+				l.close()
+			}
 			s.cleanup()
 			return err
 		}
-		if s.listenAddr6 != "" {
-			if err := s.startListener(ctx, "udp6", s.listenAddr6, port, "ipv6"); err != nil {
-				s.mu.Unlock()
-				s.cleanup()
-				return err
-			}
+	}
+
+	s.mu.Lock()
+	if s.trapManager != nil {
+		s.trapManager.Start()
+	}
+	for _, l := range bound {
+		s.serveListenerLocked(ctx, l)
+	}
+
+	if s.trapManager != nil && s.trapManager.Config().OnStart {
+		devices := make(map[int]int, len(s.agents))
+		for port, vAgent := range s.agents {
+			devices[port] = vAgent.DeviceID()
 		}
+		s.trapManager.EnqueueStartEvents(devices)
 	}
 
+	s.pollRate.reset()
+	s.stopped = make(chan struct{})
+	s.wg.Add(1)
+	go s.samplePollRate(ctx, s.stopped)
+	if s.replay != nil {
+		s.wg.Add(1)
+		go s.runReplay(ctx, s.stopped)
+	}
+	udpCount, tcpCount := len(s.listeners), len(s.tcpListeners)
 	s.mu.Unlock()
 
-	log.Printf("Started %d UDP listeners", len(s.listeners))
+	if plan.tcp {
+		s.logf("Started %d UDP and %d TCP listeners", udpCount, tcpCount)
+	} else {
+		s.logf("Started %d UDP listeners", udpCount)
+	}
 	return nil
 }
 
-func (s *Simulator) startListener(ctx context.Context, network, listenAddr string, port int, family string) error {
+// listenPlan is what Start binds, copied under s.mu so the binds can run
+// without it
+type listenPlan struct {
+	ports        []int
+	listenAddr   string
+	listenAddr6  string
+	dualStack    bool
+	udp, tcp     bool
+	bindAttempts int
+	bindBackoff  time.Duration
+}
+
+func (s *Simulator) listenPlanLocked() listenPlan {
+	plan := listenPlan{
+		listenAddr:   s.listenAddr,
+		listenAddr6:  s.listenAddr6,
+		dualStack:    s.dualStack,
+		udp:          s.servesUDP(),
+		tcp:          s.servesTCP(),
+		bindAttempts: s.bindAttempts,
+		bindBackoff:  s.bindBackoff,
+	}
+	for port := range s.agents {
+		plan.ports = append(plan.ports, port)
+	}
+	return plan
+}
+
+// portListener is a socket bound for an agent port, not yet served
+type portListener struct {
+	key  string
+	port int
+	udp  *net.UDPConn
+	tcp  net.Listener
+}
+
+func (l portListener) close() {
+	if l.udp != nil {
+		_ = l.udp.Close()
+	}
+	if l.tcp != nil {
+		_ = l.tcp.Close()
+	}
+}
+
+// bindPortListeners opens the sockets of one agent port for each address
+// family and transport of plan. On error it returns the sockets opened so
+// far for the caller to close.
+func (s *Simulator) bindPortListeners(ctx context.Context, plan listenPlan, port int) ([]portListener, error) {
+	type family struct {
+		network, addr, name string
+	}
+	var families []family
+	if !plan.dualStack {
+		families = append(families, family{"", plan.listenAddr, "ipv4"})
+	}
+	if plan.listenAddr6 != "" {
+		families = append(families, family{"6", plan.listenAddr6, "ipv6"})
+	}
+	var bound []portListener
+	for _, f := range families {
+		key := fmt.Sprintf("%s:%d", f.name, port)
+		if plan.udp {
+			conn, err := s.bindUDP(ctx, plan, "udp"+f.network, f.addr, port, f.name)
+			if err != nil {
+				return bound, err
+			}
+			bound = append(bound, portListener{key: key, port: port, udp: conn})
+		}
+		if plan.tcp {
+			ln, err := s.bindTCP(ctx, plan, "tcp"+f.network, f.addr, port, f.name)
+			if err != nil {
+				return bound, err
+			}
+			bound = append(bound, portListener{key: key, port: port, tcp: ln})
+		}
+	}
+	return bound, nil
+}
+
+// serveListenerLocked records l for cleanup and starts serving it. Called
+// with s.mu held.
+func (s *Simulator) serveListenerLocked(ctx context.Context, l portListener) {
+	if l.tcp != nil {
+		s.tcpListeners[l.key] = l.tcp
+		s.wg.Add(1)
+		go s.acceptTCP(ctx, l.tcp, l.port)
+		return
+	}
+	s.listeners[l.key] = l.udp
+	for worker := 0; worker < s.readWorkers; worker++ {
+		s.wg.Add(1)
+		go s.handleListener(ctx, l.udp, l.port, worker)
+	}
+}
+
+// bindUDP binds the UDP socket of port on listenAddr with the socket
+// options the listeners need
+func (s *Simulator) bindUDP(ctx context.Context, plan listenPlan, network, listenAddr string, port int, family string) (*net.UDPConn, error) {
 	addr := net.UDPAddr{Port: port, IP: net.ParseIP(listenAddr)}
-	conn, err := net.ListenUDP(network, &addr)
+	var control func(string, string, syscall.RawConn) error
+	if network == "udp6" {
+		control = v6OnlyControl(!plan.dualStack)
+	}
+	conn, err := s.listenUDP(ctx, plan, network, &addr, control)
 	if err != nil {
-		return fmt.Errorf("failed to listen on %s port %d: %w", family, port, err)
+		return nil, fmt.Errorf("failed to listen on %s port %d: %w", family, port, err)
 	}
 	if err := setSocketOptions(conn); err != nil {
 		_ = conn.Close()
-		return fmt.Errorf("failed to set socket options on %s port %d: %w", family, port, err)
+		return nil, fmt.Errorf("failed to set socket options on %s port %d: %w", family, port, err)
+	}
+	return conn, nil
+}
+
+// listenUDP binds addr, retrying while the address is still in use, e.g.
+// right after a previous lab on the same ports shut down
+func (s *Simulator) listenUDP(ctx context.Context, plan listenPlan, network string, addr *net.UDPAddr, control func(string, string, syscall.RawConn) error) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: control}
+	var conn *net.UDPConn
+	err := s.retryBind(ctx, plan, addr.Port, func() error {
+		pc, err := lc.ListenPacket(ctx, network, addr.String())
+		if err == nil {
+			conn = pc.(*net.UDPConn)
+		}
+		return err
+	})
+	return conn, err
+}
+
+// retryBind calls bind until it succeeds, fails with an error other than
+// EADDRINUSE, or the bind attempts of plan run out, doubling the backoff
+// between attempts
+func (s *Simulator) retryBind(ctx context.Context, plan listenPlan, port int, bind func() error) error {
+	backoff := plan.bindBackoff
+	for attempt := 1; ; attempt++ {
+		err := bind()
+		if err == nil {
+			return nil
+		}
+		if attempt >= plan.bindAttempts || !errors.Is(err, syscall.EADDRINUSE) {
+			return err
+		}
+		s.logf("Port %d in use, retrying bind in %s (attempt %d/%d)", port, backoff, attempt, plan.bindAttempts)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
 	}
-	key := fmt.Sprintf("%s:%d", family, port)
-	s.listeners[key] = conn
-	s.wg.Add(1)
-	go s.handleListener(ctx, conn, port)
-	return nil
 }
 
-// handleListener handles incoming packets on a specific port
-func (s *Simulator) handleListener(ctx context.Context, conn *net.UDPConn, port int) {
+// handleListener handles incoming packets on a specific port. Each of the
+// port's read workers runs one; UDP sockets allow concurrent reads and writes.
+func (s *Simulator) handleListener(ctx context.Context, conn *net.UDPConn, port int, worker int) {
 	defer s.wg.Done()
 
 	agent := s.agents[port]
+	latency := s.baseLatency[port]
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("Closing listener on port %d", port)
+			if worker == 0 {
+				s.logf("Closing listener on port %d", port)
+			}
 			return
 		default:
 		}
@@ -312,20 +1123,35 @@ func (s *Simulator) handleListener(ctx context.Context, conn *net.UDPConn, port
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				continue
 			}
+			if errors.Is(err, net.ErrClosed) {
+				if worker == 0 {
+					s.logf("Closing listener on port %d", port)
+				}
+				return
+			}
 			if s.running.Load() {
-				log.Printf("Error reading from port %d: %v", port, err)
+				s.logf("Error reading from port %d: %v", port, err)
 			}
 			continue
 		}
 
+		if !agent.Enabled() {
+			s.packetPool.Put(buffer)
+			continue
+		}
+
 		// Dispatch packet to agent
 		response := agent.HandlePacketFrom(buffer[:n], remoteAddr, port)
 		s.packetPool.Put(buffer) // Return buffer after processing
 
 		if response != nil {
+			if latency > 0 {
+				s.writeAfter(latency, conn, response, remoteAddr, port)
+				continue
+			}
 			_, err := conn.WriteToUDP(response, remoteAddr)
 			if err != nil {
-				log.Printf("Error writing to port %d: %v", port, err)
+				s.logf("Error writing to port %d: %v", port, err)
 			}
 		}
 	}
@@ -343,44 +1169,151 @@ func (s *Simulator) Stop() {
 		s.trapManager.Stop()
 	}
 
-	log.Printf("All listeners stopped")
+	s.logf("All listeners stopped")
+}
+
+// writeAfter sends response once delay has passed without blocking the
+// listener. Writes that lose the race with Stop closing conn are dropped.
+func (s *Simulator) writeAfter(delay time.Duration, conn *net.UDPConn, response []byte, remoteAddr *net.UDPAddr, port int) {
+	time.AfterFunc(delay, func() {
+		if _, err := conn.WriteToUDP(response, remoteAddr); err != nil && s.running.Load() {
+			s.logf("Error writing to port %d: %v", port, err)
+		}
+	})
 }
 
 func (s *Simulator) cleanup() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.stopped != nil {
+		close(s.stopped)
+		s.stopped = nil
+	}
+
 	for key, conn := range s.listeners {
 		// Set a past deadline to unblock any pending ReadFromUDP calls
 		// before closing the connection.
 		conn.SetDeadline(time.Now())
 		if err := conn.Close(); err != nil {
-			log.Printf("Error closing listener %s: %v", key, err)
+			s.logf("Error closing listener %s: %v", key, err)
 		}
 	}
 	s.listeners = make(map[string]*net.UDPConn)
+
+	for key, ln := range s.tcpListeners {
+		if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.logf("Error closing TCP listener %s: %v", key, err)
+		}
+	}
+	s.tcpListeners = make(map[string]net.Listener)
+
+	s.tcpMu.Lock()
+	for conn := range s.tcpConns {
+		conn.Close()
+	}
+	s.tcpConns = make(map[net.Conn]struct{})
+	s.tcpMu.Unlock()
 }
 
-// Statistics returns current simulator statistics
-func (s *Simulator) Statistics() map[string]interface{} {
+// DatasetHash returns the SHA-256 of the default dataset the agents serve,
+// as computed by store.OIDDatabase.Hash when it was loaded, so fleets can
+// check every lab runs the same dataset version.
+func (s *Simulator) DatasetHash() string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.datasetHash
+}
 
-	var totalPolls int64
-	for _, virtualAgent := range s.agents {
-		stats := virtualAgent.GetStatistics()
-		if count, ok := stats["poll_count"].(int64); ok {
-			totalPolls += count
-		}
+// Statistics returns current simulator statistics
+func (s *Simulator) Statistics() map[string]interface{} {
+	totalPolls := s.totalPolls()
+	pollsPerSecond := 0.0
+	if s.running.Load() {
+		pollsPerSecond = s.pollRate.perSecond()
 	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return map[string]interface{}{
 		"running":          s.running.Load(),
-		"active_listeners": len(s.listeners),
+		"active_listeners": len(s.listeners) + len(s.tcpListeners),
 		"virtual_agents":   len(s.agents),
 		"total_polls":      totalPolls,
+		"polls_per_second": pollsPerSecond,
 		"port_start":       s.portStart,
 		"port_end":         s.portEnd,
+		"dataset_hash":     s.datasetHash,
+	}
+}
+
+// AgentStats returns the statistics of each agent, ordered by port
+func (s *Simulator) AgentStats() []map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ports := make([]int, 0, len(s.agents))
+	for port := range s.agents {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	stats := make([]map[string]interface{}, 0, len(ports))
+	for _, port := range ports {
+		stats = append(stats, s.agents[port].GetStatistics())
+	}
+	return stats
+}
+
+// totalPolls sums the poll counters of all agents
+func (s *Simulator) totalPolls() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total int64
+	for _, virtualAgent := range s.agents {
+		if count, ok := virtualAgent.GetStatistics()["poll_count"].(int64); ok {
+			total += count
+		}
+	}
+	return total
+}
+
+// ResetStatistics zeroes every agent's poll counter so total_polls counts
+// only what follows. It returns the per-port counts and their total from
+// just before the reset.
+func (s *Simulator) ResetStatistics() (totalPolls int64, polls map[int]int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	polls = make(map[int]int64, len(s.agents))
+	for port, virtualAgent := range s.agents {
+		count := virtualAgent.ResetPollCount()
+		polls[port] = count
+		totalPolls += count
+	}
+	s.logf("Statistics reset (%d polls across %d agents)", totalPolls, len(polls))
+	return totalPolls, polls
+}
+
+// v6OnlyControl returns a listen control that sets IPV6_V6ONLY before the
+// socket is bound, overriding the platform default
+func v6OnlyControl(v6Only bool) func(string, string, syscall.RawConn) error {
+	value := 0
+	if v6Only {
+		value = 1
+	}
+	return func(_, _ string, rawConn syscall.RawConn) error {
+		var setsockoptErr error
+		err := rawConn.Control(func(fd uintptr) {
+			if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, value); err != nil {
+				setsockoptErr = fmt.Errorf("failed to set IPV6_V6ONLY: %w", err)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("rawConn.Control failed: %w", err)
+		}
+		return setsockoptErr
 	}
 }
 
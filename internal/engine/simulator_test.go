@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+)
+
+func TestNewSimulatorRejectsMoreDevicesThanPorts(t *testing.T) {
+	_, err := NewSimulator("127.0.0.1", 20000, 20100, 5000, "", "", "", v3.Config{Enabled: false})
+	if err == nil {
+		t.Fatal("expected error for 5000 devices on a 100-port range")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "numDevices (5000) exceeds the 100 ports") || !strings.Contains(msg, "25000") {
+		t.Fatalf("unclear oversubscription error: %v", err)
+	}
+
+	sim, err := NewSimulator("127.0.0.1", 20000, 20100, 100, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("one device per port should be accepted: %v", err)
+	}
+	if len(sim.agents) != 100 {
+		t.Fatalf("created %d agents, want 100", len(sim.agents))
+	}
+}
+
+func TestNewSimulatorRejectsDeviceCountAboveCap(t *testing.T) {
+	_, err := NewSimulator("127.0.0.1", 1, 70001, 70000, "", "", "", v3.Config{Enabled: false})
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 65535 devices") {
+		t.Fatalf("70000 devices: err = %v, want the default cap error", err)
+	}
+
+	defer func(old int) { MaxDevices = old }(MaxDevices)
+	MaxDevices = 10
+	if _, err := NewSimulator("127.0.0.1", 20000, 20100, 11, "", "", "", v3.Config{Enabled: false}); err == nil || !strings.Contains(err.Error(), "limit of 10 devices") {
+		t.Fatalf("11 devices with cap 10: err = %v, want the cap error", err)
+	}
+	if _, err := NewSimulator("127.0.0.1", 20000, 20100, 10, "", "", "", v3.Config{Enabled: false}); err != nil {
+		t.Fatalf("10 devices with cap 10: %v", err)
+	}
+}
+
+func TestStartRetriesBindWhilePortInUse(t *testing.T) {
+	held, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := held.LocalAddr().(*net.UDPAddr).Port
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetBindRetry(6, 50*time.Millisecond); err != nil {
+		t.Fatalf("set bind retry: %v", err)
+	}
+
+	// While Start is retrying, the simulator stays usable; then release the port
+	blocked := make(chan time.Duration, 1)
+	time.AfterFunc(75*time.Millisecond, func() {
+		called := time.Now()
+		_ = sim.SetOverlayValue(port, "1.3.6.1.4.1.55555.3.1.0", "set while binding")
+		blocked <- time.Since(called)
+	})
+	time.AfterFunc(150*time.Millisecond, func() { held.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := sim.Start(ctx); err != nil {
+		t.Fatalf("expected start to bind once the port was released: %v", err)
+	}
+	if d := <-blocked; d > 40*time.Millisecond {
+		t.Fatalf("SetOverlayValue waited %v for the bind retries", d)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+}
+
+func TestStartDoesNotRetryPermanentBindErrors(t *testing.T) {
+	// 192.0.2.1 (TEST-NET-1) is not a local address, so binding fails with
+	// EADDRNOTAVAIL rather than EADDRINUSE
+	sim, err := NewSimulator("192.0.2.1", 20161, 20162, 1, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetBindRetry(5, time.Second); err != nil {
+		t.Fatalf("set bind retry: %v", err)
+	}
+
+	start := time.Now()
+	if err := sim.Start(context.Background()); err == nil {
+		sim.Stop()
+		t.Fatal("expected start to fail binding a non-local address")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("permanent bind error was retried (took %s)", elapsed)
+	}
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/traps"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+// startTrapSimulator runs one agent that sends v2c traps to the returned
+// receiver
+func startTrapSimulator(t *testing.T, v3cfg v3.Config, onStart bool) (int, *net.UDPConn) {
+	t.Helper()
+	snmprec := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(snmprec, []byte("1.3.6.1.2.1.1.5.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+	trapConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen trap receiver: %v", err)
+	}
+	t.Cleanup(func() { trapConn.Close() })
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3cfg)
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetTrapConfig(traps.Config{
+		Targets: []string{trapConn.LocalAddr().String()},
+		Version: "v2c",
+		OnStart: onStart,
+		Timeout: time.Second,
+	}); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := sim.Start(ctx); err != nil {
+		cancel()
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	return port, trapConn
+}
+
+// readTrap returns the snmpTrapOID and varbinds of the next trap
+func readTrap(t *testing.T, trapConn *net.UDPConn) (string, map[string]gosnmp.SnmpPDU) {
+	t.Helper()
+	_ = trapConn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := trapConn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("read trap: %v", err)
+	}
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	pkt, err := decoder.SnmpDecodePacket(buf[:n])
+	if err != nil {
+		t.Fatalf("decode trap: %v", err)
+	}
+	vars := make(map[string]gosnmp.SnmpPDU, len(pkt.Variables))
+	for _, v := range pkt.Variables {
+		vars[v.Name] = v
+	}
+	trapOID, _ := vars[".1.3.6.1.6.3.1.1.4.1.0"].Value.(string)
+	return trapOID, vars
+}
+
+func TestWrongV3PassphraseSendsAuthenticationFailureTrap(t *testing.T) {
+	port, trapConn := startTrapSimulator(t, v3.Config{
+		Enabled:  true,
+		Username: "simuser",
+		Auth:     v3.AuthSHA1,
+		AuthKey:  "authpass123",
+	}, false)
+
+	client := &gosnmp.GoSNMP{
+		Target:        "127.0.0.1",
+		Port:          uint16(port),
+		Version:       gosnmp.Version3,
+		Timeout:       time.Second,
+		SecurityModel: gosnmp.UserSecurityModel,
+		MsgFlags:      gosnmp.AuthNoPriv,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{
+			UserName:                 "simuser",
+			AuthenticationProtocol:   gosnmp.SHA,
+			AuthenticationPassphrase: "wrongpass123",
+		},
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	if _, err := client.Get([]string{"1.3.6.1.2.1.1.5.0"}); err == nil {
+		t.Fatal("get with a wrong passphrase succeeded")
+	}
+
+	trapOID, vars := readTrap(t, trapConn)
+	if trapOID != "."+traps.TrapOIDAuthenticationFailure {
+		t.Fatalf("trap OID = %q, want authenticationFailure", trapOID)
+	}
+	if got := vars[".1.3.6.1.4.1.55555.4.2.0"].Value; got != port {
+		t.Errorf("port varbind = %v, want %d", got, port)
+	}
+	if got, _ := vars[".1.3.6.1.4.1.55555.4.3.0"].Value.([]byte); string(got) != "simuser" {
+		t.Errorf("user varbind = %q, want simuser", got)
+	}
+}
+
+func TestTrapOnStartSendsColdStart(t *testing.T) {
+	port, trapConn := startTrapSimulator(t, v3.Config{}, true)
+
+	trapOID, vars := readTrap(t, trapConn)
+	if trapOID != "."+traps.TrapOIDColdStart {
+		t.Fatalf("trap OID = %q, want coldStart", trapOID)
+	}
+	if got := vars[".1.3.6.1.4.1.55555.4.2.0"].Value; got != port {
+		t.Errorf("port varbind = %v, want %d", got, port)
+	}
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const stateSnapshotVersion = 1
+
+// StateSnapshot is the serialized mutable state of every agent: the device
+// overlay values, keyed by listener port and OID.
+type StateSnapshot struct {
+	Version int                       `json:"version"`
+	Agents  map[int]map[string]string `json:"agents"`
+}
+
+// SnapshotState checkpoints the overlay values of all agents as a JSON blob
+// that RestoreState accepts.
+func (s *Simulator) SnapshotState() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := StateSnapshot{Version: stateSnapshotVersion, Agents: make(map[int]map[string]string)}
+	for port, vAgent := range s.agents {
+		if overlay := vAgent.OverlaySnapshot(); len(overlay) > 0 {
+			snap.Agents[port] = overlay
+		}
+	}
+	return json.Marshal(snap)
+}
+
+// RestoreState reapplies a SnapshotState blob. Every agent's overlay is
+// replaced, so values set after the snapshot are discarded. The blob is
+// validated before any agent is touched, and the simulator write lock is held
+// for the whole restore so SnapshotState and SetOverlayValue never observe a
+// partially restored state. SNMP SETs arriving on the agents themselves are
+// not serialized against it.
+func (s *Simulator) RestoreState(blob []byte) error {
+	var snap StateSnapshot
+	if err := json.Unmarshal(blob, &snap); err != nil {
+		return fmt.Errorf("decode state snapshot: %w", err)
+	}
+	if snap.Version != stateSnapshotVersion {
+		return fmt.Errorf("unsupported state snapshot version %d", snap.Version)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var unknown []int
+	for port := range snap.Agents {
+		if _, ok := s.agents[port]; !ok {
+			unknown = append(unknown, port)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Ints(unknown)
+		return fmt.Errorf("state snapshot references unknown agent ports %v", unknown)
+	}
+
+	for port, vAgent := range s.agents {
+		vAgent.RestoreOverlay(snap.Agents[port])
+	}
+	return nil
+}
+
+// SetOverlayValue overlays oid on the agent listening on port.
+func (s *Simulator) SetOverlayValue(port int, oid, value string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vAgent, ok := s.agents[port]
+	if !ok {
+		return fmt.Errorf("no agent on port %d", port)
+	}
+	vAgent.SetOIDValue(oid, value)
+	return nil
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestSnapshotRestoreOverlayState(t *testing.T) {
+	sim, err := NewSimulator("127.0.0.1", 20000, 20002, 2, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	const oid = "1.3.6.1.4.1.55555.3.1.0"
+	const intOID = "1.3.6.1.4.1.55555.3.2.0"
+
+	if err := sim.SetOverlayValue(20000, oid, "before"); err != nil {
+		t.Fatalf("set overlay: %v", err)
+	}
+	sim.agents[20000].SetOIDValue(intOID, &store.OIDValue{Type: gosnmp.Integer, Value: 7})
+	blob, err := sim.SnapshotState()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+
+	if err := sim.SetOverlayValue(20000, oid, "after"); err != nil {
+		t.Fatalf("set overlay: %v", err)
+	}
+	if err := sim.SetOverlayValue(20001, oid, "added later"); err != nil {
+		t.Fatalf("set overlay: %v", err)
+	}
+
+	if err := sim.RestoreState(blob); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	pdu, ok := sim.agents[20000].ResolveOID(oid)
+	if !ok || pdu.Value != "before" {
+		t.Fatalf("port 20000 %s = %+v, want restored value", oid, pdu)
+	}
+	pdu, ok = sim.agents[20000].ResolveOID(intOID)
+	if !ok || pdu.Type != gosnmp.Integer || pdu.Value != 7 {
+		t.Fatalf("port 20000 %s = %+v, want restored Integer 7", intOID, pdu)
+	}
+	if _, ok := sim.agents[20001].ResolveOID(oid); ok {
+		t.Fatal("overlay set after the snapshot should be discarded on restore")
+	}
+
+	if err := sim.RestoreState([]byte(`{"version":1,"agents":{"30000":{"1.3.6.1.2.1.1.5.0":"x"}}}`)); err == nil {
+		t.Fatal("expected error for snapshot naming an unknown port")
+	}
+}
+
+func TestRestoreStateIsAtomicToSnapshots(t *testing.T) {
+	sim, err := NewSimulator("127.0.0.1", 20000, 20008, 8, "", "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	const oid = "1.3.6.1.4.1.55555.3.1.0"
+
+	blobs := make([][]byte, 2)
+	for i, value := range []string{"a", "b"} {
+		agents := make(map[int]map[string]string)
+		for port := 20000; port < 20008; port++ {
+			agents[port] = map[string]string{oid: value}
+		}
+		blobs[i], err = json.Marshal(StateSnapshot{Version: stateSnapshotVersion, Agents: agents})
+		if err != nil {
+			t.Fatalf("marshal snapshot: %v", err)
+		}
+	}
+	if err := sim.RestoreState(blobs[0]); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if err := sim.RestoreState(blobs[i%2]); err != nil {
+				t.Errorf("restore: %v", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		blob, err := sim.SnapshotState()
+		if err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		var snap StateSnapshot
+		if err := json.Unmarshal(blob, &snap); err != nil {
+			t.Fatalf("decode snapshot: %v", err)
+		}
+		seen := make(map[string]bool)
+		for _, overlay := range snap.Agents {
+			seen[overlay[oid]] = true
+		}
+		if len(snap.Agents) != 8 || len(seen) != 1 {
+			t.Fatalf("snapshot observed a partial restore: %v", snap.Agents)
+		}
+	}
+	wg.Wait()
+}
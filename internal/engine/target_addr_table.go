@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/traps"
+	"github.com/gosnmp/gosnmp"
+)
+
+// snmpTargetAddrEntry is the SNMP-TARGET-MIB snmpTargetAddrTable row
+const snmpTargetAddrEntry = "1.3.6.1.6.3.12.1.2.1"
+
+// Transport domains of snmpTargetAddrTDomain
+const (
+	snmpUDPDomain          = "1.3.6.1.6.1.1"       // SNMPv2-TM, 4-byte address and port
+	transportDomainUDPIPv6 = "1.3.6.1.2.1.100.1.2" // TRANSPORT-ADDRESS-MIB, 16-byte address and port
+)
+
+// targetAddrTableEntries renders the trap targets of a normalized config as
+// snmpTargetAddrTable rows named target1, target2, ... in config order.
+// Targets whose host does not resolve get no row and are returned in
+// unresolved.
+func targetAddrTableEntries(cfg traps.Config) (entries map[string]*store.OIDValue, unresolved []string) {
+	entries = make(map[string]*store.OIDValue, len(cfg.Targets)*8)
+	tag := "trap"
+	if cfg.Inform {
+		tag = "inform"
+	}
+	for i, target := range cfg.Targets {
+		domain, address, err := targetTransportAddress(target)
+		if err != nil {
+			unresolved = append(unresolved, target)
+			continue
+		}
+		settings := cfg.TargetSettings[target]
+		columns := map[int]*store.OIDValue{
+			2: {Type: gosnmp.ObjectIdentifier, Value: domain},
+			3: {Type: gosnmp.OctetString, Value: address},
+			4: {Type: gosnmp.Integer, Value: int(settings.Timeout / (10 * time.Millisecond))}, // TimeInterval, 1/100 s
+			5: {Type: gosnmp.Integer, Value: settings.Retries},
+			6: {Type: gosnmp.OctetString, Value: tag},
+			7: {Type: gosnmp.OctetString, Value: "snmpsim-" + cfg.Version},
+			8: {Type: gosnmp.Integer, Value: storageReadOnly},
+			9: {Type: gosnmp.Integer, Value: rowStatusActive},
+		}
+		index := impliedIndex(fmt.Sprintf("target%d", i+1))
+		for col, value := range columns {
+			entries[fmt.Sprintf("%s.%d.%s", snmpTargetAddrEntry, col, index)] = value
+		}
+	}
+	return entries, unresolved
+}
+
+// targetTransportAddress encodes a host:port target as its transport domain
+// and snmpTargetAddrTAddress: the address bytes followed by the port in
+// network order
+func targetTransportAddress(target string) (domain, address string, err error) {
+	host, portText, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", "", err
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return "", "", err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		addrs, err := net.LookupIP(host)
+		if err != nil || len(addrs) == 0 {
+			return "", "", fmt.Errorf("resolve %q: %v", host, err)
+		}
+		ip = addrs[0]
+	}
+	domain = transportDomainUDPIPv6
+	if v4 := ip.To4(); v4 != nil {
+		ip, domain = v4, snmpUDPDomain
+	}
+	return domain, string(binary.BigEndian.AppendUint16(append([]byte(nil), ip...), uint16(port))), nil
+}
+
+// insertTargetAddrTable adds the trap targets' snmpTargetAddrTable rows to
+// every dataset of ds; without traps configured it does nothing
+func (s *Simulator) insertTargetAddrTable(ds *store.DatasetStore, manager *traps.Manager) error {
+	if manager == nil {
+		return nil
+	}
+	entries, unresolved := targetAddrTableEntries(manager.Config())
+	for _, target := range unresolved {
+		s.logf("Warning: trap target %s does not resolve; leaving it out of snmpTargetAddrTable", target)
+	}
+	return ds.InsertAll(entries)
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/traps"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestTargetAddrTableListsTrapTargets(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(snmprec, []byte("1.3.6.1.2.1.1.1.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetTrapConfig(traps.Config{
+		Targets: []string{"192.0.2.10:162", "[2001:db8::1]:1162;timeout=3s;retries=2"},
+		Timeout: time.Second,
+	}); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	pdus, err := client.WalkAll("1.3.6.1.6.3.12.1.2")
+	if err != nil {
+		t.Fatalf("walk snmpTargetAddrTable: %v", err)
+	}
+
+	got := make(map[string]interface{}, len(pdus))
+	for _, pdu := range pdus {
+		got[strings.TrimPrefix(pdu.Name, ".")] = pdu.Value
+	}
+	const target1 = "116.97.114.103.101.116.49" // "target1"
+	const target2 = "116.97.114.103.101.116.50"
+	rows := 0
+	for oid := range got {
+		if strings.HasPrefix(oid, snmpTargetAddrEntry+".2.") {
+			rows++
+		}
+	}
+	if rows != 2 || len(pdus) != 16 {
+		t.Fatalf("walk returned %d rows in %d varbinds, want 2 rows of 8 columns: %v", rows, len(pdus), got)
+	}
+
+	want := map[string]interface{}{
+		snmpTargetAddrEntry + ".2." + target1: "." + snmpUDPDomain,
+		snmpTargetAddrEntry + ".3." + target1: []byte{192, 0, 2, 10, 0, 162},
+		snmpTargetAddrEntry + ".4." + target1: 100,
+		snmpTargetAddrEntry + ".5." + target1: 0,
+		snmpTargetAddrEntry + ".2." + target2: "." + transportDomainUDPIPv6,
+		snmpTargetAddrEntry + ".3." + target2: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x04, 0x8a},
+		snmpTargetAddrEntry + ".4." + target2: 300,
+		snmpTargetAddrEntry + ".5." + target2: 2,
+		snmpTargetAddrEntry + ".6." + target2: []byte("trap"),
+	}
+	for oid, value := range want {
+		if b, ok := value.([]byte); ok {
+			if v, _ := got[oid].([]byte); string(v) != string(b) {
+				t.Errorf("%s = %v, want %v", oid, got[oid], b)
+			}
+			continue
+		}
+		if got[oid] != value {
+			t.Errorf("%s = %v (%T), want %v", oid, got[oid], got[oid], value)
+		}
+	}
+}
+
+func TestSetTrapConfigDropsRemovedTargets(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(snmprec, []byte("1.3.6.1.2.1.1.1.0|octetstring|router\n"), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+	sim, err := NewSimulator("127.0.0.1", 20000, 20001, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+
+	rows := func() []string {
+		oidDB, _ := sim.datasetStore.Resolve("")
+		var names []string
+		oidDB.Walk(func(oid string, _ *store.OIDValue) bool {
+			if strings.HasPrefix(oid, snmpTargetAddrEntry+".2.") {
+				names = append(names, oid)
+			}
+			return true
+		})
+		return names
+	}
+
+	cfg := traps.Config{Targets: []string{"192.0.2.10:162", "192.0.2.11:162"}, Timeout: time.Second}
+	if err := sim.SetTrapConfig(cfg); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+	if got := rows(); len(got) != 2 {
+		t.Fatalf("rows after two targets = %v, want 2", got)
+	}
+
+	cfg.Targets = cfg.Targets[:1]
+	if err := sim.SetTrapConfig(cfg); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+	if got := rows(); len(got) != 1 {
+		t.Fatalf("rows after one target = %v, want 1", got)
+	}
+
+	if err := sim.SetTrapConfig(traps.Config{}); err != nil {
+		t.Fatalf("clear trap config: %v", err)
+	}
+	if got := rows(); len(got) != 0 {
+		t.Fatalf("rows after clearing the targets = %v, want none", got)
+	}
+	if oidDB, _ := sim.datasetStore.Resolve(""); oidDB.Get("1.3.6.1.2.1.1.1.0") == nil {
+		t.Fatal("dataset lost sysDescr on trap reconfiguration")
+	}
+}
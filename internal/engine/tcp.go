@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Transports the agents can be served over
+const (
+	TransportUDP  = "udp"
+	TransportTCP  = "tcp"
+	TransportBoth = "both"
+)
+
+// maxTCPMessage caps the SNMP messages read from a TCP connection, the
+// largest a UDP datagram could carry
+const maxTCPMessage = 65507
+
+// tcpWriteTimeout bounds each response write, so a client that stopped
+// reading cannot hold its connection's goroutine forever
+const tcpWriteTimeout = 10 * time.Second
+
+// SetTransport chooses whether Start listens on UDP, on TCP (RFC 3430) or on
+// both for every agent port. The default is UDP. Call it before Start.
+func (s *Simulator) SetTransport(transport string) error {
+	switch transport {
+	case TransportUDP, TransportTCP, TransportBoth:
+	default:
+		return fmt.Errorf("unknown transport %q (want udp, tcp or both)", transport)
+	}
+	if s.running.Load() {
+		return fmt.Errorf("cannot change the transport of a running simulator")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transport = transport
+	return nil
+}
+
+func (s *Simulator) servesUDP() bool {
+	return s.transport != TransportTCP
+}
+
+func (s *Simulator) servesTCP() bool {
+	return s.transport == TransportTCP || s.transport == TransportBoth
+}
+
+// bindTCP listens on TCP port of listenAddr, retrying while the address is
+// still in use
+func (s *Simulator) bindTCP(ctx context.Context, plan listenPlan, network, listenAddr string, port int, family string) (net.Listener, error) {
+	addr := net.TCPAddr{Port: port, IP: net.ParseIP(listenAddr)}
+	var control func(string, string, syscall.RawConn) error
+	if network == "tcp6" {
+		control = v6OnlyControl(!plan.dualStack)
+	}
+	lc := net.ListenConfig{Control: control}
+	var ln net.Listener
+	err := s.retryBind(ctx, plan, port, func() error {
+		var err error
+		ln, err = lc.Listen(ctx, network, addr.String())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s TCP port %d: %w", family, port, err)
+	}
+	return ln, nil
+}
+
+// acceptTCP serves the connections of ln until it is closed by cleanup or
+// ctx ends
+func (s *Simulator) acceptTCP(ctx context.Context, ln net.Listener, port int) {
+	defer s.wg.Done()
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+				s.logf("Closing TCP listener on port %d", port)
+				return
+			}
+			s.logf("Error accepting on TCP port %d: %v", port, err)
+			continue
+		}
+		if !s.trackTCPConn(conn) {
+			conn.Close() // cleanup ran between Accept and here
+			return
+		}
+		s.wg.Add(1)
+		go s.serveTCPConn(ctx, conn, port)
+	}
+}
+
+// trackTCPConn records conn so cleanup can close it. It returns false once
+// the simulator has stopped.
+func (s *Simulator) trackTCPConn(conn net.Conn) bool {
+	s.tcpMu.Lock()
+	defer s.tcpMu.Unlock()
+	if !s.running.Load() {
+		return false
+	}
+	s.tcpConns[conn] = struct{}{}
+	return true
+}
+
+func (s *Simulator) untrackTCPConn(conn net.Conn) {
+	s.tcpMu.Lock()
+	defer s.tcpMu.Unlock()
+	delete(s.tcpConns, conn)
+}
+
+// serveTCPConn answers the SNMP messages of one connection in order until
+// the client closes it, it sends something that is not a message, or the
+// simulator stops
+func (s *Simulator) serveTCPConn(ctx context.Context, conn net.Conn, port int) {
+	defer s.wg.Done()
+	defer s.untrackTCPConn(conn)
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	agent := s.agents[port]
+	latency := s.baseLatency[port]
+	remote := udpAddrOf(conn.RemoteAddr())
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readSNMPMessage(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && s.running.Load() {
+				s.logf("Closing TCP connection from %s on port %d: %v", conn.RemoteAddr(), port, err)
+			}
+			return
+		}
+		if !agent.Enabled() {
+			continue
+		}
+		response := agent.HandlePacketFrom(msg, remote, port)
+		if response == nil {
+			continue
+		}
+		if latency > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(latency):
+			}
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+		if _, err := conn.Write(response); err != nil {
+			if s.running.Load() {
+				s.logf("Error writing to TCP port %d: %v", port, err)
+			}
+			return
+		}
+	}
+}
+
+// readSNMPMessage reads one BER encoded SNMP message, a SEQUENCE whose
+// length header delimits it on the stream (RFC 3430 section 2.1)
+func readSNMPMessage(r *bufio.Reader) ([]byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0x30 {
+		return nil, fmt.Errorf("message starts with tag 0x%02x, not a SEQUENCE", tag)
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	header := []byte{tag, first}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7F)
+		if n == 0 || n > 3 {
+			return nil, fmt.Errorf("unsupported length of %d octets", n)
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			header = append(header, b)
+			length = length<<8 | int(b)
+		}
+	}
+	if len(header)+length > maxTCPMessage {
+		return nil, fmt.Errorf("message of %d bytes exceeds %d", len(header)+length, maxTCPMessage)
+	}
+	msg := make([]byte, len(header)+length)
+	copy(msg, header)
+	if _, err := io.ReadFull(r, msg[len(header):]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return msg, nil
+}
+
+// unexpectedEOF turns an EOF inside a message into io.ErrUnexpectedEOF, so
+// only a connection closed between messages counts as a clean close
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// udpAddrOf converts a TCP peer address for the agent, which routes and
+// logs requests by a UDP address
+func udpAddrOf(addr net.Addr) *net.UDPAddr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return &net.UDPAddr{IP: tcp.IP, Port: tcp.Port, Zone: tcp.Zone}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReadSNMPMessageFraming(t *testing.T) {
+	long := append([]byte{0x30, 0x82, 0x01, 0x00}, bytes.Repeat([]byte{0x05}, 0x100)...)
+	stream := append([]byte{0x30, 0x03, 0x02, 0x01, 0x07}, long...)
+	r := bufio.NewReader(bytes.NewReader(stream))
+	for i, want := range [][]byte{stream[:5], long} {
+		msg, err := readSNMPMessage(r)
+		if err != nil || !bytes.Equal(msg, want) {
+			t.Fatalf("message %d = %x, %v; want %x", i, msg, err, want)
+		}
+	}
+	if _, err := readSNMPMessage(r); !errors.Is(err, io.EOF) {
+		t.Fatalf("read at end of stream = %v, want EOF", err)
+	}
+
+	for name, bad := range map[string][]byte{
+		"not a sequence": {0x04, 0x01, 0x00},
+		"truncated":      {0x30, 0x05, 0x02, 0x01},
+		"too large":      {0x30, 0x83, 0x01, 0x00, 0x00},
+		"indefinite":     {0x30, 0x80, 0x00, 0x00},
+	} {
+		_, err := readSNMPMessage(bufio.NewReader(bytes.NewReader(bad)))
+		if err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("%s: err = %v, want a framing error", name, err)
+		}
+	}
+}
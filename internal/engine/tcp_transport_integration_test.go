@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestTCPTransportServesSNMPOverStreams(t *testing.T) {
+	snmprec := filepath.Join(t.TempDir(), "tcp.snmprec")
+	content := `1.3.6.1.4.1.55555.40.1.0|octetstring|over tcp
+1.3.6.1.4.1.55555.40.2.0|integer|2
+1.3.6.1.4.1.55555.40.3.0|integer|3
+`
+	if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetTransport("sctp"); err == nil {
+		t.Fatal("SetTransport accepted sctp")
+	}
+	if err := sim.SetTransport(TransportBoth); err != nil {
+		t.Fatalf("set transport: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := sim.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	stopped := false
+	t.Cleanup(func() {
+		if !stopped {
+			sim.Stop()
+		}
+	})
+
+	for _, transport := range []string{"udp", "tcp"} {
+		client := &gosnmp.GoSNMP{
+			Target:    "127.0.0.1",
+			Port:      uint16(port),
+			Transport: transport,
+			Version:   gosnmp.Version2c,
+			Community: "public",
+			Timeout:   time.Second,
+		}
+		if err := client.Connect(); err != nil {
+			t.Fatalf("connect over %s: %v", transport, err)
+		}
+		walked, err := client.WalkAll("1.3.6.1.4.1.55555.40")
+		client.Conn.Close()
+		if err != nil || len(walked) != 3 {
+			t.Fatalf("walk over %s: %v (%d values)", transport, err, len(walked))
+		}
+		if got := string(walked[0].Value.([]byte)); got != "over tcp" {
+			t.Fatalf("walk over %s read %q", transport, got)
+		}
+	}
+
+	// Two requests in one write are two messages, answered in order
+	raw, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("dial tcp: %v", err)
+	}
+	defer raw.Close()
+	var batch []byte
+	for id, oid := range []string{"1.3.6.1.4.1.55555.40.2.0", "1.3.6.1.4.1.55555.40.3.0"} {
+		req := &gosnmp.SnmpPacket{
+			Version:   gosnmp.Version2c,
+			Community: "public",
+			PDUType:   gosnmp.GetRequest,
+			RequestID: uint32(id + 1),
+			Variables: []gosnmp.SnmpPDU{{Name: oid, Type: gosnmp.Null}},
+			Logger:    gosnmp.NewLogger(nil),
+		}
+		msg, err := req.MarshalMsg()
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		batch = append(batch, msg...)
+	}
+	if _, err := raw.Write(batch); err != nil {
+		t.Fatalf("write requests: %v", err)
+	}
+	_ = raw.SetReadDeadline(time.Now().Add(2 * time.Second))
+	r := bufio.NewReader(raw)
+	decoder := gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	for i, want := range []int{2, 3} {
+		msg, err := readSNMPMessage(r)
+		if err != nil {
+			t.Fatalf("read response %d: %v", i, err)
+		}
+		resp, err := decoder.SnmpDecodePacket(msg)
+		if err != nil {
+			t.Fatalf("decode response %d: %v", i, err)
+		}
+		if resp.RequestID != uint32(i+1) || len(resp.Variables) != 1 || gosnmp.ToBigInt(resp.Variables[0].Value).Int64() != int64(want) {
+			t.Fatalf("response %d = id %d %+v, want id %d value %d", i, resp.RequestID, resp.Variables, i+1, want)
+		}
+	}
+
+	// Shutting down closes open connections and waits for their goroutines
+	done := make(chan struct{})
+	go func() {
+		cancel()
+		sim.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		stopped = true
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not finish with a TCP connection open")
+	}
+	_ = raw.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := r.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Fatalf("read after Stop = %v, want EOF", err)
+	}
+}
@@ -0,0 +1,381 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/traps"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestVariationTrapCarriesAgentCounterValue(t *testing.T) {
+	dir := t.TempDir()
+	snmprec := filepath.Join(dir, "switch.snmprec")
+	content := `1.3.6.1.2.1.2.2.1.13.3|counter32|0
+1.3.6.1.2.1.2.2.1.10.3|counter32|4242
+`
+	if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+	// Any value change reported by the variation engine raises the event;
+	// ifInDiscards ticking up is the trigger, ifInOctets the reported value
+	variations := filepath.Join(dir, "variations.yaml")
+	yaml := `bindings:
+  - prefix: "1.3.6.1.2.1.2.2.1.13"
+    variations:
+      - type: counterMonotonic
+        delta: 1
+`
+	if err := os.WriteFile(variations, []byte(yaml), 0o644); err != nil {
+		t.Fatalf("write variations: %v", err)
+	}
+
+	trapConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen trap receiver: %v", err)
+	}
+	defer trapConn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", variations, v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	counterVarbind, err := traps.ParseVarbindTemplate("1.3.6.1.2.1.2.2.1.10.$index||${oid:1.3.6.1.2.1.2.2.1.10.$index}")
+	if err != nil {
+		t.Fatalf("parse varbind: %v", err)
+	}
+	if err := sim.SetTrapConfig(traps.Config{
+		Targets:     []string{trapConn.LocalAddr().String()},
+		Version:     "v2c",
+		OnVariation: true,
+		Varbinds:    []traps.VarbindTemplate{counterVarbind},
+		Timeout:     time.Second,
+	}); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Retries:   1,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	if _, err := client.Get([]string{"1.3.6.1.2.1.2.2.1.13.3"}); err != nil {
+		t.Fatalf("get ifInDiscards: %v", err)
+	}
+
+	_ = trapConn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := trapConn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("read trap: %v", err)
+	}
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	pkt, err := decoder.SnmpDecodePacket(buf[:n])
+	if err != nil {
+		t.Fatalf("decode trap: %v", err)
+	}
+
+	for _, v := range pkt.Variables {
+		if v.Name != ".1.3.6.1.2.1.2.2.1.10.3" {
+			continue
+		}
+		if v.Type != gosnmp.Counter32 || gosnmp.ToBigInt(v.Value).Uint64() != 4242 {
+			t.Fatalf("counter varbind = %+v, want Counter32 4242", v)
+		}
+		return
+	}
+	t.Fatalf("trap is missing the ifInOctets.3 varbind: %+v", pkt.Variables)
+}
+
+func TestSetTrapDefinitionSendsLinkDown(t *testing.T) {
+	dir := t.TempDir()
+	snmprec := filepath.Join(dir, "switch.snmprec")
+	content := `1.3.6.1.2.1.2.2.1.1.7|integer|7
+1.3.6.1.2.1.2.2.1.7.7|integer|1
+1.3.6.1.2.1.2.2.1.8.7|integer|1
+`
+	if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+	defsPath := filepath.Join(dir, "traps.yaml")
+	defsYAML := `onSet:
+  - oid: 1.3.6.1.2.1.2.2.1.7
+    value: "1"
+    trap: 1.3.6.1.6.3.1.1.5.4
+  - oid: 1.3.6.1.2.1.2.2.1.7
+    value: "2"
+    trap: 1.3.6.1.6.3.1.1.5.3
+    varbinds:
+      - 1.3.6.1.2.1.2.2.1.1.$index|integer|$index
+      - 1.3.6.1.2.1.2.2.1.7.$index|integer|$value
+      - 1.3.6.1.2.1.2.2.1.8.$index||${oid:1.3.6.1.2.1.2.2.1.8.$index}
+`
+	if err := os.WriteFile(defsPath, []byte(defsYAML), 0o644); err != nil {
+		t.Fatalf("write trap definitions: %v", err)
+	}
+	defs, err := traps.LoadTrapDefs(defsPath)
+	if err != nil {
+		t.Fatalf("load trap definitions: %v", err)
+	}
+
+	trapConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen trap receiver: %v", err)
+	}
+	defer trapConn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetTrapConfig(traps.Config{
+		Targets:  []string{trapConn.LocalAddr().String()},
+		Version:  "v2c",
+		SetTraps: defs.OnSet,
+		Timeout:  time.Second,
+	}); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+	if err := sim.SetWritableOIDs([]string{"1.3.6.1.2.1.2.2.1.7"}); err != nil {
+		t.Fatalf("set writable OIDs: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Version:   gosnmp.Version2c,
+		Community: "private",
+		Timeout:   time.Second,
+		Retries:   0,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	resp, err := client.Set([]gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.2.2.1.7.7", Type: gosnmp.Integer, Value: 2}})
+	if err != nil || resp.Error != gosnmp.NoError {
+		t.Fatalf("set ifAdminStatus.7: %v (response %+v)", err, resp)
+	}
+
+	_ = trapConn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := trapConn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("read trap: %v", err)
+	}
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	pkt, err := decoder.SnmpDecodePacket(buf[:n])
+	if err != nil {
+		t.Fatalf("decode trap: %v", err)
+	}
+
+	got := make(map[string]gosnmp.SnmpPDU, len(pkt.Variables))
+	for _, v := range pkt.Variables {
+		got[v.Name] = v
+	}
+	if trapOID := got[".1.3.6.1.6.3.1.1.4.1.0"]; trapOID.Value != ".1.3.6.1.6.3.1.1.5.3" {
+		t.Fatalf("snmpTrapOID = %v, want linkDown", trapOID.Value)
+	}
+	want := map[string]int64{
+		".1.3.6.1.2.1.2.2.1.1.7": 7,
+		".1.3.6.1.2.1.2.2.1.7.7": 2,
+		".1.3.6.1.2.1.2.2.1.8.7": 1,
+	}
+	for name, value := range want {
+		v, ok := got[name]
+		if !ok || v.Type != gosnmp.Integer || gosnmp.ToBigInt(v.Value).Int64() != value {
+			t.Fatalf("varbind %s = %+v, want integer %d (all: %+v)", name, v, value, pkt.Variables)
+		}
+	}
+	if _, ok := got[".1.3.6.1.4.1.55555.3.1.0"]; ok {
+		t.Fatal("expected the definition to replace the generic set-event trap")
+	}
+
+	// A rejected SET changes nothing and so sends no trap
+	resp, err = client.Set([]gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.2.2.1.7.7", Type: gosnmp.OctetString, Value: []byte("2")}})
+	if err != nil || resp.Error != gosnmp.WrongType {
+		t.Fatalf("set ifAdminStatus.7 to a string: %v (response %+v), want wrongType", err, resp)
+	}
+	_ = trapConn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, _, err := trapConn.ReadFromUDP(buf); err == nil {
+		t.Fatalf("rejected SET sent a trap of %d bytes", n)
+	}
+}
+
+func TestFlapVariationTogglesOperStatusAndSendsLinkDown(t *testing.T) {
+	dir := t.TempDir()
+	snmprec := filepath.Join(dir, "switch.snmprec")
+	content := `1.3.6.1.2.1.2.2.1.1.4|integer|4
+1.3.6.1.2.1.2.2.1.7.4|integer|1
+1.3.6.1.2.1.2.2.1.8.4|integer|1
+`
+	if err := os.WriteFile(snmprec, []byte(content), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+	variations := filepath.Join(dir, "variations.yaml")
+	yaml := `bindings:
+  - prefix: "1.3.6.1.2.1.2.2.1.8"
+    variations:
+      - type: flap
+        up: 700ms
+        down: 1m
+        indices: [4]
+        traps: true
+`
+	if err := os.WriteFile(variations, []byte(yaml), 0o644); err != nil {
+		t.Fatalf("write variations: %v", err)
+	}
+
+	trapConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen trap receiver: %v", err)
+	}
+	defer trapConn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resolve udp addr: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", variations, v3.Config{Enabled: false})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	if err := sim.SetTrapConfig(traps.Config{
+		Targets: []string{trapConn.LocalAddr().String()},
+		Version: "v2c",
+		Timeout: time.Second,
+	}); err != nil {
+		t.Fatalf("set trap config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+
+	time.Sleep(600 * time.Millisecond)
+
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Version:   gosnmp.Version2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Retries:   1,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Conn.Close()
+	operStatus := func() int64 {
+		t.Helper()
+		pkt, err := client.Get([]string{"1.3.6.1.2.1.2.2.1.8.4"})
+		if err != nil || len(pkt.Variables) != 1 {
+			t.Fatalf("get ifOperStatus: %v", err)
+		}
+		return gosnmp.ToBigInt(pkt.Variables[0].Value).Int64()
+	}
+
+	if got := operStatus(); got != 1 {
+		t.Fatalf("ifOperStatus before the down window = %d, want up(1)", got)
+	}
+	time.Sleep(time.Second)
+	if got := operStatus(); got != 2 {
+		t.Fatalf("ifOperStatus in the down window = %d, want down(2)", got)
+	}
+
+	_ = trapConn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := trapConn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("read trap: %v", err)
+	}
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	pkt, err := decoder.SnmpDecodePacket(buf[:n])
+	if err != nil {
+		t.Fatalf("decode trap: %v", err)
+	}
+
+	got := make(map[string]gosnmp.SnmpPDU, len(pkt.Variables))
+	for _, v := range pkt.Variables {
+		got[v.Name] = v
+	}
+	if trapOID := got[".1.3.6.1.6.3.1.1.4.1.0"]; trapOID.Value != "."+traps.TrapOIDLinkDown {
+		t.Fatalf("snmpTrapOID = %v, want linkDown", trapOID.Value)
+	}
+	want := map[string]int64{
+		".1.3.6.1.2.1.2.2.1.1.4": 4,
+		".1.3.6.1.2.1.2.2.1.7.4": 1,
+		".1.3.6.1.2.1.2.2.1.8.4": 2,
+	}
+	for name, value := range want {
+		v, ok := got[name]
+		if !ok || v.Type != gosnmp.Integer || gosnmp.ToBigInt(v.Value).Int64() != value {
+			t.Fatalf("varbind %s = %+v, want integer %d (all: %+v)", name, v, value, pkt.Variables)
+		}
+	}
+}
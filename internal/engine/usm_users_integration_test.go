@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestAgentAuthenticatesEachConfiguredUser(t *testing.T) {
+	dir := t.TempDir()
+	snmprec := filepath.Join(dir, "device.snmprec")
+	if err := os.WriteFile(snmprec, []byte("1.3.6.1.4.1.55555.1.0|4|multi-user\n"), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	cfg := v3.Config{
+		Enabled:  true,
+		Username: "simuser",
+		Auth:     v3.AuthSHA1,
+		AuthKey:  "authpass123",
+		Priv:     v3.PrivAES128,
+		PrivKey:  "privpass123",
+		Users: []v3.User{
+			{Name: "rouser", Auth: v3.AuthSHA256, AuthKey: "ro-auth-pass"},
+			{Name: "rwuser", Auth: v3.AuthSHA512, AuthKey: "rw-auth-pass", Priv: v3.PrivAES256, PrivKey: "rw-priv-pass"},
+		},
+	}
+	sim, err := NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", cfg)
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sim.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	time.Sleep(600 * time.Millisecond)
+
+	get := func(flags gosnmp.SnmpV3MsgFlags, usm *gosnmp.UsmSecurityParameters) (*gosnmp.SnmpPacket, error) {
+		t.Helper()
+		client := &gosnmp.GoSNMP{
+			Target:             "127.0.0.1",
+			Port:               uint16(port),
+			Version:            gosnmp.Version3,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			MsgFlags:           flags,
+			SecurityParameters: usm,
+			Timeout:            time.Second,
+		}
+		if err := client.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer client.Conn.Close()
+		return client.Get([]string{"1.3.6.1.4.1.55555.1.0"})
+	}
+
+	for _, tc := range []struct {
+		name  string
+		flags gosnmp.SnmpV3MsgFlags
+		usm   *gosnmp.UsmSecurityParameters
+	}{
+		{"default user", gosnmp.AuthPriv, &gosnmp.UsmSecurityParameters{UserName: "simuser",
+			AuthenticationProtocol: gosnmp.SHA, AuthenticationPassphrase: "authpass123",
+			PrivacyProtocol: gosnmp.AES, PrivacyPassphrase: "privpass123"}},
+		{"authNoPriv user", gosnmp.AuthNoPriv, &gosnmp.UsmSecurityParameters{UserName: "rouser",
+			AuthenticationProtocol: gosnmp.SHA256, AuthenticationPassphrase: "ro-auth-pass"}},
+		{"authPriv user", gosnmp.AuthPriv, &gosnmp.UsmSecurityParameters{UserName: "rwuser",
+			AuthenticationProtocol: gosnmp.SHA512, AuthenticationPassphrase: "rw-auth-pass",
+			PrivacyProtocol: gosnmp.AES256, PrivacyPassphrase: "rw-priv-pass"}},
+	} {
+		pkt, err := get(tc.flags, tc.usm)
+		if err != nil {
+			t.Fatalf("%s: get: %v", tc.name, err)
+		}
+		if len(pkt.Variables) != 1 || string(pkt.Variables[0].Value.([]byte)) != "multi-user" {
+			t.Fatalf("%s: varbinds = %+v, want the dataset value", tc.name, pkt.Variables)
+		}
+	}
+
+	// Another user's passphrase does not authenticate rwuser
+	if _, err := get(gosnmp.AuthNoPriv, &gosnmp.UsmSecurityParameters{UserName: "rwuser",
+		AuthenticationProtocol: gosnmp.SHA512, AuthenticationPassphrase: "ro-auth-pass"}); err == nil {
+		t.Fatal("rwuser with rouser's passphrase was answered")
+	}
+	// An unknown user is reported as such, even when its PDU is encrypted
+	for _, flags := range []gosnmp.SnmpV3MsgFlags{gosnmp.AuthNoPriv, gosnmp.AuthPriv} {
+		if _, err := get(flags, &gosnmp.UsmSecurityParameters{UserName: "intruder",
+			AuthenticationProtocol: gosnmp.SHA, AuthenticationPassphrase: "authpass123",
+			PrivacyProtocol: gosnmp.AES, PrivacyPassphrase: "privpass123"}); err == nil || !strings.Contains(err.Error(), "unknown username") {
+			t.Fatalf("unknown user at %v: err = %v, want an unknown user name report", flags, err)
+		}
+	}
+}
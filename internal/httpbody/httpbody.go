@@ -0,0 +1,77 @@
+// Package httpbody caps request body sizes and checks their media types for
+// the HTTP API servers.
+package httpbody
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBytes is the default request body limit (1 MiB).
+const DefaultMaxBytes = 1 << 20
+
+// Limit caps r's body at maxBytes. A request that declares a larger
+// Content-Length is answered with 413 and Limit returns false; streamed bodies
+// fail while decoding once they cross the limit. maxBytes <= 0 disables it.
+func Limit(w http.ResponseWriter, r *http.Request, maxBytes int64) bool {
+	if maxBytes <= 0 {
+		return true
+	}
+	if r.ContentLength > maxBytes {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	return true
+}
+
+// Handler applies Limit to every request before calling next.
+func Handler(next http.Handler, maxBytes int64) http.Handler {
+	if maxBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Limit(w, r, maxBytes) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// ErrUnsupportedMediaType is wrapped by CheckContentType errors.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// CheckContentType returns an error wrapping ErrUnsupportedMediaType unless
+// r's Content-Type is one of mediaTypes, ignoring parameters such as
+// charset. A request without Content-Type passes, so clients that never set
+// it keep working.
+func CheckContentType(r *http.Request, mediaTypes ...string) error {
+	value := strings.TrimSpace(r.Header.Get("Content-Type"))
+	if value == "" {
+		return nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(value); err == nil {
+		for _, allowed := range mediaTypes {
+			if mediaType == allowed {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w %q (want %s)", ErrUnsupportedMediaType, value, strings.Join(mediaTypes, " or "))
+}
+
+// ErrorStatus maps a body read or decode error to its HTTP status: 413 when
+// the body hit the size limit, 415 for a CheckContentType error, 400
+// otherwise.
+func ErrorStatus(err error) int {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, ErrUnsupportedMediaType) {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
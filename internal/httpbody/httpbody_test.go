@@ -0,0 +1,62 @@
+package httpbody
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerRejectsOversizedBodies(t *testing.T) {
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			http.Error(w, err.Error(), ErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}), 16)
+
+	for name, tc := range map[string]struct {
+		body          string
+		contentLength int64
+		want          int
+	}{
+		"small":    {`{"a":"b"}`, 9, http.StatusOK},
+		"declared": {`{"a":"` + strings.Repeat("x", 32) + `"}`, 40, http.StatusRequestEntityTooLarge},
+		"streamed": {`{"a":"` + strings.Repeat("x", 32) + `"}`, -1, http.StatusRequestEntityTooLarge},
+		"invalid":  {`{`, 1, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+		req.ContentLength = tc.contentLength
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("%s: status = %d, want %d", name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	for contentType, want := range map[string]int{
+		"":                                  http.StatusOK,
+		"application/json":                  http.StatusOK,
+		"application/json; charset=utf-8":   http.StatusOK,
+		"application/x-www-form-urlencoded": http.StatusUnsupportedMediaType,
+		"text/plain":                        http.StatusUnsupportedMediaType,
+		"not a media type;;":                http.StatusUnsupportedMediaType,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		got := http.StatusOK
+		if err := CheckContentType(req, "application/json"); err != nil {
+			got = ErrorStatus(err)
+		}
+		if got != want {
+			t.Errorf("Content-Type %q: status = %d, want %d", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package httpgzip compresses responses of the HTTP API servers for clients
+// that accept gzip.
+package httpgzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMinSize is the smallest response body compressed by default.
+// Smaller bodies gain little and cost a gzip header and CPU.
+const DefaultMinSize = 1024
+
+// Options configures Handler.
+type Options struct {
+	// MinSize is the smallest body that is compressed; 0 means DefaultMinSize.
+	MinSize int
+	// Skip lists exact paths that are never compressed, such as /metrics,
+	// which Prometheus clients negotiate themselves.
+	Skip []string
+}
+
+// Handler gzips responses of next when the request carries
+// Accept-Encoding: gzip and the body reaches the minimum size. Bodies are
+// buffered up to the threshold, so small responses go out unchanged and with
+// their Content-Length. Responses that already set Content-Encoding are
+// passed through.
+func Handler(next http.Handler, opts Options) http.Handler {
+	minSize := opts.MinSize
+	if minSize <= 0 {
+		minSize = DefaultMinSize
+	}
+	skip := make(map[string]bool, len(opts.Skip))
+	for _, path := range opts.Skip {
+		skip[path] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if skip[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		// Byte ranges index the uncompressed file, so range responses stay plain
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &responseWriter{ResponseWriter: w, minSize: minSize, status: http.StatusOK}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// responseWriter holds the body back until it either reaches minSize, and
+// is then compressed, or the handler finishes, and it is sent as is.
+type responseWriter struct {
+	http.ResponseWriter
+	minSize     int
+	status      int
+	wroteHeader bool // the handler called WriteHeader
+	decided     bool // headers went out; gz says whether the body is compressed
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.wroteHeader || rw.decided {
+		return
+	}
+	rw.wroteHeader = true
+	rw.status = status
+	if !bodyAllowed(status) || rw.Header().Get("Content-Encoding") != "" {
+		rw.passThrough()
+	}
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.decided {
+		if rw.gz != nil {
+			return rw.gz.Write(p)
+		}
+		return rw.ResponseWriter.Write(p)
+	}
+	rw.buf.Write(p)
+	if rw.buf.Len() >= rw.minSize {
+		if err := rw.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// startGzip sends compressed headers and the buffered body
+func (rw *responseWriter) startGzip() error {
+	rw.decided = true
+	h := rw.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(rw.buf.Bytes()))
+	}
+	rw.ResponseWriter.WriteHeader(rw.status)
+	rw.gz = gzip.NewWriter(rw.ResponseWriter)
+	_, err := rw.gz.Write(rw.buf.Bytes())
+	rw.buf.Reset()
+	return err
+}
+
+// passThrough sends the headers and any buffered body uncompressed
+func (rw *responseWriter) passThrough() {
+	rw.decided = true
+	rw.ResponseWriter.WriteHeader(rw.status)
+	if rw.buf.Len() > 0 {
+		_, _ = rw.ResponseWriter.Write(rw.buf.Bytes())
+		rw.buf.Reset()
+	}
+}
+
+// Close finishes the response once the handler returns
+func (rw *responseWriter) Close() {
+	if !rw.decided {
+		if !rw.wroteHeader && rw.buf.Len() == 0 {
+			return // nothing written; net/http sends its implicit 200
+		}
+		rw.passThrough()
+	}
+	if rw.gz != nil {
+		_ = rw.gz.Close()
+	}
+}
+
+// Flush sends what is buffered so streaming handlers keep working. A body
+// still below the threshold is compressed from here on regardless, since the
+// handler is streaming it.
+func (rw *responseWriter) Flush() {
+	if !rw.decided {
+		if !rw.wroteHeader {
+			rw.WriteHeader(http.StatusOK)
+		}
+		if !rw.decided {
+			_ = rw.startGzip()
+		}
+	}
+	if rw.gz != nil {
+		_ = rw.gz.Flush()
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,76 @@
+package httpgzip
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerCompressesLargeResponses(t *testing.T) {
+	large := strings.Repeat("snmpsim ", 512)
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.URL.Path {
+		case "/small":
+			io.WriteString(w, "ok")
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "br")
+			io.WriteString(w, large)
+		default:
+			io.WriteString(w, large)
+		}
+	}), Options{Skip: []string{"/metrics"}})
+
+	for name, tc := range map[string]struct {
+		path, accept string
+		wantGzip     bool
+	}{
+		"large":           {"/large", "gzip, deflate", true},
+		"no accept":       {"/large", "", false},
+		"gzip refused":    {"/large", "gzip;q=0, deflate", false},
+		"small":           {"/small", "gzip", false},
+		"skipped":         {"/metrics", "gzip", false},
+		"already encoded": {"/encoded", "gzip", false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept-Encoding", tc.accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding") == "gzip"; got != tc.wantGzip {
+			t.Fatalf("%s: gzip = %v, want %v", name, got, tc.wantGzip)
+		}
+		if !tc.wantGzip {
+			continue
+		}
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("%s: gzip reader: %v", name, err)
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil || string(body) != large {
+			t.Fatalf("%s: decoded body mismatch (%d bytes, err %v)", name, len(body), err)
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s: Vary = %q, want Accept-Encoding", name, rec.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestHandlerKeepsStatusOfCompressedErrors(t *testing.T) {
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, strings.Repeat("x", 2*DefaultMinSize), http.StatusBadRequest)
+	}), Options{})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("status = %d, encoding = %q; want 400 gzip", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,26 @@
+// Package httpmethod answers OPTIONS and rejects disallowed methods for the
+// HTTP API servers, with the Allow header RFC 9110 asks for.
+package httpmethod
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Allow reports whether r uses one of methods. Otherwise it answers the
+// request itself and returns false: OPTIONS gets 204 and any other method
+// 405, both with an Allow header listing methods and OPTIONS.
+func Allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(append(methods[:len(methods):len(methods)], http.MethodOptions), ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
@@ -0,0 +1,32 @@
+package httpmethod
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllow(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Allow(w, r, http.MethodGet, http.MethodPost) {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for method, want := range map[string]int{
+		http.MethodGet:     http.StatusOK,
+		http.MethodPost:    http.StatusOK,
+		http.MethodDelete:  http.StatusMethodNotAllowed,
+		http.MethodOptions: http.StatusNoContent,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, "/", nil))
+		if rec.Code != want {
+			t.Fatalf("%s: status = %d, want %d", method, rec.Code, want)
+		}
+		if want != http.StatusOK && rec.Header().Get("Allow") != "GET, POST, OPTIONS" {
+			t.Fatalf("%s: Allow = %q, want %q", method, rec.Header().Get("Allow"), "GET, POST, OPTIONS")
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package httptimeout sets connection timeouts on the HTTP API servers so
+// slow or stalled clients cannot hold connections open indefinitely.
+package httptimeout
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Default server timeouts. Read and write leave room for large state
+// restores and snapshots; idle bounds keep-alive connections.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 60 * time.Second
+	DefaultWriteTimeout      = 120 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+)
+
+// Timeouts mirrors the timeout fields of http.Server. Zero disables a
+// timeout, except that ReadHeader then falls back to Read as in net/http.
+type Timeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// Defaults returns the default server timeouts
+func Defaults() Timeouts {
+	return Timeouts{
+		ReadHeader: DefaultReadHeaderTimeout,
+		Read:       DefaultReadTimeout,
+		Write:      DefaultWriteTimeout,
+		Idle:       DefaultIdleTimeout,
+	}
+}
+
+// Validate rejects negative timeouts
+func (t Timeouts) Validate() error {
+	for _, f := range []struct {
+		name string
+		d    time.Duration
+	}{{"read header", t.ReadHeader}, {"read", t.Read}, {"write", t.Write}, {"idle", t.Idle}} {
+		if f.d < 0 {
+			return fmt.Errorf("%s timeout must not be negative, got %s", f.name, f.d)
+		}
+	}
+	return nil
+}
+
+// Apply sets the timeouts on srv and returns it
+func (t Timeouts) Apply(srv *http.Server) *http.Server {
+	srv.ReadHeaderTimeout = t.ReadHeader
+	srv.ReadTimeout = t.Read
+	srv.WriteTimeout = t.Write
+	srv.IdleTimeout = t.Idle
+	return srv
+}
@@ -0,0 +1,25 @@
+package httptimeout
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestApplySetsServerTimeouts(t *testing.T) {
+	srv := Defaults().Apply(&http.Server{})
+	if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout || srv.ReadTimeout != DefaultReadTimeout ||
+		srv.WriteTimeout != DefaultWriteTimeout || srv.IdleTimeout != DefaultIdleTimeout {
+		t.Fatalf("unexpected timeouts: header=%s read=%s write=%s idle=%s",
+			srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
+
+func TestValidateRejectsNegativeTimeouts(t *testing.T) {
+	if err := Defaults().Validate(); err != nil {
+		t.Fatalf("defaults invalid: %v", err)
+	}
+	if err := (Timeouts{Write: -time.Second}).Validate(); err == nil {
+		t.Fatal("expected error for negative write timeout")
+	}
+}
@@ -0,0 +1,111 @@
+package recorder
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
+)
+
+// Target is a single agent to record.
+type Target struct {
+	Host string
+	Port uint16
+}
+
+func (t Target) String() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+}
+
+// TargetRecording holds the outcome of recording one target.
+type TargetRecording struct {
+	Target  Target
+	Entries []snmprecfmt.Entry
+	Err     error
+}
+
+// ParseTargets parses "host" or "host:port" specs, using defaultPort when no
+// port is given. IPv6 literals with a port must be bracketed ("[::1]:161").
+func ParseTargets(specs []string, defaultPort uint16) ([]Target, error) {
+	targets := make([]Target, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		host, portText, err := net.SplitHostPort(spec)
+		if err != nil {
+			targets = append(targets, Target{Host: strings.Trim(spec, "[]"), Port: defaultPort})
+			continue
+		}
+		port, err := strconv.ParseUint(portText, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid port in target %q", spec)
+		}
+		targets = append(targets, Target{Host: host, Port: uint16(port)})
+	}
+	return targets, nil
+}
+
+// ReadTargetsFile reads one target spec per line, skipping blanks and # comments.
+func ReadTargetsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		specs = append(specs, line)
+	}
+	return specs, nil
+}
+
+// RecordAll records each target in turn with the shared options. A failure on
+// one target is reported in its TargetRecording and does not stop the others.
+func RecordAll(opts Options, targets []Target) []TargetRecording {
+	results := make([]TargetRecording, 0, len(targets))
+	for _, target := range targets {
+		targetOpts := opts
+		targetOpts.Target = target.Host
+		targetOpts.Port = target.Port
+
+		entries, err := Record(targetOpts)
+		results = append(results, TargetRecording{Target: target, Entries: entries, Err: err})
+	}
+	return results
+}
+
+// MergeDeviceMapped combines per-target recordings into one device-mapped
+// dataset by suffixing every value with "@<label>", the device routing syntax
+// understood by store.ParseDeviceOID. labels[i] names recordings[i]; failed
+// recordings are skipped.
+func MergeDeviceMapped(recordings []TargetRecording, labels []string) ([]snmprecfmt.Entry, error) {
+	if len(labels) != len(recordings) {
+		return nil, fmt.Errorf("got %d labels for %d recordings", len(labels), len(recordings))
+	}
+
+	var merged []snmprecfmt.Entry
+	for i, rec := range recordings {
+		if rec.Err != nil {
+			continue
+		}
+		label := strings.TrimSpace(labels[i])
+		if label == "" || strings.ContainsAny(label, "@|") {
+			return nil, fmt.Errorf("invalid device label %q for %s", labels[i], rec.Target)
+		}
+		for _, entry := range rec.Entries {
+			entry.Value = entry.Value + "@" + label
+			merged = append(merged, entry)
+		}
+	}
+	snmprecfmt.SortEntries(merged)
+	return merged, nil
+}
@@ -0,0 +1,95 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+)
+
+func TestRecordAllMergesDeviceMappedDataset(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var targets []Target
+	for i, name := range []string{"alpha", "beta"} {
+		source := filepath.Join(tmpDir, name+".snmprec")
+		content := fmt.Sprintf(`1.3.6.1.2.1.1.1.0|octetstring|Mock Device
+1.3.6.1.4.1.55555.1.0|octetstring|%s
+1.3.6.1.4.1.55555.2.0|octetstring|ops@%s.example.com
+1.3.6.1.4.1.55555.3.0|integer|%d
+`, name, name, i+10)
+		if err := os.WriteFile(source, []byte(content), 0o644); err != nil {
+			t.Fatalf("write source file: %v", err)
+		}
+		port := freeUDPPort(t)
+		startSimulator(t, source, port)
+		targets = append(targets, Target{Host: "127.0.0.1", Port: uint16(port)})
+	}
+
+	recordings := RecordAll(Options{
+		Community: "public",
+		Roots:     []string{"1.3.6.1.4.1.55555"},
+		Timeout:   1500 * time.Millisecond,
+	}, targets)
+	for _, rec := range recordings {
+		if rec.Err != nil {
+			t.Fatalf("record %s: %v", rec.Target, rec.Err)
+		}
+		if len(rec.Entries) != 3 {
+			t.Fatalf("record %s: got %d entries, want 3", rec.Target, len(rec.Entries))
+		}
+	}
+
+	merged, err := MergeDeviceMapped(recordings, []string{"device-alpha", "device-beta"})
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	mergedPath := filepath.Join(tmpDir, "rack.snmprec")
+	if err := snmprecfmt.WriteFile(mergedPath, merged); err != nil {
+		t.Fatalf("write merged file: %v", err)
+	}
+
+	mapping, err := store.LoadDeviceMappings(mergedPath)
+	if err != nil {
+		t.Fatalf("load merged file: %v", err)
+	}
+	if total, _, devices, _ := mapping.GetStats(); total != 6 || devices != 6 {
+		t.Fatalf("mapping stats total=%d devices=%d, want 6/6", total, devices)
+	}
+
+	for i, name := range []string{"alpha", "beta"} {
+		device := "device-" + name
+		if got := mapping.GetOID("1.3.6.1.4.1.55555.1.0", 0, device); got == nil || got.Value != name {
+			t.Fatalf("%s name = %+v, want %q", device, got, name)
+		}
+		if got := mapping.GetOID("1.3.6.1.4.1.55555.2.0", 0, device); got == nil || got.Value != "ops@"+name+".example.com" {
+			t.Fatalf("%s contact = %+v", device, got)
+		}
+		if got := mapping.GetOID("1.3.6.1.4.1.55555.3.0", 0, device); got == nil || got.Value != i+10 {
+			t.Fatalf("%s integer = %+v, want %d", device, got, i+10)
+		}
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets([]string{"10.0.0.1", "10.0.0.2:1161", "[::1]:162", "::1"}, 161)
+	if err != nil {
+		t.Fatalf("parse targets: %v", err)
+	}
+	want := []Target{{"10.0.0.1", 161}, {"10.0.0.2", 1161}, {"::1", 162}, {"::1", 161}}
+	if len(targets) != len(want) {
+		t.Fatalf("got %v, want %v", targets, want)
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Fatalf("target %d = %v, want %v", i, targets[i], want[i])
+		}
+	}
+	if _, err := ParseTargets([]string{"host:notaport"}, 161); err == nil {
+		t.Fatal("expected error for invalid port")
+	}
+}
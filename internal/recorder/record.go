@@ -3,6 +3,7 @@ package recorder
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
@@ -26,6 +27,11 @@ type Options struct {
 	MaxOIDs   int
 	RateLimit int
 
+	// Workers is how many roots are walked at once, each over its own
+	// connection. MaxOIDs and RateLimit apply to the recording as a whole.
+	// 0 or 1 walks the roots one after another.
+	Workers int
+
 	Roots   []string
 	Exclude []string
 
@@ -36,26 +42,36 @@ type Options struct {
 	V3AuthKey string
 	V3Priv    string
 	V3PrivKey string
+	V3Context string // contextName of the v3 requests; empty is the default context
 }
 
 func Record(opts Options) ([]snmprecfmt.Entry, error) {
-	client, err := newClient(opts)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := client.Connect(); err != nil {
-		return nil, fmt.Errorf("connect: %w", err)
-	}
-	defer client.Conn.Close()
-
 	roots := opts.Roots
 	if len(roots) == 0 {
 		roots = append([]string(nil), DefaultRoots...)
 	}
+	workers := min(max(opts.Workers, 1), len(roots))
+
+	// a gosnmp client waits for one response at a time, so each worker has
+	// its own
+	clients := make([]*gosnmp.GoSNMP, 0, workers)
+	defer func() {
+		for _, client := range clients {
+			client.Conn.Close()
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		client, err := newClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := client.Connect(); err != nil {
+			return nil, fmt.Errorf("connect: %w", err)
+		}
+		clients = append(clients, client)
+	}
 
-	entries := make(map[string]snmprecfmt.Entry)
-	rootErrors := make([]error, 0)
+	rec := &recording{entries: make(map[string]snmprecfmt.Entry), maxOIDs: opts.MaxOIDs}
 
 	var throttle <-chan time.Time
 	if opts.RateLimit > 0 {
@@ -68,31 +84,90 @@ func Record(opts Options) ([]snmprecfmt.Entry, error) {
 		throttle = ticker.C
 	}
 
-	for _, root := range roots {
-		if opts.MaxOIDs > 0 && len(entries) >= opts.MaxOIDs {
+	// rootErrors[i] is written only by the worker walking roots[i]
+	rootErrors := make([]error, len(roots))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *gosnmp.GoSNMP) {
+			defer wg.Done()
+			for i := range next {
+				if err := walkRoot(client, strings.TrimPrefix(roots[i], "."), opts.Exclude, rec, throttle); err != nil {
+					rootErrors[i] = fmt.Errorf("root %s: %w", roots[i], err)
+				}
+			}
+		}(client)
+	}
+	for i := range roots {
+		if rec.full() {
 			break
 		}
-		if err := walkRoot(client, strings.TrimPrefix(root, "."), opts.Exclude, opts.MaxOIDs, entries, throttle); err != nil {
-			rootErrors = append(rootErrors, fmt.Errorf("root %s: %w", root, err))
-		}
+		next <- i
 	}
+	close(next)
+	wg.Wait()
 
-	if len(entries) == 0 && len(rootErrors) > 0 {
-		return nil, rootErrors[0]
+	if len(rec.entries) == 0 {
+		for _, err := range rootErrors {
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	out := make([]snmprecfmt.Entry, 0, len(entries))
-	for _, entry := range entries {
+	out := make([]snmprecfmt.Entry, 0, len(rec.entries))
+	for _, entry := range rec.entries {
 		out = append(out, entry)
 	}
 	snmprecfmt.SortEntries(out)
 	return out, nil
 }
 
-func walkRoot(client *gosnmp.GoSNMP, root string, excludes []string, maxOIDs int, entries map[string]snmprecfmt.Entry, throttle <-chan time.Time) error {
+// recording collects the entries of all roots, shared by the workers
+type recording struct {
+	mu      sync.Mutex
+	entries map[string]snmprecfmt.Entry
+	maxOIDs int
+}
+
+// full reports whether MaxOIDs entries have been recorded
+func (r *recording) full() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fullLocked()
+}
+
+func (r *recording) fullLocked() bool {
+	return r.maxOIDs > 0 && len(r.entries) >= r.maxOIDs
+}
+
+func (r *recording) has(oid string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.entries[oid]
+	return ok
+}
+
+// add records entry unless it is already there. It returns false, recording
+// nothing, once the recording is full.
+func (r *recording) add(entry snmprecfmt.Entry) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[entry.OID]; ok {
+		return true
+	}
+	if r.fullLocked() {
+		return false
+	}
+	r.entries[entry.OID] = entry
+	return true
+}
+
+func walkRoot(client *gosnmp.GoSNMP, root string, excludes []string, rec *recording, throttle <-chan time.Time) error {
 	current := root
 	for {
-		if maxOIDs > 0 && len(entries) >= maxOIDs {
+		if rec.full() {
 			return nil
 		}
 
@@ -122,7 +197,7 @@ func walkRoot(client *gosnmp.GoSNMP, root string, excludes []string, maxOIDs int
 		if shouldExclude(oid, excludes) {
 			continue
 		}
-		if _, exists := entries[oid]; exists {
+		if rec.has(oid) {
 			continue
 		}
 
@@ -130,7 +205,9 @@ func walkRoot(client *gosnmp.GoSNMP, root string, excludes []string, maxOIDs int
 		if err != nil {
 			return fmt.Errorf("convert %s: %w", oid, err)
 		}
-		entries[oid] = entry
+		if !rec.add(entry) {
+			return nil
+		}
 	}
 }
 
@@ -156,6 +233,10 @@ func newClient(opts Options) (*gosnmp.GoSNMP, error) {
 		return nil, fmt.Errorf("use either community (v1/v2c) or v3 flags, not both")
 	}
 
+	if opts.V3Context != "" && opts.V3User == "" {
+		return nil, fmt.Errorf("--v3-context needs --v3-user")
+	}
+
 	if opts.V3User != "" {
 		usm := &gosnmp.UsmSecurityParameters{UserName: opts.V3User}
 		flags := gosnmp.NoAuthNoPriv
@@ -192,6 +273,7 @@ func newClient(opts Options) (*gosnmp.GoSNMP, error) {
 			SecurityModel:      gosnmp.UserSecurityModel,
 			MsgFlags:           flags,
 			SecurityParameters: usm,
+			ContextName:        opts.V3Context,
 		}, nil
 	}
 
@@ -73,7 +73,7 @@ func TestRecordReplayDiffIdentical(t *testing.T) {
 		t.Fatalf("write second recording: %v", err)
 	}
 
-	diffResult, err := walkdiff.CompareFiles(firstRecord, secondRecord)
+	diffResult, err := walkdiff.CompareFiles(firstRecord, secondRecord, walkdiff.Options{})
 	if err != nil {
 		t.Fatalf("diff files: %v", err)
 	}
@@ -134,3 +134,195 @@ func startSimulator(t *testing.T, snmprecPath string, port int) {
 	}
 	t.Fatalf("simulator on port %d did not become ready", port)
 }
+
+func TestRecordReplayPreservesStringFormatting(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "source.snmprec")
+	firstRecord := filepath.Join(tmpDir, "recorded.snmprec")
+	secondRecord := filepath.Join(tmpDir, "replayed.snmprec")
+
+	want := map[string]string{
+		"1.3.6.1.4.1.55555.5.1.0": "ops@example.com",
+		"1.3.6.1.4.1.55555.5.2.0": " edge-01\t",
+		"1.3.6.1.4.1.55555.5.3.0": "rack 4|row #2",
+		"1.3.6.1.4.1.55555.5.4.0": "plain",
+		"1.3.6.1.4.1.55555.5.5.0": "line one\nline two",
+	}
+	source := []snmprecfmt.Entry{
+		{OID: "1.3.6.1.2.1.1.1.0", Type: "octetstring", Value: "Mock Device"},
+		{OID: "1.3.6.1.4.1.55555.5.6.0", Type: "integer", Value: "00042"},
+	}
+	for oid, value := range want {
+		source = append(source, snmprecfmt.Entry{OID: oid, Type: "octetstring", Value: value})
+	}
+	if err := snmprecfmt.WriteFile(sourceFile, snmprecfmt.PreserveFormatting(source)); err != nil {
+		t.Fatalf("write source file: %v", err)
+	}
+
+	record := func(port int) []snmprecfmt.Entry {
+		entries, err := Record(Options{
+			Target:    "127.0.0.1",
+			Port:      uint16(port),
+			Community: "public",
+			Roots:     []string{"1.3.6.1.4.1.55555.5"},
+			Timeout:   1500 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		return entries
+	}
+
+	portA := freeUDPPort(t)
+	startSimulator(t, sourceFile, portA)
+	entriesA := record(portA)
+	if len(entriesA) != len(want)+1 {
+		t.Fatalf("recorded %d entries, want %d: %+v", len(entriesA), len(want)+1, entriesA)
+	}
+	for _, entry := range entriesA {
+		if value, ok := want[entry.OID]; ok && entry.Value != value {
+			t.Fatalf("recorded %s = %q, want %q", entry.OID, entry.Value, value)
+		}
+	}
+	if err := snmprecfmt.WriteFile(firstRecord, snmprecfmt.PreserveFormatting(entriesA)); err != nil {
+		t.Fatalf("write first recording: %v", err)
+	}
+
+	portB := freeUDPPort(t)
+	startSimulator(t, firstRecord, portB)
+	if err := snmprecfmt.WriteFile(secondRecord, snmprecfmt.PreserveFormatting(record(portB))); err != nil {
+		t.Fatalf("write second recording: %v", err)
+	}
+
+	diffResult, err := walkdiff.CompareFiles(firstRecord, secondRecord, walkdiff.Options{})
+	if err != nil {
+		t.Fatalf("diff files: %v", err)
+	}
+	if !diffResult.Identical() {
+		t.Fatalf("expected identical recordings, found differences: %+v", diffResult.Diffs)
+	}
+
+	fromFile, err := snmprecfmt.ReadFile(firstRecord)
+	if err != nil {
+		t.Fatalf("read first recording: %v", err)
+	}
+	if diff := walkdiff.CompareEntries(entriesA, fromFile, walkdiff.Options{}); !diff.Identical() {
+		t.Fatalf("written recording differs from the recorded values: %+v", diff.Diffs)
+	}
+}
+
+func TestRecordReplayKeepsUnsigned32Type(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "source.snmprec")
+	recorded := filepath.Join(tmpDir, "recorded.snmprec")
+
+	content := `1.3.6.1.2.1.1.1.0|octetstring|Mock Device
+1.3.6.1.4.1.55555.8.1.0|unsigned32|4000000000
+1.3.6.1.4.1.55555.8.2.0|gauge32|17
+`
+	if err := os.WriteFile(sourceFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("write source file: %v", err)
+	}
+
+	record := func(path string) []snmprecfmt.Entry {
+		port := freeUDPPort(t)
+		startSimulator(t, path, port)
+		entries, err := Record(Options{
+			Target:    "127.0.0.1",
+			Port:      uint16(port),
+			Community: "public",
+			Roots:     []string{"1.3.6.1.4.1.55555.8"},
+			Timeout:   1500 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("record %s: %v", path, err)
+		}
+		return entries
+	}
+
+	want := []snmprecfmt.Entry{
+		{OID: "1.3.6.1.4.1.55555.8.1.0", Type: "unsigned32", Value: "4000000000"},
+		{OID: "1.3.6.1.4.1.55555.8.2.0", Type: "gauge32", Value: "17"},
+	}
+	first := record(sourceFile)
+	if diff := walkdiff.CompareEntries(want, first, walkdiff.Options{}); !diff.Identical() {
+		t.Fatalf("first recording differs from the source: %+v", diff.Diffs)
+	}
+	if err := snmprecfmt.WriteFile(recorded, first); err != nil {
+		t.Fatalf("write recording: %v", err)
+	}
+	if diff := walkdiff.CompareEntries(want, record(recorded), walkdiff.Options{}); !diff.Identical() {
+		t.Fatalf("replayed recording differs from the source: %+v", diff.Diffs)
+	}
+}
+
+func TestRecordReplayKeepsV3Context(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	defaultFile := write("default.snmprec", "1.3.6.1.4.1.55555.9.1.0|octetstring|default context\n")
+	blueFile := write("blue.snmprec", "1.3.6.1.4.1.55555.9.1.0|octetstring|blue context\n1.3.6.1.4.1.55555.9.2.0|integer|7\n")
+	sourceRoutes := write("source-routes.yaml", `routes:
+  - match:
+      context: ctx-blue
+    action:
+      datasetPath: `+blueFile+`
+`)
+
+	cfg := v3.Config{Enabled: true, Username: "simuser", Auth: v3.AuthSHA1, AuthKey: "authpass123"}
+	record := func(snmprecPath, routeFile, contextName string) []snmprecfmt.Entry {
+		port := freeUDPPort(t)
+		sim, err := engine.NewSimulator("127.0.0.1", port, port+1, 1, snmprecPath, routeFile, "", cfg)
+		if err != nil {
+			t.Fatalf("new simulator: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() { _ = sim.Start(ctx) }()
+		t.Cleanup(func() {
+			cancel()
+			sim.Stop()
+		})
+		time.Sleep(500 * time.Millisecond)
+
+		entries, err := Record(Options{
+			Target:    "127.0.0.1",
+			Port:      uint16(port),
+			Roots:     []string{"1.3.6.1.4.1.55555.9"},
+			Timeout:   1500 * time.Millisecond,
+			V3User:    "simuser",
+			V3Auth:    "SHA1",
+			V3AuthKey: "authpass123",
+			V3Context: contextName,
+		})
+		if err != nil {
+			t.Fatalf("record context %q: %v", contextName, err)
+		}
+		return entries
+	}
+
+	blue := record(defaultFile, sourceRoutes, "ctx-blue")
+	if len(blue) != 2 || blue[0].Value != "blue context" {
+		t.Fatalf("recorded ctx-blue as %+v", blue)
+	}
+	recorded := filepath.Join(tmpDir, "recorded-blue.snmprec")
+	if err := snmprecfmt.WriteContextFile(recorded, "ctx-blue", blue); err != nil {
+		t.Fatalf("write recording: %v", err)
+	}
+	if got, err := snmprecfmt.ReadContext(recorded); err != nil || got != "ctx-blue" {
+		t.Fatalf("ReadContext = %q, %v", got, err)
+	}
+
+	// the recording replays in the context it was made in, and only there
+	replayRoutes := write("replay-routes.yaml", "contextDatasets:\n  - "+recorded+"\n")
+	if diff := walkdiff.CompareEntries(blue, record(defaultFile, replayRoutes, "ctx-blue"), walkdiff.Options{}); !diff.Identical() {
+		t.Fatalf("replayed ctx-blue differs from the recording: %+v", diff.Diffs)
+	}
+	if other := record(defaultFile, replayRoutes, ""); len(other) != 1 || other[0].Value != "default context" {
+		t.Fatalf("default context replayed as %+v", other)
+	}
+}
@@ -0,0 +1,67 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordWorkersWalkRootsConcurrently(t *testing.T) {
+	var content strings.Builder
+	for table := 1; table <= 3; table++ {
+		for row := 1; row <= 4; row++ {
+			fmt.Fprintf(&content, "1.3.6.1.4.1.55555.%d.1.%d|integer|%d\n", table, row, table*10+row)
+		}
+	}
+	sourceFile := filepath.Join(t.TempDir(), "source.snmprec")
+	if err := os.WriteFile(sourceFile, []byte(content.String()), 0o644); err != nil {
+		t.Fatalf("write source file: %v", err)
+	}
+	port := freeUDPPort(t)
+	startSimulator(t, sourceFile, port)
+
+	opts := Options{
+		Target:    "127.0.0.1",
+		Port:      uint16(port),
+		Community: "public",
+		// the last root lies inside the second; its OIDs are recorded once
+		Roots:   []string{"1.3.6.1.4.1.55555.1", "1.3.6.1.4.1.55555.2", "1.3.6.1.4.1.55555.3", "1.3.6.1.4.1.55555.2.1"},
+		Timeout: 1500 * time.Millisecond,
+	}
+	sequential, err := Record(opts)
+	if err != nil {
+		t.Fatalf("record with one worker: %v", err)
+	}
+	if len(sequential) != 12 {
+		t.Fatalf("one worker recorded %d OIDs, want 12", len(sequential))
+	}
+
+	opts.Workers = 3
+	parallel, err := Record(opts)
+	if err != nil {
+		t.Fatalf("record with three workers: %v", err)
+	}
+	if !reflect.DeepEqual(parallel, sequential) {
+		t.Fatalf("three workers recorded %+v, want %+v", parallel, sequential)
+	}
+
+	// MaxOIDs and RateLimit hold across workers, not per worker
+	opts.MaxOIDs = 5
+	opts.RateLimit = 20
+	start := time.Now()
+	limited, err := Record(opts)
+	if err != nil {
+		t.Fatalf("record with limits: %v", err)
+	}
+	if len(limited) != 5 {
+		t.Fatalf("recorded %d OIDs with MaxOIDs 5", len(limited))
+	}
+	// five GETNEXTs at 20 per second take at least 200ms with any number of workers
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("recording 5 OIDs at 20/s took %v", elapsed)
+	}
+}
@@ -1,11 +1,13 @@
 package routing
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 	"sort"
 	"strings"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
 	"gopkg.in/yaml.v3"
 )
 
@@ -27,7 +29,23 @@ type Rule struct {
 }
 
 type Config struct {
-	Routes []Rule `yaml:"routes"`
+	Routes      []Rule      `yaml:"routes"`
+	Communities []Community `yaml:"communities"`
+
+	// ContextDatasets are recordings made in an SNMPv3 context, each routed
+	// by the context its #context line names
+	ContextDatasets []string `yaml:"contextDatasets"`
+}
+
+// Community maps a v1/v2c community to an SNMPv3 context, as a row of the
+// SNMP-COMMUNITY-MIB snmpCommunityTable does for a proxy. Requests with the
+// community route as if they named the context.
+type Community struct {
+	Index           string `yaml:"index"`           // snmpCommunityIndex; defaults to Community
+	Community       string `yaml:"community"`       // snmpCommunityName
+	SecurityName    string `yaml:"securityName"`    // defaults to Community
+	ContextEngineID string `yaml:"contextEngineID"` // hex; empty means the local engine
+	Context         string `yaml:"context"`         // snmpCommunityContextName
 }
 
 type RequestKey struct {
@@ -39,10 +57,17 @@ type RequestKey struct {
 }
 
 type Router struct {
-	routes []Rule
+	routes      []Rule
+	communities []Community
+	contexts    map[string]string // community -> context
 }
 
 func NewRouter(rules []Rule) (*Router, error) {
+	return NewRouterWithCommunities(rules, nil)
+}
+
+// NewRouterWithCommunities is NewRouter with community to context mappings
+func NewRouterWithCommunities(rules []Rule, communities []Community) (*Router, error) {
 	validated := make([]Rule, 0, len(rules))
 	for i, rule := range rules {
 		if strings.TrimSpace(rule.Action.DatasetPath) == "" {
@@ -57,7 +82,45 @@ func NewRouter(rules []Rule) (*Router, error) {
 		return pi > pj
 	})
 
-	return &Router{routes: validated}, nil
+	contexts := make(map[string]string, len(communities))
+	indexes := make(map[string]bool, len(communities))
+	mapped := make([]Community, 0, len(communities))
+	for i, c := range communities {
+		if c.Community == "" {
+			return nil, fmt.Errorf("community %d: community is required", i)
+		}
+		if _, ok := contexts[c.Community]; ok {
+			return nil, fmt.Errorf("community %d: community %q is mapped twice", i, c.Community)
+		}
+		if c.Index == "" {
+			c.Index = c.Community
+		}
+		if len(c.Index) > 32 {
+			return nil, fmt.Errorf("community %d: index %q is longer than 32 characters", i, c.Index)
+		}
+		if indexes[c.Index] {
+			return nil, fmt.Errorf("community %d: index %q is used twice", i, c.Index)
+		}
+		if c.SecurityName == "" {
+			c.SecurityName = c.Community
+		}
+		if _, err := hex.DecodeString(strings.TrimPrefix(c.ContextEngineID, "0x")); err != nil {
+			return nil, fmt.Errorf("community %d: contextEngineID must be hex: %w", i, err)
+		}
+		contexts[c.Community] = c.Context
+		indexes[c.Index] = true
+		mapped = append(mapped, c)
+	}
+
+	return &Router{routes: validated, communities: mapped, contexts: contexts}, nil
+}
+
+// Communities returns the community mappings with defaults filled in
+func (r *Router) Communities() []Community {
+	if r == nil {
+		return nil
+	}
+	return append([]Community(nil), r.communities...)
 }
 
 func LoadFromFile(path string) (*Router, error) {
@@ -71,13 +134,31 @@ func LoadFromFile(path string) (*Router, error) {
 		return nil, fmt.Errorf("parse route yaml: %w", err)
 	}
 
-	return NewRouter(cfg.Routes)
+	routes := cfg.Routes
+	for _, datasetPath := range cfg.ContextDatasets {
+		context, err := snmprecfmt.ReadContext(datasetPath)
+		if err != nil {
+			return nil, fmt.Errorf("read context dataset: %w", err)
+		}
+		if context == "" {
+			return nil, fmt.Errorf("context dataset %s has no %s line", datasetPath, snmprecfmt.ContextDirective)
+		}
+		routes = append(routes, Rule{Match: Matchers{Context: context}, Action: Action{DatasetPath: datasetPath}})
+	}
+
+	return NewRouterWithCommunities(routes, cfg.Communities)
 }
 
 func (r *Router) Select(key RequestKey) string {
 	if r == nil {
 		return ""
 	}
+	if key.Context == "" {
+		// A mapped community stands for its context
+		if context, ok := r.contexts[key.Community]; ok {
+			key.Context = context
+		}
+	}
 	for _, rule := range r.routes {
 		if ruleMatches(rule.Match, key) {
 			return rule.Action.DatasetPath
@@ -1,6 +1,10 @@
 package routing
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestRouterPriorityAndMatching(t *testing.T) {
 	router, err := NewRouter([]Rule{
@@ -96,3 +100,61 @@ func TestRouterValidation(t *testing.T) {
 		t.Fatal("expected NewRouter to fail when datasetPath is empty")
 	}
 }
+
+func TestRouterMapsCommunitiesToContexts(t *testing.T) {
+	router, err := NewRouterWithCommunities([]Rule{
+		{Match: Matchers{Context: "ctxA"}, Action: Action{DatasetPath: "context.snmprec"}},
+		{Match: Matchers{}, Action: Action{DatasetPath: "default.snmprec"}},
+	}, []Community{{Community: "alpha", Context: "ctxA"}})
+	if err != nil {
+		t.Fatalf("NewRouterWithCommunities failed: %v", err)
+	}
+	if got := router.Select(RequestKey{Community: "alpha"}); got != "context.snmprec" {
+		t.Fatalf("mapped community routed to %q, want context.snmprec", got)
+	}
+	if got := router.Select(RequestKey{Community: "public"}); got != "default.snmprec" {
+		t.Fatalf("unmapped community routed to %q, want default.snmprec", got)
+	}
+	if got := router.Communities(); len(got) != 1 || got[0].Index != "alpha" || got[0].SecurityName != "alpha" {
+		t.Fatalf("communities = %+v, want index and security name defaulted", got)
+	}
+
+	for _, bad := range [][]Community{
+		{{Context: "ctxA"}},
+		{{Community: "a"}, {Community: "a"}},
+		{{Community: "a", Index: "x"}, {Community: "b", Index: "x"}},
+		{{Community: "a", ContextEngineID: "zz"}},
+	} {
+		if _, err := NewRouterWithCommunities(nil, bad); err == nil {
+			t.Errorf("NewRouterWithCommunities(%+v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestLoadFromFileRoutesContextDatasets(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	blue := write("blue.snmprec", "#context ctx-blue\n1.3.6.1.2.1.1.1.0|octetstring|blue\n")
+	plain := write("plain.snmprec", "1.3.6.1.2.1.1.1.0|octetstring|plain\n")
+
+	router, err := LoadFromFile(write("routes.yaml", "contextDatasets:\n  - "+blue+"\nroutes:\n  - match: {}\n    action:\n      datasetPath: "+plain+"\n"))
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	if got := router.Select(RequestKey{Context: "ctx-blue"}); got != blue {
+		t.Fatalf("ctx-blue routed to %q, want %q", got, blue)
+	}
+	if got := router.Select(RequestKey{}); got != plain {
+		t.Fatalf("default context routed to %q, want %q", got, plain)
+	}
+
+	if _, err := LoadFromFile(write("bad.yaml", "contextDatasets:\n  - "+plain+"\n")); err == nil {
+		t.Fatal("LoadFromFile accepted a context dataset without a #context line")
+	}
+}
@@ -2,15 +2,28 @@ package snmprecfmt
 
 import (
 	"bufio"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gosnmp/gosnmp"
 )
 
+// HexTypeSuffix marks a value written as hex, e.g. "octetstring:hex|20657468302a".
+// ReadFile and the simulator's loader decode it back to the original bytes.
+const HexTypeSuffix = ":hex"
+
+// ContextDirective names the SNMPv3 context a file was recorded in, as
+// "#context <name>" on a line of its own. Loaders skip it like any comment;
+// a route file lists such files under contextDatasets to serve each in its
+// context.
+const ContextDirective = "#context"
+
 type Entry struct {
 	OID   string
 	Type  string
@@ -49,7 +62,7 @@ func TypeName(ber gosnmp.Asn1BER) string {
 	case gosnmp.Counter64:
 		return "counter64"
 	case gosnmp.Uinteger32:
-		return "gauge32"
+		return "unsigned32"
 	case gosnmp.BitString:
 		return "bits"
 	case gosnmp.Null:
@@ -59,6 +72,34 @@ func TypeName(ber gosnmp.Asn1BER) string {
 	}
 }
 
+// CanonicalType returns the TypeName spelling of the snmprec type name typ,
+// resolving the short aliases the loaders accept, such as c32 or tt. Names
+// it does not know are returned lowercased.
+func CanonicalType(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	switch typ {
+	case "int", "i":
+		return "integer"
+	case "counter", "c32":
+		return "counter32"
+	case "gauge", "g":
+		return "gauge32"
+	case "uinteger32":
+		return "unsigned32"
+	case "c64":
+		return "counter64"
+	case "tt", "ticks":
+		return "timeticks"
+	case "string", "s":
+		return "octetstring"
+	case "oid", "o":
+		return "objectidentifier"
+	case "ip":
+		return "ipaddress"
+	}
+	return typ
+}
+
 func ValueString(ber gosnmp.Asn1BER, value interface{}) (string, error) {
 	switch ber {
 	case gosnmp.Integer:
@@ -86,6 +127,60 @@ func ValueString(ber gosnmp.Asn1BER, value interface{}) (string, error) {
 	}
 }
 
+// PreserveFormatting returns entries with the string-like values that the
+// OID|TYPE|VALUE line format would alter hex-encoded under HexTypeSuffix, so
+// writing and reading them back yields the recorded text byte for byte.
+// Numeric values are left as ValueString normalized them.
+func PreserveFormatting(entries []Entry) []Entry {
+	out := make([]Entry, len(entries))
+	for i, entry := range entries {
+		if isStringType(entry.Type) && needsHex(entry.Value) {
+			entry.Type += HexTypeSuffix
+			entry.Value = hex.EncodeToString([]byte(entry.Value))
+		}
+		out[i] = entry
+	}
+	return out
+}
+
+// DecodeValue strips HexTypeSuffix from typ and decodes value; other values
+// are returned unchanged
+func DecodeValue(typ, value string) (string, string, error) {
+	base, ok := strings.CutSuffix(typ, HexTypeSuffix)
+	if !ok {
+		return typ, value, nil
+	}
+	raw, err := hex.DecodeString(value)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid hex value %q: %w", value, err)
+	}
+	return base, string(raw), nil
+}
+
+func isStringType(typ string) bool {
+	switch typ {
+	case "octetstring", "opaque", "bits", "nsapaddress":
+		return true
+	}
+	return false
+}
+
+// needsHex reports whether value would change on a round-trip: readers trim
+// surrounding whitespace, split lines on '|' and newlines, treat '@' as a
+// device route and '#' as a template range, and non-printable bytes do not
+// survive editing.
+func needsHex(value string) bool {
+	if value != strings.TrimSpace(value) || !utf8.ValidString(value) {
+		return true
+	}
+	for _, r := range value {
+		if r == '|' || r == '@' || r == '#' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
 func SortEntries(entries []Entry) {
 	sort.Slice(entries, func(i, j int) bool {
 		return CompareOID(entries[i].OID, entries[j].OID) < 0
@@ -134,6 +229,13 @@ func CompareOID(a, b string) int {
 }
 
 func WriteFile(path string, entries []Entry) error {
+	return WriteContextFile(path, "", entries)
+}
+
+// WriteContextFile is WriteFile for entries recorded in SNMPv3 context
+// contextName, which it notes in a ContextDirective line. An empty name
+// writes no directive.
+func WriteContextFile(path, contextName string, entries []Entry) error {
 	copyEntries := append([]Entry(nil), entries...)
 	SortEntries(copyEntries)
 
@@ -144,6 +246,11 @@ func WriteFile(path string, entries []Entry) error {
 	defer f.Close()
 
 	w := bufio.NewWriter(f)
+	if contextName != "" {
+		if _, err := fmt.Fprintf(w, "%s %s\n", ContextDirective, contextName); err != nil {
+			return err
+		}
+	}
 	for _, entry := range copyEntries {
 		if _, err := fmt.Fprintf(w, "%s|%s|%s\n", entry.OID, entry.Type, entry.Value); err != nil {
 			return err
@@ -152,6 +259,22 @@ func WriteFile(path string, entries []Entry) error {
 	return w.Flush()
 }
 
+// ReadContext returns the context the ContextDirective of the file at path
+// names, or "" when the file has none
+func ReadContext(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), ContextDirective+" ")
+		if ok {
+			return strings.TrimSpace(rest), nil
+		}
+	}
+	return "", nil
+}
+
 func ReadFile(path string) ([]Entry, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -169,10 +292,14 @@ func ReadFile(path string) ([]Entry, error) {
 		if len(parts) != 3 {
 			return nil, fmt.Errorf("invalid snmprec line %d: %q", i+1, line)
 		}
+		typ, value, err := DecodeValue(strings.ToLower(strings.TrimSpace(parts[1])), strings.TrimSpace(parts[2]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid snmprec line %d: %w", i+1, err)
+		}
 		entries = append(entries, Entry{
 			OID:   strings.TrimPrefix(strings.TrimSpace(parts[0]), "."),
-			Type:  strings.ToLower(strings.TrimSpace(parts[1])),
-			Value: strings.TrimSpace(parts[2]),
+			Type:  typ,
+			Value: value,
 		})
 	}
 	SortEntries(entries)
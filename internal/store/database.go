@@ -10,6 +10,10 @@ import (
 
 const defaultShardCount = 64
 
+// NoResponse marks a black-hole OID: requests that touch it are dropped
+// without a reply, so the manager sees a timeout (snmprec type "noresponse")
+const NoResponse gosnmp.Asn1BER = 0xff
+
 type oidShard struct {
 	mu     sync.RWMutex
 	values map[string]*OIDValue
@@ -139,6 +143,24 @@ func (odb *OIDDatabase) Walk(callback func(oid string, value *OIDValue) bool) {
 	}
 }
 
+// Clone returns an independent copy of the database. Values are shared,
+// which is safe because stored values are never modified in place.
+func (odb *OIDDatabase) Clone() *OIDDatabase {
+	clone := NewOIDDatabase()
+	odb.mu.RLock()
+	clone.sortedOIDs = append(clone.sortedOIDs, odb.sortedOIDs...)
+	odb.mu.RUnlock()
+	for i := range odb.shards {
+		shard := &odb.shards[i]
+		shard.mu.RLock()
+		for oid, value := range shard.values {
+			clone.shards[i].values[oid] = value
+		}
+		shard.mu.RUnlock()
+	}
+	return clone
+}
+
 // GetAll returns all OIDs (for debugging/inspection)
 func (odb *OIDDatabase) GetAll() map[string]*OIDValue {
 	odb.mu.RLock()
@@ -264,8 +286,18 @@ func partitionOIDs(oids []string, low, high int) int {
 	return i + 1
 }
 
+// LoadOptions controls what LoadOIDDatabase adds besides the dataset file
+type LoadOptions struct {
+	// NoDefaultOIDs skips the built-in system/interface/IP OIDs, so a
+	// database holds exactly the OIDs of its file
+	NoDefaultOIDs bool
+	// DeriveIfNumber sets ifNumber to the number of ifTable rows once the
+	// dataset is loaded, replacing any value the file gives
+	DeriveIfNumber bool
+}
+
 // LoadOIDDatabase creates and loads a database from various sources
-func LoadOIDDatabase(snmprecFile string) (*OIDDatabase, error) {
+func LoadOIDDatabase(snmprecFile string, opts LoadOptions) (*OIDDatabase, error) {
 	db := NewOIDDatabase()
 
 	// Load from .snmprec file if provided
@@ -279,15 +311,22 @@ func LoadOIDDatabase(snmprecFile string) (*OIDDatabase, error) {
 	}
 
 	// Load default OID templates
-	loadDefaultOIDs(db)
+	if !opts.NoDefaultOIDs {
+		loadDefaultOIDs(db)
+	}
 
 	// Sort OIDs for efficient GetNext operations
 	db.SortOIDs()
 
+	if opts.DeriveIfNumber {
+		deriveIfNumber(db)
+	}
+
 	return db, nil
 }
 
-// loadDefaultOIDs loads a default set of system OIDs
+// loadDefaultOIDs loads a default set of system OIDs, keeping any value the
+// dataset already defines
 func loadDefaultOIDs(db *OIDDatabase) {
 	defaults := map[string]*OIDValue{
 		// System group
@@ -328,9 +367,14 @@ func loadDefaultOIDs(db *OIDDatabase) {
 		"1.3.6.1.2.1.11.6.0": {Type: gosnmp.Counter32, Value: uint32(100)},
 	}
 
+	added := 0
 	for oid, value := range defaults {
+		if db.Get(oid) != nil {
+			continue
+		}
 		db.Insert(oid, value)
+		added++
 	}
 
-	log.Printf("Loaded %d default OIDs", len(defaults))
+	log.Printf("Loaded %d default OIDs", added)
 }
@@ -11,7 +11,7 @@ type DatasetStore struct {
 	indexes     map[string]*OIDIndexManager
 }
 
-func NewDatasetStore(defaultPath string, extraPaths []string) (*DatasetStore, error) {
+func NewDatasetStore(defaultPath string, extraPaths []string, opts LoadOptions) (*DatasetStore, error) {
 	paths := make([]string, 0, len(extraPaths)+1)
 	paths = append(paths, defaultPath)
 	paths = append(paths, extraPaths...)
@@ -34,7 +34,7 @@ func NewDatasetStore(defaultPath string, extraPaths []string) (*DatasetStore, er
 	}
 
 	for _, path := range unique {
-		db, err := LoadOIDDatabase(path)
+		db, err := LoadOIDDatabase(path, opts)
 		if err != nil {
 			return nil, fmt.Errorf("load dataset %q: %w", path, err)
 		}
@@ -72,3 +72,22 @@ func (ds *DatasetStore) Resolve(path string) (*OIDDatabase, *OIDIndexManager) {
 
 	return nil, nil
 }
+
+// InsertAll adds entries to every loaded dataset, replacing values of OIDs a
+// dataset already holds, and rebuilds their indexes. Like ApplyFilter it must
+// run before the datasets are served.
+func (ds *DatasetStore) InsertAll(entries map[string]*OIDValue) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	for path, db := range ds.datasets {
+		db.BatchInsert(entries)
+		db.SortOIDs()
+		idx := NewOIDIndexManager()
+		if err := idx.BuildIndex(db); err != nil {
+			return fmt.Errorf("build index for dataset %q: %w", path, err)
+		}
+		ds.indexes[path] = idx
+	}
+	return nil
+}
@@ -1,12 +1,14 @@
 package store
 
 import (
+	"encoding/hex"
 	"fmt"
 	"log"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
 	"github.com/gosnmp/gosnmp"
 )
 
@@ -78,6 +80,7 @@ func ParseDeviceOID(line string) (*DeviceOIDEntry, error) {
 	oid := strings.TrimSpace(parts[0])
 	typeStr := strings.TrimSpace(parts[1])
 	valueWithRoute := strings.TrimSpace(parts[2])
+	typeStr, hexValue := strings.CutSuffix(typeStr, snmprecfmt.HexTypeSuffix)
 
 	// Parse type
 	snmpType, err := parseType(typeStr)
@@ -120,6 +123,14 @@ func ParseDeviceOID(line string) (*DeviceOIDEntry, error) {
 		entry.Priority = 0 // default has lowest priority
 	}
 
+	if hexValue {
+		raw, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value %q for OID %s: %v", value, oid, err)
+		}
+		value = string(raw)
+	}
+
 	// Parse value based on type
 	parsedValue, err := parseMappingValue(snmpType, value)
 	if err != nil {
@@ -245,7 +256,7 @@ func parseMappingValue(snmpType gosnmp.Asn1BER, value string) (interface{}, erro
 		}
 		return v, nil
 
-	case gosnmp.Gauge32:
+	case gosnmp.Gauge32, gosnmp.Uinteger32:
 		v, err := strconv.ParseUint(value, 10, 32)
 		if err != nil {
 			return nil, err
@@ -263,7 +274,7 @@ func parseMappingValue(snmpType gosnmp.Asn1BER, value string) (interface{}, erro
 		return value, nil
 
 	case gosnmp.ObjectIdentifier:
-		return value, nil
+		return parseObjectIdentifier(value)
 
 	case gosnmp.IPAddress:
 		return value, nil
@@ -286,6 +297,8 @@ func parseType(typeStr string) (gosnmp.Asn1BER, error) {
 		return gosnmp.Counter64, nil
 	case "gauge32", "gauge":
 		return gosnmp.Gauge32, nil
+	case "unsigned32", "uinteger32":
+		return gosnmp.Uinteger32, nil
 	case "timeticks", "timetick":
 		return gosnmp.TimeTicks, nil
 	case "integer32", "int32":
@@ -296,6 +309,12 @@ func parseType(typeStr string) (gosnmp.Asn1BER, error) {
 		return gosnmp.ObjectIdentifier, nil
 	case "ipaddress", "ipaddr":
 		return gosnmp.IPAddress, nil
+	case "bits":
+		return gosnmp.BitString, nil
+	case "nsapaddress":
+		return gosnmp.NsapAddress, nil
+	case "noresponse":
+		return NoResponse, nil
 	default:
 		return gosnmp.OctetString, fmt.Errorf("unknown type: %s", typeStr)
 	}
@@ -324,7 +343,7 @@ func CollectDeviceMappings(lines []string) ([]*DeviceOIDEntry, []*OIDEntry, erro
 	deviceEntries := make([]*DeviceOIDEntry, 0)
 	regularEntries := make([]*OIDEntry, 0)
 
-	for _, line := range lines {
+	for i, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -334,14 +353,14 @@ func CollectDeviceMappings(lines []string) ([]*DeviceOIDEntry, []*OIDEntry, erro
 		if IsDeviceOID(line) {
 			entry, err := ParseDeviceOID(line)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
 			}
 			deviceEntries = append(deviceEntries, entry)
 		} else {
 			// Try parsing as regular OID
 			entry, err := ParseOIDEntry(line)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
 			}
 			regularEntries = append(regularEntries, entry)
 		}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OIDFilter limits which OIDs a dataset serves. An OID is allowed when it is
+// under one of the Include prefixes (or Include is empty) and under none of
+// the Exclude prefixes. Prefixes match whole arcs: 1.3.6.1.2 covers
+// 1.3.6.1.2.1 but not 1.3.6.1.20.
+type OIDFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// NewOIDFilter normalizes and validates include and exclude prefixes
+func NewOIDFilter(include, exclude []string) (OIDFilter, error) {
+	var f OIDFilter
+	var err error
+	if f.Include, err = normalizePrefixes(include); err != nil {
+		return OIDFilter{}, fmt.Errorf("include: %w", err)
+	}
+	if f.Exclude, err = normalizePrefixes(exclude); err != nil {
+		return OIDFilter{}, fmt.Errorf("exclude: %w", err)
+	}
+	return f, nil
+}
+
+func normalizePrefixes(prefixes []string) ([]string, error) {
+	out := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		oid, err := parseObjectIdentifier(prefix)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, strings.TrimPrefix(oid, "."))
+	}
+	return out, nil
+}
+
+// Empty reports whether the filter allows every OID
+func (f OIDFilter) Empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// Allows reports whether oid passes the filter
+func (f OIDFilter) Allows(oid string) bool {
+	oid = strings.TrimPrefix(oid, ".")
+	if len(f.Include) > 0 && !underAny(oid, f.Include) {
+		return false
+	}
+	return !underAny(oid, f.Exclude)
+}
+
+func underAny(oid string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if oid == prefix || strings.HasPrefix(oid, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Retain removes every OID for which keep returns false and returns how many
+// were removed
+func (odb *OIDDatabase) Retain(keep func(oid string) bool) int {
+	odb.mu.Lock()
+	defer odb.mu.Unlock()
+
+	kept := odb.sortedOIDs[:0]
+	removed := 0
+	for _, oid := range odb.sortedOIDs {
+		if keep(oid) {
+			kept = append(kept, oid)
+			continue
+		}
+		shard := odb.shardFor(oid)
+		shard.mu.Lock()
+		if _, ok := shard.values[oid]; ok {
+			delete(shard.values, oid)
+			removed++
+		}
+		shard.mu.Unlock()
+	}
+	odb.sortedOIDs = kept
+	return removed
+}
+
+// ApplyFilter drops the OIDs f rejects from every loaded dataset and
+// rebuilds their indexes. It must run before the datasets are served.
+func (ds *DatasetStore) ApplyFilter(f OIDFilter) (int, error) {
+	if f.Empty() {
+		return 0, nil
+	}
+	removed := 0
+	for path, db := range ds.datasets {
+		removed += db.Retain(f.Allows)
+		idx := NewOIDIndexManager()
+		if err := idx.BuildIndex(db); err != nil {
+			return removed, fmt.Errorf("build index for dataset %q: %w", path, err)
+		}
+		ds.indexes[path] = idx
+	}
+	return removed, nil
+}
@@ -0,0 +1,27 @@
+package store
+
+import "testing"
+
+func TestOIDFilterMatchesWholeArcs(t *testing.T) {
+	f, err := NewOIDFilter([]string{".1.3.6.1.2"}, []string{"1.3.6.1.2.1.4"})
+	if err != nil {
+		t.Fatalf("new filter: %v", err)
+	}
+	cases := map[string]bool{
+		"1.3.6.1.2.1.1.1.0":  true,
+		".1.3.6.1.2.1.1.1.0": true,
+		"1.3.6.1.2.1.4.1.0":  false,
+		"1.3.6.1.2.1.40.1.0": true,
+		"1.3.6.1.20.1.0":     false,
+		"1.3.6.1.4.1.9.1.0":  false,
+	}
+	for oid, want := range cases {
+		if got := f.Allows(oid); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", oid, got, want)
+		}
+	}
+
+	if _, err := NewOIDFilter(nil, []string{"1.3.x"}); err == nil {
+		t.Fatal("expected invalid prefix to be rejected")
+	}
+}
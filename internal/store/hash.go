@@ -0,0 +1,43 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
+)
+
+// Hash returns a hex SHA-256 over the database's OID|TYPE|VALUE entries in
+// OID order. It depends only on the content, not on load order or the files
+// it came from, so labs serving the same dataset report the same hash.
+func (odb *OIDDatabase) Hash() string {
+	odb.mu.RLock()
+	oids := append([]string(nil), odb.sortedOIDs...)
+	odb.mu.RUnlock()
+	sort.Slice(oids, func(i, j int) bool { return isOIDLess(oids[i], oids[j]) })
+
+	h := sha256.New()
+	for i, oid := range oids {
+		if i > 0 && oid == oids[i-1] {
+			continue
+		}
+		val := odb.Get(oid)
+		if val == nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s|%s|%s\n", oid, snmprecfmt.TypeName(val.Type), hashValue(val))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashValue(val *OIDValue) string {
+	if ref, ok := val.Value.(*ValueRef); ok {
+		return ref.String()
+	}
+	if text, err := snmprecfmt.ValueString(val.Type, val.Value); err == nil {
+		return text
+	}
+	return fmt.Sprint(val.Value)
+}
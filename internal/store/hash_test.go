@@ -0,0 +1,48 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOIDDatabaseHashIsStableAndTracksValues(t *testing.T) {
+	dir := t.TempDir()
+	load := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, content)
+		db := NewOIDDatabase()
+		if _, err := LoadSNMPrecFile(db, path); err != nil {
+			t.Fatalf("load %s: %v", name, err)
+		}
+		db.SortOIDs()
+		return db.Hash()
+	}
+
+	a := load("a.snmprec", `1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+1.3.6.1.2.1.2.2.1.10.1|counter32|100
+`)
+	// Same entries in a different file order
+	b := load("b.snmprec", `1.3.6.1.2.1.2.2.1.10.1|counter32|100
+1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+`)
+	changed := load("c.snmprec", `1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+1.3.6.1.2.1.2.2.1.10.1|counter32|101
+`)
+	retyped := load("d.snmprec", `1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+1.3.6.1.2.1.2.2.1.10.1|gauge32|100
+`)
+
+	if len(a) != 64 {
+		t.Fatalf("hash = %q, want 64 hex digits", a)
+	}
+	if a != b {
+		t.Fatalf("identical datasets hash differently: %s vs %s", a, b)
+	}
+	if a == changed {
+		t.Fatal("changed value kept the same hash")
+	}
+	if a == retyped {
+		t.Fatal("changed type kept the same hash")
+	}
+}
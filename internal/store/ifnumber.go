@@ -0,0 +1,34 @@
+package store
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// deriveIfNumber sets ifNumber to the number of distinct ifTable rows, so
+// template-expanded tables and the count pollers read first agree. A
+// dataset without an ifTable is left alone.
+func deriveIfNumber(db *OIDDatabase) {
+	rows := make(map[string]struct{})
+	prefix := oidIfEntry + "."
+	db.Walk(func(oid string, _ *OIDValue) bool {
+		if !strings.HasPrefix(oid, prefix) {
+			return true
+		}
+		if _, _, index, err := ParseTableOID(oid); err == nil {
+			rows[index] = struct{}{}
+		}
+		return true
+	})
+	if len(rows) == 0 {
+		return
+	}
+	if old := db.Get(oidIfNumber); old != nil && old.Type == gosnmp.Integer && old.Value == len(rows) {
+		return
+	}
+	db.Insert(oidIfNumber, &OIDValue{Type: gosnmp.Integer, Value: len(rows)})
+	db.SortOIDs()
+	log.Printf("Derived ifNumber %d from the ifTable rows", len(rows))
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDeriveIfNumberCountsExpandedIfTableRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "switch.snmprec")
+	writeTestFile(t, path, `1.3.6.1.2.1.1.1.0|octetstring|48-port switch
+1.3.6.1.2.1.2.1.0|integer|2
+1.3.6.1.2.1.2.2.1.1|integer|1|#1-48
+1.3.6.1.2.1.2.2.1.2|octetstring|GigabitEthernet|#1-48
+1.3.6.1.2.1.2.2.1.8|integer|1|#1-48
+`)
+
+	db, err := LoadOIDDatabase(path, LoadOptions{DeriveIfNumber: true})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := db.Get(oidIfNumber); got == nil || got.Value != 48 {
+		t.Fatalf("ifNumber = %v, want 48", got)
+	}
+	if warnings := warningsFor(LintDataset(db), LintIfNumber); len(warnings) != 0 {
+		t.Fatalf("lint after deriving ifNumber: %v", warnings)
+	}
+
+	db, err = LoadOIDDatabase(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := db.Get(oidIfNumber); got == nil || got.Value != 2 {
+		t.Fatalf("ifNumber without DeriveIfNumber = %v, want the static 2", got)
+	}
+}
+
+func TestDeriveIfNumberLeavesDatasetsWithoutIfTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host.snmprec")
+	writeTestFile(t, path, "1.3.6.1.2.1.1.1.0|octetstring|host\n")
+
+	db, err := LoadOIDDatabase(path, LoadOptions{NoDefaultOIDs: true, DeriveIfNumber: true})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := db.Get(oidIfNumber); got != nil {
+		t.Fatalf("ifNumber = %v, want none without an ifTable", got)
+	}
+}
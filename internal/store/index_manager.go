@@ -5,6 +5,8 @@ import (
 	"log"
 	"sort"
 	"sync"
+
+	"github.com/gosnmp/gosnmp"
 )
 
 // OIDIndexManager manages OID indexing and table traversal for Zabbix LLD
@@ -98,6 +100,12 @@ func (im *OIDIndexManager) BuildIndex(db *OIDDatabase) error {
 		im.sortedOIDs = append(im.sortedOIDs, tableOIDs...)
 	}
 
+	// GetNext binary-searches this list, so table OIDs must be merged into
+	// global order rather than left appended after the scalars.
+	sort.SliceStable(im.sortedOIDs, func(i, j int) bool {
+		return isOIDLess(im.sortedOIDs[i], im.sortedOIDs[j])
+	})
+
 	// Build index map
 	im.oidToIndex = make(map[string]int)
 	for i, oid := range im.sortedOIDs {
@@ -130,6 +138,13 @@ func (im *OIDIndexManager) GetNext(oid string, db *OIDDatabase) (string, *OIDVal
 		return im.getNextTableOID(oid, db)
 	}
 
+	return im.getNextSorted(oid, db)
+}
+
+// getNextSorted returns the first OID after oid in the global sorted list.
+// oid need not exist: from an interior node such as a bare column or a
+// scalar without .0, that is the first instance under it.
+func (im *OIDIndexManager) getNextSorted(oid string, db *OIDDatabase) (string, *OIDValue) {
 	// Binary search for position
 	idx := searchOIDPosition(im.sortedOIDs, oid)
 
@@ -155,14 +170,15 @@ func (im *OIDIndexManager) GetNext(oid string, db *OIDDatabase) (string, *OIDVal
 
 	// End of MIB
 	return "", &OIDValue{
-		Type:  2, // EndOfMibView
+		Type:  gosnmp.EndOfMibView,
 		Value: nil,
 	}
 }
 
 // GetNextBulk returns multiple next OIDs for GetBulk operations
 // maxRepeaters: Zabbix default is 10, max is typically 128
-// Returns: list of (OID, value) pairs, up to maxRepeaters items
+// Returns: list of (OID, value) pairs, up to maxRepeaters items, ending with
+// an endOfMibView entry when the walk passes the last OID
 func (im *OIDIndexManager) GetNextBulk(oid string, maxRepeaters int, db *OIDDatabase) []*getNextBulkResult {
 	im.mu.RLock()
 	defer im.mu.RUnlock()
@@ -175,74 +191,47 @@ func (im *OIDIndexManager) GetNextBulk(oid string, maxRepeaters int, db *OIDData
 		maxRepeaters = 1
 	}
 
-	results := make([]*getNextBulkResult, 0, maxRepeaters)
-
 	// For table OIDs, use table-aware traversal
+	var results []*getNextBulkResult
 	if im.isTableOID(oid) {
-		return im.getNextBulkTable(oid, maxRepeaters, db)
+		results = im.getNextBulkTable(oid, maxRepeaters, db)
 	}
 
-	// Binary search for starting position
-	idx := searchOIDPosition(im.sortedOIDs, oid)
-	if idx < len(im.sortedOIDs) && im.sortedOIDs[idx] == oid {
-		idx++
+	// Past the table, or outside any, continue in plain OID order
+	last := oid
+	if len(results) > 0 {
+		last = results[len(results)-1].OID
 	}
-
-	// Collect next maxRepeaters OIDs
-	count := 0
-	for i := idx; i < len(im.sortedOIDs) && count < maxRepeaters; i++ {
-		nextOID := im.sortedOIDs[i]
-		if value := db.Get(nextOID); value != nil {
-			results = append(results, &getNextBulkResult{
-				OID:   nextOID,
-				Value: value,
-			})
-			count++
+	if len(results) < maxRepeaters {
+		results = append(results, im.getNextBulkRegular(last, maxRepeaters-len(results), db)...)
+		if len(results) > 0 {
+			last = results[len(results)-1].OID
 		}
 	}
 
+	// Fewer results than asked for means the walk ran off the end of the
+	// MIB; say so explicitly, as GETNEXT does, so clients stop walking
+	if len(results) < maxRepeaters {
+		results = append(results, &getNextBulkResult{
+			OID:   last,
+			Value: &OIDValue{Type: gosnmp.EndOfMibView, Value: nil},
+		})
+	}
+
 	return results
 }
 
 // getNextTableOID handles GetNext for table OIDs
 // Performance critical: must use pre-sorted table structure
 func (im *OIDIndexManager) getNextTableOID(oid string, db *OIDDatabase) (string, *OIDValue) {
-	// Parse the table OID
+	// Table traversal continues from an existing cell. Anything else under
+	// a table (the table or entry OID, a bare column, an absent instance)
+	// is an interior node, answered in plain OID order as net-snmp does;
+	// ParseTableOID would misread e.g. a bare column ending in .1.
 	entryOID, colIndex, rowIndex, err := ParseTableOID(oid)
-	if err != nil {
-		// oid might be the entry OID itself (e.g. "1.3.6.1.2.1.2.2.1") or the table
-		// base (e.g. "1.3.6.1.2.1.2.2") — not a row entry. Find first cell of the table.
-		entryKey := oid
-		if _, ok := im.tables[entryKey]; !ok {
-			entryKey = oid + ".1"
-		}
-		if table, ok := im.tables[entryKey]; ok {
-			oidStr, _, _, val, found := table.GetFirstValue()
-			if found && val != nil {
-				valObj := db.Get(oidStr)
-				if valObj == nil {
-					valObj = &OIDValue{Type: 0, Value: val}
-				}
-				return oidStr, valObj
-			}
-			return im.getOIDAfterTable(entryKey, db)
-		}
-		// Not a valid table OID, return next non-table OID
-		idx := searchOIDPosition(im.sortedOIDs, oid)
-		if idx < len(im.sortedOIDs) && im.sortedOIDs[idx] == oid {
-			idx++
-		}
-		if idx < len(im.sortedOIDs) {
-			if val := db.Get(im.sortedOIDs[idx]); val != nil {
-				return im.sortedOIDs[idx], val
-			}
-		}
-		return "", nil
-	}
-
 	table, ok := im.tables[entryOID]
-	if !ok {
-		return "", nil
+	if _, exists := im.oidToIndex[oid]; err != nil || !ok || !exists || !IsTableEntry(oid) {
+		return im.getNextSorted(oid, db)
 	}
 
 	// Use table structure for efficient traversal
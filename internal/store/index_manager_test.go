@@ -60,3 +60,98 @@ func TestOIDIndexManagerBuildIndexDeterministicOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestOIDIndexManagerGetNextAfterTableReachesLaterScalars(t *testing.T) {
+	db := NewOIDDatabase()
+	db.BatchInsert(map[string]*OIDValue{
+		"1.3.6.1.2.1.1.1.0":     {Type: gosnmp.OctetString, Value: "sysDescr"},
+		"1.3.6.1.2.1.2.2.1.1.1": {Type: gosnmp.Integer, Value: 1},
+		"1.3.6.1.2.1.2.2.1.1.2": {Type: gosnmp.Integer, Value: 2},
+		"1.3.6.1.4.1.55555.1.0": {Type: gosnmp.OctetString, Value: "enterprise"},
+	})
+	db.SortOIDs()
+
+	im := NewOIDIndexManager()
+	if err := im.BuildIndex(db); err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	next, val := im.GetNext("1.3.6.1.4.1", db)
+	if next != "1.3.6.1.4.1.55555.1.0" || val == nil || val.Value != "enterprise" {
+		t.Fatalf("GetNext(1.3.6.1.4.1) = %q %+v, want enterprise scalar", next, val)
+	}
+}
+
+func TestOIDIndexManagerGetNextBulkEndsWithEndOfMibView(t *testing.T) {
+	db := NewOIDDatabase()
+	db.BatchInsert(map[string]*OIDValue{
+		"1.3.6.1.2.1.1.1.0":     {Type: gosnmp.OctetString, Value: "sysDescr"},
+		"1.3.6.1.2.1.2.2.1.1.1": {Type: gosnmp.Integer, Value: 1},
+		"1.3.6.1.2.1.2.2.1.1.2": {Type: gosnmp.Integer, Value: 2},
+		"1.3.6.1.4.1.55555.1.0": {Type: gosnmp.OctetString, Value: "enterprise"},
+	})
+	db.SortOIDs()
+
+	im := NewOIDIndexManager()
+	if err := im.BuildIndex(db); err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	results := im.GetNextBulk("1.3.6.1.4.1.99999", 5, db)
+	if len(results) != 1 || results[0].OID != "1.3.6.1.4.1.99999" || results[0].Value.Type != gosnmp.EndOfMibView {
+		t.Fatalf("GetNextBulk on an unknown subtree = %+v, want a single endOfMibView", results)
+	}
+
+	results = im.GetNextBulk("1.3.6.1.2.1.2.2.1.1.1", 5, db)
+	if len(results) != 3 {
+		t.Fatalf("GetNextBulk from the table = %d results, want 3", len(results))
+	}
+	if results[1].OID != "1.3.6.1.4.1.55555.1.0" {
+		t.Fatalf("GetNextBulk past the table = %q, want the later scalar", results[1].OID)
+	}
+	if end := results[2]; end.OID != "1.3.6.1.4.1.55555.1.0" || end.Value.Type != gosnmp.EndOfMibView {
+		t.Fatalf("GetNextBulk last result = %+v, want endOfMibView after the last OID", end)
+	}
+}
+
+func TestOIDIndexManagerGetNextFromInteriorNodes(t *testing.T) {
+	db := NewOIDDatabase()
+	db.BatchInsert(map[string]*OIDValue{
+		"1.3.6.1.2.1.1.1.0":        {Type: gosnmp.OctetString, Value: "sysDescr"},
+		"1.3.6.1.2.1.1.5.0":        {Type: gosnmp.OctetString, Value: "sysName"},
+		"1.3.6.1.2.1.2.2.1.1.1":    {Type: gosnmp.Integer, Value: 1},
+		"1.3.6.1.2.1.2.2.1.1.2":    {Type: gosnmp.Integer, Value: 2},
+		"1.3.6.1.2.1.2.2.1.2.1":    {Type: gosnmp.OctetString, Value: "eth0"},
+		"1.3.6.1.2.1.2.2.1.2.2":    {Type: gosnmp.OctetString, Value: "eth1"},
+		"1.3.6.1.2.1.31.1.1.1.1.1": {Type: gosnmp.OctetString, Value: "Gi0/1"},
+		"1.3.6.1.2.1.31.1.1.1.1.2": {Type: gosnmp.OctetString, Value: "Gi0/2"},
+		"1.3.6.1.2.1.31.1.1.1.6.2": {Type: gosnmp.Counter64, Value: uint64(6)},
+	})
+	db.SortOIDs()
+
+	im := NewOIDIndexManager()
+	if err := im.BuildIndex(db); err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	tests := []struct {
+		name, oid, want string
+	}{
+		{"bare sysDescr", "1.3.6.1.2.1.1.1", "1.3.6.1.2.1.1.1.0"},
+		{"system group", "1.3.6.1.2.1.1", "1.3.6.1.2.1.1.1.0"},
+		{"bare column", "1.3.6.1.2.1.2.2.1.2", "1.3.6.1.2.1.2.2.1.2.1"},
+		{"bare column ending in .1", "1.3.6.1.2.1.31.1.1.1.1", "1.3.6.1.2.1.31.1.1.1.1.1"},
+		{"bare table entry", "1.3.6.1.2.1.2.2.1", "1.3.6.1.2.1.2.2.1.1.1"},
+		{"bare table entry ending in .1.1", "1.3.6.1.2.1.31.1.1.1", "1.3.6.1.2.1.31.1.1.1.1.1"},
+		{"bare table", "1.3.6.1.2.1.31.1.1", "1.3.6.1.2.1.31.1.1.1.1.1"},
+		{"absent instance", "1.3.6.1.2.1.2.2.1.2.0", "1.3.6.1.2.1.2.2.1.2.1"},
+		{"sparse column", "1.3.6.1.2.1.31.1.1.1.1.2", "1.3.6.1.2.1.31.1.1.1.6.2"},
+		{"end of column", "1.3.6.1.2.1.2.2.1.1.2", "1.3.6.1.2.1.2.2.1.2.1"},
+	}
+	for _, tt := range tests {
+		next, val := im.GetNext(tt.oid, db)
+		if next != tt.want || val == nil {
+			t.Errorf("%s: GetNext(%s) = %q %+v, want %s", tt.name, tt.oid, next, val, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
+	"github.com/gosnmp/gosnmp"
+)
+
+// Lint rule names reported in LintWarning.Rule
+const (
+	LintMissingScalar  = "missing-scalar"  // sysDescr or sysObjectID is absent
+	LintIfNumber       = "ifnumber"        // ifNumber disagrees with the ifTable rows
+	LintCounterType    = "counter-type"    // a known counter column is not a counter
+	LintMissingColumns = "missing-columns" // a table row lacks columns other rows have
+)
+
+const (
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+	oidIfNumber    = "1.3.6.1.2.1.2.1.0"
+	oidIfEntry     = "1.3.6.1.2.1.2.2.1"
+	oidIfXEntry    = "1.3.6.1.2.1.31.1.1.1"
+)
+
+// counterColumns maps table entries to the columns IF-MIB defines as
+// Counter32 or Counter64
+var counterColumns = map[string]map[int]string{
+	oidIfEntry: {
+		10: "ifInOctets", 11: "ifInUcastPkts", 12: "ifInNUcastPkts", 13: "ifInDiscards",
+		14: "ifInErrors", 15: "ifInUnknownProtos", 16: "ifOutOctets", 17: "ifOutUcastPkts",
+		18: "ifOutNUcastPkts", 19: "ifOutDiscards", 20: "ifOutErrors",
+	},
+	oidIfXEntry: {
+		2: "ifInMulticastPkts", 3: "ifInBroadcastPkts", 4: "ifOutMulticastPkts", 5: "ifOutBroadcastPkts",
+		6: "ifHCInOctets", 7: "ifHCInUcastPkts", 8: "ifHCInMulticastPkts", 9: "ifHCInBroadcastPkts",
+		10: "ifHCOutOctets", 11: "ifHCOutUcastPkts", 12: "ifHCOutMulticastPkts", 13: "ifHCOutBroadcastPkts",
+	},
+}
+
+// LintWarning is one dataset authoring problem found by LintDataset
+type LintWarning struct {
+	OID     string
+	Rule    string
+	Message string
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s [%s] %s", w.OID, w.Rule, w.Message)
+}
+
+// LintDataset checks a loaded dataset for common authoring mistakes that
+// parse fine but confuse pollers: missing sysDescr/sysObjectID, an ifNumber
+// that disagrees with the ifTable, counter columns declared with a
+// non-counter type, and table rows lacking columns other rows have. Tables
+// are detected the same way the index does, so only single-arc row indexes
+// are checked for missing columns. Warnings are sorted by OID.
+func LintDataset(db *OIDDatabase) []LintWarning {
+	warnings := make([]LintWarning, 0)
+	for _, scalar := range []struct{ oid, name string }{
+		{oidSysDescr, "sysDescr"},
+		{oidSysObjectID, "sysObjectID"},
+	} {
+		if db.Get(scalar.oid) == nil {
+			warnings = append(warnings, LintWarning{OID: scalar.oid, Rule: LintMissingScalar,
+				Message: scalar.name + " is missing"})
+		}
+	}
+
+	entries := make([]*OIDEntry, 0)
+	db.Walk(func(oid string, value *OIDValue) bool {
+		entries = append(entries, &OIDEntry{OID: oid, Type: value.Type, Value: value.Value})
+		if name, ok := counterColumnName(oid); ok && value.Type != gosnmp.Counter32 && value.Type != gosnmp.Counter64 {
+			warnings = append(warnings, LintWarning{OID: oid, Rule: LintCounterType,
+				Message: fmt.Sprintf("%s is %s, want counter32 or counter64", name, snmprecfmt.TypeName(value.Type))})
+		}
+		return true
+	})
+	tables := DetectTableStructure(entries)
+
+	if ifTable := tables[oidIfEntry]; ifTable != nil {
+		warnings = append(warnings, lintIfNumber(db, ifTable)...)
+	}
+	for _, table := range tables {
+		warnings = append(warnings, lintMissingColumns(table)...)
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return isOIDLess(warnings[i].OID, warnings[j].OID)
+	})
+	return warnings
+}
+
+func counterColumnName(oid string) (string, bool) {
+	if !IsTableEntry(oid) {
+		return "", false
+	}
+	entryOID, col, _, err := ParseTableOID(oid)
+	if err != nil {
+		return "", false
+	}
+	name, ok := counterColumns[entryOID][col]
+	return name, ok
+}
+
+// lintIfNumber compares ifNumber with the number of ifTable rows
+func lintIfNumber(db *OIDDatabase, ifTable *SNMPTable) []LintWarning {
+	rows := ifTable.RowCount()
+	value := db.Get(oidIfNumber)
+	if value == nil {
+		return []LintWarning{{OID: oidIfNumber, Rule: LintIfNumber,
+			Message: fmt.Sprintf("ifNumber is missing but ifTable has %d rows", rows)}}
+	}
+	if _, ok := value.Value.(*ValueRef); ok {
+		return nil // resolved at request time
+	}
+	n, err := refNumber(value.Value)
+	if err != nil {
+		return []LintWarning{{OID: oidIfNumber, Rule: LintIfNumber,
+			Message: fmt.Sprintf("ifNumber is not a number: %v", err)}}
+	}
+	if n != int64(rows) {
+		return []LintWarning{{OID: oidIfNumber, Rule: LintIfNumber,
+			Message: fmt.Sprintf("ifNumber is %d but ifTable has %d rows", n, rows)}}
+	}
+	return nil
+}
+
+// lintMissingColumns reports, per row, the columns some other row of the
+// table has and this one lacks, at the OID of the first missing cell
+func lintMissingColumns(table *SNMPTable) []LintWarning {
+	if table.RowCount() < 2 {
+		return nil
+	}
+	cols := make([]int, 0, len(table.Columns))
+	for col := range table.Columns {
+		cols = append(cols, col)
+	}
+	sort.Ints(cols)
+
+	var warnings []LintWarning
+	for _, rowID := range table.SortedRowIDs {
+		row := table.Rows[rowID]
+		var missing []string
+		for _, col := range cols {
+			if _, ok := row.Values[col]; !ok {
+				missing = append(missing, strconv.Itoa(col))
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		warnings = append(warnings, LintWarning{OID: table.EntryOID + "." + missing[0] + "." + rowID, Rule: LintMissingColumns,
+			Message: fmt.Sprintf("row %s of %s lacks column(s) %s", rowID, table.EntryOID, strings.Join(missing, ", "))})
+	}
+	return warnings
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const lintSystem = `1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.1.4.1.9.1.1
+`
+
+func lintFile(t *testing.T, content string) []LintWarning {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lint.snmprec")
+	writeTestFile(t, path, content)
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	db.SortOIDs()
+	return LintDataset(db)
+}
+
+func warningsFor(warnings []LintWarning, rule string) []LintWarning {
+	var out []LintWarning
+	for _, w := range warnings {
+		if w.Rule == rule {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func TestLintDatasetCleanDatasetHasNoWarnings(t *testing.T) {
+	warnings := lintFile(t, lintSystem+`1.3.6.1.2.1.2.1.0|integer|2
+1.3.6.1.2.1.2.2.1.1.1|integer|1
+1.3.6.1.2.1.2.2.1.1.2|integer|2
+1.3.6.1.2.1.2.2.1.10.1|counter32|100
+1.3.6.1.2.1.2.2.1.10.2|counter32|200
+`)
+	if len(warnings) != 0 {
+		t.Fatalf("warnings = %v, want none", warnings)
+	}
+}
+
+func TestLintDatasetReportsMissingSystemScalars(t *testing.T) {
+	warnings := warningsFor(lintFile(t, "1.3.6.1.2.1.1.5.0|octetstring|router\n"), LintMissingScalar)
+	if len(warnings) != 2 || warnings[0].OID != oidSysDescr || warnings[1].OID != oidSysObjectID {
+		t.Fatalf("warnings = %v, want sysDescr and sysObjectID", warnings)
+	}
+}
+
+func TestLintDatasetReportsIfNumberMismatch(t *testing.T) {
+	warnings := warningsFor(lintFile(t, lintSystem+`1.3.6.1.2.1.2.1.0|integer|4
+1.3.6.1.2.1.2.2.1.1.1|integer|1
+1.3.6.1.2.1.2.2.1.1.2|integer|2
+`), LintIfNumber)
+	if len(warnings) != 1 || warnings[0].OID != oidIfNumber || !strings.Contains(warnings[0].Message, "4 but ifTable has 2") {
+		t.Fatalf("warnings = %v, want one ifNumber mismatch", warnings)
+	}
+}
+
+func TestLintDatasetReportsMissingIfNumber(t *testing.T) {
+	warnings := warningsFor(lintFile(t, lintSystem+`1.3.6.1.2.1.2.2.1.1.1|integer|1
+`), LintIfNumber)
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "missing") {
+		t.Fatalf("warnings = %v, want missing ifNumber", warnings)
+	}
+}
+
+func TestLintDatasetReportsCountersDeclaredAsIntegers(t *testing.T) {
+	warnings := warningsFor(lintFile(t, lintSystem+`1.3.6.1.2.1.2.1.0|integer|1
+1.3.6.1.2.1.2.2.1.1.1|integer|1
+1.3.6.1.2.1.2.2.1.10.1|integer|100
+1.3.6.1.2.1.2.2.1.16.1|counter32|100
+1.3.6.1.2.1.31.1.1.1.6.1|gauge32|100
+`), LintCounterType)
+	if len(warnings) != 2 {
+		t.Fatalf("warnings = %v, want ifInOctets and ifHCInOctets", warnings)
+	}
+	if warnings[0].OID != "1.3.6.1.2.1.2.2.1.10.1" || !strings.Contains(warnings[0].Message, "ifInOctets is integer") {
+		t.Errorf("first warning = %v", warnings[0])
+	}
+	if warnings[1].OID != "1.3.6.1.2.1.31.1.1.1.6.1" || !strings.Contains(warnings[1].Message, "ifHCInOctets is gauge32") {
+		t.Errorf("second warning = %v", warnings[1])
+	}
+}
+
+func TestLintDatasetReportsRowsWithMissingColumns(t *testing.T) {
+	warnings := warningsFor(lintFile(t, lintSystem+`1.3.6.1.2.1.2.1.0|integer|3
+1.3.6.1.2.1.2.2.1.1.1|integer|1
+1.3.6.1.2.1.2.2.1.1.2|integer|2
+1.3.6.1.2.1.2.2.1.1.3|integer|3
+1.3.6.1.2.1.2.2.1.2.1|octetstring|eth0
+1.3.6.1.2.1.2.2.1.2.3|octetstring|eth2
+1.3.6.1.2.1.2.2.1.5.1|gauge32|1000
+1.3.6.1.2.1.2.2.1.5.3|gauge32|1000
+`), LintMissingColumns)
+	if len(warnings) != 1 {
+		t.Fatalf("warnings = %v, want one row", warnings)
+	}
+	if warnings[0].OID != "1.3.6.1.2.1.2.2.1.2.2" || !strings.Contains(warnings[0].Message, "row 2 of 1.3.6.1.2.1.2.2.1 lacks column(s) 2, 5") {
+		t.Fatalf("warning = %v", warnings[0])
+	}
+}
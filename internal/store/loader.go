@@ -7,29 +7,28 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
 	"github.com/gosnmp/gosnmp"
 )
 
 // LoadSNMPrecFile loads OIDs from a .snmprec, snmpwalk, or text file
 // Automatically detects format: snmprec (OID|TYPE|VALUE), snmpwalk named (MIB::), or snmpwalk numeric (.1.3...)
 // Also supports template syntax: OID|TYPE|VALUE|#1-48 for range expansion
+// and "#include other.snmprec" directives resolved relative to the including file,
+// plus the "#iftable ports=N" macro that generates a full interface table
 func LoadSNMPrecFile(db *OIDDatabase, filePath string) (int, error) {
-	data, err := os.ReadFile(filePath)
+	lines, err := readWithIncludes(filePath, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read file: %w", err)
+		return 0, err
 	}
 
-	dataStr := string(data)
-
-	// Check if this is snmpwalk format (named or numeric) or .snmprec with possible templates
-	// Snmpwalk formats have " = " separators, .snmprec has "|" separators
-	isSnmpwalk := strings.Contains(dataStr, " = ") && !strings.Contains(dataStr, "|")
+	dataStr := joinSourceLines(lines)
 
 	var count int
 
-	if isSnmpwalk {
+	if isSnmpwalkData(dataStr) {
 		// Parse as snmpwalk output (named or numeric format)
-		parsedDB, err := ParseSnmpwalkOutput(data)
+		parsedDB, err := ParseSnmpwalkOutput([]byte(dataStr))
 		if err != nil {
 			return 0, fmt.Errorf("failed to parse snmpwalk output: %w", err)
 		}
@@ -42,7 +41,7 @@ func LoadSNMPrecFile(db *OIDDatabase, filePath string) (int, error) {
 		})
 	} else {
 		// Parse as .snmprec format with potential templates
-		count, err = loadSnmprec(db, dataStr)
+		count, err = loadSnmprec(db, lines)
 		if err != nil {
 			return 0, err
 		}
@@ -51,13 +50,190 @@ func LoadSNMPrecFile(db *OIDDatabase, filePath string) (int, error) {
 	return count, nil
 }
 
+// LoadSNMPrecData loads snmprec lines held in memory, such as a request
+// body, into db with the same template and macro support as files. Unlike
+// files, which skip lines they cannot use, every OID line must be valid, so
+// a typo is reported instead of silently dropped. Lines are numbered from 1
+// in errors. #include is rejected, since there is no file to resolve it
+// against.
+func LoadSNMPrecData(db *OIDDatabase, data []byte) (int, error) {
+	var lines []sourceLine
+	for i, text := range strings.Split(string(data), "\n") {
+		line := sourceLine{num: i + 1, text: strings.TrimSuffix(text, "\r")}
+		if fields := strings.Fields(line.text); len(fields) > 0 && fields[0] == includeDirective {
+			return 0, fmt.Errorf("%s: %s is only supported in files", line.pos(), includeDirective)
+		}
+		if err := checkSnmprecLine(line.text); err != nil {
+			return 0, fmt.Errorf("%s: %w", line.pos(), err)
+		}
+		lines = append(lines, line)
+	}
+	return loadSnmprec(db, lines)
+}
+
+// checkSnmprecLine validates the OID of a snmprec line and, for plain
+// values, the value against its type. Comments and macros pass.
+func checkSnmprecLine(text string) error {
+	line := strings.TrimSpace(text)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	parts := strings.SplitN(line, "|", 3)
+	if len(parts) < 3 {
+		return fmt.Errorf("expected OID|TYPE|VALUE, got %q", line)
+	}
+	if _, err := parseObjectIdentifier(parts[0]); err != nil {
+		return err
+	}
+	typeStr, valueStr := strings.TrimSpace(parts[1]), strings.TrimSpace(parts[2])
+	if IsTemplateOID(line) || IsValueRef(valueStr) || IsDeviceOID(line) || strings.HasSuffix(typeStr, snmprecfmt.HexTypeSuffix) {
+		return nil // validated while loading
+	}
+	if _, err := ParseOIDValue(typeStr, valueStr); err != nil {
+		return fmt.Errorf("OID %s: invalid %s value %q: %w", strings.TrimSpace(parts[0]), typeStr, valueStr, err)
+	}
+	return nil
+}
+
+const includeDirective = "#include"
+
+// isSnmpwalkData reports whether data is snmpwalk output (named or numeric)
+// rather than .snmprec: snmpwalk formats have " = " separators, .snmprec has "|"
+func isSnmpwalkData(data string) bool {
+	return strings.Contains(data, " = ") && !strings.Contains(data, "|")
+}
+
+// sourceLine is a dataset line tagged with the file and line number it was
+// read from, so errors still point at the original location after includes
+// and macros have been spliced in
+type sourceLine struct {
+	file string
+	num  int
+	text string
+}
+
+func (l sourceLine) pos() string {
+	switch {
+	case l.file == "":
+		return fmt.Sprintf("line %d", l.num)
+	case l.num == 0:
+		return l.file
+	}
+	return fmt.Sprintf("%s line %d", l.file, l.num)
+}
+
+func joinSourceLines(lines []sourceLine) string {
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString(line.text)
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
+
+// readWithIncludes reads filePath and splices the lines of any
+// "#include path" lines in place, so entries after an include override the
+// included ones. stack holds the files currently being expanded to detect cycles.
+// Format is detected per file: an included snmpwalk capture is converted to
+// snmprec lines, but snmpwalk files cannot contain includes themselves.
+func readWithIncludes(filePath string, stack []string) ([]sourceLine, error) {
+	absPath, err := resolveSource(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+	}
+	for _, seen := range stack {
+		if seen == absPath {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, absPath), " -> "))
+		}
+	}
+
+	data, err := readSource(absPath)
+	if err != nil {
+		if len(stack) > 0 {
+			return nil, fmt.Errorf("failed to read included file %s: %w", filePath, err)
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if isSnmpwalkData(string(data)) {
+		for _, text := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(text); len(fields) > 0 && fields[0] == includeDirective {
+				return nil, fmt.Errorf("%s: %s is only supported in .snmprec files", filePath, includeDirective)
+			}
+		}
+		if len(stack) > 0 {
+			return snmpwalkSourceLines(filePath, data)
+		}
+	}
+
+	name := filePath
+	if name == StdinSource {
+		name = "stdin"
+	}
+	stack = append(stack, absPath)
+	var out []sourceLine
+	for i, text := range strings.Split(string(data), "\n") {
+		line := sourceLine{file: name, num: i + 1, text: text}
+		trimmed := strings.TrimSpace(text)
+		fields := strings.Fields(trimmed)
+		if len(fields) == 0 || fields[0] != includeDirective {
+			out = append(out, line)
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: invalid include directive %q", line.pos(), trimmed)
+		}
+
+		target, err := includeTarget(absPath, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include target %q: %w", line.pos(), fields[1], err)
+		}
+		included, err := readWithIncludes(target, stack)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, included...)
+	}
+	return out, nil
+}
+
+// snmpwalkSourceLines parses an included snmpwalk capture and renders it as
+// snmprec lines. The walk parser does not keep line numbers, so errors only
+// name the file.
+func snmpwalkSourceLines(filePath string, data []byte) ([]sourceLine, error) {
+	db, err := ParseSnmpwalkOutput(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse included snmpwalk file %s: %w", filePath, err)
+	}
+	var out []sourceLine
+	db.Walk(func(oid string, value *OIDValue) bool {
+		text, valueErr := snmprecfmt.ValueString(value.Type, value.Value)
+		if valueErr != nil {
+			err = fmt.Errorf("%s: OID %s: %w", filePath, oid, valueErr)
+			return false
+		}
+		out = append(out, sourceLine{
+			file: filePath,
+			text: fmt.Sprintf("%s|%s|%s", oid, snmprecfmt.TypeName(value.Type), text),
+		})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // loadSnmprec parses .snmprec format with template and device mapping support
 // Format: OID|TYPE|VALUE or OID|TYPE|VALUE|#RANGE or OID|TYPE|VALUE@PORT
-func loadSnmprec(db *OIDDatabase, content string) (int, error) {
-	lines := strings.Split(content, "\n")
+func loadSnmprec(db *OIDDatabase, source []sourceLine) (int, error) {
+	lines, err := expandMacros(source)
+	if err != nil {
+		return 0, err
+	}
 
 	// First pass: collect templates and regular entries
-	templates, regularEntries, err := CollectTemplates(lines)
+	templates, regularEntries, err := collectTemplates(lines)
 	if err != nil {
 		return 0, err
 	}
@@ -105,19 +281,16 @@ func loadSnmprec(db *OIDDatabase, content string) (int, error) {
 //
 // Returns a DeviceOIDMapping for use by VirtualAgent
 func LoadDeviceMappings(filePath string) (*DeviceOIDMapping, error) {
-	data, err := os.ReadFile(filePath)
+	lines, err := readWithIncludes(filePath, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read device mapping file: %w", err)
 	}
 
-	dataStr := string(data)
-	lines := strings.Split(dataStr, "\n")
-
 	// Collect and parse device mappings
 	mapping := NewDeviceOIDMapping()
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+	for _, src := range lines {
+		line := strings.TrimSpace(src.text)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
@@ -126,7 +299,7 @@ func LoadDeviceMappings(filePath string) (*DeviceOIDMapping, error) {
 		if IsDeviceOID(line) {
 			entry, err := ParseDeviceOID(line)
 			if err != nil {
-				log.Printf("Warning: failed to parse device mapping '%s': %v", line, err)
+				log.Printf("Warning: failed to parse device mapping on %s '%s': %v", src.pos(), line, err)
 				continue
 			}
 			mapping.AddEntry(entry)
@@ -137,8 +310,9 @@ func LoadDeviceMappings(filePath string) (*DeviceOIDMapping, error) {
 	return mapping, nil
 }
 
-// parseOIDValue converts string representation to actual value
-func parseOIDValue(typeStr, valueStr string) (interface{}, error) {
+// ParseOIDValue converts the string form of a snmprec value to the Go value
+// gosnmp expects for typeStr. Unknown types are an error.
+func ParseOIDValue(typeStr, valueStr string) (interface{}, error) {
 	typeStr = strings.ToLower(strings.TrimSpace(typeStr))
 
 	switch typeStr {
@@ -146,13 +320,17 @@ func parseOIDValue(typeStr, valueStr string) (interface{}, error) {
 		val, err := strconv.ParseInt(valueStr, 10, 32)
 		return int(val), err
 
-	case "counter32", "gauge32", "counter", "gauge", "c32":
-		val, err := strconv.ParseInt(valueStr, 10, 32)
+	case "counter32", "gauge32", "counter", "gauge", "c32", "g":
+		val, err := strconv.ParseUint(valueStr, 10, 32)
+		return uint32(val), err
+
+	case "unsigned32", "uinteger32":
+		val, err := strconv.ParseUint(valueStr, 10, 32)
 		return uint32(val), err
 
 	case "counter64", "c64":
-		val, err := strconv.ParseInt(valueStr, 10, 64)
-		return uint64(val), err
+		val, err := strconv.ParseUint(valueStr, 10, 64)
+		return val, err
 
 	case "timeticks", "tt", "ticks":
 		val, err := strconv.ParseInt(valueStr, 10, 32)
@@ -162,7 +340,7 @@ func parseOIDValue(typeStr, valueStr string) (interface{}, error) {
 		return valueStr, nil
 
 	case "objectidentifier", "oid", "o":
-		return valueStr, nil
+		return parseObjectIdentifier(valueStr)
 
 	case "ipaddress", "ip":
 		return valueStr, nil
@@ -176,13 +354,36 @@ func parseOIDValue(typeStr, valueStr string) (interface{}, error) {
 	case "bits":
 		return valueStr, nil
 
+	case "noresponse":
+		return nil, nil
+
 	default:
 		return nil, fmt.Errorf("unknown type: %s", typeStr)
 	}
 }
 
-// getSNMPType returns the appropriate gosnmp type for a type string
-func getSNMPType(typeStr string) gosnmp.Asn1BER {
+// parseObjectIdentifier validates a dotted-decimal OID value and returns it in
+// the leading-dot form net-snmp and gosnmp use when rendering OID values
+func parseObjectIdentifier(valueStr string) (string, error) {
+	oid := strings.TrimPrefix(strings.TrimSpace(valueStr), ".")
+	if oid == "" {
+		return "", fmt.Errorf("empty object identifier")
+	}
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("object identifier %q needs at least two components", valueStr)
+	}
+	for i, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+			return "", fmt.Errorf("object identifier %q: component %d (%q) is not a number", valueStr, i+1, part)
+		}
+	}
+	return "." + oid, nil
+}
+
+// GetSNMPType returns the gosnmp type for a snmprec type string, defaulting
+// to OctetString
+func GetSNMPType(typeStr string) gosnmp.Asn1BER {
 	typeStr = strings.ToLower(strings.TrimSpace(typeStr))
 
 	switch typeStr {
@@ -194,6 +395,8 @@ func getSNMPType(typeStr string) gosnmp.Asn1BER {
 		return gosnmp.Counter64
 	case "gauge32", "gauge", "g":
 		return gosnmp.Gauge32
+	case "unsigned32", "uinteger32":
+		return gosnmp.Uinteger32
 	case "timeticks", "tt", "ticks":
 		return gosnmp.TimeTicks
 	case "octetstring", "string", "s":
@@ -208,6 +411,8 @@ func getSNMPType(typeStr string) gosnmp.Asn1BER {
 		return gosnmp.NsapAddress
 	case "bits":
 		return gosnmp.BitString
+	case "noresponse":
+		return NoResponse
 	default:
 		return gosnmp.OctetString
 	}
@@ -217,7 +422,7 @@ func getSNMPType(typeStr string) gosnmp.Asn1BER {
 func GenerateDefaultSNMPrecFile(filePath string) error {
 	content := `# SNMP Simulator Record File (.snmprec)
 # Format: OID|TYPE|VALUE
-# Supported types: integer, counter32, gauge32, timeticks, octetstring, objectidentifier, ipaddress
+# Supported types: integer, counter32, gauge32, unsigned32, timeticks, octetstring, objectidentifier, ipaddress
 
 # System group (1.3.6.1.2.1.1)
 1.3.6.1.2.1.1.1.0|octetstring|Simulated SNMP Device
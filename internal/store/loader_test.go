@@ -0,0 +1,475 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestLoadSNMPrecFileIncludeOverridesBase(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base", "system.snmprec"), `1.3.6.1.2.1.1.1.0|octetstring|Generic Device
+1.3.6.1.2.1.1.4.0|octetstring|noc@example.com
+`)
+	devicePath := filepath.Join(dir, "devices", "router.snmprec")
+	writeTestFile(t, devicePath, `#include ../base/system.snmprec
+1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+1.3.6.1.2.1.2.1.0|integer|4
+`)
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, devicePath); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if got := db.Get("1.3.6.1.2.1.1.1.0"); got == nil || got.Value != "Edge Router" {
+		t.Fatalf("sysDescr = %+v, want override from device file", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.1.4.0"); got == nil || got.Value != "noc@example.com" {
+		t.Fatalf("sysContact = %+v, want value from base file", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.2.1.0"); got == nil || got.Value != 4 {
+		t.Fatalf("ifNumber = %+v, want 4", got)
+	}
+}
+
+func TestLoadSNMPrecFileKeepsFullCounter64Range(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hc.snmprec")
+	writeTestFile(t, path, "1.3.6.1.2.1.31.1.1.1.6.1|counter64|18446744073709551000\n")
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := db.Get("1.3.6.1.2.1.31.1.1.1.6.1"); got == nil || got.Value != uint64(18446744073709551000) {
+		t.Fatalf("ifHCInOctets = %+v, want 18446744073709551000", got)
+	}
+}
+
+func TestLoadSNMPrecFileIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.snmprec"), "#include b.snmprec\n1.3.6.1.2.1.1.1.0|octetstring|A\n")
+	writeTestFile(t, filepath.Join(dir, "b.snmprec"), "#include a.snmprec\n1.3.6.1.2.1.1.5.0|octetstring|B\n")
+
+	_, err := LoadSNMPrecFile(NewOIDDatabase(), filepath.Join(dir, "a.snmprec"))
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected include cycle error, got %v", err)
+	}
+}
+
+func TestLoadSNMPrecFileIncludeDetectsSnmpwalkFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "walk.txt"), `.1.3.6.1.2.1.1.1.0 = STRING: "Captured Router"
+.1.3.6.1.2.1.1.5.0 = STRING: "core-1"
+.1.3.6.1.2.1.2.1.0 = INTEGER: 2
+`)
+	devicePath := filepath.Join(dir, "device.snmprec")
+	writeTestFile(t, devicePath, `#include walk.txt
+1.3.6.1.2.1.1.5.0|octetstring|edge-1
+`)
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, devicePath); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := db.Get("1.3.6.1.2.1.1.1.0"); got == nil || got.Value != "Captured Router" {
+		t.Fatalf("sysDescr = %+v, want value from included snmpwalk", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.2.1.0"); got == nil || got.Type != gosnmp.Integer || got.Value != 2 {
+		t.Fatalf("ifNumber = %+v, want integer 2 from included snmpwalk", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.1.5.0"); got == nil || got.Value != "edge-1" {
+		t.Fatalf("sysName = %+v, want override from including file", got)
+	}
+
+	walkPath := filepath.Join(dir, "walk-with-include.txt")
+	writeTestFile(t, walkPath, "#include device.snmprec\n.1.3.6.1.2.1.1.1.0 = STRING: \"x\"\n")
+	if _, err := LoadSNMPrecFile(NewOIDDatabase(), walkPath); err == nil || !strings.Contains(err.Error(), "only supported in .snmprec") {
+		t.Fatalf("expected include-in-snmpwalk error, got %v", err)
+	}
+}
+
+func TestLoadDeviceMappingsFollowsIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "rack.snmprec"), "1.3.6.1.2.1.1.5.0|octetstring|edge-1@Device-1\n")
+	devicePath := filepath.Join(dir, "lab.snmprec")
+	writeTestFile(t, devicePath, "#include rack.snmprec\n1.3.6.1.2.1.1.5.0|octetstring|core-1@20000\n")
+
+	mapping, err := LoadDeviceMappings(devicePath)
+	if err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+	if got := mapping.GetOID("1.3.6.1.2.1.1.5.0", 20001, "Device-1"); got == nil || got.Value != "edge-1" {
+		t.Fatalf("Device-1 sysName = %+v, want mapping from included file", got)
+	}
+	if got := mapping.GetOID("1.3.6.1.2.1.1.5.0", 20000, "Device-0"); got == nil || got.Value != "core-1" {
+		t.Fatalf("port 20000 sysName = %+v, want port mapping", got)
+	}
+}
+
+func TestLoadSNMPrecFileValidatesObjectIdentifiers(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.snmprec")
+	writeTestFile(t, valid, "1.3.6.1.2.1.1.1.0|octetstring|Router\n1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.1.4.1.9.1.1\n")
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, valid); err != nil {
+		t.Fatalf("load valid file: %v", err)
+	}
+	got := db.Get("1.3.6.1.2.1.1.2.0")
+	if got == nil || got.Type != gosnmp.ObjectIdentifier || got.Value != ".1.3.6.1.4.1.9.1.1" {
+		t.Fatalf("sysObjectID = %+v, want .1.3.6.1.4.1.9.1.1", got)
+	}
+
+	invalid := filepath.Join(dir, "invalid.snmprec")
+	writeTestFile(t, invalid, "1.3.6.1.2.1.1.1.0|octetstring|Router\n1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.x\n")
+	_, err := LoadSNMPrecFile(NewOIDDatabase(), invalid)
+	if err == nil {
+		t.Fatal("expected error for invalid objectidentifier value")
+	}
+	if !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), `"x"`) {
+		t.Fatalf("error should name line and bad component, got %v", err)
+	}
+}
+
+func TestLoadSNMPrecFileValidatesRoutedAndTemplateObjectIdentifiers(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"routed.snmprec":   "1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.x@20000\n",
+		"template.snmprec": "1.3.6.1.4.1.55555.4.1|objectidentifier|1.3.6.x|#1-4\n",
+	} {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, content)
+		_, err := LoadSNMPrecFile(NewOIDDatabase(), path)
+		if err == nil || !strings.Contains(err.Error(), "line 1") || !strings.Contains(err.Error(), `"x"`) {
+			t.Fatalf("%s: expected line-numbered objectidentifier error, got %v", name, err)
+		}
+	}
+
+	routed := filepath.Join(dir, "routed-ok.snmprec")
+	writeTestFile(t, routed, "1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.1.4.1.9.1.1@20000\n")
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, routed); err != nil {
+		t.Fatalf("load routed objectidentifier: %v", err)
+	}
+	if got := db.Get("1.3.6.1.2.1.1.2.0"); got == nil || got.Value != ".1.3.6.1.4.1.9.1.1" {
+		t.Fatalf("routed sysObjectID = %+v, want value without route suffix", got)
+	}
+}
+
+func TestLoadSNMPrecFileRoutedLinesDoNotReplacePlainValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routed.snmprec")
+	writeTestFile(t, path, `1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.1.4.1.8072.3.2.10
+1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.1.4.1.9.1.1@Device-2
+1.3.6.1.2.1.4.20.1.1.10.0.0.2|ipaddress|10.0.0.2@Device-2
+`)
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := db.Get("1.3.6.1.2.1.1.2.0"); got == nil || got.Value != ".1.3.6.1.4.1.8072.3.2.10" {
+		t.Fatalf("sysObjectID = %+v, want the plain line's value", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.4.20.1.1.10.0.0.2"); got == nil || got.Value != "10.0.0.2" {
+		t.Fatalf("routed ipaddress = %+v, want value without route suffix", got)
+	}
+}
+
+func TestLoadSNMPrecFileErrorsReportIncludedFileLine(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base.snmprec"), `1.3.6.1.2.1.1.1.0|octetstring|Generic Device
+1.3.6.1.2.1.1.4.0|octetstring|noc@example.com
+1.3.6.1.2.1.1.2.0|objectidentifier|1.3.6.x
+`)
+	devicePath := filepath.Join(dir, "device.snmprec")
+	writeTestFile(t, devicePath, `1.3.6.1.2.1.1.5.0|octetstring|edge-1
+#iftable ports=2
+#include base.snmprec
+`)
+
+	_, err := LoadSNMPrecFile(NewOIDDatabase(), devicePath)
+	if err == nil {
+		t.Fatal("expected error for invalid objectidentifier in included file")
+	}
+	if !strings.Contains(err.Error(), "base.snmprec line 3") {
+		t.Fatalf("error should name the included file and its own line, got %v", err)
+	}
+
+	writeTestFile(t, devicePath, `1.3.6.1.2.1.1.5.0|octetstring|edge-1
+#include other.snmprec
+#iftable ports=0
+`)
+	writeTestFile(t, filepath.Join(dir, "other.snmprec"), "1.3.6.1.2.1.1.6.0|octetstring|lab\n")
+	_, err = LoadSNMPrecFile(NewOIDDatabase(), devicePath)
+	if err == nil || !strings.Contains(err.Error(), "device.snmprec line 3") {
+		t.Fatalf("macro error should name the directive's own line, got %v", err)
+	}
+}
+
+func TestLoadSNMPrecFileIfTableMacro(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "switch.snmprec")
+	writeTestFile(t, path, `#iftable ports=4 speed=10000000000 prefix=ge-0/0/
+1.3.6.1.2.1.2.2.1.8.3|integer|2
+`)
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	db.SortOIDs()
+
+	rows := 0
+	for oid := db.GetNext("1.3.6.1.2.1.2.2.1.1"); strings.HasPrefix(oid, "1.3.6.1.2.1.2.2.1.1."); oid = db.GetNext(oid) {
+		rows++
+	}
+	if rows != 4 {
+		t.Fatalf("walked %d ifIndex rows, want 4", rows)
+	}
+
+	if got := db.Get("1.3.6.1.2.1.2.1.0"); got == nil || got.Value != 4 {
+		t.Fatalf("ifNumber = %+v, want 4", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.2.2.1.2.2"); got == nil || got.Value != "ge-0/0/2" {
+		t.Fatalf("ifDescr.2 = %+v, want ge-0/0/2", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.2.2.1.5.1"); got == nil || got.Type != gosnmp.Gauge32 || got.Value != uint32(4294967295) {
+		t.Fatalf("ifSpeed.1 = %+v, want saturated gauge32", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.31.1.1.1.15.1"); got == nil || got.Value != uint32(10000) {
+		t.Fatalf("ifHighSpeed.1 = %+v, want 10000", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.2.2.1.8.3"); got == nil || got.Value != 2 {
+		t.Fatalf("ifOperStatus.3 = %+v, want override 2", got)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.snmprec")
+	writeTestFile(t, bad, "#iftable speed=100\n")
+	if _, err := LoadSNMPrecFile(NewOIDDatabase(), bad); err == nil || !strings.Contains(err.Error(), "ports") {
+		t.Fatalf("expected missing ports error, got %v", err)
+	}
+}
+
+func TestLoadSNMPrecFileSparseTemplateIndices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sparse.snmprec")
+	writeTestFile(t, path, `1.3.6.1.2.1.2.2.1.5|gauge32|1000000000|#1-48,1001-1004
+#iftable indices=3,1-2,1001 prefix=vlan
+`)
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	db.SortOIDs()
+
+	walk := func(column string) []string {
+		var indices []string
+		for oid := db.GetNext(column); strings.HasPrefix(oid, column+"."); oid = db.GetNext(oid) {
+			indices = append(indices, strings.TrimPrefix(oid, column+"."))
+		}
+		return indices
+	}
+
+	var want []string
+	for i := 1; i <= 48; i++ {
+		want = append(want, strconv.Itoa(i))
+	}
+	want = append(want, "1001", "1002", "1003", "1004")
+	if got := walk("1.3.6.1.2.1.2.2.1.5"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("ifSpeed walk order = %v, want %v", got, want)
+	}
+
+	im := NewOIDIndexManager()
+	if err := im.BuildIndex(db); err != nil {
+		t.Fatalf("build index: %v", err)
+	}
+	var indexed []string
+	for oid, _ := im.GetNext("1.3.6.1.2.1.2.2.1.5", db); strings.HasPrefix(oid, "1.3.6.1.2.1.2.2.1.5."); oid, _ = im.GetNext(oid, db) {
+		indexed = append(indexed, strings.TrimPrefix(oid, "1.3.6.1.2.1.2.2.1.5."))
+	}
+	if strings.Join(indexed, ",") != strings.Join(want, ",") {
+		t.Fatalf("indexed ifSpeed walk order = %v, want %v", indexed, want)
+	}
+
+	if got := walk("1.3.6.1.2.1.2.2.1.1"); strings.Join(got, ",") != "1,2,3,1001" {
+		t.Fatalf("ifIndex walk order = %v, want [1 2 3 1001]", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.2.2.1.2.1001"); got == nil || got.Value != "vlan1001" {
+		t.Fatalf("ifDescr.1001 = %+v, want vlan1001", got)
+	}
+	if got := db.Get("1.3.6.1.2.1.2.1.0"); got == nil || got.Value != 4 {
+		t.Fatalf("ifNumber = %+v, want 4", got)
+	}
+}
+
+func TestLoadSNMPrecFileRejectsBadTemplateSpecs(t *testing.T) {
+	dir := t.TempDir()
+	for name, tc := range map[string]struct{ content, want string }{
+		"huge-list.snmprec": {
+			"1.3.6.1.2.1.1.1.0|octetstring|x\n1.3.6.1.2.1.2.2.1.5|gauge32|1|#1-2,5-2000000000\n",
+			"line 2",
+		},
+		"huge-range.snmprec":   {"1.3.6.1.2.1.2.2.1.5|gauge32|1|#1-2000000000\n", "line 1"},
+		"huge-iftable.snmprec": {"#iftable indices=1-2000000000\n", "line 1"},
+		"bad-spec.snmprec":     {"1.3.6.1.2.1.1.1.0|octetstring|x\n1.3.6.1.2.1.2.2.1.5|gauge32|1|#7-3\n", "line 2"},
+	} {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, tc.content)
+		_, err := LoadSNMPrecFile(NewOIDDatabase(), path)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error mentioning %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestLoadSNMPrecFileFromStdin(t *testing.T) {
+	oldStdin := stdin
+	t.Cleanup(func() {
+		stdin = oldStdin
+		stdinOnce = sync.Once{}
+		stdinData, stdinErr = nil, nil
+	})
+	stdin = strings.NewReader("1.3.6.1.4.1.55555.8.1.0|octetstring|piped\n1.3.6.1.4.1.55555.8.2.0|integer|7@20001\n")
+	stdinOnce = sync.Once{}
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, StdinSource); err != nil {
+		t.Fatalf("load stdin: %v", err)
+	}
+	if val := db.Get("1.3.6.1.4.1.55555.8.1.0"); val == nil || val.Value != "piped" {
+		t.Fatalf("stdin value = %+v", val)
+	}
+
+	// Device mappings parse the same input again from the cached copy
+	mapping, err := LoadDeviceMappings(StdinSource)
+	if err != nil {
+		t.Fatalf("load device mappings from stdin: %v", err)
+	}
+	if val := mapping.GetOID("1.3.6.1.4.1.55555.8.2.0", 20001, "Device-1"); val == nil {
+		t.Fatal("device mapping missing from stdin dataset")
+	}
+}
+
+func TestLoadSNMPrecFileFromURL(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "base.snmprec"), "1.3.6.1.4.1.55555.8.1.0|octetstring|remote-base\n")
+	writeTestFile(t, filepath.Join(dir, "lab", "device.snmprec"), "#include ../base.snmprec\n1.3.6.1.4.1.55555.8.2.0|octetstring|remote\n")
+	writeTestFile(t, filepath.Join(dir, "big.snmprec"), strings.Repeat("1.3.6.1.4.1.55555.8.3.0|octetstring|x\n", 100))
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, server.URL+"/lab/device.snmprec"); err != nil {
+		t.Fatalf("load URL: %v", err)
+	}
+	if val := db.Get("1.3.6.1.4.1.55555.8.2.0"); val == nil || val.Value != "remote" {
+		t.Fatalf("URL value = %+v", val)
+	}
+	if val := db.Get("1.3.6.1.4.1.55555.8.1.0"); val == nil || val.Value != "remote-base" {
+		t.Fatalf("include relative to the URL = %+v", val)
+	}
+
+	if _, err := LoadSNMPrecFile(NewOIDDatabase(), server.URL+"/missing.snmprec"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("missing URL error = %v, want HTTP 404", err)
+	}
+
+	oldMax := maxRemoteDatasetBytes
+	maxRemoteDatasetBytes = 512
+	defer func() { maxRemoteDatasetBytes = oldMax }()
+	if _, err := LoadSNMPrecFile(NewOIDDatabase(), server.URL+"/big.snmprec"); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("oversized URL error = %v, want size limit error", err)
+	}
+}
+
+func TestLoadSNMPrecFileParsesValueRefs(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "ref.snmprec")
+	writeTestFile(t, valid, "1.3.6.1.2.1.2.2.1.5.1|gauge32|1000000000\n1.3.6.1.2.1.31.1.1.1.15.1|gauge32|ref:.1.3.6.1.2.1.2.2.1.5.1/1000000\n")
+
+	db := NewOIDDatabase()
+	if _, err := LoadSNMPrecFile(db, valid); err != nil {
+		t.Fatalf("load valid file: %v", err)
+	}
+	got := db.Get("1.3.6.1.2.1.31.1.1.1.15.1")
+	ref, ok := got.Value.(*ValueRef)
+	if !ok || got.Type != gosnmp.Gauge32 || ref.OID != "1.3.6.1.2.1.2.2.1.5.1" || ref.Op != '/' || ref.Operand != 1000000 {
+		t.Fatalf("ifHighSpeed = %+v, want a gauge32 reference dividing ifSpeed by 1000000", got)
+	}
+	resolved, err := ref.Resolve(got.Type, db.Get("1.3.6.1.2.1.2.2.1.5.1"))
+	if err != nil || resolved.Value != uint32(1000) {
+		t.Fatalf("resolved = %+v, %v; want 1000", resolved, err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.snmprec")
+	writeTestFile(t, invalid, "1.3.6.1.2.1.31.1.1.1.15.1|gauge32|ref:1.3.6.1.2.1.2.2.1.5.1/0\n")
+	if _, err := LoadSNMPrecFile(NewOIDDatabase(), invalid); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected a line-numbered error for division by zero, got %v", err)
+	}
+}
+
+func TestLoadOIDDatabaseWithoutDefaultOIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "minimal.snmprec")
+	writeTestFile(t, path, "1.3.6.1.2.1.1.1.0|octetstring|Edge Router\n1.3.6.1.4.1.55555.1.0|integer|7\n")
+
+	db, err := LoadOIDDatabase(path, LoadOptions{NoDefaultOIDs: true})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	var walked []string
+	db.Walk(func(oid string, _ *OIDValue) bool {
+		walked = append(walked, oid)
+		return true
+	})
+	if strings.Join(walked, ",") != "1.3.6.1.2.1.1.1.0,1.3.6.1.4.1.55555.1.0" {
+		t.Fatalf("walk = %v, want only the file's OIDs", walked)
+	}
+	if got := db.Get("1.3.6.1.2.1.1.1.0"); got == nil || got.Value != "Edge Router" {
+		t.Fatalf("sysDescr = %+v, want the file's value", got)
+	}
+
+	withDefaults, err := LoadOIDDatabase(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("load with defaults: %v", err)
+	}
+	if withDefaults.Get("1.3.6.1.2.1.2.1.0") == nil {
+		t.Fatal("expected default ifNumber when defaults are on")
+	}
+}
+
+func TestLoadSNMPrecDataRejectsInvalidLines(t *testing.T) {
+	db := NewOIDDatabase()
+	count, err := LoadSNMPrecData(db, []byte("# comment\n1.3.6.1.2.1.1.5.0|octetstring|router\r\n1.3.6.1.2.1.1.7.0|integer|72\n"))
+	if err != nil || count != 2 {
+		t.Fatalf("load = %d, %v; want 2 OIDs", count, err)
+	}
+	if got := db.Get("1.3.6.1.2.1.1.5.0"); got == nil || got.Value != "router" {
+		t.Fatalf("sysName = %+v", got)
+	}
+
+	for _, bad := range []string{
+		"1.3.6.1.2.1.1.5.0|octetstring",
+		"1.3.x.1|octetstring|router",
+		"1.3.6.1.2.1.1.7.0|integer|seventy-two",
+		"#include other.snmprec",
+	} {
+		if _, err := LoadSNMPrecData(NewOIDDatabase(), []byte("1.3.6.1.2.1.1.1.0|octetstring|ok\n"+bad+"\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("load %q: err = %v, want a line 2 error", bad, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const ifTableDirective = "#iftable"
+
+const (
+	ifNumberOID   = "1.3.6.1.2.1.2.1.0"
+	ifEntryOID    = "1.3.6.1.2.1.2.2.1"
+	ifXEntryOID   = "1.3.6.1.2.1.31.1.1.1"
+	maxGauge32    = 4294967295
+	defaultIfMTU  = 1500
+	defaultIfType = 6 // ethernetCsmacd
+)
+
+// ifTableOptions are the key=value arguments of an #iftable directive
+type ifTableOptions struct {
+	ports   int
+	indices []int
+	speed   uint64
+	prefix  string
+	ifType  int
+	mtu     int
+	oper    int
+}
+
+// expandMacros replaces macro directives with the snmprec lines they generate.
+// Generated lines take the directive's place, so entries after it override
+// the generated defaults, and errors in them report the directive's position.
+//
+//	#iftable ports=48 speed=1000000000 prefix=ge-0/0/
+//	#iftable indices=1-48,1001-1004
+func expandMacros(lines []sourceLine) ([]sourceLine, error) {
+	var out []sourceLine
+	for _, line := range lines {
+		fields := strings.Fields(strings.TrimSpace(line.text))
+		if len(fields) == 0 || fields[0] != ifTableDirective {
+			out = append(out, line)
+			continue
+		}
+		opts, err := parseIfTableOptions(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", line.pos(), ifTableDirective, err)
+		}
+		for _, text := range ifTableLines(opts) {
+			out = append(out, sourceLine{file: line.file, num: line.num, text: text})
+		}
+	}
+	return out, nil
+}
+
+func parseIfTableOptions(args []string) (ifTableOptions, error) {
+	opts := ifTableOptions{
+		speed:  1000000000,
+		prefix: "eth",
+		ifType: defaultIfType,
+		mtu:    defaultIfMTU,
+		oper:   1,
+	}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return opts, fmt.Errorf("invalid argument %q (want key=value)", arg)
+		}
+		var err error
+		switch key {
+		case "ports":
+			opts.ports, err = strconv.Atoi(value)
+		case "indices":
+			opts.indices, err = parseIndexList(value)
+		case "speed":
+			opts.speed, err = strconv.ParseUint(value, 10, 64)
+		case "prefix":
+			opts.prefix = value
+		case "type":
+			opts.ifType, err = strconv.Atoi(value)
+		case "mtu":
+			opts.mtu, err = strconv.Atoi(value)
+		case "status":
+			switch value {
+			case "up":
+				opts.oper = 1
+			case "down":
+				opts.oper = 2
+			default:
+				err = fmt.Errorf("want up or down")
+			}
+		default:
+			return opts, fmt.Errorf("unknown argument %q", key)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+	}
+	if opts.indices == nil {
+		if opts.ports <= 0 || opts.ports > maxTemplateIndices {
+			return opts, fmt.Errorf("ports must be between 1 and %d", maxTemplateIndices)
+		}
+		for idx := 1; idx <= opts.ports; idx++ {
+			opts.indices = append(opts.indices, idx)
+		}
+	}
+	return opts, nil
+}
+
+// ifTableLines generates ifNumber plus one ifTable and ifXTable row per index
+func ifTableLines(opts ifTableOptions) []string {
+	ifSpeed := opts.speed
+	if ifSpeed > maxGauge32 {
+		ifSpeed = maxGauge32
+	}
+
+	type column struct {
+		oid   string
+		typ   string
+		value func(idx int) string
+	}
+	constant := func(v string) func(int) string { return func(int) string { return v } }
+	name := func(idx int) string { return opts.prefix + strconv.Itoa(idx) }
+
+	columns := []column{
+		{ifEntryOID + ".1", "integer", strconv.Itoa},
+		{ifEntryOID + ".2", "octetstring", name},
+		{ifEntryOID + ".3", "integer", constant(strconv.Itoa(opts.ifType))},
+		{ifEntryOID + ".4", "integer", constant(strconv.Itoa(opts.mtu))},
+		{ifEntryOID + ".5", "gauge32", constant(strconv.FormatUint(ifSpeed, 10))},
+		{ifEntryOID + ".7", "integer", constant("1")},
+		{ifEntryOID + ".8", "integer", constant(strconv.Itoa(opts.oper))},
+		{ifEntryOID + ".9", "timeticks", constant("0")},
+		{ifEntryOID + ".10", "counter32", constant("0")},
+		{ifEntryOID + ".16", "counter32", constant("0")},
+		{ifXEntryOID + ".1", "octetstring", name},
+		{ifXEntryOID + ".6", "counter64", constant("0")},
+		{ifXEntryOID + ".10", "counter64", constant("0")},
+		{ifXEntryOID + ".15", "gauge32", constant(strconv.FormatUint(opts.speed/1000000, 10))},
+		{ifXEntryOID + ".18", "octetstring", constant("")},
+	}
+
+	lines := make([]string, 0, 1+len(columns)*len(opts.indices))
+	lines = append(lines, fmt.Sprintf("%s|integer|%d", ifNumberOID, len(opts.indices)))
+	for _, col := range columns {
+		for _, idx := range opts.indices {
+			lines = append(lines, fmt.Sprintf("%s.%d|%s|%s", col.oid, idx, col.typ, col.value(idx)))
+		}
+	}
+	return lines
+}
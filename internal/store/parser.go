@@ -5,6 +5,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
 	"github.com/gosnmp/gosnmp"
 )
 
@@ -358,11 +359,19 @@ func parseSnmprec(data string) ([]*OIDEntry, error) {
 		}
 
 		oid := strings.TrimSpace(parts[0])
-		typeStr := strings.TrimSpace(parts[1])
-		valueStr := strings.TrimSpace(parts[2])
+		typeStr, valueStr, err := snmprecfmt.DecodeValue(strings.TrimSpace(parts[1]), strings.TrimSpace(parts[2]))
+		if err != nil {
+			log.Printf("Warning: Failed to parse OID %s on line %d: %v", oid, lineNum+1, err)
+			continue
+		}
 
 		// Parse type and value
-		value, err := parseOIDValue(typeStr, valueStr)
+		var value interface{}
+		if IsValueRef(valueStr) {
+			value, err = ParseValueRef(valueStr)
+		} else {
+			value, err = ParseOIDValue(typeStr, valueStr)
+		}
 		if err != nil {
 			log.Printf("Warning: Failed to parse OID %s on line %d: %v", oid, lineNum+1, err)
 			continue
@@ -370,7 +379,7 @@ func parseSnmprec(data string) ([]*OIDEntry, error) {
 
 		entries = append(entries, &OIDEntry{
 			OID:   oid,
-			Type:  getSNMPType(typeStr),
+			Type:  GetSNMPType(typeStr),
 			Value: value,
 		})
 	}
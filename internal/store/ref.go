@@ -0,0 +1,135 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// RefPrefix marks a snmprec value that references another OID:
+//
+//	1.3.6.1.2.1.2.2.1.5.1|gauge32|1000000000
+//	1.3.6.1.2.1.31.1.1.1.15.1|gauge32|ref:1.3.6.1.2.1.2.2.1.5.1/1000000
+const RefPrefix = "ref:"
+
+// ValueRef is the value of an entry that serves another OID's current value,
+// optionally transformed by one integer operation (* / + -). It is resolved
+// at request time, so overlays and SETs on the source show up in the entry.
+type ValueRef struct {
+	OID     string
+	Op      byte // 0 (none), '*', '/', '+' or '-'
+	Operand int64
+}
+
+// IsValueRef reports whether a snmprec value uses the ref: syntax
+func IsValueRef(valueStr string) bool {
+	return strings.HasPrefix(strings.TrimSpace(valueStr), RefPrefix)
+}
+
+// ParseValueRef parses ref:OID[OP N]
+func ParseValueRef(valueStr string) (*ValueRef, error) {
+	spec := strings.TrimPrefix(strings.TrimSpace(valueStr), RefPrefix)
+	ref := &ValueRef{}
+	oidPart := spec
+	if i := strings.IndexAny(spec, "*/+-"); i >= 0 {
+		oidPart = spec[:i]
+		ref.Op = spec[i]
+		operand, err := strconv.ParseInt(strings.TrimSpace(spec[i+1:]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("reference %q: invalid operand: %w", valueStr, err)
+		}
+		if ref.Op == '/' && operand == 0 {
+			return nil, fmt.Errorf("reference %q: division by zero", valueStr)
+		}
+		ref.Operand = operand
+	}
+	oid, err := parseObjectIdentifier(oidPart)
+	if err != nil {
+		return nil, fmt.Errorf("reference %q: %w", valueStr, err)
+	}
+	ref.OID = strings.TrimPrefix(oid, ".")
+	return ref, nil
+}
+
+// String returns the snmprec form of the reference
+func (r *ValueRef) String() string {
+	if r.Op == 0 {
+		return RefPrefix + r.OID
+	}
+	return fmt.Sprintf("%s%s%c%d", RefPrefix, r.OID, r.Op, r.Operand)
+}
+
+// Resolve converts the referenced OID's value to typ, applying the
+// transform. Without a transform only the Go representation changes, so
+// string-typed references copy the source as is.
+func (r *ValueRef) Resolve(typ gosnmp.Asn1BER, source *OIDValue) (*OIDValue, error) {
+	if r.Op == 0 && !isNumericType(typ) {
+		return &OIDValue{Type: typ, Value: source.Value}, nil
+	}
+	n, err := refNumber(source.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", r, err)
+	}
+	switch r.Op {
+	case '*':
+		n *= r.Operand
+	case '/':
+		n /= r.Operand
+	case '+':
+		n += r.Operand
+	case '-':
+		n -= r.Operand
+	}
+	switch typ {
+	case gosnmp.Integer:
+		return &OIDValue{Type: typ, Value: int(n)}, nil
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		if n < 0 {
+			n = 0
+		}
+		if n > maxGauge32 {
+			n = maxGauge32
+		}
+		return &OIDValue{Type: typ, Value: uint32(n)}, nil
+	case gosnmp.Counter64:
+		if n < 0 {
+			n = 0
+		}
+		return &OIDValue{Type: typ, Value: uint64(n)}, nil
+	default:
+		return &OIDValue{Type: typ, Value: strconv.FormatInt(n, 10)}, nil
+	}
+}
+
+func isNumericType(typ gosnmp.Asn1BER) bool {
+	switch typ {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32, gosnmp.Counter64:
+		return true
+	}
+	return false
+}
+
+func refNumber(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	case []byte:
+		return strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64)
+	default:
+		return 0, fmt.Errorf("source value %v (%T) is not a number", value, value)
+	}
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayTimeLayouts are the capture timestamps recognized in replay file
+// names, longest first so a shorter layout never matches part of a longer one
+var replayTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15-04-05",
+	"2006-01-02_15-04-05",
+	"20060102T150405",
+	"20060102-150405",
+	"20060102150405",
+	"2006-01-02T15-04",
+	"2006-01-02_15-04",
+	"20060102T1504",
+	"20060102-1504",
+	"200601021504",
+}
+
+// ReplaySnapshot is one capture of a replay series, Offset after the first
+type ReplaySnapshot struct {
+	Path   string
+	Offset time.Duration
+}
+
+// ReplaySeries is a time series of snmprec captures of one device, served in
+// order by replay mode
+type ReplaySeries struct {
+	Snapshots []ReplaySnapshot
+}
+
+// LoadReplaySeries lists the .snmprec files of dir as a replay series. With
+// interval > 0 the files are taken in name order, interval apart. Otherwise
+// each name must carry its capture time, either as a timestamp such as
+// 20240101T120000 or 2024-01-01T12-00-00 or as 10-digit Unix seconds, and the
+// files are ordered and spaced by those times.
+func LoadReplaySeries(dir string, interval time.Duration) (*ReplaySeries, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.snmprec"))
+	if err != nil {
+		return nil, fmt.Errorf("list replay captures: %w", err)
+	}
+	if len(paths) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("replay directory: %w", err)
+		}
+		return nil, fmt.Errorf("replay directory %s has no .snmprec files", dir)
+	}
+	sort.Strings(paths)
+
+	series := &ReplaySeries{Snapshots: make([]ReplaySnapshot, len(paths))}
+	if interval > 0 {
+		for i, path := range paths {
+			series.Snapshots[i] = ReplaySnapshot{Path: path, Offset: time.Duration(i) * interval}
+		}
+		return series, nil
+	}
+
+	type capture struct {
+		path string
+		at   time.Time
+	}
+	captures := make([]capture, len(paths))
+	for i, path := range paths {
+		t, ok := captureTime(filepath.Base(path))
+		if !ok {
+			return nil, fmt.Errorf("replay capture %s has no timestamp in its name; name the files by capture time or set a replay interval", filepath.Base(path))
+		}
+		captures[i] = capture{path: path, at: t}
+	}
+	sort.SliceStable(captures, func(i, j int) bool { return captures[i].at.Before(captures[j].at) })
+	for i, c := range captures {
+		series.Snapshots[i] = ReplaySnapshot{Path: c.path, Offset: c.at.Sub(captures[0].at)}
+	}
+	return series, nil
+}
+
+// captureTime finds the capture timestamp in a file name
+func captureTime(name string) (time.Time, bool) {
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	for _, layout := range replayTimeLayouts {
+		for i := 0; i+len(layout) <= len(stem); i++ {
+			if t, err := time.Parse(layout, stem[i:i+len(layout)]); err == nil {
+				return t, true
+			}
+		}
+	}
+	for i := 0; i+10 <= len(stem); i++ {
+		digits := stem[i : i+10]
+		if (i > 0 && isDigit(stem[i-1])) || (i+10 < len(stem) && isDigit(stem[i+10])) {
+			continue
+		}
+		if sec, err := strconv.ParseInt(digits, 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Duration is the offset of the last snapshot
+func (s *ReplaySeries) Duration() time.Duration {
+	return s.Snapshots[len(s.Snapshots)-1].Offset
+}
+
+// period is the length of one pass of a looping series: up to the last
+// capture plus the gap before it, so the last capture is served as long as
+// the others
+func (s *ReplaySeries) period() time.Duration {
+	n := len(s.Snapshots)
+	if n < 2 {
+		return 0
+	}
+	return s.Duration() + s.Snapshots[n-1].Offset - s.Snapshots[n-2].Offset
+}
+
+// At returns the index of the snapshot current at elapsed, the series time
+// since the first capture. Past the last capture the series holds on it, or
+// with loop starts over one capture interval after it.
+func (s *ReplaySeries) At(elapsed time.Duration, loop bool) int {
+	if period := s.period(); loop && period > 0 {
+		elapsed %= period
+	}
+	// first snapshot with an offset past elapsed; the one before is current
+	i := sort.Search(len(s.Snapshots), func(i int) bool { return s.Snapshots[i].Offset > elapsed })
+	if i == 0 {
+		return 0
+	}
+	return i - 1
+}
+
+// Next returns how much series time after elapsed the next snapshot becomes
+// current; ok is false once a series that does not loop reached its last one
+func (s *ReplaySeries) Next(elapsed time.Duration, loop bool) (wait time.Duration, ok bool) {
+	period := s.period()
+	if loop && period > 0 {
+		elapsed %= period
+	}
+	if i := s.At(elapsed, false) + 1; i < len(s.Snapshots) {
+		return s.Snapshots[i].Offset - elapsed, true
+	}
+	if loop && period > 0 {
+		return period - elapsed, true
+	}
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadReplaySeriesOrdersCapturesByNameTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	// name order differs from capture order
+	for _, name := range []string{"b-20240101T120200.snmprec", "a-20240101T120500.snmprec", "c-20240101T120000.snmprec", "notes.txt"} {
+		writeTestFile(t, filepath.Join(dir, name), "1.3.6.1.2.1.1.5.0|octetstring|r\n")
+	}
+	series, err := LoadReplaySeries(dir, 0)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	want := []struct {
+		name   string
+		offset time.Duration
+	}{
+		{"c-20240101T120000.snmprec", 0},
+		{"b-20240101T120200.snmprec", 2 * time.Minute},
+		{"a-20240101T120500.snmprec", 5 * time.Minute},
+	}
+	if len(series.Snapshots) != len(want) {
+		t.Fatalf("snapshots = %+v, want %d", series.Snapshots, len(want))
+	}
+	for i, w := range want {
+		if got := series.Snapshots[i]; filepath.Base(got.Path) != w.name || got.Offset != w.offset {
+			t.Errorf("snapshot %d = %s at %s, want %s at %s", i, filepath.Base(got.Path), got.Offset, w.name, w.offset)
+		}
+	}
+}
+
+func TestCaptureTimeFormats(t *testing.T) {
+	want := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{
+		"router-20240101T120000.snmprec",
+		"2024-01-01T12-00-00.snmprec",
+		"walk_2024-01-01_12-00-00.snmprec",
+		"20240101-1200.snmprec",
+		"1704110400.snmprec",
+	} {
+		got, ok := captureTime(name)
+		if !ok || !got.Equal(want) {
+			t.Errorf("captureTime(%q) = %v, %v; want %v", name, got, ok, want)
+		}
+	}
+	if _, ok := captureTime("router.snmprec"); ok {
+		t.Error("a name without a timestamp parsed")
+	}
+}
+
+func TestLoadReplaySeriesNeedsTimestampsOrInterval(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "first.snmprec"), "1.3.6.1.2.1.1.5.0|octetstring|r\n")
+	writeTestFile(t, filepath.Join(dir, "second.snmprec"), "1.3.6.1.2.1.1.5.0|octetstring|r\n")
+	if _, err := LoadReplaySeries(dir, 0); err == nil || !strings.Contains(err.Error(), "no timestamp") {
+		t.Fatalf("err = %v, want a missing timestamp error", err)
+	}
+	series, err := LoadReplaySeries(dir, time.Minute)
+	if err != nil {
+		t.Fatalf("load with interval: %v", err)
+	}
+	if filepath.Base(series.Snapshots[1].Path) != "second.snmprec" || series.Snapshots[1].Offset != time.Minute {
+		t.Fatalf("snapshots = %+v", series.Snapshots)
+	}
+}
+
+func TestReplaySeriesAtAndNext(t *testing.T) {
+	series := &ReplaySeries{Snapshots: []ReplaySnapshot{{Offset: 0}, {Offset: time.Minute}, {Offset: 3 * time.Minute}}}
+	for _, tc := range []struct {
+		elapsed  time.Duration
+		loop     bool
+		index    int
+		wait     time.Duration
+		advances bool
+	}{
+		{0, false, 0, time.Minute, true},
+		{90 * time.Second, false, 1, 90 * time.Second, true},
+		{10 * time.Minute, false, 2, 0, false},
+		// a loop runs 5 minutes: the last capture lasts as long as the gap before it
+		{4 * time.Minute, true, 2, time.Minute, true},
+		{5*time.Minute + 30*time.Second, true, 0, 30 * time.Second, true},
+	} {
+		if got := series.At(tc.elapsed, tc.loop); got != tc.index {
+			t.Errorf("At(%s, %v) = %d, want %d", tc.elapsed, tc.loop, got, tc.index)
+		}
+		wait, ok := series.Next(tc.elapsed, tc.loop)
+		if wait != tc.wait || ok != tc.advances {
+			t.Errorf("Next(%s, %v) = %s, %v; want %s, %v", tc.elapsed, tc.loop, wait, ok, tc.wait, tc.advances)
+		}
+	}
+}
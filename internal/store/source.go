@@ -0,0 +1,109 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StdinSource is the dataset path that reads the dataset from standard input.
+const StdinSource = "-"
+
+var (
+	// remoteDatasetTimeout bounds fetching an http(s):// dataset
+	remoteDatasetTimeout = 30 * time.Second
+	// maxRemoteDatasetBytes caps datasets read from stdin or a URL
+	maxRemoteDatasetBytes int64 = 128 << 20
+
+	// stdin is read once and cached, since the dataset is parsed more than
+	// once (values, then device mappings)
+	stdin     io.Reader = os.Stdin
+	stdinOnce sync.Once
+	stdinData []byte
+	stdinErr  error
+)
+
+func isURLSource(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// resolveSource normalizes a dataset path: files become absolute, while
+// stdin and URLs are kept as given.
+func resolveSource(path string) (string, error) {
+	if path == StdinSource || isURLSource(path) {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
+
+// includeTarget resolves an #include target relative to the including
+// source: a URL against the including URL, a path against the including
+// file's directory (the working directory for stdin).
+func includeTarget(from, target string) (string, error) {
+	if isURLSource(target) || filepath.IsAbs(target) {
+		return target, nil
+	}
+	if isURLSource(from) {
+		base, err := url.Parse(from)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(target)
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+	if from == StdinSource {
+		return target, nil
+	}
+	return filepath.Join(filepath.Dir(from), target), nil
+}
+
+// readSource returns the contents of a dataset file, stdin ("-") or an
+// http(s):// URL.
+func readSource(path string) ([]byte, error) {
+	switch {
+	case path == StdinSource:
+		stdinOnce.Do(func() {
+			stdinData, stdinErr = readLimited(stdin, "stdin")
+		})
+		return stdinData, stdinErr
+	case isURLSource(path):
+		return fetchDataset(path)
+	}
+	return os.ReadFile(path)
+}
+
+func fetchDataset(rawURL string) ([]byte, error) {
+	client := &http.Client{Timeout: remoteDatasetTimeout}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: HTTP %s", rawURL, resp.Status)
+	}
+	if resp.ContentLength > maxRemoteDatasetBytes {
+		return nil, fmt.Errorf("fetch %s: dataset exceeds %d bytes", rawURL, maxRemoteDatasetBytes)
+	}
+	return readLimited(resp.Body, rawURL)
+}
+
+func readLimited(r io.Reader, name string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxRemoteDatasetBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	if int64(len(data)) > maxRemoteDatasetBytes {
+		return nil, fmt.Errorf("read %s: dataset exceeds %d bytes", name, maxRemoteDatasetBytes)
+	}
+	return data, nil
+}
@@ -93,33 +93,22 @@ func (t *SNMPTable) GetValue(colIndex int, rowIndex string) (interface{}, bool,
 // Used by GetNext and GetBulk operations
 // Returns: next OID, value, found
 func (t *SNMPTable) GetNextValue(colIndex int, rowIndex string) (string, interface{}, bool) {
-	// Find current position using numeric-aware search
-	rowPos := searchRowIDs(t.SortedRowIDs, rowIndex)
-
-	// Try next row in current column
-	if rowPos < len(t.SortedRowIDs)-1 {
-		nextRowID := t.SortedRowIDs[rowPos+1]
-		if val, colExists, _ := t.GetValue(colIndex, nextRowID); colExists {
-			oid := fmt.Sprintf("%s.%d.%s", t.EntryOID, colIndex, nextRowID)
-			return oid, val, true
-		}
+	// Next row that has the current column
+	if nextRowID, val, found := t.GetNextRowForColumn(colIndex, rowIndex); found {
+		return fmt.Sprintf("%s.%d.%s", t.EntryOID, colIndex, nextRowID), val, true
 	}
 
-	// Next column, first row
+	// First row of a later column; sparse rows may lack it
 	cols := make([]int, 0, len(t.Columns))
 	for col := range t.Columns {
 		cols = append(cols, col)
 	}
 	sort.Ints(cols)
 
-	colPos := sort.SearchInts(cols, colIndex)
-	if colPos < len(cols)-1 {
-		nextCol := cols[colPos+1]
-		if len(t.SortedRowIDs) > 0 {
-			firstRow := t.SortedRowIDs[0]
-			if val, ok, _ := t.GetValue(nextCol, firstRow); ok {
-				oid := fmt.Sprintf("%s.%d.%s", t.EntryOID, nextCol, firstRow)
-				return oid, val, true
+	for _, col := range cols[sort.SearchInts(cols, colIndex+1):] {
+		for _, rowID := range t.SortedRowIDs {
+			if val, ok, _ := t.GetValue(col, rowID); ok {
+				return fmt.Sprintf("%s.%d.%s", t.EntryOID, col, rowID), val, true
 			}
 		}
 	}
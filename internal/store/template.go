@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
 	"github.com/gosnmp/gosnmp"
 )
 
@@ -17,6 +18,7 @@ const (
 	TemplateRange                   // #1-10, #0-47  -> explicit range
 	TemplateExpression              // #1-$count     -> expression-based
 	TemplateAutoDetect              // Auto-detect from file indices
+	TemplateList                    // #1-48,1001-1004 -> sparse index list
 )
 
 // OIDTemplate represents a template OID with expansion rules
@@ -35,6 +37,7 @@ type TemplatePattern struct {
 	EndIndex   int            // For range: end
 	Step       int            // For range: step (usually 1)
 	Expression string         // For expression: like "$device_count"
+	Indices    []int          // For list: sorted unique indices
 	Variables  map[string]int // Runtime variables
 }
 
@@ -44,6 +47,7 @@ type TemplatePattern struct {
 //
 //	1.3.6.1.2.1.2.2.1.5|integer|1000000000|#1-48
 //	1.3.6.1.2.1.2.2.1.2|octetstring|eth0|#0-47
+//	1.3.6.1.2.1.2.2.1.2|octetstring|eth0|#1-48,1001-1004
 func ParseTemplateOID(line string) (*OIDTemplate, error) {
 	parts := strings.SplitN(line, "|", 4)
 
@@ -57,10 +61,17 @@ func ParseTemplateOID(line string) (*OIDTemplate, error) {
 
 	template := &OIDTemplate{
 		OID:        oid,
-		Type:       getSNMPType(typeStr),
+		Type:       GetSNMPType(typeStr),
 		Value:      parseTemplateValue(typeStr, value),
 		IsTemplate: false,
 	}
+	if template.Type == gosnmp.ObjectIdentifier {
+		oidValue, err := parseObjectIdentifier(value)
+		if err != nil {
+			return nil, fmt.Errorf("OID %s: %w", oid, err)
+		}
+		template.Value = oidValue
+	}
 
 	// Check for template specification (4th field)
 	if len(parts) == 4 {
@@ -76,7 +87,7 @@ func ParseTemplateOID(line string) (*OIDTemplate, error) {
 	return template, nil
 }
 
-// parseTemplatePattern parses template spec like "#1-10" or "#1-$count"
+// parseTemplatePattern parses template spec like "#1-10", "#1-48,1001-1004" or "#1-$count"
 func parseTemplatePattern(spec string, oid string) (*TemplatePattern, error) {
 	if !strings.HasPrefix(spec, "#") {
 		return nil, fmt.Errorf("invalid template spec: %s", spec)
@@ -84,6 +95,19 @@ func parseTemplatePattern(spec string, oid string) (*TemplatePattern, error) {
 
 	spec = strings.TrimPrefix(spec, "#")
 
+	// Comma-separated ranges and single indices for sparse tables
+	if strings.Contains(spec, ",") {
+		indices, err := parseIndexList(spec)
+		if err != nil {
+			return nil, err
+		}
+		return &TemplatePattern{
+			Type:      TemplateList,
+			Indices:   indices,
+			Variables: make(map[string]int),
+		}, nil
+	}
+
 	// Check for expression like "1-$device_count"
 	if strings.Contains(spec, "$") {
 		parts := strings.SplitN(spec, "-", 2)
@@ -120,6 +144,9 @@ func parseTemplatePattern(spec string, oid string) (*TemplatePattern, error) {
 	if start > end {
 		return nil, fmt.Errorf("invalid range: start (%d) > end (%d)", start, end)
 	}
+	if end-start >= maxTemplateIndices {
+		return nil, fmt.Errorf("range #%s exceeds %d indices", spec, maxTemplateIndices)
+	}
 
 	return &TemplatePattern{
 		Type:       TemplateRange,
@@ -130,6 +157,49 @@ func parseTemplatePattern(spec string, oid string) (*TemplatePattern, error) {
 	}, nil
 }
 
+// maxTemplateIndices caps how many rows one template or #iftable may
+// generate, so a typo like #1-2000000000 fails the load instead of
+// exhausting memory
+const maxTemplateIndices = 1 << 20
+
+// parseIndexList parses "1-48,1001,1003-1004" into sorted unique indices
+func parseIndexList(spec string) ([]int, error) {
+	seen := make(map[int]bool)
+	var indices []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("invalid index list: #%s", spec)
+		}
+		start, end := part, part
+		if lo, hi, ok := strings.Cut(part, "-"); ok {
+			start, end = lo, hi
+		}
+		first, err1 := strconv.Atoi(strings.TrimSpace(start))
+		last, err2 := strconv.Atoi(strings.TrimSpace(end))
+		if err1 != nil || err2 != nil || first < 0 {
+			return nil, fmt.Errorf("invalid index range %q in #%s", part, spec)
+		}
+		if first > last {
+			return nil, fmt.Errorf("invalid range: start (%d) > end (%d)", first, last)
+		}
+		if last-first >= maxTemplateIndices {
+			return nil, fmt.Errorf("index list #%s exceeds %d indices", spec, maxTemplateIndices)
+		}
+		for i := first; i <= last; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indices = append(indices, i)
+			}
+		}
+		if len(indices) > maxTemplateIndices {
+			return nil, fmt.Errorf("index list #%s exceeds %d indices", spec, maxTemplateIndices)
+		}
+	}
+	sort.Ints(indices)
+	return indices, nil
+}
+
 // ExpandTemplates expands all templates in database with discovered indices
 func ExpandTemplates(templates []*OIDTemplate, knownIndices []int) []*OIDEntry {
 	var expanded []*OIDEntry
@@ -162,6 +232,16 @@ func expandSingleTemplate(tmpl *OIDTemplate, knownIndices []int) []*OIDEntry {
 			})
 		}
 
+	case TemplateList:
+		// Sparse list: #1-48,1001-1004
+		for _, idx := range tmpl.Pattern.Indices {
+			entries = append(entries, &OIDEntry{
+				OID:   fmt.Sprintf("%s.%d", tmpl.OID, idx),
+				Type:  tmpl.Type,
+				Value: tmpl.Value,
+			})
+		}
+
 	case TemplateAutoDetect:
 		// Use detected indices from other OIDs
 		if len(knownIndices) == 0 {
@@ -231,13 +311,13 @@ func parseTemplateValue(typeStr, valueStr string) interface{} {
 		val, _ := strconv.ParseInt(valueStr, 10, 32)
 		return int(val)
 
-	case "counter32", "gauge32", "counter", "gauge", "c32":
-		val, _ := strconv.ParseInt(valueStr, 10, 32)
+	case "counter32", "gauge32", "counter", "gauge", "c32", "unsigned32", "uinteger32":
+		val, _ := strconv.ParseUint(valueStr, 10, 32)
 		return uint32(val)
 
 	case "counter64", "c64":
-		val, _ := strconv.ParseInt(valueStr, 10, 64)
-		return uint64(val)
+		val, _ := strconv.ParseUint(valueStr, 10, 64)
+		return val
 
 	case "timeticks", "tt", "ticks":
 		val, _ := strconv.ParseInt(valueStr, 10, 32)
@@ -271,11 +351,23 @@ func IsTemplateOID(line string) bool {
 
 // CollectTemplates extracts all template OIDs from entries list
 func CollectTemplates(lines []string) ([]*OIDTemplate, []*OIDEntry, error) {
+	source := make([]sourceLine, len(lines))
+	for i, line := range lines {
+		source[i] = sourceLine{num: i + 1, text: line}
+	}
+	return collectTemplates(source)
+}
+
+func collectTemplates(lines []sourceLine) ([]*OIDTemplate, []*OIDEntry, error) {
 	var templates []*OIDTemplate
 	var regularEntries []*OIDEntry
+	// A routed line (VALUE@port) is only the fallback for devices without
+	// a mapping when no plain line sets the OID
+	var routed []bool
+	plain := make(map[string]bool)
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+	for _, src := range lines {
+		line := strings.TrimSpace(src.text)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
@@ -284,9 +376,7 @@ func CollectTemplates(lines []string) ([]*OIDTemplate, []*OIDEntry, error) {
 		if IsTemplateOID(line) {
 			tmpl, err := ParseTemplateOID(line)
 			if err != nil {
-				// Log warning but continue
-				// ignoring malformed templates is safer than stopping
-				continue
+				return nil, nil, fmt.Errorf("%s: %w", src.pos(), err)
 			}
 			templates = append(templates, tmpl)
 		} else {
@@ -298,17 +388,68 @@ func CollectTemplates(lines []string) ([]*OIDTemplate, []*OIDEntry, error) {
 			}
 
 			oid := strings.TrimSpace(parts[0])
-			typeStr := strings.TrimSpace(parts[1])
-			valueStr := strings.TrimSpace(parts[2])
+			typeStr, valueStr, err := snmprecfmt.DecodeValue(strings.TrimSpace(parts[1]), strings.TrimSpace(parts[2]))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: OID %s: %w", src.pos(), oid, err)
+			}
+
+			if IsValueRef(valueStr) {
+				ref, err := ParseValueRef(valueStr)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: OID %s: %w", src.pos(), oid, err)
+				}
+				regularEntries = append(regularEntries, &OIDEntry{
+					OID:   oid,
+					Type:  GetSNMPType(typeStr),
+					Value: ref,
+				})
+				routed = append(routed, false)
+				plain[oid] = true
+				continue
+			}
 
+			snmpType := GetSNMPType(typeStr)
+			if snmpType == gosnmp.IPAddress && IsDeviceOID(line) {
+				// Like an OID, an address never contains '@', so the route
+				// cannot be part of the value
+				valueStr = valueStr[:strings.LastIndex(valueStr, "@")]
+			}
 			value := parseTemplateValue(typeStr, valueStr)
+			if snmpType == gosnmp.ObjectIdentifier {
+				// An OID never contains '@', so a device route (VALUE@port)
+				// can be split off unambiguously before validating
+				if IsDeviceOID(line) {
+					valueStr = valueStr[:strings.LastIndex(valueStr, "@")]
+				}
+				oidValue, err := parseObjectIdentifier(valueStr)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: OID %s: %w", src.pos(), oid, err)
+				}
+				value = oidValue
+			}
 
 			regularEntries = append(regularEntries, &OIDEntry{
 				OID:   oid,
-				Type:  getSNMPType(typeStr),
+				Type:  snmpType,
 				Value: value,
 			})
+			isRouted := IsDeviceOID(line)
+			routed = append(routed, isRouted)
+			if !isRouted {
+				plain[oid] = true
+			}
+		}
+	}
+
+	if len(plain) > 0 {
+		kept := regularEntries[:0]
+		for i, entry := range regularEntries {
+			if routed[i] && plain[entry.OID] {
+				continue
+			}
+			kept = append(kept, entry)
 		}
+		regularEntries = kept
 	}
 
 	return templates, regularEntries, nil
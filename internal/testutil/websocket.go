@@ -0,0 +1,121 @@
+package testutil
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// WSClient is a bare WebSocket client for tests of the servers' streams
+type WSClient struct {
+	Conn net.Conn
+	br   *bufio.Reader
+}
+
+// WSFrame is one frame read by a WSClient
+type WSFrame struct {
+	Opcode  byte
+	Payload []byte
+}
+
+// DialWebSocket opens rawURL (http:// or ws://) with header added to the
+// handshake and fails t unless the server switches protocols
+func DialWebSocket(t testing.TB, rawURL string, header http.Header) *WSClient {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse %s: %v", rawURL, err)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial %s: %v", u.Host, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	req, _ := http.NewRequest(http.MethodGet, "http://"+u.Host+u.RequestURI(), nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(nonce))
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("handshake status = %d, want 101: %s", resp.StatusCode, body)
+	}
+	return &WSClient{Conn: conn, br: br}
+}
+
+// ReadFrame reads the next frame, giving up after timeout
+func (c *WSClient) ReadFrame(timeout time.Duration) (WSFrame, error) {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(timeout))
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return WSFrame{}, err
+	}
+	if head[1]&0x80 != 0 {
+		return WSFrame{}, fmt.Errorf("server frame is masked")
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return WSFrame{}, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return WSFrame{}, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return WSFrame{}, err
+	}
+	return WSFrame{Opcode: head[0] & 0x0F, Payload: payload}, nil
+}
+
+// WriteFrame sends a masked, unfragmented frame, as a client must
+func (c *WSClient) WriteFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := make([]byte, 4)
+	_, _ = rand.Read(mask)
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.Conn.Write(frame)
+	return err
+}
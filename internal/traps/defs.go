@@ -0,0 +1,91 @@
+package traps
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetTrap sends a specific notification when a SET matches OID, instead of
+// the generic set-event trap. OID matches the set OID exactly or as a prefix
+// (a table column), and Value, when given, must equal the set value.
+// Varbinds are OID|TYPE|VALUE templates and may use $value for the set value
+// besides the placeholders VarbindTemplate supports.
+type SetTrap struct {
+	OID      string   `yaml:"oid"`
+	Value    string   `yaml:"value"`
+	Trap     string   `yaml:"trap"`
+	Varbinds []string `yaml:"varbinds"`
+
+	templates []VarbindTemplate
+}
+
+// TrapDefs is the trap definition file:
+//
+//	onSet:
+//	  - oid: 1.3.6.1.2.1.2.2.1.7      # ifAdminStatus
+//	    value: "2"                    # down
+//	    trap: 1.3.6.1.6.3.1.1.5.3    # linkDown
+//	    varbinds:
+//	      - 1.3.6.1.2.1.2.2.1.1.$index|integer|$index
+//	      - 1.3.6.1.2.1.2.2.1.7.$index|integer|$value
+type TrapDefs struct {
+	OnSet []SetTrap `yaml:"onSet"`
+}
+
+// LoadTrapDefs reads and validates a trap definition file
+func LoadTrapDefs(path string) (TrapDefs, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return TrapDefs{}, fmt.Errorf("read trap definitions: %w", err)
+	}
+	var defs TrapDefs
+	if err := yaml.Unmarshal(raw, &defs); err != nil {
+		return TrapDefs{}, fmt.Errorf("parse trap definitions yaml: %w", err)
+	}
+	for i := range defs.OnSet {
+		if err := defs.OnSet[i].compile(); err != nil {
+			return TrapDefs{}, fmt.Errorf("trap definitions %s: onSet[%d]: %w", path, i, err)
+		}
+	}
+	return defs, nil
+}
+
+func (d *SetTrap) compile() error {
+	d.OID = strings.TrimPrefix(strings.TrimSpace(d.OID), ".")
+	d.Trap = strings.TrimPrefix(strings.TrimSpace(d.Trap), ".")
+	if d.OID == "" {
+		return fmt.Errorf("oid is required")
+	}
+	if d.Trap == "" {
+		return fmt.Errorf("trap is required")
+	}
+	d.templates = d.templates[:0]
+	for _, spec := range d.Varbinds {
+		tmpl, err := ParseVarbindTemplate(spec)
+		if err != nil {
+			return err
+		}
+		d.templates = append(d.templates, tmpl)
+	}
+	return nil
+}
+
+func (d *SetTrap) matches(oid, value string) bool {
+	if oid != d.OID && !strings.HasPrefix(oid, d.OID+".") {
+		return false
+	}
+	return d.Value == "" || d.Value == value
+}
+
+// matchSetTrap returns the first definition matching a SET, or nil
+func (m *Manager) matchSetTrap(oid, value string) *SetTrap {
+	for i := range m.config.SetTraps {
+		if m.config.SetTraps[i].matches(oid, value) {
+			return &m.config.SetTraps[i]
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,8 +18,23 @@ const (
 	TrapOIDCron      = "1.3.6.1.4.1.55555.0.1"
 	TrapOIDVariation = "1.3.6.1.4.1.55555.0.2"
 	TrapOIDSet       = "1.3.6.1.4.1.55555.0.3"
+	TrapOIDHeartbeat = "1.3.6.1.4.1.55555.0.5"
+	TrapOIDColdStart = "1.3.6.1.6.3.1.1.5.1" // SNMPv2-MIB coldStart
+	TrapOIDWarmStart = "1.3.6.1.6.3.1.1.5.2" // SNMPv2-MIB warmStart
+	TrapOIDLinkDown  = "1.3.6.1.6.3.1.1.5.3" // IF-MIB linkDown
+	TrapOIDLinkUp    = "1.3.6.1.6.3.1.1.5.4" // IF-MIB linkUp
+
+	TrapOIDAuthenticationFailure = "1.3.6.1.6.3.1.1.5.5" // SNMPv2-MIB authenticationFailure
 )
 
+// linkVarbinds are the IF-MIB linkDown/linkUp objects; $value is the new
+// ifOperStatus, which the dataset does not hold
+var linkVarbinds = []VarbindTemplate{
+	{OID: "1.3.6.1.2.1.2.2.1.1.$index", Type: "integer", Value: "$index"},
+	{OID: "1.3.6.1.2.1.2.2.1.7.$index", Value: "${oid:1.3.6.1.2.1.2.2.1.7.$index}"},
+	{OID: "1.3.6.1.2.1.2.2.1.8.$index", Type: "integer", Value: "$value"},
+}
+
 type Config struct {
 	Targets     []string
 	Version     string
@@ -31,10 +47,33 @@ type Config struct {
 	CronSpecs   []string
 	OnVariation bool
 	OnSetOIDs   []string
+	SetTraps    []SetTrap
 	Inform      bool
+	Varbinds    []VarbindTemplate
 
 	Timeout time.Duration
 	Retries int
+
+	// Heartbeat is the interval of keepalive traps sent regardless of cron
+	// specs, for checking that a trap receiver stays reachable; 0 disables.
+	Heartbeat time.Duration
+
+	// OnStart sends coldStart for every agent when the simulator starts and
+	// warmStart when it reloads its dataset. Reboots send coldStart
+	// regardless.
+	OnStart bool
+
+	// TargetSettings holds the effective timeout and retries of each target,
+	// keyed by normalized host:port. Normalize fills it from the target
+	// syntax host:port;timeout=5s;retries=3, using Timeout and Retries for
+	// targets without overrides.
+	TargetSettings map[string]TargetSettings
+}
+
+// TargetSettings is the delivery timeout and retry count of one trap target
+type TargetSettings struct {
+	Timeout time.Duration
+	Retries int
 }
 
 func (c *Config) Normalize() error {
@@ -42,32 +81,52 @@ func (c *Config) Normalize() error {
 	if c.Version == "" {
 		c.Version = "v2c"
 	}
-	if c.Version != "v2c" && c.Version != "v3" {
-		return fmt.Errorf("invalid trap version %q (want v2c or v3)", c.Version)
+	if c.Version != "v1" && c.Version != "v2c" && c.Version != "v3" {
+		return fmt.Errorf("invalid trap version %q (want v1, v2c or v3)", c.Version)
+	}
+	if c.Version == "v1" && c.Inform {
+		return fmt.Errorf("trap v1 cannot send informs (use v2c or v3)")
+	}
+	if c.Heartbeat < 0 {
+		return fmt.Errorf("invalid trap heartbeat %s (want a positive interval)", c.Heartbeat)
 	}
 	if len(c.Targets) == 0 {
 		return nil
 	}
 
+	if c.Timeout <= 0 {
+		c.Timeout = 2 * time.Second
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+
+	settings := make(map[string]TargetSettings, len(c.Targets))
 	for i, t := range c.Targets {
-		host, port, err := net.SplitHostPort(t)
+		addr, opts, hasOpts := strings.Cut(t, ";")
+		host, port, err := net.SplitHostPort(strings.TrimSpace(addr))
 		if err != nil || host == "" || port == "" {
-			return fmt.Errorf("invalid trap target %q (want host:port)", t)
+			return fmt.Errorf("invalid trap target %q (want host:port[;timeout=D][;retries=N])", t)
 		}
 		if _, err := strconv.Atoi(port); err != nil {
 			return fmt.Errorf("invalid trap target port in %q", t)
 		}
 		c.Targets[i] = net.JoinHostPort(host, port)
-	}
 
-	if c.Timeout <= 0 {
-		c.Timeout = 2 * time.Second
-	}
-	if c.Retries < 0 {
-		c.Retries = 0
+		ts, ok := c.TargetSettings[c.Targets[i]]
+		if !ok {
+			ts = TargetSettings{Timeout: c.Timeout, Retries: c.Retries}
+		}
+		if hasOpts {
+			if ts, err = parseTargetOptions(ts, opts); err != nil {
+				return fmt.Errorf("invalid trap target %q: %w", t, err)
+			}
+		}
+		settings[c.Targets[i]] = ts
 	}
+	c.TargetSettings = settings
 
-	if c.Version == "v2c" {
+	if c.Version == "v1" || c.Version == "v2c" {
 		if c.Community == "" {
 			c.Community = "public"
 		}
@@ -97,9 +156,53 @@ func (c *Config) Normalize() error {
 	return nil
 }
 
+// parseTargetOptions applies the ;-separated key=value overrides of a trap
+// target to ts
+func parseTargetOptions(ts TargetSettings, opts string) (TargetSettings, error) {
+	for _, opt := range strings.Split(opts, ";") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			return ts, fmt.Errorf("option %q is not key=value", opt)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "timeout":
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil || d <= 0 {
+				return ts, fmt.Errorf("invalid timeout %q", value)
+			}
+			ts.Timeout = d
+		case "retries":
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return ts, fmt.Errorf("invalid retries %q", value)
+			}
+			ts.Retries = n
+		default:
+			return ts, fmt.Errorf("unknown option %q (want timeout or retries)", key)
+		}
+	}
+	return ts, nil
+}
+
 type message struct {
-	trapOID string
-	vars    []gosnmp.SnmpPDU
+	trapOID   string
+	vars      []gosnmp.SnmpPDU
+	templates []VarbindTemplate
+	event     eventContext
+}
+
+// eventContext identifies the device and OID that triggered a notification so
+// varbind templates can be resolved against that device at send time.
+type eventContext struct {
+	hasDevice bool
+	deviceID  int
+	port      int
+	oid       string
+	value     string
 }
 
 type Manager struct {
@@ -107,11 +210,16 @@ type Manager struct {
 	sender    *Sender
 	onSetOIDs map[string]struct{}
 
+	resolverMu sync.RWMutex
+	resolvers  map[int]Resolver
+
 	queue chan message
 	stop  chan struct{}
 	wg    sync.WaitGroup
 
 	cron *cron.Cron
+
+	started time.Time // heartbeat uptime counts from here
 }
 
 func NewManager(cfg Config) (*Manager, error) {
@@ -127,6 +235,13 @@ func NewManager(cfg Config) (*Manager, error) {
 		return nil, err
 	}
 
+	cfg.SetTraps = append([]SetTrap(nil), cfg.SetTraps...)
+	for i := range cfg.SetTraps {
+		if err := cfg.SetTraps[i].compile(); err != nil {
+			return nil, fmt.Errorf("set trap %d: %w", i, err)
+		}
+	}
+
 	onSet := make(map[string]struct{}, len(cfg.OnSetOIDs))
 	for _, oid := range cfg.OnSetOIDs {
 		oid = strings.TrimPrefix(strings.TrimSpace(oid), ".")
@@ -139,6 +254,7 @@ func NewManager(cfg Config) (*Manager, error) {
 		config:    cfg,
 		sender:    NewSender(builder, cfg.Targets, cfg.Inform),
 		onSetOIDs: onSet,
+		resolvers: make(map[int]Resolver),
 		queue:     make(chan message, 1024),
 		stop:      make(chan struct{}),
 	}
@@ -161,12 +277,22 @@ func NewManager(cfg Config) (*Manager, error) {
 	return m, nil
 }
 
+// Config returns the normalized configuration the manager runs with
+func (m *Manager) Config() Config {
+	return m.config
+}
+
 func (m *Manager) Start() {
 	if m == nil {
 		return
 	}
+	m.started = time.Now()
 	m.wg.Add(1)
 	go m.loop()
+	if m.config.Heartbeat > 0 {
+		m.wg.Add(1)
+		go m.heartbeatLoop()
+	}
 	if m.cron != nil {
 		m.cron.Start()
 	}
@@ -191,21 +317,63 @@ func (m *Manager) loop() {
 		case <-m.stop:
 			return
 		case msg := <-m.queue:
-			if err := m.sender.Send(msg.trapOID, msg.vars); err != nil {
+			vars := append(append([]gosnmp.SnmpPDU(nil), msg.vars...), m.renderVarbinds(msg.templates, msg.event)...)
+			vars = append(vars, m.renderVarbinds(m.config.Varbinds, msg.event)...)
+			if err := m.sender.Send(msg.trapOID, vars); err != nil {
 				log.Printf("trap send failed: %v", err)
 			}
 		}
 	}
 }
 
-func (m *Manager) enqueue(trapOID string, vars []gosnmp.SnmpPDU) {
+// heartbeatLoop enqueues a heartbeat trap every Heartbeat interval until Stop
+func (m *Manager) heartbeatLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.config.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.EnqueueHeartbeatEvent()
+		}
+	}
+}
+
+// SetResolver registers the data source used to resolve ${oid:...} varbind
+// templates for events raised by the agent on port. A nil resolver removes it.
+func (m *Manager) SetResolver(port int, r Resolver) {
+	if m == nil {
+		return
+	}
+	m.resolverMu.Lock()
+	defer m.resolverMu.Unlock()
+	if r == nil {
+		delete(m.resolvers, port)
+		return
+	}
+	m.resolvers[port] = r
+}
+
+func (m *Manager) resolver(port int) Resolver {
+	m.resolverMu.RLock()
+	defer m.resolverMu.RUnlock()
+	return m.resolvers[port]
+}
+
+func (m *Manager) enqueue(trapOID string, vars []gosnmp.SnmpPDU, event eventContext) {
+	m.enqueueMessage(message{trapOID: trapOID, vars: vars, event: event})
+}
+
+func (m *Manager) enqueueMessage(msg message) {
 	if m == nil {
 		return
 	}
 	select {
-	case m.queue <- message{trapOID: trapOID, vars: vars}:
+	case m.queue <- msg:
 	default:
-		log.Printf("trap queue full; dropping event %s", trapOID)
+		log.Printf("trap queue full; dropping event %s", msg.trapOID)
 	}
 }
 
@@ -214,7 +382,7 @@ func (m *Manager) EnqueueCronEvent(spec string) {
 		{Name: ".1.3.6.1.4.1.55555.1.1.0", Type: gosnmp.OctetString, Value: "cron"},
 		{Name: ".1.3.6.1.4.1.55555.1.2.0", Type: gosnmp.OctetString, Value: spec},
 	}
-	m.enqueue(TrapOIDCron, vars)
+	m.enqueue(TrapOIDCron, vars, eventContext{})
 }
 
 func (m *Manager) EnqueueVariationEvent(deviceID int, port int, oid string, detail string) {
@@ -227,7 +395,7 @@ func (m *Manager) EnqueueVariationEvent(deviceID int, port int, oid string, deta
 		{Name: ".1.3.6.1.4.1.55555.2.3.0", Type: gosnmp.Integer, Value: deviceID},
 		{Name: ".1.3.6.1.4.1.55555.2.4.0", Type: gosnmp.Integer, Value: port},
 	}
-	m.enqueue(TrapOIDVariation, vars)
+	m.enqueue(TrapOIDVariation, vars, eventContext{hasDevice: true, deviceID: deviceID, port: port, oid: strings.TrimPrefix(oid, ".")})
 }
 
 func (m *Manager) EnqueueSetEvent(deviceID int, port int, oid string, valueType string, valueText string) {
@@ -235,6 +403,11 @@ func (m *Manager) EnqueueSetEvent(deviceID int, port int, oid string, valueType
 		return
 	}
 	oid = strings.TrimPrefix(strings.TrimSpace(oid), ".")
+	event := eventContext{hasDevice: true, deviceID: deviceID, port: port, oid: oid, value: valueText}
+	if def := m.matchSetTrap(oid, valueText); def != nil {
+		m.enqueueMessage(message{trapOID: def.Trap, templates: def.templates, event: event})
+		return
+	}
 	if len(m.onSetOIDs) > 0 {
 		if _, ok := m.onSetOIDs[oid]; !ok {
 			return
@@ -248,17 +421,128 @@ func (m *Manager) EnqueueSetEvent(deviceID int, port int, oid string, valueType
 		{Name: ".1.3.6.1.4.1.55555.3.4.0", Type: gosnmp.Integer, Value: deviceID},
 		{Name: ".1.3.6.1.4.1.55555.3.5.0", Type: gosnmp.Integer, Value: port},
 	}
-	m.enqueue(TrapOIDSet, vars)
+	m.enqueue(TrapOIDSet, vars, event)
+}
+
+// EnqueueLinkEvent sends linkUp or linkDown for the interface whose
+// ifOperStatus OID changed, with ifIndex, ifAdminStatus (when the agent has
+// it) and the new ifOperStatus as varbinds
+func (m *Manager) EnqueueLinkEvent(deviceID int, port int, oid string, up bool) {
+	if m == nil {
+		return
+	}
+	trapOID, status := TrapOIDLinkDown, "2"
+	if up {
+		trapOID, status = TrapOIDLinkUp, "1"
+	}
+	event := eventContext{hasDevice: true, deviceID: deviceID, port: port, oid: strings.TrimPrefix(oid, "."), value: status}
+	m.enqueueMessage(message{trapOID: trapOID, templates: linkVarbinds, event: event})
+}
+
+// EnqueueHeartbeatEvent sends a keepalive carrying the number of agents
+// registered with SetResolver and the time since Start in hundredths of a
+// second, like sysUpTime
+func (m *Manager) EnqueueHeartbeatEvent() {
+	if m == nil {
+		return
+	}
+	m.resolverMu.RLock()
+	devices := len(m.resolvers)
+	m.resolverMu.RUnlock()
+	vars := []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.4.1.55555.5.1.0", Type: gosnmp.Integer, Value: devices},
+		{Name: ".1.3.6.1.4.1.55555.5.2.0", Type: gosnmp.TimeTicks, Value: uint32(time.Since(m.started) / (10 * time.Millisecond))},
+	}
+	m.enqueue(TrapOIDHeartbeat, vars, eventContext{})
+}
+
+// EnqueueColdStartEvent sends coldStart for a simulated reboot of the
+// agent on port
+func (m *Manager) EnqueueColdStartEvent(deviceID int, port int) {
+	if m == nil {
+		return
+	}
+	m.enqueue(TrapOIDColdStart, deviceVars(deviceID, port), eventContext{hasDevice: true, deviceID: deviceID, port: port})
+}
+
+// EnqueueStartEvents sends coldStart for every agent in devices, which
+// maps ports to device IDs. Unlike the other events these wait for room in
+// the queue rather than being dropped, so a large simulator announces every
+// agent; they are queued from a goroutine that Stop ends.
+func (m *Manager) EnqueueStartEvents(devices map[int]int) {
+	if m == nil || len(devices) == 0 {
+		return
+	}
+	ports := make([]int, 0, len(devices))
+	for port := range devices {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for _, port := range ports {
+			deviceID := devices[port]
+			msg := message{trapOID: TrapOIDColdStart, vars: deviceVars(deviceID, port), event: eventContext{hasDevice: true, deviceID: deviceID, port: port}}
+			select {
+			case m.queue <- msg:
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// EnqueueWarmStartEvent sends warmStart for the agent on port after its
+// dataset was reloaded
+func (m *Manager) EnqueueWarmStartEvent(deviceID int, port int) {
+	if m == nil {
+		return
+	}
+	m.enqueue(TrapOIDWarmStart, deviceVars(deviceID, port), eventContext{hasDevice: true, deviceID: deviceID, port: port})
+}
+
+// EnqueueAuthFailureEvent sends authenticationFailure for a request to the
+// agent on port that failed authentication as user
+func (m *Manager) EnqueueAuthFailureEvent(deviceID int, port int, user string) {
+	if m == nil {
+		return
+	}
+	vars := append(deviceVars(deviceID, port), gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.55555.4.3.0", Type: gosnmp.OctetString, Value: user})
+	m.enqueue(TrapOIDAuthenticationFailure, vars, eventContext{hasDevice: true, deviceID: deviceID, port: port})
+}
+
+// deviceVars identifies the agent a coldStart, warmStart or
+// authenticationFailure is about
+func deviceVars(deviceID int, port int) []gosnmp.SnmpPDU {
+	return []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.4.1.55555.4.1.0", Type: gosnmp.Integer, Value: deviceID},
+		{Name: ".1.3.6.1.4.1.55555.4.2.0", Type: gosnmp.Integer, Value: port},
+	}
 }
 
 type Builder interface {
 	Build(target string) (*gosnmp.GoSNMP, error)
 }
 
-type v2Builder struct {
-	community string
+// targetDefaults resolves the timeout and retries of a target, falling back
+// to the global values for targets without their own settings
+type targetDefaults struct {
 	timeout   time.Duration
 	retries   int
+	perTarget map[string]TargetSettings
+}
+
+func (d targetDefaults) settings(target string) TargetSettings {
+	if ts, ok := d.perTarget[target]; ok {
+		return ts
+	}
+	return TargetSettings{Timeout: d.timeout, Retries: d.retries}
+}
+
+type v2Builder struct {
+	community string
+	targetDefaults
 }
 
 func (b *v2Builder) Build(target string) (*gosnmp.GoSNMP, error) {
@@ -266,13 +550,14 @@ func (b *v2Builder) Build(target string) (*gosnmp.GoSNMP, error) {
 	if err != nil {
 		return nil, err
 	}
+	ts := b.settings(target)
 	return &gosnmp.GoSNMP{
 		Target:    host,
 		Port:      port,
 		Version:   gosnmp.Version2c,
 		Community: b.community,
-		Timeout:   b.timeout,
-		Retries:   b.retries,
+		Timeout:   ts.Timeout,
+		Retries:   ts.Retries,
 	}, nil
 }
 
@@ -282,8 +567,7 @@ type v3Builder struct {
 	authKey string
 	priv    gosnmp.SnmpV3PrivProtocol
 	privKey string
-	timeout time.Duration
-	retries int
+	targetDefaults
 }
 
 func (b *v3Builder) Build(target string) (*gosnmp.GoSNMP, error) {
@@ -298,13 +582,14 @@ func (b *v3Builder) Build(target string) (*gosnmp.GoSNMP, error) {
 	if b.priv != gosnmp.NoPriv {
 		flags = gosnmp.AuthPriv
 	}
+	ts := b.settings(target)
 
 	return &gosnmp.GoSNMP{
 		Target:        host,
 		Port:          port,
 		Version:       gosnmp.Version3,
-		Timeout:       b.timeout,
-		Retries:       b.retries,
+		Timeout:       ts.Timeout,
+		Retries:       ts.Retries,
 		SecurityModel: gosnmp.UserSecurityModel,
 		MsgFlags:      flags,
 		SecurityParameters: &gosnmp.UsmSecurityParameters{
@@ -318,18 +603,21 @@ func (b *v3Builder) Build(target string) (*gosnmp.GoSNMP, error) {
 }
 
 func NewBuilder(cfg Config) (Builder, error) {
-	if cfg.Version == "v3" {
+	defaults := targetDefaults{timeout: cfg.Timeout, retries: cfg.Retries, perTarget: cfg.TargetSettings}
+	switch cfg.Version {
+	case "v1":
+		return &v1Builder{v2Builder{community: cfg.Community, targetDefaults: defaults}}, nil
+	case "v3":
 		return &v3Builder{
-			user:    cfg.V3User,
-			auth:    parseV3Auth(cfg.V3Auth),
-			authKey: cfg.V3AuthKey,
-			priv:    parseV3Priv(cfg.V3Priv),
-			privKey: cfg.V3PrivKey,
-			timeout: cfg.Timeout,
-			retries: cfg.Retries,
+			user:           cfg.V3User,
+			auth:           parseV3Auth(cfg.V3Auth),
+			authKey:        cfg.V3AuthKey,
+			priv:           parseV3Priv(cfg.V3Priv),
+			privKey:        cfg.V3PrivKey,
+			targetDefaults: defaults,
 		}, nil
 	}
-	return &v2Builder{community: cfg.Community, timeout: cfg.Timeout, retries: cfg.Retries}, nil
+	return &v2Builder{community: cfg.Community, targetDefaults: defaults}, nil
 }
 
 type Sender struct {
@@ -346,12 +634,13 @@ func (s *Sender) Send(trapOID string, vars []gosnmp.SnmpPDU) error {
 	if len(s.targets) == 0 {
 		return nil
 	}
+	uptime := uint32(time.Now().Unix() % 4294967295)
 	fullVars := append([]gosnmp.SnmpPDU{
-		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(time.Now().Unix() % 4294967295)},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uptime},
 		{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier, Value: trapOID},
 	}, vars...)
 
-	trap := gosnmp.SnmpTrap{Variables: fullVars, IsInform: s.inform}
+	v2Trap := gosnmp.SnmpTrap{Variables: fullVars, IsInform: s.inform}
 	for _, target := range s.targets {
 		client, err := s.builder.Build(target)
 		if err != nil {
@@ -360,6 +649,11 @@ func (s *Sender) Send(trapOID string, vars []gosnmp.SnmpPDU) error {
 		if err := client.Connect(); err != nil {
 			return fmt.Errorf("connect trap target %s: %w", target, err)
 		}
+		trap := v2Trap
+		if client.Version == gosnmp.Version1 {
+			// sysUpTime and the trap OID move into the v1 PDU header
+			trap = v1Trap(trapOID, vars, v1AgentAddress(client.Conn), uptime)
+		}
 		_, err = client.SendTrap(trap)
 		_ = client.Conn.Close()
 		if err != nil {
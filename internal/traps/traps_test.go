@@ -0,0 +1,290 @@
+package traps
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+type fakeResolver map[string]gosnmp.SnmpPDU
+
+func (f fakeResolver) ResolveOID(oid string) (gosnmp.SnmpPDU, bool) {
+	pdu, ok := f[oid]
+	return pdu, ok
+}
+
+func TestVariationTrapIncludesResolvedVarbinds(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer conn.Close()
+
+	tmplCopy, err := ParseVarbindTemplate("1.3.6.1.4.1.55555.2.5.0||${oid:1.3.6.1.2.1.2.2.1.10.$index}")
+	if err != nil {
+		t.Fatalf("parse template: %v", err)
+	}
+	tmplText, err := ParseVarbindTemplate("1.3.6.1.4.1.55555.2.6.0|octetstring|if$index in=${oid:1.3.6.1.2.1.2.2.1.10.$index}")
+	if err != nil {
+		t.Fatalf("parse template: %v", err)
+	}
+	tmplMissing, err := ParseVarbindTemplate("1.3.6.1.4.1.55555.2.7.0||${oid:1.3.6.1.2.1.99.0}")
+	if err != nil {
+		t.Fatalf("parse template: %v", err)
+	}
+
+	manager, err := NewManager(Config{
+		Targets:     []string{conn.LocalAddr().String()},
+		Version:     "v2c",
+		OnVariation: true,
+		Varbinds:    []VarbindTemplate{tmplCopy, tmplText, tmplMissing},
+		Timeout:     time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	manager.SetResolver(20000, fakeResolver{
+		"1.3.6.1.2.1.2.2.1.10.3": {Name: ".1.3.6.1.2.1.2.2.1.10.3", Type: gosnmp.Counter32, Value: uint32(4242)},
+	})
+	manager.Start()
+	defer manager.Stop()
+
+	manager.EnqueueVariationEvent(0, 20000, "1.3.6.1.2.1.2.2.1.8.3", "ifOperStatus changed")
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("read trap: %v", err)
+	}
+
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	pkt, err := decoder.SnmpDecodePacket(buf[:n])
+	if err != nil {
+		t.Fatalf("decode trap: %v", err)
+	}
+
+	got := make(map[string]gosnmp.SnmpPDU, len(pkt.Variables))
+	for _, v := range pkt.Variables {
+		got[v.Name] = v
+	}
+
+	copied, ok := got[".1.3.6.1.4.1.55555.2.5.0"]
+	if !ok {
+		t.Fatalf("missing copied varbind in %+v", pkt.Variables)
+	}
+	if copied.Type != gosnmp.Counter32 || gosnmp.ToBigInt(copied.Value).Uint64() != 4242 {
+		t.Fatalf("unexpected copied varbind: %+v", copied)
+	}
+
+	text, ok := got[".1.3.6.1.4.1.55555.2.6.0"]
+	if !ok {
+		t.Fatalf("missing text varbind in %+v", pkt.Variables)
+	}
+	if text.Type != gosnmp.OctetString || string(text.Value.([]byte)) != "if3 in=4242" {
+		t.Fatalf("unexpected text varbind: %+v", text)
+	}
+
+	if _, ok := got[".1.3.6.1.4.1.55555.2.7.0"]; ok {
+		t.Fatal("expected unresolved varbind to be omitted")
+	}
+}
+
+func TestParseVarbindTemplateRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"1.3.6.1.2.1.1.5.0", "|octetstring|x", "1.3.6.1.4.1.1.0||literal", "1.3.6.x.0|octetstring|x"} {
+		if _, err := ParseVarbindTemplate(spec); err == nil {
+			t.Fatalf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestNormalizeParsesPerTargetTimeoutAndRetries(t *testing.T) {
+	cfg := Config{
+		Targets: []string{
+			"127.0.0.1:9162",
+			"127.0.0.1:9163;timeout=5s;retries=3",
+			"127.0.0.1:9164;retries=0",
+		},
+		Timeout: time.Second,
+		Retries: 1,
+	}
+	if err := cfg.Normalize(); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if cfg.Targets[1] != "127.0.0.1:9163" {
+		t.Fatalf("expected options stripped from target, got %q", cfg.Targets[1])
+	}
+
+	builder, err := NewBuilder(cfg)
+	if err != nil {
+		t.Fatalf("new builder: %v", err)
+	}
+	want := map[string]TargetSettings{
+		"127.0.0.1:9162": {Timeout: time.Second, Retries: 1},
+		"127.0.0.1:9163": {Timeout: 5 * time.Second, Retries: 3},
+		"127.0.0.1:9164": {Timeout: time.Second, Retries: 0},
+	}
+	for _, target := range cfg.Targets {
+		client, err := builder.Build(target)
+		if err != nil {
+			t.Fatalf("build %s: %v", target, err)
+		}
+		if got := (TargetSettings{Timeout: client.Timeout, Retries: client.Retries}); got != want[target] {
+			t.Fatalf("target %s: got %+v, want %+v", target, got, want[target])
+		}
+	}
+
+	for _, bad := range []string{"127.0.0.1:9162;timeout=soon", "127.0.0.1:9162;retries=-1", "127.0.0.1:9162;ttl=3"} {
+		cfg := Config{Targets: []string{bad}}
+		if err := cfg.Normalize(); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestHeartbeatTrapsArriveAtInterval(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer conn.Close()
+
+	manager, err := NewManager(Config{
+		Targets:   []string{conn.LocalAddr().String()},
+		Version:   "v2c",
+		Timeout:   time.Second,
+		Heartbeat: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	manager.SetResolver(20000, fakeResolver{})
+	manager.SetResolver(20001, fakeResolver{})
+	manager.Start()
+	defer manager.Stop()
+
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	buf := make([]byte, 4096)
+	for i := 0; i < 2; i++ {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("read heartbeat %d: %v", i, err)
+		}
+		pkt, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Fatalf("decode heartbeat %d: %v", i, err)
+		}
+
+		got := make(map[string]gosnmp.SnmpPDU, len(pkt.Variables))
+		for _, v := range pkt.Variables {
+			got[v.Name] = v
+		}
+		if trapOID := got[".1.3.6.1.6.3.1.1.4.1.0"]; trapOID.Value != "."+TrapOIDHeartbeat {
+			t.Fatalf("heartbeat %d snmpTrapOID = %v, want %s", i, trapOID.Value, TrapOIDHeartbeat)
+		}
+		if devices := got[".1.3.6.1.4.1.55555.5.1.0"]; devices.Type != gosnmp.Integer || devices.Value != 2 {
+			t.Fatalf("heartbeat %d device count = %+v, want 2", i, devices)
+		}
+		if uptime := got[".1.3.6.1.4.1.55555.5.2.0"]; uptime.Type != gosnmp.TimeTicks || uptime.Value.(uint32) < 9 {
+			t.Fatalf("heartbeat %d uptime = %+v, want at least one interval", i, uptime)
+		}
+	}
+}
+
+func TestNormalizeRejectsNegativeHeartbeat(t *testing.T) {
+	cfg := Config{Targets: []string{"127.0.0.1:9162"}, Heartbeat: -time.Second}
+	if err := cfg.Normalize(); err == nil {
+		t.Fatal("expected error for negative heartbeat")
+	}
+}
+
+func TestV1TrapCarriesEnterpriseSpecificHeader(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer conn.Close()
+
+	manager, err := NewManager(Config{
+		Targets: []string{conn.LocalAddr().String()},
+		Version: "v1",
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	manager.Start()
+	defer manager.Stop()
+
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version1, Community: "public", Logger: gosnmp.NewLogger(nil)}
+	read := func() *gosnmp.SnmpPacket {
+		t.Helper()
+		buf := make([]byte, 4096)
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("read trap: %v", err)
+		}
+		pkt, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			t.Fatalf("decode trap: %v", err)
+		}
+		if pkt.Version != gosnmp.Version1 || pkt.PDUType != gosnmp.Trap || pkt.Community != "public" {
+			t.Fatalf("trap is %v %v community %q, want a v1 Trap-PDU", pkt.Version, pkt.PDUType, pkt.Community)
+		}
+		return pkt
+	}
+
+	manager.EnqueueSetEvent(7, 20000, "1.3.6.1.2.1.1.5.0", "OctetString", "test-host")
+	pkt := read()
+	if pkt.Enterprise != ".1.3.6.1.4.1.55555" || pkt.GenericTrap != 6 || pkt.SpecificTrap != 3 {
+		t.Fatalf("set trap header = enterprise %s generic %d specific %d, want .1.3.6.1.4.1.55555 6 3", pkt.Enterprise, pkt.GenericTrap, pkt.SpecificTrap)
+	}
+	if pkt.AgentAddress != "127.0.0.1" {
+		t.Fatalf("agent address = %q, want 127.0.0.1", pkt.AgentAddress)
+	}
+	if len(pkt.Variables) != 5 || pkt.Variables[0].Name != ".1.3.6.1.4.1.55555.3.1.0" {
+		t.Fatalf("varbinds = %+v, want the 5 set varbinds without sysUpTime or snmpTrapOID", pkt.Variables)
+	}
+
+	manager.EnqueueColdStartEvent(1, 20001)
+	pkt = read()
+	if pkt.Enterprise != ".1.3.6.1.6.3.1.1.5" || pkt.GenericTrap != 0 || pkt.SpecificTrap != 0 {
+		t.Fatalf("coldStart header = enterprise %s generic %d specific %d, want snmpTraps 0 0", pkt.Enterprise, pkt.GenericTrap, pkt.SpecificTrap)
+	}
+}
+
+func TestV1TrapTranslation(t *testing.T) {
+	vars := []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.6.3.1.1.4.3.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.9"},
+		{Name: ".1.3.6.1.2.1.2.2.1.1.3", Type: gosnmp.Integer, Value: 3},
+		{Name: ".1.3.6.1.2.1.31.1.1.1.6.3", Type: gosnmp.Counter64, Value: uint64(1 << 40)},
+	}
+	trap := v1Trap(TrapOIDLinkDown, vars, "10.0.0.1", 500)
+	if trap.Enterprise != "1.3.6.1.4.1.9" || trap.GenericTrap != 2 || trap.SpecificTrap != 0 || trap.Timestamp != 500 {
+		t.Fatalf("linkDown = %+v, want enterprise from snmpTrapEnterprise.0 and generic-trap 2", trap)
+	}
+	if len(trap.Variables) != 1 || trap.Variables[0].Name != ".1.3.6.1.2.1.2.2.1.1.3" {
+		t.Fatalf("varbinds = %+v, want snmpTrapEnterprise.0 and Counter64 dropped", trap.Variables)
+	}
+
+	// Enterprise traps whose OID has no 0 arc keep their whole parent
+	trap = v1Trap("1.3.6.1.4.1.9.9.41.2.1", nil, "10.0.0.1", 0)
+	if trap.Enterprise != "1.3.6.1.4.1.9.9.41.2" || trap.GenericTrap != 6 || trap.SpecificTrap != 1 {
+		t.Fatalf("enterprise trap = %+v", trap)
+	}
+}
+
+func TestNormalizeRejectsV1Inform(t *testing.T) {
+	cfg := Config{Targets: []string{"127.0.0.1:9162"}, Version: "v1", Inform: true}
+	if err := cfg.Normalize(); err == nil {
+		t.Fatal("expected error for v1 inform")
+	}
+	cfg = Config{Targets: []string{"127.0.0.1:9162"}, Version: "V1"}
+	if err := cfg.Normalize(); err != nil || cfg.Community != "public" {
+		t.Fatalf("v1 normalize: %v, community %q", err, cfg.Community)
+	}
+}
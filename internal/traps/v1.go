@@ -0,0 +1,84 @@
+package traps
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	oidSnmpTraps          = "1.3.6.1.6.3.1.1.5"     // SNMPv2-MIB snmpTraps, parent of the generic traps
+	oidSnmpTrapEnterprise = "1.3.6.1.6.3.1.1.4.3.0" // SNMPv2-MIB snmpTrapEnterprise.0
+)
+
+type v1Builder struct {
+	v2Builder
+}
+
+func (b *v1Builder) Build(target string) (*gosnmp.GoSNMP, error) {
+	client, err := b.v2Builder.Build(target)
+	if err != nil {
+		return nil, err
+	}
+	client.Version = gosnmp.Version1
+	return client, nil
+}
+
+// v1Trap translates a notification to an SNMPv1 Trap-PDU as RFC 3584
+// section 3.2 does. The generic traps under snmpTraps map to generic-trap
+// 0-5 with the enterprise taken from a snmpTrapEnterprise.0 varbind, or
+// snmpTraps without one. Any other trap OID is enterpriseSpecific (6): the
+// last arc is the specific-trap and the enterprise is the rest, less a
+// trailing 0 arc, so 1.3.6.1.4.1.55555.0.3 is enterprise 1.3.6.1.4.1.55555,
+// specific-trap 3. snmpTrapEnterprise.0 is dropped from the varbinds, as are
+// Counter64 values, which SNMPv1 cannot carry.
+func v1Trap(trapOID string, vars []gosnmp.SnmpPDU, agentAddress string, uptime uint32) gosnmp.SnmpTrap {
+	trapOID = strings.TrimPrefix(trapOID, ".")
+	trap := gosnmp.SnmpTrap{AgentAddress: agentAddress, Timestamp: uint(uptime)}
+
+	enterprise := ""
+	kept := make([]gosnmp.SnmpPDU, 0, len(vars))
+	for _, v := range vars {
+		switch {
+		case strings.TrimPrefix(v.Name, ".") == oidSnmpTrapEnterprise:
+			if oid, ok := v.Value.(string); ok {
+				enterprise = strings.TrimPrefix(oid, ".")
+			}
+		case v.Type == gosnmp.Counter64:
+		default:
+			kept = append(kept, v)
+		}
+	}
+	trap.Variables = kept
+
+	parent, last := trapOID, ""
+	if i := strings.LastIndex(trapOID, "."); i >= 0 {
+		parent, last = trapOID[:i], trapOID[i+1:]
+	}
+	arc, _ := strconv.Atoi(last)
+	if parent == oidSnmpTraps && arc >= 1 && arc <= 6 {
+		trap.GenericTrap = arc - 1
+		trap.Enterprise = oidSnmpTraps
+		if enterprise != "" {
+			trap.Enterprise = enterprise
+		}
+		return trap
+	}
+	trap.GenericTrap = 6
+	trap.SpecificTrap = arc
+	trap.Enterprise = strings.TrimSuffix(parent, ".0")
+	return trap
+}
+
+// v1AgentAddress is the agent-addr of a v1 trap sent over conn: the local
+// IPv4 address the trap leaves from, or 0.0.0.0 when it is not IPv4
+func v1AgentAddress(conn net.Conn) string {
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		if ip := addr.IP.To4(); ip != nil && !ip.IsUnspecified() {
+			return ip.String()
+		}
+	}
+	return "0.0.0.0"
+}
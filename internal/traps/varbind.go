@@ -0,0 +1,149 @@
+package traps
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+	"github.com/gosnmp/gosnmp"
+)
+
+// Resolver looks up the current value of an OID on a simulated device.
+type Resolver interface {
+	ResolveOID(oid string) (gosnmp.SnmpPDU, bool)
+}
+
+// VarbindTemplate is an extra varbind appended to every notification.
+//
+// Value may reference live device data with ${oid:OID}. In both OID and Value
+// the placeholders $index (alias $ifIndex), $oid, $deviceID and $port expand to
+// the last arc of the triggering OID, the triggering OID, and the device
+// identity; $value expands to the value of the SET that triggered it. When Type is empty and Value is a single ${oid:...} reference, the
+// resolved varbind type and value are copied as-is.
+type VarbindTemplate struct {
+	OID   string
+	Type  string
+	Value string
+}
+
+var oidRefPattern = regexp.MustCompile(`\$\{oid:([^}]+)\}`)
+
+// ParseVarbindTemplate parses an "OID|TYPE|VALUE" varbind template spec.
+func ParseVarbindTemplate(spec string) (VarbindTemplate, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), "|", 3)
+	if len(parts) != 3 {
+		return VarbindTemplate{}, fmt.Errorf("invalid trap varbind %q (want OID|TYPE|VALUE)", spec)
+	}
+	tmpl := VarbindTemplate{
+		OID:   strings.TrimPrefix(strings.TrimSpace(parts[0]), "."),
+		Type:  strings.ToLower(strings.TrimSpace(parts[1])),
+		Value: strings.TrimSpace(parts[2]),
+	}
+	if tmpl.OID == "" {
+		return VarbindTemplate{}, fmt.Errorf("invalid trap varbind %q: OID is required", spec)
+	}
+	if !strings.Contains(tmpl.OID, "$") {
+		if _, err := store.ParseOIDValue("objectidentifier", tmpl.OID); err != nil {
+			return VarbindTemplate{}, fmt.Errorf("invalid trap varbind %q: %w", spec, err)
+		}
+	}
+	if tmpl.Type == "" && !oidRefPattern.MatchString(tmpl.Value) {
+		return VarbindTemplate{}, fmt.Errorf("invalid trap varbind %q: TYPE may only be empty for ${oid:...} values", spec)
+	}
+	return tmpl, nil
+}
+
+// renderVarbinds expands templates for one event. Templates whose OID
+// references cannot be resolved are skipped.
+func (m *Manager) renderVarbinds(templates []VarbindTemplate, ev eventContext) []gosnmp.SnmpPDU {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	var resolver Resolver
+	if ev.hasDevice {
+		resolver = m.resolver(ev.port)
+	}
+
+	out := make([]gosnmp.SnmpPDU, 0, len(templates))
+	for _, tmpl := range templates {
+		pdu, ok := renderVarbind(tmpl, ev, resolver)
+		if !ok {
+			continue
+		}
+		out = append(out, pdu)
+	}
+	return out
+}
+
+func renderVarbind(tmpl VarbindTemplate, ev eventContext, resolver Resolver) (gosnmp.SnmpPDU, bool) {
+	value := expandEventVars(tmpl.Value, ev)
+	// Placeholders left unexpanded (events without a device) fail validation
+	oidValue, err := store.ParseOIDValue("objectidentifier", expandEventVars(tmpl.OID, ev))
+	if err != nil {
+		return gosnmp.SnmpPDU{}, false
+	}
+	name := oidValue.(string)
+
+	if tmpl.Type == "" {
+		m := oidRefPattern.FindStringSubmatch(value)
+		if m == nil || m[0] != value || resolver == nil {
+			return gosnmp.SnmpPDU{}, false
+		}
+		resolved, ok := resolver.ResolveOID(m[1])
+		if !ok {
+			return gosnmp.SnmpPDU{}, false
+		}
+		return gosnmp.SnmpPDU{Name: name, Type: resolved.Type, Value: resolved.Value}, true
+	}
+
+	unresolved := false
+	text := oidRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if resolver == nil {
+			unresolved = true
+			return ""
+		}
+		resolved, ok := resolver.ResolveOID(oidRefPattern.FindStringSubmatch(ref)[1])
+		if !ok {
+			unresolved = true
+			return ""
+		}
+		s, err := snmprecfmt.ValueString(resolved.Type, resolved.Value)
+		if err != nil {
+			unresolved = true
+			return ""
+		}
+		return s
+	})
+	if unresolved {
+		return gosnmp.SnmpPDU{}, false
+	}
+
+	ber := store.GetSNMPType(tmpl.Type)
+	typed, err := store.ParseOIDValue(tmpl.Type, text)
+	if err != nil || ber == store.NoResponse {
+		return gosnmp.SnmpPDU{}, false
+	}
+	return gosnmp.SnmpPDU{Name: name, Type: ber, Value: typed}, true
+}
+
+func expandEventVars(s string, ev eventContext) string {
+	if !ev.hasDevice {
+		return s
+	}
+	index := ev.oid
+	if i := strings.LastIndex(index, "."); i >= 0 {
+		index = index[i+1:]
+	}
+	return strings.NewReplacer(
+		"$ifIndex", index,
+		"$index", index,
+		"$deviceID", strconv.Itoa(ev.deviceID),
+		"$port", strconv.Itoa(ev.port),
+		"$oid", ev.oid,
+		"$value", ev.value,
+	).Replace(s)
+}
@@ -44,15 +44,31 @@ func GenerateEngineID(seed string) string {
 	return string(append([]byte{0x80, 0x00, 0x1F, 0x88}, h[:12]...))
 }
 
+// Engine ID length limits from RFC 3411 (SnmpEngineID)
+const (
+	MinEngineIDLen = 5
+	MaxEngineIDLen = 32
+)
+
+// ParseEngineID returns the raw engine ID for input, given either as hex
+// (optionally 0x-prefixed) or as plain text. An empty input is allowed and
+// yields "", letting the caller generate one. A 0x prefix always means hex.
 func ParseEngineID(input string) (string, error) {
 	if input == "" {
 		return "", nil
 	}
-	clean := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(input)), "0x")
-	if decoded, err := hex.DecodeString(clean); err == nil {
-		return string(decoded), nil
+	trimmed := strings.TrimSpace(input)
+	lower := strings.ToLower(trimmed)
+	engineID := input
+	if decoded, err := hex.DecodeString(strings.TrimPrefix(lower, "0x")); err == nil {
+		engineID = string(decoded)
+	} else if strings.HasPrefix(lower, "0x") {
+		return "", fmt.Errorf("engine ID %q is not valid hex: %w", input, err)
+	}
+	if n := len(engineID); n < MinEngineIDLen || n > MaxEngineIDLen {
+		return "", fmt.Errorf("engine ID %q is %d octets, must be %d to %d", input, n, MinEngineIDLen, MaxEngineIDLen)
 	}
-	return input, nil
+	return engineID, nil
 }
 
 func (s *EngineStateStore) EnsureBoots(engineID string) (uint32, error) {
@@ -2,6 +2,7 @@ package v3
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -37,3 +38,24 @@ func TestEngineStateStorePersistsBoots(t *testing.T) {
 		t.Fatalf("boots not persisted: boots2=%d boots3=%d", boots2, boots3)
 	}
 }
+
+func TestParseEngineID(t *testing.T) {
+	valid := map[string]string{
+		"":                   "",
+		"800007e5017f000001": "\x80\x00\x07\xe5\x01\x7f\x00\x00\x01",
+		"0x80001F8804":       "\x80\x00\x1f\x88\x04",
+		"lab-engine":         "lab-engine",
+	}
+	for input, want := range valid {
+		got, err := ParseEngineID(input)
+		if err != nil || got != want {
+			t.Errorf("ParseEngineID(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"800007e5", "abc", "0x80zz", strings.Repeat("x", 33)} {
+		if _, err := ParseEngineID(input); err == nil {
+			t.Errorf("ParseEngineID(%q) succeeded, want an error", input)
+		}
+	}
+}
@@ -32,14 +32,90 @@ const (
 
 type Config struct {
 	Enabled bool
+	// Only drops SNMPv1 and v2c packets unanswered instead of serving them
+	Only     bool
 	EngineID string
 	Username string
 
-	Auth AuthProtocol
+	Auth    AuthProtocol
 	AuthKey string
 
-	Priv PrivProtocol
+	Priv    PrivProtocol
 	PrivKey string
+
+	// TimeWindowSeconds is how far a request's engine time may differ from
+	// the agent's before it is rejected with notInTimeWindow; 0 selects
+	// DefaultTimeWindowSeconds
+	TimeWindowSeconds int
+
+	// Users are USM users the agent accepts besides Username, each with its
+	// own credentials
+	Users []User
+}
+
+// User is one USM user with its auth and privacy credentials
+type User struct {
+	Name    string
+	Auth    AuthProtocol
+	AuthKey string
+	Priv    PrivProtocol
+	PrivKey string
+}
+
+// ForUser returns c with the credentials of the USM user name in Username,
+// Auth, AuthKey, Priv and PrivKey: its own for Username, or those of the
+// matching entry of Users. ok is false for a user c does not know.
+func (c Config) ForUser(name string) (Config, bool) {
+	if name == c.Username {
+		return c, true
+	}
+	for _, u := range c.Users {
+		if u.Name == name {
+			c.Username, c.Auth, c.AuthKey, c.Priv, c.PrivKey = u.Name, u.Auth, u.AuthKey, u.Priv, u.PrivKey
+			return c, true
+		}
+	}
+	return c, false
+}
+
+// ParseUser parses a user spec of the form
+// name[;auth=PROTO;auth-key=KEY][;priv=PROTO;priv-key=KEY]
+func ParseUser(spec string) (User, error) {
+	fields := strings.Split(spec, ";")
+	u := User{Name: strings.TrimSpace(fields[0])}
+	if u.Name == "" {
+		return User{}, fmt.Errorf("invalid snmpv3 user %q: name is required", spec)
+	}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return User{}, fmt.Errorf("invalid snmpv3 user %q: want key=value, got %q", spec, field)
+		}
+		switch strings.TrimSpace(key) {
+		case "auth":
+			u.Auth = AuthProtocol(strings.ToUpper(strings.TrimSpace(value)))
+		case "auth-key":
+			u.AuthKey = value
+		case "priv":
+			u.Priv = PrivProtocol(strings.ToUpper(strings.TrimSpace(value)))
+		case "priv-key":
+			u.PrivKey = value
+		default:
+			return User{}, fmt.Errorf("invalid snmpv3 user %q: unknown key %q (want auth, auth-key, priv or priv-key)", spec, key)
+		}
+	}
+	return u, nil
+}
+
+// DefaultTimeWindowSeconds is the USM time window of RFC 3414 section 3.2
+const DefaultTimeWindowSeconds = 150
+
+// TimeWindow is the effective USM time window in seconds
+func (c Config) TimeWindow() uint32 {
+	if c.TimeWindowSeconds == 0 {
+		return DefaultTimeWindowSeconds
+	}
+	return uint32(c.TimeWindowSeconds)
 }
 
 func (c Config) SecurityLevel() gosnmp.SnmpV3MsgFlags {
@@ -87,24 +163,51 @@ func (c Config) ToGoSNMPPriv() gosnmp.SnmpV3PrivProtocol {
 }
 
 func (c Config) Validate() error {
+	if c.Only && !c.Enabled {
+		return fmt.Errorf("snmpv3-only mode requires v3 to be enabled")
+	}
 	if !c.Enabled {
 		return nil
 	}
 	if c.Username == "" {
 		return fmt.Errorf("snmpv3 username is required when v3 is enabled")
 	}
-	if c.Auth != AuthNone && c.AuthKey == "" {
+	if err := validateCredentials(c.Auth, c.AuthKey, c.Priv, c.PrivKey); err != nil {
+		return err
+	}
+	if c.TimeWindowSeconds < 0 {
+		return fmt.Errorf("snmpv3 time window must not be negative, got %d seconds", c.TimeWindowSeconds)
+	}
+	seen := map[string]bool{c.Username: true}
+	for _, u := range c.Users {
+		if u.Name == "" {
+			return fmt.Errorf("snmpv3 user name is required")
+		}
+		if seen[u.Name] {
+			return fmt.Errorf("snmpv3 user %q is defined twice", u.Name)
+		}
+		seen[u.Name] = true
+		if err := validateCredentials(u.Auth, u.AuthKey, u.Priv, u.PrivKey); err != nil {
+			return fmt.Errorf("snmpv3 user %q: %w", u.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateCredentials checks the auth and privacy settings of one user
+func validateCredentials(auth AuthProtocol, authKey string, priv PrivProtocol, privKey string) error {
+	if auth != AuthNone && authKey == "" {
 		return fmt.Errorf("snmpv3 auth key is required for auth protocols")
 	}
-	if c.Priv != PrivNone {
-		if c.Auth == AuthNone {
+	if priv != PrivNone {
+		if auth == AuthNone {
 			return fmt.Errorf("privacy protocol requires auth protocol")
 		}
-		if c.PrivKey == "" {
+		if privKey == "" {
 			return fmt.Errorf("snmpv3 priv key is required for priv protocols")
 		}
 	}
-	if strings.EqualFold(string(c.Priv), string(Priv3DES)) {
+	if strings.EqualFold(string(priv), string(Priv3DES)) {
 		// crypto helpers support 3DES, but gosnmp wire path does not.
 		return fmt.Errorf("snmpv3 3DES is not supported by gosnmp wire codec; use DES/AES128/AES192/AES256")
 	}
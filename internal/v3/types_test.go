@@ -0,0 +1,72 @@
+package v3
+
+import "testing"
+
+func TestConfigTimeWindow(t *testing.T) {
+	cfg := Config{Enabled: true, Username: "simuser"}
+	if got := cfg.TimeWindow(); got != DefaultTimeWindowSeconds {
+		t.Fatalf("default TimeWindow = %d, want %d", got, DefaultTimeWindowSeconds)
+	}
+	cfg.TimeWindowSeconds = 30
+	if got := cfg.TimeWindow(); got != 30 || cfg.Validate() != nil {
+		t.Fatalf("TimeWindow = %d, Validate = %v; want 30 and valid", got, cfg.Validate())
+	}
+	cfg.TimeWindowSeconds = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate accepted a negative time window")
+	}
+}
+
+func TestConfigForUserAndValidateUsers(t *testing.T) {
+	cfg := Config{
+		Enabled:  true,
+		Username: "simuser",
+		Auth:     AuthSHA1,
+		AuthKey:  "authpass123",
+		Users:    []User{{Name: "rwuser", Auth: AuthSHA256, AuthKey: "rwpass123", Priv: PrivAES128, PrivKey: "rwpriv123"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got, ok := cfg.ForUser("simuser"); !ok || got.AuthKey != "authpass123" || got.Priv != PrivNone {
+		t.Fatalf("ForUser(simuser) = %+v, %v", got, ok)
+	}
+	if got, ok := cfg.ForUser("rwuser"); !ok || got.Username != "rwuser" || got.Auth != AuthSHA256 || got.PrivKey != "rwpriv123" || got.EngineID != cfg.EngineID {
+		t.Fatalf("ForUser(rwuser) = %+v, %v", got, ok)
+	}
+	if _, ok := cfg.ForUser("intruder"); ok {
+		t.Fatal("ForUser accepted an unknown user")
+	}
+
+	for name, users := range map[string][]User{
+		"duplicate":   {{Name: "simuser"}},
+		"no name":     {{Auth: AuthSHA1, AuthKey: "x"}},
+		"no auth key": {{Name: "u", Auth: AuthSHA1}},
+		"priv only":   {{Name: "u", Priv: PrivAES128, PrivKey: "x"}},
+	} {
+		bad := cfg
+		bad.Users = users
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, users)
+		}
+	}
+}
+
+func TestParseUser(t *testing.T) {
+	u, err := ParseUser("rwuser;auth=sha256;auth-key=a;b=c;priv=aes256;priv-key=p,q")
+	if err == nil {
+		t.Fatalf("ParseUser accepted an unknown key: %+v", u)
+	}
+	u, err = ParseUser("rwuser;auth=sha256;auth-key=a=b;priv=aes256;priv-key=p,q")
+	if err != nil {
+		t.Fatalf("ParseUser: %v", err)
+	}
+	if want := (User{Name: "rwuser", Auth: AuthSHA256, AuthKey: "a=b", Priv: PrivAES256, PrivKey: "p,q"}); u != want {
+		t.Fatalf("ParseUser = %+v, want %+v", u, want)
+	}
+	for _, bad := range []string{"", ";auth=SHA1", "u;auth"} {
+		if _, err := ParseUser(bad); err == nil {
+			t.Errorf("ParseUser(%q) succeeded", bad)
+		}
+	}
+}
@@ -3,12 +3,14 @@ package v3
 import (
 	"encoding/asn1"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/gosnmp/gosnmp"
 )
 
 const (
 	USMStatsNotInTimeWindowOID = ".1.3.6.1.6.3.15.1.1.2.0"
+	USMStatsUnknownUserNameOID = ".1.3.6.1.6.3.15.1.1.3.0"
 	USMStatsUnknownEngineIDOID = ".1.3.6.1.6.3.15.1.1.4.0"
 	USMStatsWrongDigestOID     = ".1.3.6.1.6.3.15.1.1.5.0"
 )
@@ -39,10 +41,175 @@ func DecodeUSMSecurityParameters(data []byte) (SecurityParams, error) {
 	return params, nil
 }
 
-func BuildUSMReportVar(oid string) gosnmp.SnmpPDU {
+// MessageHeader is the part of an SNMPv3 message readable without keys: the
+// msgGlobalData and the USM security parameters (RFC 3412 section 6, RFC 3414
+// section 2.4)
+type MessageHeader struct {
+	MsgID         int
+	MsgMaxSize    int
+	MsgFlags      gosnmp.SnmpV3MsgFlags
+	SecurityModel int
+	USM           SecurityParams
+}
+
+// ParseMessageHeader reads the header of an SNMPv3 message, so the user's
+// keys can be chosen before its scoped PDU is decrypted. Integers are read
+// leniently: encoders, gosnmp among them, pad some to a fixed width, which
+// encoding/asn1 rejects.
+func ParseMessageHeader(packet []byte) (MessageHeader, error) {
+	msg, _, err := berElement(packet, berSequence)
+	if err != nil {
+		return MessageHeader{}, fmt.Errorf("decode v3 message: %w", err)
+	}
+	version, msg, err := berInt(msg)
+	if err != nil || version != int(gosnmp.Version3) {
+		return MessageHeader{}, fmt.Errorf("not an SNMPv3 message")
+	}
+	global, msg, err := berElement(msg, berSequence)
+	if err != nil {
+		return MessageHeader{}, fmt.Errorf("decode msgGlobalData: %w", err)
+	}
+	var hdr MessageHeader
+	if hdr.MsgID, global, err = berInt(global); err != nil {
+		return MessageHeader{}, fmt.Errorf("decode msgID: %w", err)
+	}
+	if hdr.MsgMaxSize, global, err = berInt(global); err != nil {
+		return MessageHeader{}, fmt.Errorf("decode msgMaxSize: %w", err)
+	}
+	flags, global, err := berElement(global, berOctetString)
+	if err != nil || len(flags) != 1 {
+		return MessageHeader{}, fmt.Errorf("decode msgFlags")
+	}
+	hdr.MsgFlags = gosnmp.SnmpV3MsgFlags(flags[0])
+	if hdr.SecurityModel, _, err = berInt(global); err != nil {
+		return MessageHeader{}, fmt.Errorf("decode msgSecurityModel: %w", err)
+	}
+
+	secParams, _, err := berElement(msg, berOctetString)
+	if err != nil {
+		return MessageHeader{}, fmt.Errorf("decode msgSecurityParameters: %w", err)
+	}
+	usm, _, err := berElement(secParams, berSequence)
+	if err != nil {
+		return MessageHeader{}, fmt.Errorf("decode usm params: %w", err)
+	}
+	var user []byte
+	if hdr.USM.AuthoritativeEngineID, usm, err = berElement(usm, berOctetString); err == nil {
+		if hdr.USM.AuthoritativeEngineBoots, usm, err = berInt(usm); err == nil {
+			if hdr.USM.AuthoritativeEngineTime, usm, err = berInt(usm); err == nil {
+				user, usm, err = berElement(usm, berOctetString)
+			}
+		}
+	}
+	if err != nil {
+		return MessageHeader{}, fmt.Errorf("decode usm params: %w", err)
+	}
+	hdr.USM.UserName = string(user)
+	// the digest and salt follow; a malformed one fails the full decode
+	if hdr.USM.AuthenticationParameters, usm, err = berElement(usm, berOctetString); err == nil {
+		hdr.USM.PrivacyParameters, _, _ = berElement(usm, berOctetString)
+	}
+	return hdr, nil
+}
+
+// BER tags of the SNMPv3 header
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berSequence    = 0x30
+)
+
+// berElement reads an element with tag from the front of b and returns its
+// contents and what follows it
+func berElement(b []byte, tag byte) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, fmt.Errorf("truncated element")
+	}
+	if b[0] != tag {
+		return nil, nil, fmt.Errorf("tag 0x%02x, want 0x%02x", b[0], tag)
+	}
+	n, hdrLen := int(b[1]), 2
+	if b[1]&0x80 != 0 {
+		octets := int(b[1] & 0x7f)
+		if octets == 0 || octets > 4 || len(b) < 2+octets {
+			return nil, nil, fmt.Errorf("bad length")
+		}
+		n = 0
+		for _, c := range b[2 : 2+octets] {
+			n = n<<8 | int(c)
+		}
+		hdrLen += octets
+	}
+	if n < 0 || len(b)-hdrLen < n {
+		return nil, nil, fmt.Errorf("truncated element")
+	}
+	return b[hdrLen : hdrLen+n], b[hdrLen+n:], nil
+}
+
+// berInt reads an INTEGER of up to 5 content octets as unsigned; the header
+// fields are all 0 to 2^31-1
+func berInt(b []byte) (int, []byte, error) {
+	v, rest, err := berElement(b, berInteger)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(v) == 0 || len(v) > 5 {
+		return 0, nil, fmt.Errorf("bad integer")
+	}
+	n := 0
+	for _, c := range v {
+		n = n<<8 | int(c)
+	}
+	return n, rest, nil
+}
+
+// USMStats holds the usmStats counters (RFC 3414) of a single SNMP engine.
+// The zero value is ready to use and safe for concurrent access.
+type USMStats struct {
+	notInTimeWindows atomic.Uint32
+	unknownUserNames atomic.Uint32
+	unknownEngineIDs atomic.Uint32
+	wrongDigests     atomic.Uint32
+}
+
+func (s *USMStats) counter(oid string) *atomic.Uint32 {
+	switch oid {
+	case USMStatsNotInTimeWindowOID:
+		return &s.notInTimeWindows
+	case USMStatsUnknownUserNameOID:
+		return &s.unknownUserNames
+	case USMStatsUnknownEngineIDOID:
+		return &s.unknownEngineIDs
+	case USMStatsWrongDigestOID:
+		return &s.wrongDigests
+	default:
+		return nil
+	}
+}
+
+// Increment bumps the counter identified by its report OID and returns the new
+// value. Unknown OIDs are not counted and report 1.
+func (s *USMStats) Increment(oid string) uint32 {
+	c := s.counter(oid)
+	if c == nil {
+		return 1
+	}
+	return c.Add(1)
+}
+
+// Value returns the current value of the counter identified by its report OID.
+func (s *USMStats) Value(oid string) uint32 {
+	c := s.counter(oid)
+	if c == nil {
+		return 0
+	}
+	return c.Load()
+}
+
+func BuildUSMReportVar(oid string, count uint32) gosnmp.SnmpPDU {
 	return gosnmp.SnmpPDU{
 		Name:  oid,
 		Type:  gosnmp.Counter32,
-		Value: uint(1),
+		Value: uint(count),
 	}
 }
@@ -1,6 +1,10 @@
 package v3
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
 
 func TestUSMEncodeDecode(t *testing.T) {
 	in := SecurityParams{
@@ -26,3 +30,44 @@ func TestUSMEncodeDecode(t *testing.T) {
 		t.Fatalf("decoded value mismatch: %+v", out)
 	}
 }
+
+func TestParseMessageHeaderOfEncryptedMessage(t *testing.T) {
+	cfg := Config{Enabled: true, EngineID: GenerateEngineID("header"), Username: "rwuser", Auth: AuthSHA256, AuthKey: "rwpass123", Priv: PrivAES128, PrivKey: "rwpriv123"}
+	usm := cfg.BuildUSM(3, 1234)
+	usm.Logger = gosnmp.NewLogger(nil)
+	if err := usm.InitSecurityKeys(); err != nil {
+		t.Fatalf("init keys: %v", err)
+	}
+	pkt := &gosnmp.SnmpPacket{
+		Version:            gosnmp.Version3,
+		MsgFlags:           gosnmp.AuthPriv | gosnmp.Reportable,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: usm,
+		ContextEngineID:    cfg.EngineID,
+		PDUType:            gosnmp.GetRequest,
+		MsgID:              4242,
+		RequestID:          7,
+		MsgMaxSize:         65507,
+		Variables:          []gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.Null}},
+		Logger:             gosnmp.NewLogger(nil),
+	}
+	raw, err := pkt.MarshalMsg()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	hdr, err := ParseMessageHeader(raw)
+	if err != nil {
+		t.Fatalf("ParseMessageHeader: %v", err)
+	}
+	if hdr.MsgID != 4242 || hdr.MsgMaxSize != 65507 || hdr.MsgFlags != gosnmp.AuthPriv|gosnmp.Reportable || hdr.SecurityModel != int(gosnmp.UserSecurityModel) {
+		t.Fatalf("header = %+v", hdr)
+	}
+	if hdr.USM.UserName != "rwuser" || string(hdr.USM.AuthoritativeEngineID) != cfg.EngineID || hdr.USM.AuthoritativeEngineBoots != 3 || hdr.USM.AuthoritativeEngineTime != 1234 {
+		t.Fatalf("usm = %+v", hdr.USM)
+	}
+
+	if _, err := ParseMessageHeader([]byte{0x30, 0x03, 0x02, 0x01, 0x01}); err == nil {
+		t.Fatal("ParseMessageHeader accepted a v2c-shaped message")
+	}
+}
@@ -29,12 +29,22 @@ type bindingSpec struct {
 }
 
 type variationSpec struct {
-	Type   string `yaml:"type"`
-	Delta  int64  `yaml:"delta"`
-	Max    int64  `yaml:"max"`
-	Seed   int64  `yaml:"seed"`
-	Period string `yaml:"period"`
-	Delay  string `yaml:"delay"`
+	Type   string   `yaml:"type"`
+	Delta  int64    `yaml:"delta"`
+	Min    int64    `yaml:"min"`
+	Max    int64    `yaml:"max"`
+	Step   int64    `yaml:"step"`
+	Seed   int64    `yaml:"seed"`
+	Period string   `yaml:"period"`
+	Delay  string   `yaml:"delay"`
+	Values []string `yaml:"values"`
+	Mode   string   `yaml:"mode"`
+
+	// flap
+	Up      string `yaml:"up"`
+	Down    string `yaml:"down"`
+	Indices []int  `yaml:"indices"`
+	Traps   bool   `yaml:"traps"`
 }
 
 func NewBinder(specs []bindingSpec) (*Binder, error) {
@@ -75,16 +85,43 @@ func LoadBinder(path string) (*Binder, error) {
 }
 
 func (b *Binder) Apply(now time.Time, pdu PDU) (PDU, error) {
+	return b.ApplyDevice(now, 0, pdu)
+}
+
+// ApplyDevice applies the chain bound to pdu on behalf of one device, so
+// per-device variations such as sequence keep separate cursors
+func (b *Binder) ApplyDevice(now time.Time, deviceID int, pdu PDU) (PDU, error) {
+	pdu, _, err := b.ApplyEvent(now, deviceID, pdu)
+	return pdu, err
+}
+
+// ApplyEvent is ApplyDevice that also returns the event, such as
+// EventLinkDown, the bound chain reported; see Chain.ApplyEvent
+func (b *Binder) ApplyEvent(now time.Time, deviceID int, pdu PDU) (PDU, string, error) {
 	if b == nil {
-		return pdu, nil
+		return pdu, "", nil
 	}
 	oid := normalizeOIDPrefix(pdu.Name)
 	for _, entry := range b.bindings {
 		if matchesPrefix(oid, entry.prefix) {
-			return entry.chain.Apply(now, pdu)
+			return entry.chain.ApplyEvent(now, deviceID, pdu)
 		}
 	}
-	return pdu, nil
+	return pdu, "", nil
+}
+
+// Bound reports whether oid falls under one of the binder's prefixes
+func (b *Binder) Bound(oid string) bool {
+	if b == nil {
+		return false
+	}
+	oid = normalizeOIDPrefix(oid)
+	for _, entry := range b.bindings {
+		if matchesPrefix(oid, entry.prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 func matchesPrefix(oid, prefix string) bool {
@@ -104,8 +141,20 @@ func buildVariation(spec variationSpec) (Variation, error) {
 	switch strings.ToLower(strings.TrimSpace(spec.Type)) {
 	case "countermonotonic":
 		return NewCounterMonotonic(spec.Delta), nil
+	case "counterwrap":
+		if spec.Delta < 0 {
+			return nil, fmt.Errorf("counterWrap delta must not be negative")
+		}
+		return NewCounterWrap(uint64(spec.Delta)), nil
+	case "counter64wrap":
+		if spec.Delta < 0 {
+			return nil, fmt.Errorf("counter64Wrap delta must not be negative")
+		}
+		return NewCounter64Wrap(uint64(spec.Delta)), nil
 	case "randomjitter":
 		return NewRandomJitter(spec.Max, spec.Seed), nil
+	case "randomwalk":
+		return NewRandomWalk(spec.Min, spec.Max, spec.Step, spec.Seed)
 	case "step":
 		d, err := ParseDuration(spec.Period)
 		if err != nil {
@@ -118,6 +167,18 @@ func buildVariation(spec variationSpec) (Variation, error) {
 			return nil, fmt.Errorf("invalid period: %w", err)
 		}
 		return NewPeriodicReset(d), nil
+	case "sequence":
+		return NewSequence(spec.Values, spec.Mode)
+	case "flap":
+		up, err := ParseDuration(spec.Up)
+		if err != nil {
+			return nil, fmt.Errorf("invalid up: %w", err)
+		}
+		down, err := ParseDuration(spec.Down)
+		if err != nil {
+			return nil, fmt.Errorf("invalid down: %w", err)
+		}
+		return NewFlap(up, down, spec.Indices, spec.Traps)
 	case "dropoid":
 		return &DropOID{}, nil
 	case "timeout":
@@ -3,7 +3,9 @@ package variation
 import (
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +24,20 @@ type Variation interface {
 	Apply(time.Time, PDU) (PDU, error)
 }
 
+// DeviceVariation is a Variation that keeps its state per device, so agents
+// sharing one binder do not advance each other's values
+type DeviceVariation interface {
+	Variation
+	ApplyDevice(now time.Time, deviceID int, pdu PDU) (PDU, error)
+}
+
+// EventVariation is a Variation that can report a transition worth a
+// notification, such as a link going down, along with the varied value
+type EventVariation interface {
+	Variation
+	ApplyEvent(now time.Time, deviceID int, pdu PDU) (PDU, string, error)
+}
+
 func toInt64(v interface{}) (int64, bool) {
 	switch x := v.(type) {
 	case int:
@@ -95,6 +111,79 @@ func (v *CounterMonotonic) Apply(_ time.Time, pdu PDU) (PDU, error) {
 	return pdu, nil
 }
 
+// CounterWrap increments a counter by Delta per access and rolls it over
+// the way an agent's counter does: modulo 2^32 for counterWrap, so Counter32
+// values go from 4294967295 back through 0, and modulo 2^64 for
+// counter64Wrap.
+type CounterWrap struct {
+	Delta uint64
+	Bits  int // 32 or 64
+
+	mu      sync.Mutex
+	current map[string]uint64
+}
+
+func NewCounterWrap(delta uint64) *CounterWrap {
+	return newCounterWrap(delta, 32)
+}
+
+func NewCounter64Wrap(delta uint64) *CounterWrap {
+	return newCounterWrap(delta, 64)
+}
+
+func newCounterWrap(delta uint64, bits int) *CounterWrap {
+	if delta == 0 {
+		delta = 1
+	}
+	return &CounterWrap{Delta: delta, Bits: bits, current: map[string]uint64{}}
+}
+
+func (v *CounterWrap) Apply(_ time.Time, pdu PDU) (PDU, error) {
+	base, ok := toUint64(pdu.Value)
+	if !ok {
+		return pdu, nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	cur, exists := v.current[pdu.Name]
+	if !exists {
+		cur = base
+	}
+	cur += v.Delta // unsigned, so this wraps at 2^64
+	if v.Bits == 32 {
+		cur &= 0xFFFFFFFF
+	}
+	v.current[pdu.Name] = cur
+
+	switch pdu.Type {
+	case gosnmp.Counter64:
+		pdu.Value = cur
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		pdu.Value = uint32(cur)
+	default:
+		pdu.Value = castByType(pdu.Type, int64(cur))
+	}
+	return pdu, nil
+}
+
+func toUint64(v interface{}) (uint64, bool) {
+	switch x := v.(type) {
+	case uint:
+		return uint64(x), true
+	case uint32:
+		return uint64(x), true
+	case uint64:
+		return x, true
+	}
+	n, ok := toInt64(v)
+	if !ok || n < 0 {
+		return 0, false
+	}
+	return uint64(n), true
+}
+
 type RandomJitter struct {
 	Max int64
 
@@ -127,6 +216,76 @@ func (v *RandomJitter) Apply(_ time.Time, pdu PDU) (PDU, error) {
 	return pdu, nil
 }
 
+// RandomWalk moves a Gauge32 or Integer value by a random step of at most
+// Step either way on each access, staying within Min and Max. The walk starts
+// from the dataset value, clamped, and keeps its position per device and OID.
+// Other types pass through.
+type RandomWalk struct {
+	Min  int64
+	Max  int64
+	Step int64
+
+	mu      sync.Mutex
+	rng     *rand.Rand
+	current map[string]int64
+}
+
+func NewRandomWalk(min, max, step, seed int64) (*RandomWalk, error) {
+	if min > max {
+		return nil, fmt.Errorf("randomWalk min %d is above max %d", min, max)
+	}
+	if step < 0 {
+		return nil, fmt.Errorf("randomWalk step must not be negative")
+	}
+	if seed == 0 {
+		seed = 1
+	}
+	return &RandomWalk{Min: min, Max: max, Step: step, rng: rand.New(rand.NewSource(seed)), current: map[string]int64{}}, nil
+}
+
+func (v *RandomWalk) Apply(now time.Time, pdu PDU) (PDU, error) {
+	return v.ApplyDevice(now, 0, pdu)
+}
+
+func (v *RandomWalk) ApplyDevice(_ time.Time, deviceID int, pdu PDU) (PDU, error) {
+	lo, hi := v.Min, v.Max
+	switch pdu.Type {
+	case gosnmp.Gauge32:
+		lo, hi = max(lo, 0), min(hi, math.MaxUint32)
+	case gosnmp.Integer:
+		lo, hi = max(lo, math.MinInt32), min(hi, math.MaxInt32)
+	default:
+		return pdu, nil
+	}
+	if lo > hi {
+		return pdu, nil
+	}
+
+	key := fmt.Sprintf("%d|%s", deviceID, pdu.Name)
+	v.mu.Lock()
+	cur, ok := v.current[key]
+	if !ok {
+		base, valid := toInt64(pdu.Value)
+		if !valid {
+			v.mu.Unlock()
+			return pdu, nil
+		}
+		cur = base
+	} else if v.Step > 0 {
+		cur += v.rng.Int63n(v.Step*2+1) - v.Step
+	}
+	cur = min(max(cur, lo), hi)
+	v.current[key] = cur
+	v.mu.Unlock()
+
+	if pdu.Type == gosnmp.Integer {
+		pdu.Value = int(cur) // gosnmp marshals INTEGER only from int
+	} else {
+		pdu.Value = castByType(pdu.Type, cur)
+	}
+	return pdu, nil
+}
+
 type Step struct {
 	Period time.Duration
 	Delta  int64
@@ -211,6 +370,150 @@ func (v *PeriodicReset) Apply(now time.Time, pdu PDU) (PDU, error) {
 	return pdu, nil
 }
 
+// Sequence modes: loop restarts after the last value, hold keeps serving it
+const (
+	SequenceLoop = "loop"
+	SequenceHold = "hold"
+)
+
+// Sequence serves a fixed list of values, one per access, with a cursor per
+// device and OID. Values are converted to the PDU's type; numeric types need
+// integer values.
+type Sequence struct {
+	Values []string
+	Hold   bool
+
+	mu     sync.Mutex
+	cursor map[string]int
+}
+
+func NewSequence(values []string, mode string) (*Sequence, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("sequence needs at least one value")
+	}
+	v := &Sequence{Values: append([]string(nil), values...), cursor: map[string]int{}}
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", SequenceLoop:
+	case SequenceHold:
+		v.Hold = true
+	default:
+		return nil, fmt.Errorf("unsupported sequence mode %q (want %s or %s)", mode, SequenceLoop, SequenceHold)
+	}
+	return v, nil
+}
+
+func (v *Sequence) Apply(now time.Time, pdu PDU) (PDU, error) {
+	return v.ApplyDevice(now, 0, pdu)
+}
+
+func (v *Sequence) ApplyDevice(_ time.Time, deviceID int, pdu PDU) (PDU, error) {
+	key := fmt.Sprintf("%d|%s", deviceID, pdu.Name)
+	v.mu.Lock()
+	i := v.cursor[key]
+	if i < len(v.Values)-1 || !v.Hold {
+		v.cursor[key] = (i + 1) % len(v.Values)
+	}
+	v.mu.Unlock()
+
+	value := v.Values[i]
+	switch pdu.Type {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32, gosnmp.Counter64:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return pdu, nil
+		}
+		pdu.Value = castByType(pdu.Type, n)
+	default:
+		pdu.Value = value
+	}
+	return pdu, nil
+}
+
+// ifOperStatus values served by Flap
+const (
+	FlapUp   = 1
+	FlapDown = 2
+)
+
+// Events a Flap with Traps reports on transitions
+const (
+	EventLinkUp   = "link-up"
+	EventLinkDown = "link-down"
+)
+
+// Flap alternates an interface status between up(1) for Up and down(2) for
+// Down, starting up when first applied, with all rows in step. Indices limits
+// it to rows whose last arc is listed; other rows pass through. With Traps
+// set, the first access of a row after a transition reports EventLinkDown or
+// EventLinkUp, per device.
+type Flap struct {
+	Up      time.Duration
+	Down    time.Duration
+	Indices map[string]bool
+	Traps   bool
+
+	mu    sync.Mutex
+	start time.Time
+	last  map[string]int
+}
+
+func NewFlap(up, down time.Duration, indices []int, traps bool) (*Flap, error) {
+	if up <= 0 || down <= 0 {
+		return nil, fmt.Errorf("flap needs positive up and down durations")
+	}
+	v := &Flap{Up: up, Down: down, Traps: traps, last: map[string]int{}}
+	if len(indices) > 0 {
+		v.Indices = make(map[string]bool, len(indices))
+		for _, index := range indices {
+			v.Indices[strconv.Itoa(index)] = true
+		}
+	}
+	return v, nil
+}
+
+func (v *Flap) Apply(now time.Time, pdu PDU) (PDU, error) {
+	return v.ApplyDevice(now, 0, pdu)
+}
+
+func (v *Flap) ApplyDevice(now time.Time, deviceID int, pdu PDU) (PDU, error) {
+	pdu, _, err := v.ApplyEvent(now, deviceID, pdu)
+	return pdu, err
+}
+
+func (v *Flap) ApplyEvent(now time.Time, deviceID int, pdu PDU) (PDU, string, error) {
+	name := strings.TrimPrefix(pdu.Name, ".")
+	if v.Indices != nil && !v.Indices[name[strings.LastIndex(name, ".")+1:]] {
+		return pdu, "", nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.start.IsZero() {
+		v.start = now
+	}
+	status := FlapUp
+	if now.Sub(v.start)%(v.Up+v.Down) >= v.Up {
+		status = FlapDown
+	}
+
+	event := ""
+	key := fmt.Sprintf("%d|%s", deviceID, name)
+	if last, seen := v.last[key]; v.Traps && seen && last != status {
+		event = EventLinkUp
+		if status == FlapDown {
+			event = EventLinkDown
+		}
+	}
+	v.last[key] = status
+
+	if pdu.Type == gosnmp.Integer {
+		pdu.Value = status // gosnmp marshals INTEGER only from int
+	} else {
+		pdu.Value = castByType(pdu.Type, int64(status))
+	}
+	return pdu, event, nil
+}
+
 type DropOID struct{}
 
 func (v *DropOID) Apply(_ time.Time, pdu PDU) (PDU, error) {
@@ -231,14 +534,38 @@ func (v *Timeout) Apply(_ time.Time, pdu PDU) (PDU, error) {
 type Chain []Variation
 
 func (c Chain) Apply(now time.Time, pdu PDU) (PDU, error) {
+	return c.ApplyDevice(now, 0, pdu)
+}
+
+// ApplyDevice runs the chain for one device; DeviceVariations in it use
+// that device's state
+func (c Chain) ApplyDevice(now time.Time, deviceID int, pdu PDU) (PDU, error) {
+	pdu, _, err := c.ApplyEvent(now, deviceID, pdu)
+	return pdu, err
+}
+
+// ApplyEvent runs the chain like ApplyDevice and also returns the last event
+// an EventVariation in it reported, or ""
+func (c Chain) ApplyEvent(now time.Time, deviceID int, pdu PDU) (PDU, string, error) {
 	var err error
+	event := ""
 	for _, v := range c {
-		pdu, err = v.Apply(now, pdu)
+		switch tv := v.(type) {
+		case EventVariation:
+			var ev string
+			if pdu, ev, err = tv.ApplyEvent(now, deviceID, pdu); ev != "" {
+				event = ev
+			}
+		case DeviceVariation:
+			pdu, err = tv.ApplyDevice(now, deviceID, pdu)
+		default:
+			pdu, err = v.Apply(now, pdu)
+		}
 		if err != nil {
-			return pdu, err
+			return pdu, event, err
 		}
 	}
-	return pdu, nil
+	return pdu, event, nil
 }
 
 func ParseDuration(value string) (time.Duration, error) {
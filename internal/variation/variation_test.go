@@ -25,6 +25,50 @@ func TestCounterMonotonic(t *testing.T) {
 	}
 }
 
+func TestCounterWrapRollsOverAt2To32(t *testing.T) {
+	v := NewCounterWrap(3)
+	pdu := PDU{Name: "1.3.6.1.2.1.2.2.1.10.1", Type: gosnmp.Counter32, Value: uint32(4294967290)}
+
+	want := []uint32{4294967293, 0, 3, 6}
+	for i, w := range want {
+		out, err := v.Apply(time.Now(), pdu)
+		if err != nil {
+			t.Fatalf("Apply error: %v", err)
+		}
+		if got := out.Value.(uint32); got != w {
+			t.Fatalf("read %d = %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestCounter64WrapRollsOverAt2To64(t *testing.T) {
+	v := NewCounter64Wrap(10)
+	pdu := PDU{Name: "1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(18446744073709551600)}
+
+	want := []uint64{18446744073709551610, 4, 14}
+	for i, w := range want {
+		out, _ := v.Apply(time.Now(), pdu)
+		if got := out.Value.(uint64); got != w {
+			t.Fatalf("read %d = %d, want %d", i, got, w)
+		}
+	}
+
+	// A Counter64 under counterWrap still wraps at 2^32
+	v32 := NewCounterWrap(10)
+	out, _ := v32.Apply(time.Now(), PDU{Name: "1.3.6.1.2.1.31.1.1.1.6.2", Type: gosnmp.Counter64, Value: uint64(4294967290)})
+	if got := out.Value.(uint64); got != 4 {
+		t.Fatalf("counterWrap on Counter64 = %d, want 4", got)
+	}
+}
+
+func TestBinderRejectsNegativeWrapDelta(t *testing.T) {
+	for _, typ := range []string{"counterWrap", "counter64Wrap"} {
+		if _, err := NewBinder([]bindingSpec{{Prefix: "1.3.6.1.2.1.2.2.1.10", Variations: []variationSpec{{Type: typ, Delta: -1}}}}); err == nil {
+			t.Fatalf("%s accepted a negative delta", typ)
+		}
+	}
+}
+
 func TestRandomJitterDeterministic(t *testing.T) {
 	v1 := NewRandomJitter(5, 42)
 	v2 := NewRandomJitter(5, 42)
@@ -40,6 +84,75 @@ func TestRandomJitterDeterministic(t *testing.T) {
 	}
 }
 
+func TestRandomWalkSequence(t *testing.T) {
+	pdu := PDU{Name: "1.3.6.1.2.1.99.1.1", Type: gosnmp.Gauge32, Value: uint32(50)}
+	walk := func(seed int64) []uint32 {
+		v, err := NewRandomWalk(40, 60, 5, seed)
+		if err != nil {
+			t.Fatalf("new randomWalk: %v", err)
+		}
+		var got []uint32
+		for i := 0; i < 8; i++ {
+			out, _ := v.Apply(time.Now(), pdu)
+			got = append(got, out.Value.(uint32))
+		}
+		return got
+	}
+
+	got := walk(7)
+	want := []uint32{50, 53, 58, 54, 57, 52, 57, 53}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("walk with seed 7 = %v, want %v", got, want)
+		}
+	}
+	again := walk(7)
+	for i := range got {
+		if again[i] != got[i] {
+			t.Fatalf("same seed walked %v then %v", got, again)
+		}
+	}
+}
+
+func TestRandomWalkStaysInBoundsPerOID(t *testing.T) {
+	v, err := NewRandomWalk(-10, 10, 4, 3)
+	if err != nil {
+		t.Fatalf("new randomWalk: %v", err)
+	}
+	a := PDU{Name: "1.3.6.1.2.1.99.1.1", Type: gosnmp.Integer, Value: 100} // clamped to 10 on first read
+	b := PDU{Name: "1.3.6.1.2.1.99.1.2", Type: gosnmp.Integer, Value: -3}
+	first := map[string]int{a.Name: 10, b.Name: -3}
+	last := map[string]int{}
+	for i := 0; i < 200; i++ {
+		for _, pdu := range []PDU{a, b} {
+			out, _ := v.Apply(time.Now(), pdu)
+			n := out.Value.(int)
+			if n < -10 || n > 10 {
+				t.Fatalf("read %d of %s = %d, outside [-10, 10]", i, pdu.Name, n)
+			}
+			prev, seen := last[pdu.Name]
+			if !seen {
+				prev = first[pdu.Name]
+			}
+			if n-prev > 4 || prev-n > 4 || (!seen && n != prev) {
+				t.Fatalf("read %d of %s moved from %d to %d", i, pdu.Name, prev, n)
+			}
+			last[pdu.Name] = n
+		}
+	}
+
+	counter := PDU{Name: "1.3.6.1.2.1.2.2.1.10.1", Type: gosnmp.Counter32, Value: uint32(500)}
+	if out, _ := v.Apply(time.Now(), counter); out.Value.(uint32) != 500 {
+		t.Fatalf("randomWalk changed a Counter32 to %v", out.Value)
+	}
+}
+
+func TestBinderRejectsInvertedRandomWalk(t *testing.T) {
+	if _, err := NewBinder([]bindingSpec{{Prefix: "1.3.6.1.2.1.99", Variations: []variationSpec{{Type: "randomWalk", Min: 10, Max: 5, Step: 1}}}}); err == nil {
+		t.Fatal("randomWalk accepted min above max")
+	}
+}
+
 func TestStep(t *testing.T) {
 	v := NewStep(2*time.Second, 10)
 	pdu := PDU{Name: "1.3.6.1.2.1.2.2.1.10.2", Type: gosnmp.Counter32, Value: uint32(50)}
@@ -138,3 +251,68 @@ func TestLoadBinderFromYAML(t *testing.T) {
 		t.Fatalf("expected counter 7 after variation, got %v", out.Value)
 	}
 }
+
+func TestSequenceHoldsLastValue(t *testing.T) {
+	v, err := NewSequence([]string{"1", "2"}, SequenceHold)
+	if err != nil {
+		t.Fatalf("NewSequence: %v", err)
+	}
+	pdu := PDU{Name: "1.3.6.1.4.1.55555.16.2.0", Type: gosnmp.Integer, Value: 0}
+	var got []interface{}
+	for i := 0; i < 4; i++ {
+		p, _ := v.Apply(time.Now(), pdu)
+		got = append(got, p.Value)
+	}
+	if got[0] != int64(1) || got[1] != int64(2) || got[2] != int64(2) || got[3] != int64(2) {
+		t.Fatalf("hold sequence = %v, want 1 2 2 2", got)
+	}
+
+	if _, err := NewSequence(nil, ""); err == nil {
+		t.Fatal("expected error for an empty sequence")
+	}
+	if _, err := NewSequence([]string{"1"}, "bounce"); err == nil {
+		t.Fatal("expected error for an unknown mode")
+	}
+}
+
+func TestFlapAlternatesListedIndices(t *testing.T) {
+	b, err := NewBinder([]bindingSpec{{
+		Prefix:     "1.3.6.1.2.1.2.2.1.8",
+		Variations: []variationSpec{{Type: "flap", Up: "10s", Down: "5s", Indices: []int{2}, Traps: true}},
+	}})
+	if err != nil {
+		t.Fatalf("NewBinder error: %v", err)
+	}
+	flapping := PDU{Name: ".1.3.6.1.2.1.2.2.1.8.2", Type: gosnmp.Integer, Value: 1}
+	steady := PDU{Name: ".1.3.6.1.2.1.2.2.1.8.1", Type: gosnmp.Integer, Value: 1}
+	t0 := time.Unix(0, 0)
+
+	for _, step := range []struct {
+		at     time.Duration
+		status int
+		event  string
+	}{
+		{0, FlapUp, ""},
+		{9 * time.Second, FlapUp, ""},
+		{11 * time.Second, FlapDown, EventLinkDown},
+		{14 * time.Second, FlapDown, ""},
+		{16 * time.Second, FlapUp, EventLinkUp},
+	} {
+		out, event, err := b.ApplyEvent(t0.Add(step.at), 1, flapping)
+		if err != nil || out.Value != step.status || event != step.event {
+			t.Fatalf("at %s: got %v %q %v, want %d %q", step.at, out.Value, event, err, step.status, step.event)
+		}
+	}
+
+	// Another device sees the same schedule but reports its own transitions
+	if out, event, _ := b.ApplyEvent(t0.Add(12*time.Second), 2, flapping); out.Value != FlapDown || event != "" {
+		t.Fatalf("second device first access = %v %q, want down without event", out.Value, event)
+	}
+	if out, _, _ := b.ApplyEvent(t0.Add(12*time.Second), 1, steady); out.Value != 1 {
+		t.Fatalf("unlisted index = %v, want unchanged", out.Value)
+	}
+
+	if _, err := NewBinder([]bindingSpec{{Prefix: "1.3.6.1.2.1.2.2.1.8", Variations: []variationSpec{{Type: "flap", Up: "10s"}}}}); err == nil {
+		t.Fatal("expected error for a flap without down duration")
+	}
+}
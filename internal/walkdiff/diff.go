@@ -2,30 +2,53 @@ package walkdiff
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
 )
 
 type Difference struct {
-	OID        string
-	Kind       string
-	LeftType   string
-	LeftValue  string
-	RightType  string
-	RightValue string
+	OID        string `json:"oid"`
+	Kind       string `json:"kind"`
+	LeftType   string `json:"left_type,omitempty"`
+	LeftValue  string `json:"left_value,omitempty"`
+	RightType  string `json:"right_type,omitempty"`
+	RightValue string `json:"right_value,omitempty"`
 }
 
 type Result struct {
-	LeftCount  int
-	RightCount int
-	Diffs      []Difference
+	LeftCount  int          `json:"left_count"`
+	RightCount int          `json:"right_count"`
+	Diffs      []Difference `json:"diffs"`
 }
 
 func (r Result) Identical() bool {
 	return len(r.Diffs) == 0
 }
 
-func CompareFiles(leftPath, rightPath string) (Result, error) {
+// Options tunes a comparison. The zero value reports every difference.
+type Options struct {
+	// IgnoreTypes lists snmprec type names, such as counter32 or timeticks,
+	// whose values are expected to change between walks of a live device. An
+	// OID of one of these types on both sides is equal whatever its values;
+	// an OID present on one side only is still reported. Aliases such as c32
+	// or tt name the same type as their full names.
+	IgnoreTypes []string
+}
+
+// ParseTypeList splits a comma separated list of type names, as given to
+// --ignore-types
+func ParseTypeList(spec string) []string {
+	var types []string
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.ToLower(strings.TrimSpace(part)); part != "" {
+			types = append(types, part)
+		}
+	}
+	return types
+}
+
+func CompareFiles(leftPath, rightPath string, opts Options) (Result, error) {
 	leftEntries, err := snmprecfmt.ReadFile(leftPath)
 	if err != nil {
 		return Result{}, fmt.Errorf("read left file: %w", err)
@@ -34,6 +57,15 @@ func CompareFiles(leftPath, rightPath string) (Result, error) {
 	if err != nil {
 		return Result{}, fmt.Errorf("read right file: %w", err)
 	}
+	return CompareEntries(leftEntries, rightEntries, opts), nil
+}
+
+// CompareEntries diffs two walks, reporting differences in OID order.
+func CompareEntries(leftEntries, rightEntries []snmprecfmt.Entry, opts Options) Result {
+	ignored := make(map[string]bool, len(opts.IgnoreTypes))
+	for _, typ := range opts.IgnoreTypes {
+		ignored[snmprecfmt.CanonicalType(typ)] = true
+	}
 
 	leftMap := make(map[string]snmprecfmt.Entry, len(leftEntries))
 	for _, e := range leftEntries {
@@ -67,6 +99,7 @@ func CompareFiles(leftPath, rightPath string) (Result, error) {
 		oid := e.OID
 		left, leftOK := leftMap[oid]
 		right, rightOK := rightMap[oid]
+		leftType, rightType := snmprecfmt.CanonicalType(left.Type), snmprecfmt.CanonicalType(right.Type)
 
 		switch {
 		case leftOK && !rightOK:
@@ -83,7 +116,8 @@ func CompareFiles(leftPath, rightPath string) (Result, error) {
 				RightType:  right.Type,
 				RightValue: right.Value,
 			})
-		case left.Type != right.Type || left.Value != right.Value:
+		case leftType == rightType && ignored[leftType]:
+		case leftType != rightType || left.Value != right.Value:
 			diffs = append(diffs, Difference{
 				OID:        oid,
 				Kind:       "value-mismatch",
@@ -95,5 +129,5 @@ func CompareFiles(leftPath, rightPath string) (Result, error) {
 		}
 	}
 
-	return Result{LeftCount: len(leftEntries), RightCount: len(rightEntries), Diffs: diffs}, nil
+	return Result{LeftCount: len(leftEntries), RightCount: len(rightEntries), Diffs: diffs}
 }
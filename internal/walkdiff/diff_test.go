@@ -0,0 +1,82 @@
+package walkdiff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/snmprecfmt"
+)
+
+func TestCompareFilesIgnoresVolatileTypesButNotStructure(t *testing.T) {
+	dir := t.TempDir()
+	left := filepath.Join(dir, "left.snmprec")
+	if err := os.WriteFile(left, []byte(`1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+1.3.6.1.2.1.1.3.0|timeticks|1000
+1.3.6.1.2.1.2.2.1.10.1|counter32|500
+1.3.6.1.2.1.2.2.1.10.2|counter32|600
+1.3.6.1.2.1.31.1.1.1.6.1|counter64|9000
+`), 0o644); err != nil {
+		t.Fatalf("write left: %v", err)
+	}
+	right := filepath.Join(dir, "right.snmprec")
+	if err := os.WriteFile(right, []byte(`1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+1.3.6.1.2.1.1.3.0|timeticks|7000
+1.3.6.1.2.1.2.2.1.10.1|counter32|800
+1.3.6.1.2.1.2.2.1.10.3|counter32|10
+1.3.6.1.2.1.31.1.1.1.6.1|counter64|9100
+`), 0o644); err != nil {
+		t.Fatalf("write right: %v", err)
+	}
+
+	strict, err := CompareFiles(left, right, Options{})
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if len(strict.Diffs) != 5 {
+		t.Fatalf("strict diff = %+v, want 5 differences", strict.Diffs)
+	}
+
+	result, err := CompareFiles(left, right, Options{IgnoreTypes: ParseTypeList(" Counter32, counter64,timeticks,")})
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	want := []Difference{
+		{OID: "1.3.6.1.2.1.2.2.1.10.2", Kind: "missing-in-right", LeftType: "counter32", LeftValue: "600"},
+		{OID: "1.3.6.1.2.1.2.2.1.10.3", Kind: "missing-in-left", RightType: "counter32", RightValue: "10"},
+	}
+	if !reflect.DeepEqual(result.Diffs, want) {
+		t.Fatalf("diffs ignoring counters = %+v, want %+v", result.Diffs, want)
+	}
+}
+
+func TestCompareEntriesResolvesTypeAliases(t *testing.T) {
+	result := CompareEntries(
+		[]snmprecfmt.Entry{
+			{OID: "1.3.6.1.2.1.1.3.0", Type: "tt", Value: "1000"},
+			{OID: "1.3.6.1.2.1.1.5.0", Type: "s", Value: "edge"},
+			{OID: "1.3.6.1.2.1.2.2.1.10.1", Type: "counter32", Value: "5"},
+		},
+		[]snmprecfmt.Entry{
+			{OID: "1.3.6.1.2.1.1.3.0", Type: "timeticks", Value: "7000"},
+			{OID: "1.3.6.1.2.1.1.5.0", Type: "octetstring", Value: "edge"},
+			{OID: "1.3.6.1.2.1.2.2.1.10.1", Type: "c32", Value: "9"},
+		},
+		Options{IgnoreTypes: ParseTypeList("counter,ticks")},
+	)
+	if !result.Identical() {
+		t.Fatalf("diffs = %+v, want aliases to match their full type names", result.Diffs)
+	}
+}
+
+func TestCompareEntriesStillReportsTypeChangeOfIgnoredType(t *testing.T) {
+	result := CompareEntries(
+		[]snmprecfmt.Entry{{OID: "1.3.6.1.2.1.2.2.1.10.1", Type: "counter32", Value: "5"}},
+		[]snmprecfmt.Entry{{OID: "1.3.6.1.2.1.2.2.1.10.1", Type: "gauge32", Value: "5"}},
+		Options{IgnoreTypes: []string{"counter32"}},
+	)
+	if len(result.Diffs) != 1 || result.Diffs[0].Kind != "value-mismatch" {
+		t.Fatalf("diffs = %+v, want the counter32 to gauge32 change", result.Diffs)
+	}
+}
@@ -0,0 +1,59 @@
+package walkdiff
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+)
+
+// ReadOIDList reads required OIDs, one per line. Blank lines and # comments
+// are skipped, and anything after the OID on a line (e.g. a name) is ignored.
+func ReadOIDList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open required OIDs: %w", err)
+	}
+	defer f.Close()
+
+	var oids []string
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		oid := strings.TrimPrefix(strings.Fields(line)[0], ".")
+		if _, err := store.ParseOIDValue("objectidentifier", oid); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		oids = append(oids, oid)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read required OIDs: %w", err)
+	}
+	return oids, nil
+}
+
+// MissingOIDs returns the required OIDs db has no value for, in input order.
+// A required OID is present when db holds it exactly or holds any OID under
+// it, so a table column counts as present once it has a row.
+func MissingOIDs(db *store.OIDDatabase, required []string) []string {
+	missing := make([]string, 0)
+	for _, oid := range required {
+		oid = strings.TrimPrefix(oid, ".")
+		if db.Get(oid) != nil {
+			continue
+		}
+		if next := db.GetNext(oid); strings.HasPrefix(next, oid+".") {
+			continue
+		}
+		missing = append(missing, oid)
+	}
+	return missing
+}
@@ -0,0 +1,57 @@
+package walkdiff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/store"
+)
+
+func TestMissingOIDsReportsAbsentScalarsAndEmptyColumns(t *testing.T) {
+	dir := t.TempDir()
+	dataset := filepath.Join(dir, "dataset.snmprec")
+	if err := os.WriteFile(dataset, []byte(`1.3.6.1.2.1.1.1.0|octetstring|Edge Router
+1.3.6.1.2.1.2.2.1.2.1|octetstring|eth0
+1.3.6.1.2.1.2.2.1.2.2|octetstring|eth1
+`), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	required := filepath.Join(dir, "required.txt")
+	if err := os.WriteFile(required, []byte(`# template: generic interfaces
+.1.3.6.1.2.1.1.1.0        sysDescr
+1.3.6.1.2.1.1.5.0         sysName
+1.3.6.1.2.1.2.2.1.2       ifDescr column
+1.3.6.1.2.1.2.2.1.10      ifInOctets column, no rows
+1.3.6.1.2.1.2.2.1.2.1
+`), 0o644); err != nil {
+		t.Fatalf("write required: %v", err)
+	}
+
+	oids, err := ReadOIDList(required)
+	if err != nil {
+		t.Fatalf("read required: %v", err)
+	}
+	db := store.NewOIDDatabase()
+	if _, err := store.LoadSNMPrecFile(db, dataset); err != nil {
+		t.Fatalf("load dataset: %v", err)
+	}
+	db.SortOIDs()
+
+	got := MissingOIDs(db, oids)
+	want := []string{"1.3.6.1.2.1.1.5.0", "1.3.6.1.2.1.2.2.1.10"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("missing = %v, want %v", got, want)
+	}
+}
+
+func TestReadOIDListRejectsInvalidOID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "required.txt")
+	if err := os.WriteFile(path, []byte("1.3.6.1.2.1.1.1.0\nifDescr\n"), 0o644); err != nil {
+		t.Fatalf("write required: %v", err)
+	}
+	if _, err := ReadOIDList(path); err == nil {
+		t.Fatal("expected an error for a non-numeric OID")
+	}
+}
@@ -0,0 +1,286 @@
+// Package websocket is the server side of RFC 6455 that the HTTP API needs to
+// push updates: the opening handshake, unfragmented text frames out, and the
+// control frames a client may send back. Messages from the client are read
+// and discarded.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptGUID is the key suffix hashed into Sec-WebSocket-Accept (RFC 6455
+// section 1.3)
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes (RFC 6455 section 5.2)
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// Close status codes (RFC 6455 section 7.4.1)
+const (
+	CloseNormal    = 1000
+	CloseGoingAway = 1001
+)
+
+// maxControlPayload is the largest payload RFC 6455 allows a control frame
+const maxControlPayload = 125
+
+// writeTimeout bounds each frame write, so a client that stopped reading
+// cannot block its sender forever
+const writeTimeout = 10 * time.Second
+
+// ErrClosed is returned by writes on a closed connection
+var ErrClosed = errors.New("websocket: connection closed")
+
+// Conn is a server side WebSocket connection. Its write methods are safe for
+// concurrent use.
+type Conn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	writeMu sync.Mutex
+	closed  bool
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Accept returns the Sec-WebSocket-Accept value for a Sec-WebSocket-Key
+func Accept(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// IsUpgrade reports whether r asks to switch to the WebSocket protocol
+func IsUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade completes the opening handshake of r and takes over its
+// connection. A request that is not a valid version 13 handshake is answered
+// with 400, or 426 for another version, and an error is returned.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsUpgrade(r) {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := strings.TrimSpace(r.Header.Get("Sec-WebSocket-Key"))
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: invalid key")
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+	// the server's read and write timeouts were set for the HTTP request;
+	// they would cut a long-lived stream short
+	if err := netConn.SetDeadline(time.Time{}); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: clear deadline: %w", err)
+	}
+
+	c := &Conn{conn: netConn, rw: rw, done: make(chan struct{})}
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + Accept(key) + "\r\n\r\n"
+	if err := c.writeRaw([]byte(resp)); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: write handshake: %w", err)
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Done is closed once the peer has gone: it sent a close frame, the
+// connection failed or Close was called
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// WriteText sends msg as a single text frame
+func (c *Conn) WriteText(msg []byte) error {
+	return c.writeFrame(opText, msg)
+}
+
+// WriteJSON sends v encoded as JSON in a text frame
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteText(data)
+}
+
+// Close sends a close frame with code and reason and closes the connection.
+// It does not wait for the peer's close frame.
+func (c *Conn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	err := c.writeFrame(opClose, payload)
+	if errors.Is(err, ErrClosed) {
+		err = nil // the peer closed first and was answered
+	}
+
+	c.writeMu.Lock()
+	c.closed = true
+	c.writeMu.Unlock()
+	c.finish()
+	if closeErr := c.conn.Close(); err == nil && closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+		err = closeErr
+	}
+	return err
+}
+
+func (c *Conn) finish() {
+	c.doneOnce.Do(func() { close(c.done) })
+}
+
+// writeFrame sends one unmasked, unfragmented frame
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode // FIN
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	return c.writeRaw(header, payload)
+}
+
+func (c *Conn) writeRaw(parts ...[]byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := c.rw.Write(p); err != nil {
+			return err
+		}
+	}
+	return c.rw.Flush()
+}
+
+// readLoop reads the client's frames until the connection ends, answering
+// pings and a close frame. Data frames are discarded.
+func (c *Conn) readLoop() {
+	defer c.finish()
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opPing:
+			if c.writeFrame(opPong, payload) != nil {
+				return
+			}
+		case opClose:
+			// echo the status code, as RFC 6455 section 5.5.1 asks
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			_ = c.writeFrame(opClose, payload)
+			c.writeMu.Lock()
+			c.closed = true
+			c.writeMu.Unlock()
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// maxClientPayload caps the frames accepted from a client, which has
+// nothing to say to this server beyond control frames
+const maxClientPayload = 1 << 16
+
+func (c *Conn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.rw, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("websocket: unmasked client frame")
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxClientPayload {
+		return 0, nil, fmt.Errorf("websocket: client frame of %d bytes", n)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// headerHasToken reports whether a comma separated header of h lists token,
+// compared case-insensitively
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/testutil"
+)
+
+func TestAcceptMatchesRFCExample(t *testing.T) {
+	// RFC 6455 section 1.3
+	if got := Accept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Accept = %q", got)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = Upgrade(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain GET status = %d, want 400", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("version 8 status = %d, version header %q; want 426 naming 13", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Version"))
+	}
+}
+
+func TestConnSendsTextPongsAndClose(t *testing.T) {
+	serverDone := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(serverDone)
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		if err := conn.WriteJSON(map[string]int{"n": 1}); err != nil {
+			t.Errorf("write json: %v", err)
+		}
+		long := strings.Repeat("x", 70000) // needs the 64-bit length
+		if err := conn.WriteText([]byte(long)); err != nil {
+			t.Errorf("write long: %v", err)
+		}
+		<-conn.Done()
+	}))
+	defer srv.Close()
+
+	client := testutil.DialWebSocket(t, srv.URL, nil)
+	frame, err := client.ReadFrame(2 * time.Second)
+	if err != nil || frame.Opcode != opText || string(frame.Payload) != `{"n":1}` {
+		t.Fatalf("first frame = %d %q, %v", frame.Opcode, frame.Payload, err)
+	}
+	frame, err = client.ReadFrame(2 * time.Second)
+	if err != nil || len(frame.Payload) != 70000 {
+		t.Fatalf("long frame = %d bytes, %v", len(frame.Payload), err)
+	}
+
+	if err := client.WriteFrame(opPing, []byte("hi")); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	frame, err = client.ReadFrame(2 * time.Second)
+	if err != nil || frame.Opcode != opPong || string(frame.Payload) != "hi" {
+		t.Fatalf("pong = %d %q, %v", frame.Opcode, frame.Payload, err)
+	}
+
+	closePayload := binary.BigEndian.AppendUint16(nil, CloseNormal)
+	if err := client.WriteFrame(opClose, closePayload); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	frame, err = client.ReadFrame(2 * time.Second)
+	if err != nil || frame.Opcode != opClose || binary.BigEndian.Uint16(frame.Payload) != CloseNormal {
+		t.Fatalf("close reply = %d %v, %v", frame.Opcode, frame.Payload, err)
+	}
+	select {
+	case <-serverDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Done was not closed after the client's close frame")
+	}
+}
@@ -0,0 +1,105 @@
+package webui
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric output formats for test results
+const (
+	MetricsFormatPrometheus = "prometheus" // Prometheus text exposition format
+	MetricsFormatInflux     = "influx"     // InfluxDB line protocol
+)
+
+// ParseMetricsFormat validates a metrics format name; empty means Prometheus
+func ParseMetricsFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", MetricsFormatPrometheus, "prom":
+		return MetricsFormatPrometheus, nil
+	case MetricsFormatInflux, "influxdb", "line":
+		return MetricsFormatInflux, nil
+	default:
+		return "", fmt.Errorf("unknown metrics format %q (want %s or %s)", format, MetricsFormatPrometheus, MetricsFormatInflux)
+	}
+}
+
+// MetricsContentType returns the HTTP content type of a metrics format
+func MetricsContentType(format string) string {
+	if format == MetricsFormatInflux {
+		return "text/plain; charset=utf-8"
+	}
+	return "text/plain; version=0.0.4; charset=utf-8"
+}
+
+// WriteMetrics writes one latency and one success sample per result (per
+// port, OID and iteration), timestamped with the time the poll started.
+// Results are written in iteration, port, OID order.
+func WriteMetrics(w io.Writer, results *TestResults, format string) error {
+	format, err := ParseMetricsFormat(format)
+	if err != nil {
+		return err
+	}
+	sorted := append([]TestResult(nil), results.Results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Iteration != b.Iteration {
+			return a.Iteration < b.Iteration
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.OID < b.OID
+	})
+	if format == MetricsFormatInflux {
+		return writeInflux(w, results, sorted)
+	}
+	return writePrometheus(w, results, sorted)
+}
+
+func writePrometheus(w io.Writer, results *TestResults, sorted []TestResult) error {
+	var b strings.Builder
+	b.WriteString("# HELP snmpsim_test_latency_ms Latency of one synthetic SNMP poll in milliseconds.\n")
+	b.WriteString("# TYPE snmpsim_test_latency_ms gauge\n")
+	for _, r := range sorted {
+		fmt.Fprintf(&b, "snmpsim_test_latency_ms{%s} %s %d\n", promLabels(results, r),
+			strconv.FormatFloat(r.LatencyMs, 'f', -1, 64), r.Timestamp.UnixMilli())
+	}
+	b.WriteString("# HELP snmpsim_test_success Whether one synthetic SNMP poll succeeded (1) or failed (0).\n")
+	b.WriteString("# TYPE snmpsim_test_success gauge\n")
+	for _, r := range sorted {
+		fmt.Fprintf(&b, "snmpsim_test_success{%s} %d %d\n", promLabels(results, r), boolInt(r.Success), r.Timestamp.UnixMilli())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func promLabels(results *TestResults, r TestResult) string {
+	return fmt.Sprintf(`test_id=%q,test_type=%q,port="%d",device="%d",oid=%q,iteration="%d"`,
+		results.TestID, results.TestType, r.Port, r.Device, r.OID, r.Iteration)
+}
+
+func writeInflux(w io.Writer, results *TestResults, sorted []TestResult) error {
+	var b strings.Builder
+	for _, r := range sorted {
+		fmt.Fprintf(&b, "snmpsim_test,test_id=%s,test_type=%s,port=%d,device=%d,oid=%s,iteration=%d latency_ms=%s,success=%t %d\n",
+			influxTag(results.TestID), influxTag(results.TestType), r.Port, r.Device, influxTag(r.OID), r.Iteration,
+			strconv.FormatFloat(r.LatencyMs, 'f', -1, 64), r.Success, r.Timestamp.UnixNano())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// influxTag escapes the characters line protocol gives meaning to in tag values
+func influxTag(value string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(value)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package webui
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetricsFormats(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	results := &TestResults{
+		TestID:   "test_1",
+		TestType: "get",
+		Results: []TestResult{
+			{Port: 20001, Device: 1, OID: "1.3.6.1.2.1.1.3.0", Iteration: 1, Success: false, LatencyMs: 5000, Timestamp: ts},
+			{Port: 20000, Device: 0, OID: "1.3.6.1.2.1.1.3.0", Iteration: 1, Success: true, LatencyMs: 1.5, Timestamp: ts},
+		},
+	}
+
+	var prom strings.Builder
+	if err := WriteMetrics(&prom, results, ""); err != nil {
+		t.Fatalf("write prometheus: %v", err)
+	}
+	wantProm := `# HELP snmpsim_test_latency_ms Latency of one synthetic SNMP poll in milliseconds.
+# TYPE snmpsim_test_latency_ms gauge
+snmpsim_test_latency_ms{test_id="test_1",test_type="get",port="20000",device="0",oid="1.3.6.1.2.1.1.3.0",iteration="1"} 1.5 1700000000000
+snmpsim_test_latency_ms{test_id="test_1",test_type="get",port="20001",device="1",oid="1.3.6.1.2.1.1.3.0",iteration="1"} 5000 1700000000000
+# HELP snmpsim_test_success Whether one synthetic SNMP poll succeeded (1) or failed (0).
+# TYPE snmpsim_test_success gauge
+snmpsim_test_success{test_id="test_1",test_type="get",port="20000",device="0",oid="1.3.6.1.2.1.1.3.0",iteration="1"} 1 1700000000000
+snmpsim_test_success{test_id="test_1",test_type="get",port="20001",device="1",oid="1.3.6.1.2.1.1.3.0",iteration="1"} 0 1700000000000
+`
+	if prom.String() != wantProm {
+		t.Fatalf("prometheus output:\n%s\nwant:\n%s", prom.String(), wantProm)
+	}
+
+	var influx strings.Builder
+	if err := WriteMetrics(&influx, results, "influx"); err != nil {
+		t.Fatalf("write influx: %v", err)
+	}
+	wantInflux := `snmpsim_test,test_id=test_1,test_type=get,port=20000,device=0,oid=1.3.6.1.2.1.1.3.0,iteration=1 latency_ms=1.5,success=true 1700000000000000000
+snmpsim_test,test_id=test_1,test_type=get,port=20001,device=1,oid=1.3.6.1.2.1.1.3.0,iteration=1 latency_ms=5000,success=false 1700000000000000000
+`
+	if influx.String() != wantInflux {
+		t.Fatalf("influx output:\n%s\nwant:\n%s", influx.String(), wantInflux)
+	}
+
+	if err := WriteMetrics(&influx, results, "csv"); err == nil {
+		t.Fatal("expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,258 @@
+package webui
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+	"github.com/gosnmp/gosnmp"
+)
+
+// Tester backends, chosen per request with TestRequest.Backend
+const (
+	BackendAuto    = "auto"    // net-snmp when its tools are installed, else native
+	BackendNative  = "native"  // gosnmp in process
+	BackendNetSNMP = "netsnmp" // snmpget and friends via os/exec
+)
+
+// lookPath finds the net-snmp tools; tests replace it
+var lookPath = exec.LookPath
+
+// netSNMPTools lists the commands each test type runs on the net-snmp backend
+var netSNMPTools = map[string][]string{
+	"get":      {"snmpget"},
+	"getnext":  {"snmpgetnext"},
+	"walk":     {"snmpwalk"},
+	"bulkwalk": {"snmptable", "snmpget"},
+}
+
+// resolveBackend turns auto into the backend req runs on: native for SNMPv3,
+// which only it supports, or when a net-snmp tool the test type needs is
+// missing
+func resolveBackend(req *TestRequest) string {
+	if req.Backend != BackendAuto {
+		return req.Backend
+	}
+	if req.Version == "3" {
+		return BackendNative
+	}
+	tools, ok := netSNMPTools[req.TestType]
+	if !ok {
+		tools = netSNMPTools["get"]
+	}
+	for _, tool := range tools {
+		if _, err := lookPath(tool); err != nil {
+			return BackendNative
+		}
+	}
+	return BackendNetSNMP
+}
+
+// validateSNMPVersion checks the version and v3 credentials of req
+func validateSNMPVersion(req *TestRequest) error {
+	switch req.Version {
+	case "2c":
+		return nil
+	case "3":
+	default:
+		return fmt.Errorf("version must be 2c or 3")
+	}
+	if req.Backend == BackendNetSNMP {
+		return fmt.Errorf("version 3 needs the native backend")
+	}
+	cfg := req.v3Config()
+	if cfg.Auth != v3.AuthNone && cfg.ToGoSNMPAuth() == gosnmp.NoAuth {
+		return fmt.Errorf("unknown v3_auth %q (want MD5, SHA1, SHA224, SHA256, SHA384 or SHA512)", req.V3Auth)
+	}
+	if cfg.Priv != v3.PrivNone && cfg.ToGoSNMPPriv() == gosnmp.NoPriv {
+		return fmt.Errorf("unknown v3_priv %q (want DES, AES128, AES192 or AES256)", req.V3Priv)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (req *TestRequest) v3Config() v3.Config {
+	auth := strings.ToUpper(strings.TrimSpace(req.V3Auth))
+	if auth == "SHA" {
+		auth = string(v3.AuthSHA1)
+	}
+	priv := strings.ToUpper(strings.TrimSpace(req.V3Priv))
+	if priv == "AES" {
+		priv = string(v3.PrivAES128)
+	}
+	return v3.Config{
+		Enabled:  true,
+		Username: req.V3User,
+		Auth:     v3.AuthProtocol(auth),
+		AuthKey:  req.V3AuthKey,
+		Priv:     v3.PrivProtocol(priv),
+		PrivKey:  req.V3PrivKey,
+	}
+}
+
+// nativeClient returns a connected gosnmp client for the agent on port
+func nativeClient(port int, req *TestRequest) (*gosnmp.GoSNMP, error) {
+	client := &gosnmp.GoSNMP{
+		Target:         "127.0.0.1",
+		Port:           uint16(port),
+		Version:        gosnmp.Version2c,
+		Community:      req.Community,
+		Timeout:        req.requestTimeout(),
+		Retries:        req.Retries,
+		MaxRepetitions: uint32(req.MaxRepeaters),
+	}
+	if req.Version == "3" {
+		cfg := req.v3Config()
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.MsgFlags = cfg.SecurityLevel()
+		client.SecurityParameters = &gosnmp.UsmSecurityParameters{
+			UserName:                 cfg.Username,
+			AuthenticationProtocol:   cfg.ToGoSNMPAuth(),
+			AuthenticationPassphrase: cfg.AuthKey,
+			PrivacyProtocol:          cfg.ToGoSNMPPriv(),
+			PrivacyPassphrase:        cfg.PrivKey,
+		}
+	}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// nativeGet executes a single SNMP GET request with gosnmp.
+func (st *SNMPTester) nativeGet(port int, oid string, req *TestRequest) (string, string, error) {
+	return st.nativeSingle(port, oid, req, "get", (*gosnmp.GoSNMP).Get)
+}
+
+// nativeGetNext executes a SNMP GETNEXT request with gosnmp.
+func (st *SNMPTester) nativeGetNext(port int, oid string, req *TestRequest) (string, string, error) {
+	return st.nativeSingle(port, oid, req, "getnext", (*gosnmp.GoSNMP).GetNext)
+}
+
+func (st *SNMPTester) nativeSingle(port int, oid string, req *TestRequest, op string, send func(*gosnmp.GoSNMP, []string) (*gosnmp.SnmpPacket, error)) (string, string, error) {
+	client, err := nativeClient(port, req)
+	if err != nil {
+		return "", "", fmt.Errorf("%s failed: %w", op, err)
+	}
+	defer client.Conn.Close()
+	pkt, err := send(client, []string{oid})
+	if err != nil {
+		return "", "", fmt.Errorf("%s failed: %w", op, err)
+	}
+	if pkt.Error != gosnmp.NoError {
+		return "", "", fmt.Errorf("%s failed: %v at index %d", op, pkt.Error, pkt.ErrorIndex)
+	}
+	if len(pkt.Variables) != 1 {
+		return "", "", fmt.Errorf("%s failed: response has %d varbinds", op, len(pkt.Variables))
+	}
+	return formatPDU(pkt.Variables[0])
+}
+
+// nativeWalkSingle performs a GETNEXT walk with gosnmp, summarized like
+// snmpWalkSingle.
+func (st *SNMPTester) nativeWalkSingle(port int, oid string, req *TestRequest) (string, string, error) {
+	client, err := nativeClient(port, req)
+	if err != nil {
+		return "", "", fmt.Errorf("walk failed: %w", err)
+	}
+	defer client.Conn.Close()
+	pdus, err := client.WalkAll(oid)
+	if err != nil {
+		return "", "", fmt.Errorf("walk failed: %w", err)
+	}
+	switch len(pdus) {
+	case 0:
+		return "(no values)", "WALK", nil
+	case 1:
+		value, _, err := formatPDU(pdus[0])
+		return value, "WALK", err
+	}
+	return fmt.Sprintf("[%d entries]", len(pdus)), "WALK", nil
+}
+
+// nativeBulkwalk performs a GETBULK walk of a table with gosnmp and counts
+// its rows like snmpBulkwalk; a failed walk falls back to a GET.
+func (st *SNMPTester) nativeBulkwalk(port int, oid string, req *TestRequest) (string, string, error) {
+	client, err := nativeClient(port, req)
+	if err != nil {
+		return "", "", fmt.Errorf("bulkwalk failed: %w", err)
+	}
+	pdus, err := client.BulkWalkAll(oid)
+	client.Conn.Close()
+	if err != nil {
+		return st.nativeGet(port, oid, req)
+	}
+	if len(pdus) == 0 {
+		return "(empty table)", "TABLE", nil
+	}
+	return fmt.Sprintf("[%d rows]", tableRows(oid, pdus)), "TABLE", nil
+}
+
+// tableRows counts the rows of the table at root, as snmptable does: the
+// cells of its first column, root.1.<column>.<index>
+func tableRows(root string, pdus []gosnmp.SnmpPDU) int {
+	root = "." + strings.Trim(root, ".") + "."
+	arcs := strings.SplitN(strings.TrimPrefix(pdus[0].Name, root), ".", 3)
+	if len(arcs) < 3 {
+		return len(pdus) // not a table: count the values instead
+	}
+	column := root + arcs[0] + "." + arcs[1] + "."
+	rows := 0
+	for _, pdu := range pdus {
+		if strings.HasPrefix(pdu.Name, column) {
+			rows++
+		}
+	}
+	return rows
+}
+
+// formatPDU renders a varbind as a value and a net-snmp style type name, so
+// both backends report the same types
+func formatPDU(pdu gosnmp.SnmpPDU) (string, string, error) {
+	switch pdu.Type {
+	case gosnmp.NoSuchObject:
+		return "", "", fmt.Errorf("no such object at %s", pdu.Name)
+	case gosnmp.NoSuchInstance:
+		return "", "", fmt.Errorf("no such instance at %s", pdu.Name)
+	case gosnmp.EndOfMibView:
+		return "", "", fmt.Errorf("end of MIB view after %s", pdu.Name)
+	case gosnmp.OctetString:
+		b, _ := pdu.Value.([]byte)
+		if isPrintable(b) {
+			return string(b), "STRING", nil
+		}
+		return strings.ToUpper(fmt.Sprintf("% x", b)), "Hex-STRING", nil
+	case gosnmp.ObjectIdentifier:
+		return fmt.Sprint(pdu.Value), "OID", nil
+	case gosnmp.IPAddress:
+		return fmt.Sprint(pdu.Value), "IpAddress", nil
+	case gosnmp.Integer:
+		return fmt.Sprint(pdu.Value), "INTEGER", nil
+	case gosnmp.Counter32:
+		return fmt.Sprint(pdu.Value), "Counter32", nil
+	case gosnmp.Counter64:
+		return gosnmp.ToBigInt(pdu.Value).String(), "Counter64", nil
+	case gosnmp.Gauge32:
+		return fmt.Sprint(pdu.Value), "Gauge32", nil
+	case gosnmp.TimeTicks:
+		return fmt.Sprint(pdu.Value), "Timeticks", nil
+	case gosnmp.Opaque:
+		return fmt.Sprintf("% x", pdu.Value), "Opaque", nil
+	case gosnmp.Null:
+		return "", "NULL", nil
+	}
+	return fmt.Sprint(pdu.Value), pdu.Type.String(), nil
+}
+
+func isPrintable(b []byte) bool {
+	for _, c := range b {
+		if (c < 0x20 || c > 0x7e) && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -20,6 +21,15 @@ type SNMPTester struct {
 	running     bool
 	activeJobID string
 	jobs        map[string]*TestJob
+
+	// poll answers one test job; nil runs executeJob. Tests replace it.
+	poll func(testJob, *TestRequest) TestResult
+
+	// backend is used by requests that name none; see SetDefaultBackend
+	backend string
+
+	// subscribers receive the updates of a running job; see SubscribeJob
+	subscribers map[string]map[chan JobUpdate]struct{}
 }
 
 // TestRequest defines parameters for SNMP testing.
@@ -29,12 +39,39 @@ type TestRequest struct {
 	PortStart    int      `json:"port_start"`
 	PortEnd      int      `json:"port_end"`
 	Community    string   `json:"community"`
-	Timeout      int      `json:"timeout"`
+	Timeout      int      `json:"timeout"` // seconds; superseded by TimeoutDuration
 	MaxRepeaters int      `json:"max_repeaters"`
 	Concurrency  int      `json:"concurrency"`
 	Iterations   int      `json:"iterations"`
 	IntervalSec  int      `json:"interval_seconds"`
 	DurationSec  int      `json:"duration_seconds"`
+	// MetricsFormat is the default format of the job's metrics export:
+	// prometheus (default) or influx
+	MetricsFormat string `json:"metrics_format,omitempty"`
+	// TimeoutDuration is the per-request timeout as a Go duration (e.g.
+	// "500ms"), for sub-second limits
+	TimeoutDuration string `json:"timeout_duration,omitempty"`
+	// Retries is how often a timed-out request is resent; 0 sends it once
+	Retries int `json:"retries"`
+	// MaxResults caps the per-poll results kept in TestResults.Results
+	// (default 100000); later polls still count in the statistics
+	MaxResults int `json:"max_results,omitempty"`
+	// MaxDuration stops the test once it has run this long, as a Go
+	// duration (default 24h)
+	MaxDuration string `json:"max_duration,omitempty"`
+
+	// Backend runs the polls with net-snmp's tools (netsnmp), with gosnmp
+	// in process (native) or, with auto, net-snmp when its tools are
+	// installed and native otherwise. Empty uses the tester's default.
+	Backend string `json:"backend,omitempty"`
+	// Version is the SNMP version polled, 2c (default) or 3; SNMPv3 runs on
+	// the native backend with the v3_* credentials
+	Version   string `json:"version,omitempty"`
+	V3User    string `json:"v3_user,omitempty"`
+	V3Auth    string `json:"v3_auth,omitempty"`
+	V3AuthKey string `json:"v3_auth_key,omitempty"`
+	V3Priv    string `json:"v3_priv,omitempty"`
+	V3PrivKey string `json:"v3_priv_key,omitempty"`
 }
 
 // TestResult holds the result of a single SNMP test.
@@ -71,6 +108,18 @@ type TestResults struct {
 	EndTime      time.Time    `json:"end_time"`
 	DurationMs   int64        `json:"duration_ms"`
 	ErrorSummary []string     `json:"error_summary"`
+
+	// Latency percentiles over every poll, accurate to about 1%
+	P50LatencyMs float64 `json:"p50_latency_ms"`
+	P95LatencyMs float64 `json:"p95_latency_ms"`
+	P99LatencyMs float64 `json:"p99_latency_ms"`
+
+	// ResultsTruncated reports that Results and ErrorSummary cover only the
+	// first max_results polls; DroppedResults more are in the statistics only
+	ResultsTruncated bool `json:"results_truncated,omitempty"`
+	DroppedResults   int  `json:"dropped_results,omitempty"`
+	// DurationCapped reports that the test was stopped at max_duration
+	DurationCapped bool `json:"duration_capped,omitempty"`
 }
 
 // TestJob tracks asynchronous test execution.
@@ -101,20 +150,66 @@ type TestProgress struct {
 	RemainingSeconds int     `json:"remaining_seconds"`
 }
 
+// JobUpdate is a test job's state as pushed to its subscribers. Results is
+// set only on the final update, once Status is completed, failed or canceled.
+type JobUpdate struct {
+	ID       string       `json:"id"`
+	Status   string       `json:"status"`
+	Progress TestProgress `json:"progress"`
+	Results  *TestResults `json:"results,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// Final reports whether u is the last update of its job
+func (u JobUpdate) Final() bool {
+	return u.Status != "running" && u.Status != "queued"
+}
+
 // NewSNMPTester creates a new SNMP tester.
 func NewSNMPTester() *SNMPTester {
 	return &SNMPTester{
 		lastResults: &TestResults{Results: []TestResult{}},
 		jobs:        make(map[string]*TestJob),
+		backend:     BackendAuto,
+		subscribers: make(map[string]map[chan JobUpdate]struct{}),
 	}
 }
 
-// StartTests starts an asynchronous test job.
-func (st *SNMPTester) StartTests(req interface{}) (*TestJob, error) {
+// SetDefaultBackend selects the backend of requests that name none:
+// BackendAuto (the default), BackendNative or BackendNetSNMP.
+func (st *SNMPTester) SetDefaultBackend(backend string) error {
+	switch backend {
+	case BackendAuto, BackendNative, BackendNetSNMP:
+	default:
+		return fmt.Errorf("unknown tester backend %q (want auto, native or netsnmp)", backend)
+	}
+	st.mu.Lock()
+	st.backend = backend
+	st.mu.Unlock()
+	return nil
+}
+
+// prepareRequest normalizes and validates req and settles its backend
+func (st *SNMPTester) prepareRequest(req interface{}) (*TestRequest, error) {
 	testReq := normalizeTestRequest(req)
+	if testReq.Backend == "" {
+		st.mu.RLock()
+		testReq.Backend = st.backend
+		st.mu.RUnlock()
+	}
 	if err := validateTestRequest(testReq); err != nil {
 		return nil, err
 	}
+	testReq.Backend = resolveBackend(testReq)
+	return testReq, nil
+}
+
+// StartTests starts an asynchronous test job.
+func (st *SNMPTester) StartTests(req interface{}) (*TestJob, error) {
+	testReq, err := st.prepareRequest(req)
+	if err != nil {
+		return nil, err
+	}
 
 	st.mu.Lock()
 	if st.running {
@@ -142,11 +237,12 @@ func (st *SNMPTester) StartTests(req interface{}) (*TestJob, error) {
 	}
 	st.jobs[jobID] = job
 	st.activeJobID = jobID
+	snapshot := copyJob(job)
 	st.mu.Unlock()
 
 	go st.runJob(ctx, jobID, testReq)
 
-	return copyJob(job), nil
+	return snapshot, nil
 }
 
 // CancelJob cancels a running test job.
@@ -164,18 +260,82 @@ func (st *SNMPTester) CancelJob(id string) bool {
 // GetJob returns a snapshot of a test job.
 func (st *SNMPTester) GetJob(id string) (*TestJob, bool) {
 	st.mu.RLock()
+	defer st.mu.RUnlock()
 	job, ok := st.jobs[id]
-	st.mu.RUnlock()
 	if !ok {
 		return nil, false
 	}
 	return copyJob(job), true
 }
 
+// SubscribeJob returns a channel of the updates of job id and a function
+// that ends the subscription. The channel holds the latest update: a slow
+// reader skips intermediate progress but always gets the final update, after
+// which the channel is closed. A job that has already finished yields just
+// its final update. ok is false for an unknown job.
+func (st *SNMPTester) SubscribeJob(id string) (<-chan JobUpdate, func(), bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	job, ok := st.jobs[id]
+	if !ok {
+		return nil, nil, false
+	}
+	ch := make(chan JobUpdate, 1)
+	ch <- jobUpdate(job)
+	if jobUpdate(job).Final() {
+		close(ch)
+		return ch, func() {}, true
+	}
+	if st.subscribers[id] == nil {
+		st.subscribers[id] = make(map[chan JobUpdate]struct{})
+	}
+	st.subscribers[id][ch] = struct{}{}
+	unsubscribe := func() {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		if _, ok := st.subscribers[id][ch]; ok {
+			delete(st.subscribers[id], ch)
+			if len(st.subscribers[id]) == 0 {
+				delete(st.subscribers, id)
+			}
+			close(ch)
+		}
+	}
+	return ch, unsubscribe, true
+}
+
+// publishLocked sends the state of job to its subscribers, replacing any
+// update they have not read yet. The final update also closes their
+// channels. st.mu must be held for writing.
+func (st *SNMPTester) publishLocked(job *TestJob) {
+	update := jobUpdate(job)
+	for ch := range st.subscribers[job.ID] {
+		select {
+		case <-ch: // drop the unread update
+		default:
+		}
+		ch <- update
+		if update.Final() {
+			close(ch)
+		}
+	}
+	if update.Final() {
+		delete(st.subscribers, job.ID)
+	}
+}
+
+func jobUpdate(job *TestJob) JobUpdate {
+	update := JobUpdate{ID: job.ID, Status: job.Status, Progress: job.Progress, Error: job.Error}
+	if update.Final() {
+		update.Results = job.Results
+	}
+	return update
+}
+
 // RunTests executes SNMP tests synchronously (legacy behavior).
 func (st *SNMPTester) RunTests(req interface{}) *TestResults {
-	testReq := normalizeTestRequest(req)
-	if err := validateTestRequest(testReq); err != nil {
+	testReq, err := st.prepareRequest(req)
+	if err != nil {
 		return &TestResults{Results: []TestResult{}, ErrorSummary: []string{err.Error()}}
 	}
 
@@ -192,6 +352,7 @@ func (st *SNMPTester) runJob(ctx context.Context, jobID string, req *TestRequest
 		st.mu.Lock()
 		if job, ok := st.jobs[jobID]; ok {
 			job.Progress = progress
+			st.publishLocked(job)
 		}
 		st.mu.Unlock()
 	})
@@ -216,6 +377,7 @@ func (st *SNMPTester) runJob(ctx context.Context, jobID string, req *TestRequest
 	st.lastResults = results
 	st.running = false
 	st.activeJobID = ""
+	st.publishLocked(job)
 }
 
 func (st *SNMPTester) executeTests(ctx context.Context, testReq *TestRequest, progressCb func(TestProgress)) *TestResults {
@@ -232,25 +394,37 @@ func (st *SNMPTester) executeTests(ctx context.Context, testReq *TestRequest, pr
 		ErrorSummary: []string{},
 	}
 
+	maxResults := testReq.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultMaxTestResults
+	}
+	parent := ctx
+	if maxDuration, err := time.ParseDuration(testReq.MaxDuration); err == nil && maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxDuration)
+		defer cancel()
+	}
+
 	totalJobs := (testReq.PortEnd - testReq.PortStart + 1) * len(testReq.OIDs) * testReq.Iterations
 	completed := 0
-	success := 0
-	failure := 0
+	var stats resultStats
 
 	for iter := 1; iter <= testReq.Iterations; iter++ {
 		if ctx.Err() != nil {
 			break
 		}
 
-		iterResults := st.runIteration(ctx, iter, testReq.Concurrency, testReq)
-		for _, r := range iterResults {
-			results.Results = append(results.Results, r)
-			completed++
-			if r.Success {
-				success++
+		st.runIteration(ctx, iter, testReq.Concurrency, testReq, func(r TestResult) {
+			stats.add(r)
+			if len(results.Results) < maxResults {
+				results.Results = append(results.Results, r)
+				if !r.Success {
+					results.ErrorSummary = append(results.ErrorSummary, r.Error)
+				}
 			} else {
-				failure++
+				results.DroppedResults++
 			}
+			completed++
 			elapsed := int(time.Since(startTime).Seconds())
 			rate := 0.0
 			if elapsed > 0 {
@@ -265,13 +439,13 @@ func (st *SNMPTester) executeTests(ctx context.Context, testReq *TestRequest, pr
 				CurrentIteration: iter,
 				TotalJobs:        totalJobs,
 				CompletedJobs:    completed,
-				SuccessCount:     success,
-				FailureCount:     failure,
+				SuccessCount:     stats.success,
+				FailureCount:     stats.failure,
 				RatePerSecond:    rate,
 				ElapsedSeconds:   elapsed,
 				RemainingSeconds: remaining,
 			})
-		}
+		})
 
 		if iter < testReq.Iterations {
 			select {
@@ -282,7 +456,9 @@ func (st *SNMPTester) executeTests(ctx context.Context, testReq *TestRequest, pr
 		}
 	}
 
-	st.calculateStats(results)
+	results.ResultsTruncated = results.DroppedResults > 0
+	results.DurationCapped = parent.Err() == nil && ctx.Err() == context.DeadlineExceeded
+	stats.fill(results)
 	results.EndTime = time.Now()
 	results.DurationMs = results.EndTime.Sub(results.StartTime).Milliseconds()
 	return results
@@ -295,7 +471,9 @@ type testJob struct {
 	iteration int
 }
 
-func (st *SNMPTester) runIteration(ctx context.Context, iteration, concurrency int, req *TestRequest) []TestResult {
+// runIteration polls every port and OID once, handing each result to emit
+// as it arrives
+func (st *SNMPTester) runIteration(ctx context.Context, iteration, concurrency int, req *TestRequest, emit func(TestResult)) {
 	jobs := make(chan testJob)
 	results := make(chan TestResult, max(concurrency, 1))
 	var wg sync.WaitGroup
@@ -310,7 +488,7 @@ func (st *SNMPTester) runIteration(ctx context.Context, iteration, concurrency i
 				if !ok {
 					return
 				}
-				result := st.executeJob(job, req)
+				result := st.pollJob(job, req)
 				select {
 				case <-ctx.Done():
 					return
@@ -344,11 +522,16 @@ func (st *SNMPTester) runIteration(ctx context.Context, iteration, concurrency i
 		close(results)
 	}()
 
-	iterResults := make([]TestResult, 0)
 	for result := range results {
-		iterResults = append(iterResults, result)
+		emit(result)
+	}
+}
+
+func (st *SNMPTester) pollJob(job testJob, req *TestRequest) TestResult {
+	if st.poll != nil {
+		return st.poll(job, req)
 	}
-	return iterResults
+	return st.executeJob(job, req)
 }
 
 func (st *SNMPTester) executeJob(job testJob, req *TestRequest) TestResult {
@@ -356,16 +539,25 @@ func (st *SNMPTester) executeJob(job testJob, req *TestRequest) TestResult {
 	var value, typeStr string
 	var err error
 	target := fmt.Sprintf("localhost:%d", job.port)
-
-	switch req.TestType {
-	case "getnext":
-		value, typeStr, err = st.snmpGetNext(target, job.oid, req.Community, req.Timeout)
-	case "walk":
-		value, typeStr, err = st.snmpWalkSingle(target, job.oid, req.Community, req.Timeout)
-	case "bulkwalk":
-		value, typeStr, err = st.snmpBulkwalk(target, job.oid, req.Community, req.Timeout, req.MaxRepeaters)
+	timing := timingArgs(req)
+
+	switch {
+	case req.Backend == BackendNative && req.TestType == "getnext":
+		value, typeStr, err = st.nativeGetNext(job.port, job.oid, req)
+	case req.Backend == BackendNative && req.TestType == "walk":
+		value, typeStr, err = st.nativeWalkSingle(job.port, job.oid, req)
+	case req.Backend == BackendNative && req.TestType == "bulkwalk":
+		value, typeStr, err = st.nativeBulkwalk(job.port, job.oid, req)
+	case req.Backend == BackendNative:
+		value, typeStr, err = st.nativeGet(job.port, job.oid, req)
+	case req.TestType == "getnext":
+		value, typeStr, err = st.snmpGetNext(target, job.oid, req.Community, timing)
+	case req.TestType == "walk":
+		value, typeStr, err = st.snmpWalkSingle(target, job.oid, req.Community, timing)
+	case req.TestType == "bulkwalk":
+		value, typeStr, err = st.snmpBulkwalk(target, job.oid, req.Community, timing, req.MaxRepeaters)
 	default:
-		value, typeStr, err = st.snmpGet(target, job.oid, req.Community, req.Timeout)
+		value, typeStr, err = st.snmpGet(target, job.oid, req.Community, timing)
 	}
 
 	result := TestResult{
@@ -387,9 +579,28 @@ func (st *SNMPTester) executeJob(job testJob, req *TestRequest) TestResult {
 	return result
 }
 
+// timingArgs returns the net-snmp timeout and retry options of req; -t
+// takes fractional seconds, so sub-second timeouts pass through
+func timingArgs(req *TestRequest) []string {
+	return []string{
+		"-t", strconv.FormatFloat(req.requestTimeout().Seconds(), 'f', -1, 64),
+		"-r", strconv.Itoa(req.Retries),
+	}
+}
+
+// requestTimeout returns TimeoutDuration, or Timeout seconds when it is unset
+// or invalid (validateTestRequest rejects invalid ones)
+func (req *TestRequest) requestTimeout() time.Duration {
+	if d, err := time.ParseDuration(req.TimeoutDuration); err == nil && d > 0 {
+		return d
+	}
+	return time.Duration(req.Timeout) * time.Second
+}
+
 // snmpGet executes a single SNMP GET request.
-func (st *SNMPTester) snmpGet(target, oid, community string, timeout int) (string, string, error) {
-	cmd := exec.Command("snmpget", "-v", "2c", "-c", community, "-t", strconv.Itoa(timeout), "-O", "vq", target, oid)
+func (st *SNMPTester) snmpGet(target, oid, community string, timing []string) (string, string, error) {
+	args := append([]string{"-v", "2c", "-c", community}, timing...)
+	cmd := exec.Command("snmpget", append(args, "-O", "vq", target, oid)...)
 	var out bytes.Buffer
 	var errOut bytes.Buffer
 	cmd.Stdout = &out
@@ -401,8 +612,9 @@ func (st *SNMPTester) snmpGet(target, oid, community string, timeout int) (strin
 }
 
 // snmpGetNext executes a SNMP GETNEXT request.
-func (st *SNMPTester) snmpGetNext(target, oid, community string, timeout int) (string, string, error) {
-	cmd := exec.Command("snmpgetnext", "-v", "2c", "-c", community, "-t", strconv.Itoa(timeout), "-O", "vq", target, oid)
+func (st *SNMPTester) snmpGetNext(target, oid, community string, timing []string) (string, string, error) {
+	args := append([]string{"-v", "2c", "-c", community}, timing...)
+	cmd := exec.Command("snmpgetnext", append(args, "-O", "vq", target, oid)...)
 	var out bytes.Buffer
 	var errOut bytes.Buffer
 	cmd.Stdout = &out
@@ -414,17 +626,18 @@ func (st *SNMPTester) snmpGetNext(target, oid, community string, timeout int) (s
 }
 
 // snmpBulkwalk executes a SNMP BULKWALK request.
-func (st *SNMPTester) snmpBulkwalk(target, oid, community string, timeout int, maxRepeaters int) (string, string, error) {
+func (st *SNMPTester) snmpBulkwalk(target, oid, community string, timing []string, maxRepeaters int) (string, string, error) {
 	if maxRepeaters <= 0 {
 		maxRepeaters = 10
 	}
-	cmd := exec.Command("snmptable", "-v", "2c", "-c", community, "-t", strconv.Itoa(timeout), "-Cb", "-Cc", target, oid)
+	args := append([]string{"-v", "2c", "-c", community}, timing...)
+	cmd := exec.Command("snmptable", append(args, "-Cb", "-Cc", target, oid)...)
 	var out bytes.Buffer
 	var errOut bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &errOut
 	if err := cmd.Run(); err != nil {
-		return st.snmpGet(target, oid, community, timeout)
+		return st.snmpGet(target, oid, community, timing)
 	}
 	output := strings.TrimSpace(out.String())
 	if output == "" {
@@ -435,8 +648,9 @@ func (st *SNMPTester) snmpBulkwalk(target, oid, community string, timeout int, m
 }
 
 // snmpWalkSingle performs a WALK operation but returns summarized value.
-func (st *SNMPTester) snmpWalkSingle(target, oid, community string, timeout int) (string, string, error) {
-	cmd := exec.Command("snmpwalk", "-v", "2c", "-c", community, "-t", strconv.Itoa(timeout), "-O", "vQn", "-m", "ALL", target, oid)
+func (st *SNMPTester) snmpWalkSingle(target, oid, community string, timing []string) (string, string, error) {
+	args := append([]string{"-v", "2c", "-c", community}, timing...)
+	cmd := exec.Command("snmpwalk", append(args, "-O", "vQn", "-m", "ALL", target, oid)...)
 	var out bytes.Buffer
 	var errOut bytes.Buffer
 	cmd.Stdout = &out
@@ -471,41 +685,86 @@ func parseCLIValue(output string) (string, string, error) {
 	return value, typeStr, nil
 }
 
-// calculateStats computes aggregate statistics for test results.
-func (st *SNMPTester) calculateStats(results *TestResults) {
-	if len(results.Results) == 0 {
-		return
+// resultStats accumulates the statistics of TestResults one poll at a
+// time, so they stay exact for polls whose results are not kept
+type resultStats struct {
+	total, success, failure int
+	totalLatency            float64
+	minLatency, maxLatency  float64
+	latencies               latencyHistogram
+}
+
+func (rs *resultStats) add(r TestResult) {
+	if rs.total == 0 || r.LatencyMs < rs.minLatency {
+		rs.minLatency = r.LatencyMs
+	}
+	if rs.total == 0 || r.LatencyMs > rs.maxLatency {
+		rs.maxLatency = r.LatencyMs
+	}
+	rs.total++
+	if r.Success {
+		rs.success++
+	} else {
+		rs.failure++
 	}
+	rs.totalLatency += r.LatencyMs
+	rs.latencies.add(r.LatencyMs)
+}
 
-	var totalLatency float64
-	minLatency := results.Results[0].LatencyMs
-	maxLatency := results.Results[0].LatencyMs
-	for _, result := range results.Results {
-		results.TotalTests++
-		if result.Success {
-			results.SuccessCount++
-		} else {
-			results.FailureCount++
-			results.ErrorSummary = append(results.ErrorSummary, result.Error)
-		}
-		totalLatency += result.LatencyMs
-		if result.LatencyMs < minLatency {
-			minLatency = result.LatencyMs
-		}
-		if result.LatencyMs > maxLatency {
-			maxLatency = result.LatencyMs
-		}
+// fill sets the aggregate fields of results
+func (rs *resultStats) fill(results *TestResults) {
+	if rs.total == 0 {
+		return
 	}
-	if results.TotalTests > 0 {
-		results.AvgLatencyMs = totalLatency / float64(results.TotalTests)
-		results.SuccessRate = float64(results.SuccessCount) / float64(results.TotalTests) * 100
+	results.TotalTests = rs.total
+	results.SuccessCount = rs.success
+	results.FailureCount = rs.failure
+	results.AvgLatencyMs = rs.totalLatency / float64(rs.total)
+	results.SuccessRate = float64(rs.success) / float64(rs.total) * 100
+	results.MinLatencyMs = rs.minLatency
+	results.MaxLatencyMs = rs.maxLatency
+	percentile := func(q float64) float64 {
+		return math.Min(math.Max(rs.latencies.quantile(q, rs.total), rs.minLatency), rs.maxLatency)
 	}
-	results.MinLatencyMs = minLatency
-	results.MaxLatencyMs = maxLatency
+	results.P50LatencyMs = percentile(0.50)
+	results.P95LatencyMs = percentile(0.95)
+	results.P99LatencyMs = percentile(0.99)
 
 	log.Printf("Test Results: %d/%d successful (%.1f%%), avg latency: %.2fms", results.SuccessCount, results.TotalTests, results.SuccessRate, results.AvgLatencyMs)
 }
 
+// latencyHistogram counts latencies in buckets growing by 2% from 1µs, so
+// percentiles cost a fixed 9 KiB however many polls a test runs
+type latencyHistogram [latencyBuckets]uint64
+
+const (
+	latencyBaseMs  = 0.001
+	latencyGrowth  = 1.02
+	latencyBuckets = 1120 // up to about 70 minutes
+)
+
+func (h *latencyHistogram) add(ms float64) {
+	i := 0
+	if ms > latencyBaseMs {
+		i = min(int(math.Log(ms/latencyBaseMs)/math.Log(latencyGrowth)), latencyBuckets-1)
+	}
+	h[i]++
+}
+
+// quantile returns the geometric middle of the bucket holding the q-th
+// of total latencies
+func (h *latencyHistogram) quantile(q float64, total int) float64 {
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, n := range h {
+		seen += n
+		if seen >= rank && n > 0 {
+			return latencyBaseMs * math.Pow(latencyGrowth, float64(i)+0.5)
+		}
+	}
+	return 0
+}
+
 // GetLastResults returns the most recent test results.
 func (st *SNMPTester) GetLastResults() *TestResults {
 	st.mu.RLock()
@@ -526,6 +785,19 @@ func (st *SNMPTester) IsRunning() bool {
 	return st.running
 }
 
+// Limits on the per-request timing a test may ask for
+const (
+	maxTestTimeout = time.Minute
+	maxTestRetries = 10
+)
+
+// Defaults and ceiling for what a test keeps and how long it runs
+const (
+	defaultMaxTestResults  = 100000
+	maxTestResults         = 1000000
+	defaultMaxTestDuration = 24 * time.Hour
+)
+
 func normalizeTestRequest(req interface{}) *TestRequest {
 	var testReq TestRequest
 	if data, err := json.Marshal(req); err == nil {
@@ -540,6 +812,9 @@ func normalizeTestRequest(req interface{}) *TestRequest {
 	if testReq.Timeout <= 0 {
 		testReq.Timeout = 5
 	}
+	if testReq.TimeoutDuration == "" {
+		testReq.TimeoutDuration = (time.Duration(testReq.Timeout) * time.Second).String()
+	}
 	if testReq.IntervalSec <= 0 {
 		testReq.IntervalSec = 5
 	}
@@ -561,6 +836,16 @@ func normalizeTestRequest(req interface{}) *TestRequest {
 	if testReq.MaxRepeaters <= 0 {
 		testReq.MaxRepeaters = 10
 	}
+	if testReq.MaxResults <= 0 {
+		testReq.MaxResults = defaultMaxTestResults
+	}
+	if testReq.MaxDuration == "" {
+		testReq.MaxDuration = defaultMaxTestDuration.String()
+	}
+	testReq.Version = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(testReq.Version)), "v")
+	if testReq.Version == "" {
+		testReq.Version = "2c"
+	}
 	return &testReq
 }
 
@@ -574,7 +859,27 @@ func validateTestRequest(req *TestRequest) error {
 	if len(req.OIDs) == 0 {
 		return fmt.Errorf("at least one OID is required")
 	}
-	return nil
+	if d, err := time.ParseDuration(req.TimeoutDuration); req.TimeoutDuration != "" && (err != nil || d <= 0 || d > maxTestTimeout) {
+		return fmt.Errorf("timeout_duration must be a duration between 0 and %s, e.g. 500ms", maxTestTimeout)
+	}
+	if req.Retries < 0 || req.Retries > maxTestRetries {
+		return fmt.Errorf("retries must be between 0 and %d", maxTestRetries)
+	}
+	if req.MaxResults > maxTestResults {
+		return fmt.Errorf("max_results must be at most %d", maxTestResults)
+	}
+	if d, err := time.ParseDuration(req.MaxDuration); req.MaxDuration != "" && (err != nil || d <= 0) {
+		return fmt.Errorf("max_duration must be a positive duration, e.g. 10m")
+	}
+	if _, err := ParseMetricsFormat(req.MetricsFormat); err != nil {
+		return err
+	}
+	switch req.Backend {
+	case "", BackendAuto, BackendNative, BackendNetSNMP:
+	default:
+		return fmt.Errorf("backend must be auto, native or netsnmp")
+	}
+	return validateSNMPVersion(req)
 }
 
 func copyJob(job *TestJob) *TestJob {
@@ -586,6 +891,13 @@ func copyJob(job *TestJob) *TestJob {
 	if job.Request != nil {
 		reqCopy := *job.Request
 		reqCopy.OIDs = append([]string(nil), job.Request.OIDs...)
+		// job snapshots are served over the API; keep the v3 secrets out
+		if reqCopy.V3AuthKey != "" {
+			reqCopy.V3AuthKey = "****"
+		}
+		if reqCopy.V3PrivKey != "" {
+			reqCopy.V3PrivKey = "****"
+		}
 		copied.Request = &reqCopy
 	}
 	if job.Results != nil {
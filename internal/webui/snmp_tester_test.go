@@ -0,0 +1,379 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debashish-mukherjee/go-snmpsim/internal/engine"
+	"github.com/debashish-mukherjee/go-snmpsim/internal/v3"
+)
+
+func TestNormalizeTestRequestTimeoutAndRetries(t *testing.T) {
+	req := normalizeTestRequest(map[string]interface{}{"oids": []string{"1.3.6.1.2.1.1.1.0"}, "timeout": 3})
+	if req.TimeoutDuration != "3s" || req.requestTimeout() != 3*time.Second || req.Retries != 0 {
+		t.Fatalf("defaults: timeout_duration=%q retries=%d", req.TimeoutDuration, req.Retries)
+	}
+
+	req = normalizeTestRequest(map[string]interface{}{"oids": []string{"1.3.6.1.2.1.1.1.0"}, "timeout_duration": "500ms", "retries": 2})
+	if err := validateTestRequest(req); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if got, want := timingArgs(req), []string{"-t", "0.5", "-r", "2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("timing args = %v, want %v", got, want)
+	}
+
+	for _, bad := range []map[string]interface{}{
+		{"timeout_duration": "soon"},
+		{"timeout_duration": "-1s"},
+		{"timeout_duration": "2m"},
+		{"retries": -1},
+		{"retries": 11},
+	} {
+		bad["oids"] = []string{"1.3.6.1.2.1.1.1.0"}
+		if err := validateTestRequest(normalizeTestRequest(bad)); err == nil {
+			t.Errorf("validate(%v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestTesterHonorsSubSecondTimeout(t *testing.T) {
+	if _, err := exec.LookPath("snmpget"); err != nil {
+		t.Skip("snmpget (net-snmp) not installed")
+	}
+	// A bound socket that never answers, like a device that went silent
+	silent, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	defer silent.Close()
+	port := silent.LocalAddr().(*net.UDPAddr).Port
+
+	start := time.Now()
+	results := NewSNMPTester().RunTests(map[string]interface{}{
+		"oids":             []string{"1.3.6.1.2.1.1.1.0"},
+		"port_start":       port,
+		"port_end":         port,
+		"timeout_duration": "500ms",
+		"retries":          0,
+	})
+	elapsed := time.Since(start)
+
+	if len(results.Results) != 1 || results.Results[0].Success {
+		t.Fatalf("results = %+v, want one failed poll", results.Results)
+	}
+	if elapsed < 400*time.Millisecond || elapsed > 3*time.Second {
+		t.Fatalf("poll took %s, want about the 500ms timeout", elapsed)
+	}
+}
+
+func TestNativeBackendHonorsSubSecondTimeout(t *testing.T) {
+	silent, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	defer silent.Close()
+	port := silent.LocalAddr().(*net.UDPAddr).Port
+
+	start := time.Now()
+	results := NewSNMPTester().RunTests(map[string]interface{}{
+		"oids":             []string{"1.3.6.1.2.1.1.1.0"},
+		"port_start":       port,
+		"port_end":         port,
+		"timeout_duration": "300ms",
+		"retries":          1,
+		"backend":          BackendNative,
+	})
+	elapsed := time.Since(start)
+
+	if len(results.Results) != 1 || results.Results[0].Success {
+		t.Fatalf("results = %+v, want one failed poll", results.Results)
+	}
+	// one retry doubles the wait
+	if elapsed < 500*time.Millisecond || elapsed > 3*time.Second {
+		t.Fatalf("poll took %s, want about twice the 300ms timeout", elapsed)
+	}
+}
+
+// startTestSimulator serves dataset from one agent that answers v2c and the
+// SNMPv3 user simuser (SHA1/AES128) and returns its port
+func startTestSimulator(t *testing.T, dataset string) int {
+	t.Helper()
+	snmprec := filepath.Join(t.TempDir(), "device.snmprec")
+	if err := os.WriteFile(snmprec, []byte(dataset), 0o644); err != nil {
+		t.Fatalf("write snmprec: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("UDP sockets unavailable: %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	sim, err := engine.NewSimulator("127.0.0.1", port, port+1, 1, snmprec, "", "", v3.Config{
+		Enabled: true, Username: "simuser",
+		Auth: v3.AuthSHA1, AuthKey: "authpass123",
+		Priv: v3.PrivAES128, PrivKey: "privpass123",
+	})
+	if err != nil {
+		t.Fatalf("new simulator: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := sim.Start(ctx); err != nil {
+		cancel()
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		sim.Stop()
+	})
+	return port
+}
+
+func TestNativeBackendPollsEveryTestType(t *testing.T) {
+	port := startTestSimulator(t, `1.3.6.1.4.1.55555.1.0|octetstring|edge-1
+1.3.6.1.2.1.2.2.1.1.1|integer|1
+1.3.6.1.2.1.2.2.1.1.2|integer|2
+1.3.6.1.2.1.2.2.1.1.3|integer|3
+1.3.6.1.2.1.2.2.1.10.1|counter32|100
+1.3.6.1.2.1.2.2.1.10.2|counter32|200
+1.3.6.1.2.1.2.2.1.10.3|counter32|300
+`)
+	cases := []struct {
+		name      string
+		req       map[string]interface{}
+		value     string
+		valueType string
+	}{
+		{"get", map[string]interface{}{"oids": []string{"1.3.6.1.4.1.55555.1.0"}}, "edge-1", "STRING"},
+		{"getnext", map[string]interface{}{"test_type": "getnext", "oids": []string{"1.3.6.1.2.1.2.2.1.10.1"}}, "200", "Counter32"},
+		{"walk", map[string]interface{}{"test_type": "walk", "oids": []string{"1.3.6.1.2.1.2.2.1.10"}}, "[3 entries]", "WALK"},
+		{"bulkwalk", map[string]interface{}{"test_type": "bulkwalk", "oids": []string{"1.3.6.1.2.1.2.2"}, "max_repeaters": 2}, "[3 rows]", "TABLE"},
+		{"v3 get", map[string]interface{}{"oids": []string{"1.3.6.1.4.1.55555.1.0"}, "version": "v3",
+			"v3_user": "simuser", "v3_auth": "SHA", "v3_auth_key": "authpass123", "v3_priv": "AES128", "v3_priv_key": "privpass123"}, "edge-1", "STRING"},
+	}
+	for _, tc := range cases {
+		tc.req["port_start"], tc.req["port_end"], tc.req["backend"], tc.req["timeout_duration"] = port, port, BackendNative, "2s"
+		results := NewSNMPTester().RunTests(tc.req)
+		if len(results.Results) != 1 {
+			t.Fatalf("%s: results = %+v, errors = %v", tc.name, results.Results, results.ErrorSummary)
+		}
+		r := results.Results[0]
+		if !r.Success || r.Value != tc.value || r.Type != tc.valueType || r.LatencyMs <= 0 {
+			t.Errorf("%s: result = %+v, want %s %q with a latency", tc.name, r, tc.valueType, tc.value)
+		}
+		if results.SuccessCount != 1 || results.AvgLatencyMs != r.LatencyMs {
+			t.Errorf("%s: stats success=%d avg=%v, want them to count the poll", tc.name, results.SuccessCount, results.AvgLatencyMs)
+		}
+	}
+
+	results := NewSNMPTester().RunTests(map[string]interface{}{"oids": []string{"1.3.6.1.2.1.1.9.0"},
+		"port_start": port, "port_end": port, "backend": BackendNative})
+	if r := results.Results[0]; r.Success || !strings.Contains(r.Error, "no such object") {
+		t.Fatalf("missing OID result = %+v, want a no such object failure", r)
+	}
+}
+
+func TestAutoBackendFallsBackToNative(t *testing.T) {
+	defer func(orig func(string) (string, error)) { lookPath = orig }(lookPath)
+	installed := map[string]bool{"snmpget": true, "snmpgetnext": true}
+	lookPath = func(name string) (string, error) {
+		if installed[name] {
+			return "/usr/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	tester := NewSNMPTester()
+	for _, tc := range []struct {
+		req  map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"test_type": "get"}, BackendNetSNMP},
+		{map[string]interface{}{"test_type": "walk"}, BackendNative},
+		{map[string]interface{}{"test_type": "get", "version": "3", "v3_user": "simuser"}, BackendNative},
+		{map[string]interface{}{"test_type": "walk", "backend": BackendNetSNMP}, BackendNetSNMP},
+	} {
+		tc.req["oids"] = []string{"1.3.6.1.2.1.1.1.0"}
+		req, err := tester.prepareRequest(tc.req)
+		if err != nil || req.Backend != tc.want {
+			t.Errorf("prepareRequest(%v) backend = %v, %v; want %s", tc.req, req, err, tc.want)
+		}
+	}
+
+	if err := tester.SetDefaultBackend(BackendNative); err != nil {
+		t.Fatalf("set default backend: %v", err)
+	}
+	if req, err := tester.prepareRequest(map[string]interface{}{"oids": []string{"1.3.6.1.2.1.1.1.0"}}); err != nil || req.Backend != BackendNative {
+		t.Fatalf("default backend: %+v, %v; want native", req, err)
+	}
+	if err := tester.SetDefaultBackend("telnet"); err == nil {
+		t.Fatal("unknown default backend accepted")
+	}
+	for _, bad := range []map[string]interface{}{
+		{"backend": "telnet"},
+		{"version": "1"},
+		{"version": "3", "backend": BackendNetSNMP, "v3_user": "simuser"},
+		{"version": "3", "v3_user": "simuser", "v3_auth": "ROT13", "v3_auth_key": "authpass123"},
+		{"version": "3", "v3_user": "simuser", "v3_auth": "SHA"},
+	} {
+		bad["oids"] = []string{"1.3.6.1.2.1.1.1.0"}
+		if _, err := tester.prepareRequest(bad); err == nil {
+			t.Errorf("prepareRequest(%v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestJobSnapshotRedactsV3Keys(t *testing.T) {
+	job := copyJob(&TestJob{Request: &TestRequest{V3User: "simuser", V3AuthKey: "authpass123", V3PrivKey: "privpass123"}})
+	if job.Request.V3AuthKey != "****" || job.Request.V3PrivKey != "****" || job.Request.V3User != "simuser" {
+		t.Fatalf("snapshot request = %+v, want keys redacted", job.Request)
+	}
+}
+
+func TestTesterCapsResultsButKeepsExactStats(t *testing.T) {
+	const ports, oids, maxResults = 10000, 20, 1000
+	tester := NewSNMPTester()
+	tester.poll = func(job testJob, _ *TestRequest) TestResult {
+		// Latencies 1..100ms spread evenly; every tenth port fails
+		return TestResult{Port: job.port, OID: job.oid, Iteration: job.iteration,
+			Success: job.port%10 != 0, Error: "timeout", LatencyMs: float64(job.port%100 + 1)}
+	}
+	oidList := make([]string, oids)
+	for i := range oidList {
+		oidList[i] = "1.3.6.1.2.1.1." + strconv.Itoa(i+1) + ".0"
+	}
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	results := tester.RunTests(map[string]interface{}{
+		"oids":        oidList,
+		"port_start":  0,
+		"port_end":    ports - 1,
+		"concurrency": 8,
+		"max_results": maxResults,
+	})
+	var after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	const total = ports * oids
+	if len(results.Results) != maxResults || cap(results.Results) > 2*maxResults || len(results.ErrorSummary) > maxResults {
+		t.Fatalf("kept %d results (cap %d) and %d errors, want at most %d", len(results.Results), cap(results.Results), len(results.ErrorSummary), maxResults)
+	}
+	if !results.ResultsTruncated || results.DroppedResults != total-maxResults {
+		t.Fatalf("truncated=%v dropped=%d, want true and %d", results.ResultsTruncated, results.DroppedResults, total-maxResults)
+	}
+	// 200k full results would retain well over 20 MiB
+	if retained := int64(after.HeapAlloc) - int64(before.HeapAlloc); retained > 4<<20 {
+		t.Fatalf("heap grew by %d bytes, want the kept results only", retained)
+	}
+
+	if results.TotalTests != total || results.FailureCount != total/10 || results.SuccessCount != total-total/10 {
+		t.Fatalf("counts total=%d success=%d failure=%d", results.TotalTests, results.SuccessCount, results.FailureCount)
+	}
+	if results.AvgLatencyMs != 50.5 || results.MinLatencyMs != 1 || results.MaxLatencyMs != 100 {
+		t.Fatalf("latency avg=%v min=%v max=%v, want 50.5, 1, 100", results.AvgLatencyMs, results.MinLatencyMs, results.MaxLatencyMs)
+	}
+	for _, p := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"p50", results.P50LatencyMs, 50},
+		{"p95", results.P95LatencyMs, 95},
+		{"p99", results.P99LatencyMs, 99},
+	} {
+		if math.Abs(p.got-p.want) > p.want*0.02 {
+			t.Errorf("%s = %v, want %v within 2%%", p.name, p.got, p.want)
+		}
+	}
+}
+
+func TestTesterStopsAtMaxDuration(t *testing.T) {
+	tester := NewSNMPTester()
+	tester.poll = func(job testJob, _ *TestRequest) TestResult {
+		time.Sleep(20 * time.Millisecond)
+		return TestResult{Port: job.port, OID: job.oid, Success: true, LatencyMs: 20}
+	}
+
+	start := time.Now()
+	results := tester.RunTests(map[string]interface{}{
+		"oids":         []string{"1.3.6.1.2.1.1.1.0"},
+		"port_start":   0,
+		"port_end":     999,
+		"concurrency":  1,
+		"max_duration": "200ms",
+	})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("test ran %s, want it stopped near 200ms", elapsed)
+	}
+	if !results.DurationCapped || results.TotalTests == 0 || results.TotalTests >= 1000 {
+		t.Fatalf("duration_capped=%v total=%d, want a capped partial run", results.DurationCapped, results.TotalTests)
+	}
+}
+
+func TestSubscribeJobDeliversProgressAndFinalResults(t *testing.T) {
+	tester := NewSNMPTester()
+	release := make(chan struct{})
+	tester.poll = func(job testJob, _ *TestRequest) TestResult {
+		<-release
+		return TestResult{Port: job.port, OID: job.oid, Success: true, LatencyMs: 1}
+	}
+	if _, _, ok := tester.SubscribeJob("job_missing"); ok {
+		t.Fatal("SubscribeJob of an unknown job reported ok")
+	}
+
+	job, err := tester.StartTests(map[string]interface{}{
+		"oids":        []string{"1.3.6.1.2.1.1.1.0"},
+		"port_start":  1,
+		"port_end":    3,
+		"concurrency": 1,
+	})
+	if err != nil {
+		t.Fatalf("start tests: %v", err)
+	}
+	first, unsubscribeFirst, ok := tester.SubscribeJob(job.ID)
+	if !ok {
+		t.Fatal("SubscribeJob of the running job failed")
+	}
+	defer unsubscribeFirst()
+	second, unsubscribeSecond, _ := tester.SubscribeJob(job.ID)
+	if update := <-second; update.Status != "running" || update.Results != nil {
+		t.Fatalf("initial update = %+v, want running without results", update)
+	}
+	unsubscribeSecond()
+	if _, open := <-second; open {
+		t.Fatal("channel still open after unsubscribe")
+	}
+	close(release)
+
+	var last JobUpdate
+	for update := range first {
+		last = update
+	}
+	if last.Status != "completed" || last.Progress.CompletedJobs != 3 || last.Results == nil || last.Results.SuccessCount != 3 {
+		t.Fatalf("final update = %+v, want completed with 3 successful results", last)
+	}
+
+	late, _, ok := tester.SubscribeJob(job.ID)
+	if !ok {
+		t.Fatal("SubscribeJob of the finished job failed")
+	}
+	if update, open := <-late; !open || !update.Final() || update.Results == nil {
+		t.Fatalf("finished job update = %+v (open %v), want its final update", update, open)
+	}
+	if _, open := <-late; open {
+		t.Fatal("finished job channel not closed after its final update")
+	}
+}
@@ -8,6 +8,7 @@ const appState = {
     testResults: null,
     statusRefreshInterval: null,
     testProgressInterval: null,
+    testProgressSocket: null,
     activeTest: null,
     currentResultsPage: 1,
 };
@@ -255,7 +256,7 @@ async function runTest() {
         }
 
         appState.activeTest = { jobId: jobResp.job_id };
-        startTestProgressPolling(jobResp.job_id);
+        startTestProgress(jobResp.job_id);
         showNotification(`Test job started: ${jobResp.job_id}`, 'info');
     } catch (error) {
         statusDiv.textContent = `Error: ${error.message}`;
@@ -266,6 +267,38 @@ async function runTest() {
     }
 }
 
+// startTestProgress follows a job over its WebSocket stream. Browsers cannot
+// send the API token header on a WebSocket, so with a token set, or when the
+// stream fails, the job is polled instead.
+function startTestProgress(jobID) {
+    stopTestProgress();
+    if (typeof WebSocket === 'undefined' || localStorage.getItem('snmpsim_api_token')) {
+        startTestProgressPolling(jobID);
+        return;
+    }
+
+    const scheme = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    const socket = new WebSocket(`${scheme}//${window.location.host}${API_BASE}/test/jobs/${encodeURIComponent(jobID)}/stream`);
+    let finished = false;
+    socket.onmessage = async (event) => {
+        const job = JSON.parse(event.data);
+        updateTestProgressUI(job);
+        if (isFinalJobStatus(job.status)) {
+            finished = true;
+            await finishTestJob(job);
+        }
+    };
+    socket.onclose = () => {
+        if (appState.testProgressSocket === socket) {
+            appState.testProgressSocket = null;
+        }
+        if (!finished && appState.activeTest && appState.activeTest.jobId === jobID) {
+            startTestProgressPolling(jobID);
+        }
+    };
+    appState.testProgressSocket = socket;
+}
+
 function startTestProgressPolling(jobID) {
     stopTestProgress();
     appState.testProgressInterval = setInterval(async () => {
@@ -273,34 +306,9 @@ function startTestProgressPolling(jobID) {
             const job = await apiFetch(`/test/jobs/${encodeURIComponent(jobID)}`);
             updateTestProgressUI(job);
 
-            if (job.status === 'completed' || job.status === 'failed' || job.status === 'canceled') {
+            if (isFinalJobStatus(job.status)) {
                 stopTestProgress();
-                document.getElementById('btn-run-test').disabled = false;
-                document.getElementById('btn-cancel-test').disabled = true;
-                appState.activeTest = null;
-
-                if (job.results) {
-                    appState.testResults = job.results;
-                    displayTestResults(job.results);
-                    updateDashboardMetrics(job.results);
-                } else {
-                    await refreshTestResults();
-                }
-
-                const statusDiv = document.getElementById('test-status');
-                if (job.status === 'completed') {
-                    statusDiv.className = 'test-status success';
-                    statusDiv.textContent = `Completed: ${job.progress.success_count}/${job.progress.completed_jobs} successful`; 
-                    showNotification('Test job completed', 'success');
-                } else if (job.status === 'canceled') {
-                    statusDiv.className = 'test-status error';
-                    statusDiv.textContent = 'Test job canceled';
-                    showNotification('Test job canceled', 'info');
-                } else {
-                    statusDiv.className = 'test-status error';
-                    statusDiv.textContent = `Test job failed: ${job.error || 'unknown error'}`;
-                    showNotification('Test job failed', 'error');
-                }
+                await finishTestJob(job);
             }
         } catch (error) {
             console.error('Error polling job:', error);
@@ -308,11 +316,49 @@ function startTestProgressPolling(jobID) {
     }, 1000);
 }
 
+function isFinalJobStatus(status) {
+    return status === 'completed' || status === 'failed' || status === 'canceled';
+}
+
+async function finishTestJob(job) {
+    document.getElementById('btn-run-test').disabled = false;
+    document.getElementById('btn-cancel-test').disabled = true;
+    appState.activeTest = null;
+
+    if (job.results) {
+        appState.testResults = job.results;
+        displayTestResults(job.results);
+        updateDashboardMetrics(job.results);
+    } else {
+        await refreshTestResults();
+    }
+
+    const statusDiv = document.getElementById('test-status');
+    if (job.status === 'completed') {
+        statusDiv.className = 'test-status success';
+        statusDiv.textContent = `Completed: ${job.progress.success_count}/${job.progress.completed_jobs} successful`; 
+        showNotification('Test job completed', 'success');
+    } else if (job.status === 'canceled') {
+        statusDiv.className = 'test-status error';
+        statusDiv.textContent = 'Test job canceled';
+        showNotification('Test job canceled', 'info');
+    } else {
+        statusDiv.className = 'test-status error';
+        statusDiv.textContent = `Test job failed: ${job.error || 'unknown error'}`;
+        showNotification('Test job failed', 'error');
+    }
+}
+
 function stopTestProgress() {
     if (appState.testProgressInterval) {
         clearInterval(appState.testProgressInterval);
         appState.testProgressInterval = null;
     }
+    if (appState.testProgressSocket) {
+        const socket = appState.testProgressSocket;
+        appState.testProgressSocket = null;
+        socket.close();
+    }
 }
 
 async function cancelTest() {